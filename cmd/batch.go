@@ -1,11 +1,24 @@
 package cmd
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"gdl/pkg/downloader"
+	"hash/fnv"
+	"log/slog"
+	"math/rand/v2"
+	"net/url"
 	"os"
-	"strings"
+	"slices"
+	"time"
+
+	"gdl/pkg/batchparser"
+	"gdl/pkg/bytesize"
+	"gdl/pkg/digest"
+	"gdl/pkg/dnsprefetch"
+	"gdl/pkg/downloader"
+	"gdl/pkg/hasher"
+	"gdl/pkg/queue"
 
 	"github.com/spf13/cobra"
 )
@@ -13,8 +26,22 @@ import (
 var batchCmd = &cobra.Command{
 	Use:   "batch [file]",
 	Short: "Download multiple files from a list",
-	Args:  cobra.ExactArgs(1),
+	Long: `Download the URLs listed in a file, one at a time.
+
+The URLs are shuffled first if --shuffle is given, then the first --offset
+of them are skipped, and the rest are sorted highest priority first, keeping
+the file's order within a priority. --limit counts successful downloads in
+that order: URLs that fail, or are skipped as not modified or already there,
+don't count towards it, so a run may go past the first --limit URLs. The
+shuffled order depends only on the URLs in the file, or on --seed, so it is
+the same on every run. With --daemon, the daemon's queue runs the URLs by
+priority instead.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		base, err := downloadConfig(cmd)
+		if err != nil {
+			fail(err)
+		}
 		filePath := args[0]
 		file, err := os.Open(filePath)
 		if err != nil {
@@ -23,35 +50,267 @@ var batchCmd = &cobra.Command{
 		}
 		defer file.Close()
 
-		concurrency, _ := cmd.Flags().GetInt("concurrency")
-		dir, _ := cmd.Flags().GetString("dir")
-		d := downloader.NewDownloader()
+		parse := batchparser.ParseURLList
+		if aria2, _ := cmd.Flags().GetBool("aria2"); aria2 {
+			parse = batchparser.ParseAria2Format
+		}
+		entries, err := parse(file)
+		if err != nil {
+			fmt.Println("Error reading file:", err)
+			return
+		}
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			url := strings.TrimSpace(scanner.Text())
-			if url == "" || strings.HasPrefix(url, "#") {
-				continue
+		if shuffle, _ := cmd.Flags().GetBool("shuffle"); shuffle {
+			seed, _ := cmd.Flags().GetUint64("seed")
+			if !cmd.Flags().Changed("seed") {
+				seed = entriesSeed(entries)
+			}
+			shuffleEntries(entries, seed)
+		}
+		offset, _ := cmd.Flags().GetInt("offset")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		defaultFlag, _ := cmd.Flags().GetString("default-priority")
+		defaultPriority, err := queue.ParsePriority(defaultFlag)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		entries = orderEntries(entries, offset, defaultPriority)
+
+		opts := []downloader.DownloaderOption{downloader.WithProbeCache(256, 0)}
+		useDaemon, _ := cmd.Flags().GetBool("daemon")
+		if !useDaemon {
+			opts = append(opts, downloader.WithDNSCache(prefetchDNS(entries)))
+		}
+		d, err := newDownloader(cmd, opts...)
+		if err != nil {
+			fail(err)
+		}
+
+		if useDaemon {
+			if !cmd.Flags().Changed("concurrency") {
+				base.Concurrency = 0 // the daemon's default
 			}
-			fmt.Println("Processing:", url)
-			err := d.Download(downloader.DownloadConfig{
-				Url:         url,
-				Concurrency: concurrency,
-				OutputDir:   dir,
-			})
+			for _, entry := range entries {
+				cfg := batchEntryConfig(base, entry)
+				job, err := submitToDaemon(d, cfg)
+				if err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				fmt.Printf("Queued %s as job %d\n", entry.Url, job.ID)
+			}
+			return
+		}
+
+		var hashes *hasher.AsyncHashPool
+		var sums []hasher.Result
+		collected := make(chan struct{})
+		if algoFlag, _ := cmd.Flags().GetString("print-checksum"); algoFlag != "" {
+			algo, err := hasher.ParseAlgorithm(algoFlag)
 			if err != nil {
-				fmt.Printf("Error downloading %s: %v\n", url, err)
+				fmt.Println("Error:", err)
+				return
 			}
+			workers, _ := cmd.Flags().GetInt("hash-workers")
+			// Files are hashed while the next ones download.
+			hashes = hasher.NewAsyncHashPool(algo, workers)
+			base.OnDone = hashes.Submit
+			go func() {
+				for r := range hashes.Results() {
+					sums = append(sums, r)
+				}
+				close(collected)
+			}()
 		}
 
-		if err := scanner.Err(); err != nil {
-			fmt.Println("Error reading file:", err)
+		preProbe(cmd, d, base, entries)
+
+		ledger := bandwidthLedger()
+		quota := int64(*cmd.Flags().Lookup("quota-daily").Value.(*sizeValue))
+		succeeded := 0
+		for _, entry := range entries {
+			if limit > 0 && succeeded >= limit {
+				fmt.Printf("Reached --limit of %d downloads, stopping\n", limit)
+				break
+			}
+			if quota > 0 {
+				if t, err := ledger.Load(); err == nil && t.Day(time.Now()) >= quota {
+					fmt.Printf("Reached --quota-daily of %s (%s downloaded today), stopping\n",
+						bytesize.Format(quota), bytesize.Format(t.Day(time.Now())))
+					break
+				}
+			}
+			fmt.Println("Processing:", entry.Url)
+			cfg := batchEntryConfig(base, entry)
+			record := trackBandwidth(ledger, d, &cfg)
+			err := d.Download(cfg)
+			record()
+			if errors.Is(err, downloader.ErrNotModified) {
+				fmt.Printf("Skipping %s: not modified\n", entry.Url)
+				continue
+			}
+			if errors.Is(err, downloader.ErrFileExists) {
+				fmt.Printf("Skipping %s: %v\n", entry.Url, err)
+				continue
+			}
+			if err != nil {
+				fmt.Printf("Error downloading %s: %v\n", entry.Url, err)
+				continue
+			}
+			succeeded++
 		}
+		if hashes != nil {
+			hashes.Close()
+			<-collected
+			printChecksums(sums)
+		}
+		// All entries share d's connection pool, so downloads from the same
+		// host after the first should mostly reuse connections.
+		newConns, reused := d.ConnectionStats()
+		slog.Debug("batch finished", "downloads", succeeded, "bytes", ledger.Session(), "new_connections", newConns, "reused_connections", reused)
 	},
 }
 
+// entriesSeed derives a --shuffle seed from the URLs of entries, so that
+// every run over the same batch file, on any machine, shuffles it the same
+// way and --offset picks the same URLs.
+func entriesSeed(entries []downloader.DownloadConfig) uint64 {
+	h := fnv.New64a()
+	for _, entry := range entries {
+		h.Write([]byte(entry.Url))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// shuffleEntries puts entries in a pseudo-random order that depends only on
+// seed.
+func shuffleEntries(entries []downloader.DownloadConfig, seed uint64) {
+	r := rand.New(rand.NewPCG(seed, seed))
+	r.Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+}
+
+// orderEntries skips the first offset entries and sorts the rest highest
+// priority first, giving those without one defaultPriority. Entries of equal
+// priority keep their order. Batch downloads them one at a time in this
+// order; with --daemon, the daemon's queue schedules them by priority
+// instead.
+func orderEntries(entries []downloader.DownloadConfig, offset, defaultPriority int) []downloader.DownloadConfig {
+	entries = slices.Clone(entries[min(max(offset, 0), len(entries)):])
+	for i := range entries {
+		if entries[i].Priority == 0 {
+			entries[i].Priority = defaultPriority
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b downloader.DownloadConfig) int { return b.Priority - a.Priority })
+	return entries
+}
+
+// prefetchDNS looks up the hosts of all entries at once, warning about the
+// ones that don't resolve; their downloads fail later on their own.
+func prefetchDNS(entries []downloader.DownloadConfig) map[string][]string {
+	var hosts []string
+	for _, entry := range entries {
+		if u, err := url.Parse(entry.Url); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	addrs, errs := dnsprefetch.PrefetchAll(hosts)
+	for _, err := range errs {
+		fmt.Println("Warning:", err)
+	}
+	return addrs
+}
+
+// preProbe probes all entries at once, filling d's probe cache for the
+// downloads, and prints how much the batch will download. Failures are only
+// warnings: the download of that entry reports its own error.
+func preProbe(cmd *cobra.Command, d *downloader.Downloader, base downloader.DownloadConfig, entries []downloader.DownloadConfig) {
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	cfgs := make([]downloader.DownloadConfig, len(entries))
+	for i, entry := range entries {
+		cfgs[i] = batchEntryConfig(base, entry)
+	}
+	infos, errs := downloader.BatchProbe(context.Background(), d, cfgs, parallel)
+	var total int64
+	unknown := 0
+	for i, err := range errs {
+		if err != nil {
+			fmt.Printf("Warning: probing %s: %v\n", cfgs[i].Url, err)
+			unknown++
+		} else if infos[i].Size < 0 || infos[i].Url == "" {
+			unknown++
+		} else {
+			total += infos[i].Size
+		}
+	}
+	if unknown > 0 {
+		fmt.Printf("Batch of %d files: %s, plus %d of unknown size\n", len(cfgs), bytesize.Format(total), unknown)
+	} else {
+		fmt.Printf("Batch of %d files: %s\n", len(cfgs), bytesize.Format(total))
+	}
+}
+
+// printChecksums prints the hashes of the downloaded files in the order
+// they were downloaded, in the format of sha256sum and friends.
+func printChecksums(sums []hasher.Result) {
+	slices.SortFunc(sums, func(a, b hasher.Result) int { return a.Seq - b.Seq })
+	for _, r := range sums {
+		if r.Err != nil {
+			fmt.Printf("Error hashing %s: %v\n", r.File, r.Err)
+			continue
+		}
+		fmt.Printf("%x  %s\n", r.Sum, r.File)
+	}
+}
+
+// batchEntryConfig applies the per-entry settings from a batch file on top of
+// the settings given on the command line.
+func batchEntryConfig(base, entry downloader.DownloadConfig) downloader.DownloadConfig {
+	cfg := base
+	cfg.Url = entry.Url
+	cfg.Priority = entry.Priority
+	if entry.OutputName != "" {
+		cfg.OutputName = entry.OutputName
+	}
+	if entry.OutputDir != "" {
+		cfg.OutputDir = entry.OutputDir
+	}
+	if entry.Concurrency > 0 {
+		cfg.Concurrency = entry.Concurrency
+	}
+	if entry.PostDownloadScript != "" {
+		cfg.PostDownloadScript = entry.PostDownloadScript
+	}
+	if entry.Headers != nil {
+		cfg.Headers = base.Headers.Clone()
+		if cfg.Headers == nil {
+			cfg.Headers = entry.Headers
+		} else {
+			for k, vs := range entry.Headers {
+				cfg.Headers[k] = vs
+			}
+		}
+	}
+	return cfg
+}
+
 func init() {
 	batchCmd.Flags().IntP("concurrency", "c", 16, "Number of concurrent connections per download")
 	batchCmd.Flags().StringP("dir", "d", "", "Output directory")
+	batchCmd.Flags().Bool("daemon", false, "Queue the downloads with the background daemon instead of running them")
+	batchCmd.Flags().Bool("aria2", false, "Read the file in aria2c input file format")
+	batchCmd.Flags().Int("offset", 0, "Skip the first N URLs")
+	batchCmd.Flags().Int("limit", 0, "Stop after N successful downloads, in priority order (0 means no limit)")
+	batchCmd.Flags().Bool("shuffle", false, "Randomise the order of the URLs before applying --offset and --limit")
+	batchCmd.Flags().Uint64("seed", 0, "Seed for --shuffle (default: derived from the URLs, so every run gets the same order)")
+	batchCmd.Flags().String("default-priority", "normal", "Priority of URLs the batch file gives none: critical, high, normal, low or background")
+	batchCmd.Flags().String("print-checksum", "", "Print the checksum of every downloaded file, hashed in the background: "+digest.Names)
+	batchCmd.Flags().Int("parallel", 8, "URLs probed at the same time before the downloads start")
+	batchCmd.Flags().Int("hash-workers", 0, "Files --print-checksum hashes at the same time (default: half the CPUs)")
+	batchCmd.Flags().Var(new(sizeValue), "quota-daily", "Stop once this much has been downloaded today, e.g. 10GB (see 'gdl stats')")
+	addDownloadFlags(batchCmd)
 	rootCmd.AddCommand(batchCmd)
 }
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/queue"
+)
+
+func batchEntries(n int) []downloader.DownloadConfig {
+	entries := make([]downloader.DownloadConfig, n)
+	for i := range entries {
+		entries[i].Url = fmt.Sprintf("https://example.com/file%d.bin", i)
+	}
+	return entries
+}
+
+func urls(entries []downloader.DownloadConfig) []string {
+	var us []string
+	for _, entry := range entries {
+		us = append(us, entry.Url)
+	}
+	return us
+}
+
+func TestShuffleIsDeterministic(t *testing.T) {
+	a, b := batchEntries(50), batchEntries(50)
+	if entriesSeed(a) != entriesSeed(b) {
+		t.Fatal("the same URLs give different seeds")
+	}
+	shuffleEntries(a, entriesSeed(a))
+	shuffleEntries(b, entriesSeed(b))
+	if !slices.Equal(urls(a), urls(b)) {
+		t.Errorf("two shuffles of the same file differ:\n%v\n%v", urls(a), urls(b))
+	}
+	if slices.Equal(urls(a), urls(batchEntries(50))) {
+		t.Error("shuffle left the order unchanged")
+	}
+	sorted := slices.Sorted(slices.Values(urls(a)))
+	if !slices.Equal(sorted, slices.Sorted(slices.Values(urls(batchEntries(50))))) {
+		t.Error("shuffle lost or duplicated URLs")
+	}
+
+	c := batchEntries(50)
+	shuffleEntries(c, 42)
+	if slices.Equal(urls(a), urls(c)) {
+		t.Error("a different seed gave the same order")
+	}
+	if entriesSeed(batchEntries(49)) == entriesSeed(a) {
+		t.Error("a different file gave the same seed")
+	}
+}
+
+func TestOrderEntries(t *testing.T) {
+	entries := batchEntries(6)
+	entries[0].Priority = queue.Critical // skipped by the offset
+	entries[3].Priority = queue.High
+	entries[5].Priority = queue.Low
+
+	got := urls(orderEntries(entries, 2, queue.Normal))
+	want := []string{
+		"https://example.com/file3.bin",
+		"https://example.com/file2.bin",
+		"https://example.com/file4.bin",
+		"https://example.com/file5.bin",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("orderEntries() = %v, want %v", got, want)
+	}
+	if n := len(orderEntries(entries, 10, queue.Normal)); n != 0 {
+		t.Errorf("an offset past the end left %d entries", n)
+	}
+	if n := len(orderEntries(entries, -1, queue.Normal)); n != 6 {
+		t.Errorf("a negative offset left %d entries, want 6", n)
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gdl/pkg/config"
+	"gdl/pkg/logger"
+
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the gdl config file",
+	// The config file may not exist yet, so don't load it.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		debug, _ := cmd.Flags().GetBool("debug")
+		logFile, _ := cmd.Flags().GetString("log-file")
+		return logger.Init(debug, logFile)
+	},
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Write a starter config file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		force, _ := cmd.Flags().GetBool("force")
+
+		path, _ := cmd.Flags().GetString("config")
+		if path == "" {
+			path = filepath.Join(config.Dir(), "config."+format)
+		} else if cmd.Flags().Changed("format") {
+			if f, err := config.FormatOf(path); err != nil || f != format {
+				return fmt.Errorf("%s is not a %s file", path, format)
+			}
+		} else {
+			var err error
+			if format, err = config.FormatOf(path); err != nil {
+				return err
+			}
+		}
+
+		content, err := config.Template(format)
+		if err != nil {
+			return err
+		}
+		if !force {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+		fmt.Println("Wrote", path)
+		return nil
+	},
+}
+
+var configSetHostConcurrencyCmd = &cobra.Command{
+	Use:   "set-host-concurrency <host> <n>",
+	Short: "Use n connections for downloads from host",
+	Long: `Add host, or change it, under per_host_concurrency in the config file.
+A host of the form "*.example.com" matches any subdomain of example.com.
+An explicit --concurrency still takes precedence.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid concurrency %q, expected a positive number", args[1])
+		}
+		path, _ := cmd.Flags().GetString("config")
+		if path == "" {
+			path, _ = config.DefaultPath()
+		}
+		if err := config.SetHostConcurrency(path, args[0], n); err != nil {
+			return err
+		}
+		fmt.Printf("%s now uses %d connections (%s)\n", args[0], n, path)
+		return nil
+	},
+}
+
+func init() {
+	configInitCmd.Flags().String("format", "yaml", "Config file format: yaml or toml")
+	configInitCmd.Flags().Bool("force", false, "Overwrite an existing config file")
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configSetHostConcurrencyCmd)
+	rootCmd.AddCommand(configCmd)
+}
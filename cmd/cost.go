@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gdl/pkg/accounting"
+	"gdl/pkg/bytesize"
+	"gdl/pkg/downloader"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var errDeclined = errors.New("download declined")
+
+// promptMu keeps concurrent batch downloads from asking at the same time.
+var promptMu sync.Mutex
+
+// costCheck returns a BeforeDownload hook that prints the estimated egress
+// cost set up by --cost-per-gb or --egress-region and, without --yes, asks
+// before downloading. It returns nil if neither flag is set.
+func costCheck(c *cobra.Command) func(*downloader.FileInfo) error {
+	price, _ := c.Flags().GetFloat64("cost-per-gb")
+	if region, _ := c.Flags().GetString("egress-region"); region != "" && !c.Flags().Changed("cost-per-gb") {
+		p, err := accounting.EgressPrice(region)
+		if err != nil {
+			fmt.Println("Warning:", err)
+		}
+		price = p
+	}
+	if price <= 0 {
+		return nil
+	}
+	yes, _ := c.Flags().GetBool("yes")
+
+	return func(info *downloader.FileInfo) error {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		// Stderr, so that the estimate doesn't end up in "-o -" output.
+		if info.Size < 0 {
+			fmt.Fprintf(os.Stderr, "Estimated cost: unknown, the server did not report the size of %s\n", info.Name)
+		} else {
+			fmt.Fprintf(os.Stderr, "Estimated cost: $%.2f (%s × $%g/GiB)\n",
+				accounting.EstimateCost(info.Size, price), bytesize.Format(info.Size), price)
+		}
+		if yes {
+			return nil
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("cannot ask to confirm the cost of %s: stdin is not a terminal (use --yes)", info.Name)
+		}
+		fmt.Fprintf(os.Stderr, "Download %s? [y/N] ", info.Name)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return nil
+		}
+		return errDeclined
+	}
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"gdl/pkg/daemon"
+	"gdl/pkg/downloader"
+
+	"github.com/spf13/cobra"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run downloads in a background process",
+	Long: `The daemon queues downloads submitted with 'gdl download --daemon' or
+'gdl batch --daemon' and runs a few of them at a time. Its socket and job
+history are kept in ` + daemon.Dir() + `.`,
+}
+
+var daemonStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the daemon in the background",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if foreground, _ := cmd.Flags().GetBool("foreground"); foreground {
+			if err := runDaemon(cmd); err != nil {
+				fail(err)
+			}
+			return
+		}
+		// Catch bad flags here rather than in the background process.
+		if _, err := downloadConfig(cmd); err != nil {
+			fail(err)
+		}
+		if _, err := newDownloader(cmd); err != nil {
+			fail(err)
+		}
+		if err := startDaemon(); err != nil {
+			fail(err)
+		}
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the daemon is running and how many jobs it has",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		st, err := (&daemon.Client{}).Status()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("Daemon running (pid %d) for %s, %d parallel downloads\n",
+			st.PID, time.Since(st.Started).Round(time.Second), st.Parallel)
+		fmt.Printf("Jobs: %d queued, %d running, %d done, %d failed\n", st.Queued, st.Running, st.Done, st.Failed)
+	},
+}
+
+var daemonQueueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "List the daemon's jobs",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		jobs, err := (&daemon.Client{}).Queue()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if len(jobs) == 0 {
+			fmt.Println("No jobs")
+			return
+		}
+		fmt.Printf("%-5s %-8s %9s  %s\n", "ID", "STATUS", "PROGRESS", "URL")
+		for _, j := range jobs {
+			fmt.Printf("%-5d %-8s %9s  %s\n", j.ID, j.Status, jobProgress(j), j.Spec.URL)
+			if j.Error != "" {
+				fmt.Printf("      %s\n", j.Error)
+			}
+		}
+	},
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the daemon; running downloads keep their state and can be resumed",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := (&daemon.Client{}).Stop(); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("Daemon stopped")
+	},
+}
+
+// startDaemon runs this command again with --foreground as a detached
+// process and waits for its socket to appear.
+func startDaemon() error {
+	if _, err := (&daemon.Client{}).Status(); err == nil {
+		return fmt.Errorf("the daemon is already running")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(daemon.Dir(), 0700); err != nil {
+		return err
+	}
+	logPath := filepath.Join(daemon.Dir(), "daemon.log")
+	log, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	child := exec.Command(exe, append(os.Args[1:], "--foreground")...)
+	child.Stdout, child.Stderr = log, log
+	if err := child.Start(); err != nil {
+		return err
+	}
+	pid := child.Process.Pid
+	child.Process.Release()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if _, err := (&daemon.Client{}).Status(); err == nil {
+			fmt.Printf("Daemon started (pid %d), listening on %s\n", pid, daemon.SocketPath())
+			return nil
+		}
+	}
+	return fmt.Errorf("the daemon did not start, see %s", logPath)
+}
+
+// runDaemon serves jobs until stopped. The download flags given to
+// 'daemon start' are the defaults for every job.
+func runDaemon(cmd *cobra.Command) error {
+	// Keep running when the terminal that started us goes away.
+	signal.Ignore(syscall.SIGHUP)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	d, err := newDownloader(cmd)
+	if err != nil {
+		return err
+	}
+	base, err := downloadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	base.Quiet = true
+	parallel, _ := cmd.Flags().GetInt("parallel")
+
+	s := &daemon.Server{
+		Parallel: parallel,
+		Run: func(ctx context.Context, spec daemon.JobSpec, progress func(downloaded, total int64)) (string, error) {
+			cfg := base
+			cfg.Url = spec.URL
+			cfg.OutputName = spec.OutputName
+			if spec.OutputDir != "" {
+				cfg.OutputDir = spec.OutputDir
+			}
+			if spec.Concurrency > 0 {
+				cfg.Concurrency = spec.Concurrency
+			}
+			cfg.Headers = http.Header(spec.Headers)
+			var file string
+			cfg.OnProgress = func(f string, downloaded, total int64) {
+				file = f
+				progress(downloaded, total)
+			}
+			err := d.DownloadContext(ctx, cfg)
+			return file, err
+		},
+	}
+	fmt.Printf("%s daemon listening on %s\n", time.Now().Format(time.RFC3339), daemon.SocketPath())
+	return s.Serve(ctx)
+}
+
+// submitToDaemon queues cfg, with d's global headers, with the daemon.
+// Without an output directory the daemon's default is used; a relative one
+// is made absolute, as the daemon runs in its own working directory.
+func submitToDaemon(d *downloader.Downloader, cfg downloader.DownloadConfig) (*daemon.Job, error) {
+	headers := d.GlobalHeaders.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	for k, vs := range cfg.Headers {
+		headers[k] = vs
+	}
+
+	dir := cfg.OutputDir
+	if dir != "" {
+		var err error
+		if dir, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+	}
+	return (&daemon.Client{}).Submit(daemon.JobSpec{
+		URL:         cfg.Url,
+		OutputName:  cfg.OutputName,
+		OutputDir:   dir,
+		Concurrency: cfg.Concurrency,
+		Headers:     headers,
+		Priority:    cfg.Priority,
+	})
+}
+
+// followJob prints job's progress until it finishes.
+func followJob(job *daemon.Job) error {
+	fmt.Printf("Queued as job %d, following its progress (Ctrl-C stops following, not the download)\n", job.ID)
+	final, err := (&daemon.Client{}).Watch(job.ID, func(j daemon.Job) {
+		fmt.Printf("\r%-8s %9s", j.Status, jobProgress(&j))
+	})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	if final.Status == daemon.StatusFailed {
+		return fmt.Errorf("job %d failed: %s", final.ID, final.Error)
+	}
+	fmt.Println("Saved", final.File)
+	return nil
+}
+
+// jobProgress formats how much of a job is done, as a percentage if its
+// size is known.
+func jobProgress(j *daemon.Job) string {
+	if j.Total > 0 {
+		return fmt.Sprintf("%.1f%%", float64(j.Downloaded)*100/float64(j.Total))
+	}
+	if j.Downloaded > 0 {
+		return fmt.Sprintf("%d B", j.Downloaded)
+	}
+	return "-"
+}
+
+func init() {
+	daemonStartCmd.Flags().Int("parallel", 2, "Number of jobs downloaded at the same time")
+	daemonStartCmd.Flags().Bool("foreground", false, "Run in this process instead of in the background")
+	daemonStartCmd.Flags().IntP("concurrency", "c", 16, "Default number of concurrent connections per download")
+	daemonStartCmd.Flags().StringP("dir", "d", "", "Default output directory (default: where the daemon was started)")
+	addDownloadFlags(daemonStartCmd)
+	daemonCmd.AddCommand(daemonStartCmd, daemonStatusCmd, daemonQueueCmd, daemonStopCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
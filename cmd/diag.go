@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+
+	"gdl/pkg/diag"
+
+	"github.com/spf13/cobra"
+)
+
+var diagCmd = &cobra.Command{
+	Use:   "diag [url]",
+	Short: "Check how a server handles the requests gdl relies on",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		d, err := newDownloader(cmd)
+		if err != nil {
+			fail(err)
+		}
+		report := diag.RunDiagnostics(d, args[0])
+
+		fmt.Println("Diagnostics for", report.URL)
+		for _, c := range report.Checks {
+			fmt.Printf("  [%s] %-16s %s\n", c.Status, c.Name, c.Detail)
+		}
+		if report.Failed() {
+			fmt.Println("Some checks failed; downloads from this server may be slow or fail.")
+		}
+	},
+}
+
+func init() {
+	addDownloadFlags(diagCmd)
+	rootCmd.AddCommand(diagCmd)
+}
@@ -1,8 +1,17 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"gdl/pkg/digest"
 	"gdl/pkg/downloader"
+	"gdl/pkg/editor"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
 	"github.com/spf13/cobra"
 )
 
@@ -12,26 +21,139 @@ var downloadCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		url := args[0]
-		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		if edit, _ := cmd.Flags().GetBool("edit"); edit {
+			edited, err := editURL(url)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			url = edited
+		}
 		output, _ := cmd.Flags().GetString("output")
-		dir, _ := cmd.Flags().GetString("dir")
+		if benchmark, _ := cmd.Flags().GetBool("benchmark"); benchmark {
+			output = "/dev/null"
+		}
 
-		d := downloader.NewDownloader()
-		err := d.Download(downloader.DownloadConfig{
-			Url:         url,
-			Concurrency: concurrency,
-			OutputName:  output,
-			OutputDir:   dir,
-		})
+		d, err := newDownloader(cmd)
+		if err != nil {
+			fail(err)
+		}
+		cfg, err := downloadConfig(cmd)
+		if err != nil {
+			fail(err)
+		}
+		cfg.Url = url
+		cfg.OutputName = output
+		cfg.Tee, _ = cmd.Flags().GetStringArray("tee")
+		if checksum, _ := cmd.Flags().GetString("checksum"); checksum != "" {
+			algo, sum, err := digest.ParseChecksum(checksum, cfg.ChecksumAlgorithm)
+			if err != nil {
+				fail(fmt.Errorf("--checksum: %w", err))
+			}
+			if cfg.ChecksumAlgorithm != "" && cfg.ChecksumAlgorithm != algo {
+				fail(fmt.Errorf("--checksum is %s but --checksum-algorithm is %s", algo, cfg.ChecksumAlgorithm))
+			}
+			cfg.ChecksumAlgorithm, cfg.Checksum = algo, sum
+		}
+		if specs, _ := cmd.Flags().GetStringArray("chunk-range"); len(specs) > 0 {
+			chunks, err := downloader.ParseChunkRanges(specs)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			cfg.ChunkRanges = chunks
+		}
+		if recursive, _ := cmd.Flags().GetBool("recursive"); recursive {
+			isDir, err := isFTPDirectory(url, d.FTP)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if isDir {
+				downloadFTPDirectory(cmd, d, cfg)
+				return
+			}
+		}
+		useDaemon, _ := cmd.Flags().GetBool("daemon")
+		streamPort, _ := cmd.Flags().GetInt("stream-port")
+		if streamPort > 0 && (useDaemon || output == downloader.StdoutName) {
+			fmt.Println("Error: --stream-port needs a download to a file by this process")
+			return
+		}
+		if useDaemon {
+			if !cmd.Flags().Changed("concurrency") {
+				cfg.Concurrency = 0 // the daemon's default
+			}
+			job, err := submitToDaemon(d, cfg)
+			if err == nil {
+				err = followJob(job)
+			}
+			if err != nil {
+				fmt.Println("Error:", err)
+			}
+			return
+		}
+		if streamPort > 0 {
+			live, err := downloader.NewLiveServer(fmt.Sprintf("127.0.0.1:%d", streamPort))
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			defer live.Close()
+			cfg.LiveServer = live
+			fmt.Println("Streaming at", live.URL())
+		}
+		mirrors, _ := cmd.Flags().GetStringArray("mirror-parallel")
+		record := trackBandwidth(bandwidthLedger(), d, &cfg)
+		err = d.MultiSourceDownload(context.Background(), cfg, mirrors)
+		record()
+		if err == nil && cfg.LiveServer != nil {
+			// A player may still be playing it.
+			fmt.Printf("Download complete; still streaming at %s until interrupted\n", cfg.LiveServer.URL())
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			<-ctx.Done()
+			stop()
+		}
+		if errors.Is(err, downloader.ErrNotModified) {
+			fmt.Println("File not modified, skipping.")
+			return
+		}
 		if err != nil {
 			fmt.Println("Error:", err)
 		}
 	},
 }
 
+// editURL opens url in the user's editor for --edit and returns the first
+// line left in the file.
+func editURL(url string) (string, error) {
+	text, err := editor.Edit(url+"\n", "gdl-url-*.txt")
+	if err != nil {
+		return "", err
+	}
+	for line := range strings.Lines(text) {
+		if line = strings.TrimSpace(line); line != "" {
+			return line, nil
+		}
+	}
+	return "", errors.New("the URL was left empty, not downloading")
+}
+
 func init() {
 	downloadCmd.Flags().IntP("concurrency", "c", 16, "Number of concurrent connections")
-	downloadCmd.Flags().StringP("output", "o", "", "Output filename")
+	downloadCmd.Flags().StringP("output", "o", "", "Output filename (\"-\" writes to stdout, /dev/null or nul discards)")
+	downloadCmd.Flags().Bool("benchmark", false, "Discard the data to measure network throughput (same as -o /dev/null)")
 	downloadCmd.Flags().StringP("dir", "d", "", "Output directory")
+	downloadCmd.Flags().Bool("edit", false, "Open the URL in $EDITOR and download what it is changed to")
+	downloadCmd.Flags().Int("stream-port", 0, "Serve the file on this local port while it downloads, for media players such as mpv or VLC")
+	downloadCmd.Flags().Bool("daemon", false, "Hand the download to the background daemon (see 'gdl daemon start')")
+	downloadCmd.Flags().String("checksum", "", "Expected checksum as algorithm:hex, e.g. sha1:2fd4e1c6...; bare hex is in --checksum-algorithm, or MD5 without it. A mismatch fails the download")
+	downloadCmd.Flags().StringArray("chunk-range", nil, "Byte range start-end of one chunk, instead of the even split (repeatable; together they must cover the file)")
+	downloadCmd.Flags().StringArray("tee", nil, "Also write the bytes to this file or Unix socket as they are downloaded, like tee (repeatable)")
+	downloadCmd.Flags().StringArray("mirror-parallel", nil, "Another URL of the same file to download chunks from at the same time (repeatable)")
+	downloadCmd.Flags().BoolP("recursive", "r", false, "When the URL is an FTP directory, download every file below it into --dir")
+	downloadCmd.Flags().String("include-pattern", "", "With --recursive, only download files whose name matches this glob, e.g. *.iso")
+	downloadCmd.Flags().Bool("list-only", false, "With --recursive, print the files that would be downloaded and exit")
+	addDownloadFlags(downloadCmd)
 	rootCmd.AddCommand(downloadCmd)
 }
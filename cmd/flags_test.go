@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gdl/pkg/config"
+)
+
+func TestBindAddress(t *testing.T) {
+	tests := []struct {
+		name             string
+		flag, env, podIP string
+		want             string
+		wantErr          bool
+	}{
+		{"none", "", "", "", "", false},
+		{"pod IP", "", "", "10.1.2.3", "10.1.2.3", false},
+		{"env over pod IP", "", "10.0.0.9", "10.1.2.3", "10.0.0.9", false},
+		{"flag over env", "192.168.1.5", "10.0.0.9", "10.1.2.3", "192.168.1.5", false},
+		{"IPv6", "fd00::1", "", "", "fd00::1", false},
+		{"invalid", "eth0", "", "", "", true},
+		{"invalid env", "", "eth0", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GDL_BIND_ADDR", tt.env)
+			t.Setenv("POD_IP", tt.podIP)
+			c := &cobra.Command{}
+			addDownloadFlags(c)
+			if tt.flag != "" {
+				c.Flags().Set("bind-addr", tt.flag)
+			}
+			got, err := bindAddress(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("bindAddress() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("bindAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// downloadCommand returns a command with the flags downloadConfig reads.
+func downloadCommand() *cobra.Command {
+	c := &cobra.Command{}
+	c.Flags().IntP("concurrency", "c", 16, "")
+	c.Flags().StringP("dir", "d", "", "")
+	addDownloadFlags(c)
+	return c
+}
+
+func TestDownloadConfigRejectsInvalidFlags(t *testing.T) {
+	for flag, value := range map[string]string{
+		"if-modified-since":  "last tuesday",
+		"compress":           "rar",
+		"on-size-change":     "ignore",
+		"checksum-algorithm": "crc16",
+		"state-format":       "xml",
+	} {
+		t.Run(flag, func(t *testing.T) {
+			c := downloadCommand()
+			if err := c.Flags().Set(flag, value); err != nil {
+				t.Fatal(err)
+			}
+			_, err := downloadConfig(c)
+			if err == nil || !strings.Contains(err.Error(), "--"+flag) {
+				t.Errorf("downloadConfig() error = %v, want one naming --%s", err, flag)
+			}
+		})
+	}
+}
+
+func TestDownloadConfigRejectsInvalidConfig(t *testing.T) {
+	for key, value := range map[string]map[string]string{
+		config.KeyRateSchedule:       {"9am-5pm": "1M"},
+		config.KeyPerHostConcurrency: {"example.com": "many"},
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Cleanup(viper.Reset)
+			viper.Set(key, value)
+			_, err := downloadConfig(downloadCommand())
+			if err == nil || !strings.Contains(err.Error(), key) {
+				t.Errorf("downloadConfig() error = %v, want one naming %s", err, key)
+			}
+		})
+	}
+}
+
+func TestDownloadConfigAcceptsValidFlags(t *testing.T) {
+	c := downloadCommand()
+	for flag, value := range map[string]string{
+		"if-modified-since":  "2026-01-02",
+		"compress":           "zstd",
+		"on-size-change":     "abort",
+		"checksum-algorithm": "SHA-256",
+		"state-format":       "proto",
+	} {
+		if err := c.Flags().Set(flag, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := downloadConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.IfModifiedSince.IsZero() || cfg.Compress == "" || cfg.OnSizeChange != "abort" || cfg.ChecksumAlgorithm != "sha256" {
+		t.Errorf("downloadConfig() = %+v", cfg)
+	}
+}
+
+func TestNewDownloaderRejectsInvalidFlags(t *testing.T) {
+	for flag, value := range map[string]string{
+		"resolve":                "example.com:443",
+		"bind-addr":              "eth0",
+		"ftp-mode":               "extended",
+		"ftp-passive-port-range": "41000-40000",
+	} {
+		t.Run(flag, func(t *testing.T) {
+			c := downloadCommand()
+			if err := c.Flags().Set(flag, value); err != nil {
+				t.Fatal(err)
+			}
+			_, err := newDownloader(c)
+			if err == nil || !strings.Contains(err.Error(), "--"+flag) {
+				t.Errorf("newDownloader() error = %v, want one naming --%s", err, flag)
+			}
+		})
+	}
+}
+
+// TestInvalidFlagExitStatus runs gdl download with bad flags in a child
+// process, which fail ends with os.Exit.
+func TestInvalidFlagExitStatus(t *testing.T) {
+	if args := os.Getenv("GDL_TEST_ARGS"); args != "" {
+		rootCmd.SetArgs(append([]string{"download", "http://127.0.0.1:1/file"}, strings.Split(args, "\n")...))
+		Execute()
+		os.Exit(0)
+	}
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--compress", "rar"}, `Error: --compress: unknown compression format "rar"`},
+		{[]string{"--checksum", "sha256:abcd"}, "Error: --checksum: invalid sha256 checksum"},
+		{[]string{"--checksum", "md5:" + strings.Repeat("ab", 16), "--checksum-algorithm", "sha1"},
+			"Error: --checksum is md5 but --checksum-algorithm is sha1"},
+		{[]string{"--ftp-mode", "extended"}, `Error: --ftp-mode: invalid FTP mode "extended"`},
+		{[]string{"--bind-addr", "eth0"}, `Error: --bind-addr "eth0" is not an IP address`},
+		{[]string{"--resolve", "example.com"}, `Error: --resolve: invalid resolve "example.com"`},
+	} {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestInvalidFlagExitStatus$")
+			cmd.Env = append(os.Environ(), "GDL_TEST_ARGS="+strings.Join(tc.args, "\n"), "XDG_CONFIG_HOME="+t.TempDir())
+			out, err := cmd.CombinedOutput()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+				t.Fatalf("exit status: %v, want 1; output:\n%s", err, out)
+			}
+			if !strings.Contains(string(out), tc.want) {
+				t.Errorf("output lacks %q:\n%s", tc.want, out)
+			}
+		})
+	}
+}
+
+// TestDownloadCommandsTakeDownloadFlags checks that every command that
+// downloads builds its config from the shared download flags.
+func TestDownloadCommandsTakeDownloadFlags(t *testing.T) {
+	for _, c := range []*cobra.Command{downloadCmd, batchCmd, tuiCmd, mirrorCmd, watchCmd, relayCmd, proxyCmd, daemonStartCmd} {
+		if _, err := downloadConfig(c); err != nil {
+			t.Errorf("%s: downloadConfig() = %v", c.Name(), err)
+		}
+		for _, name := range []string{"concurrency", "resolve", "bind-addr", "header-timeout"} {
+			if c.Flags().Lookup(name) == nil {
+				t.Errorf("%s has no --%s flag", c.Name(), name)
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gdl/pkg/bytesize"
+	"gdl/pkg/downloader"
+	ftpsource "gdl/pkg/source/ftp"
+
+	"github.com/spf13/cobra"
+)
+
+var ftpListCmd = &cobra.Command{
+	Use:   "ftp-list [url]",
+	Short: "List the files in an FTP directory",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		recursive, _ := cmd.Flags().GetBool("recursive")
+		pattern, _ := cmd.Flags().GetString("include-pattern")
+		opts, err := ftpOptions(cmd)
+		if err != nil {
+			fail(err)
+		}
+		files, err := listFTP(args[0], opts, recursive, pattern)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		printFTPListing(files)
+	},
+}
+
+// ftpFile is an entry found below an FTP directory, with its path relative
+// to that directory.
+type ftpFile struct {
+	Rel string
+	ftpsource.FTPEntry
+}
+
+// listFTP lists the files in the FTP directory rawURL, descending into
+// subdirectories if recursive is set; otherwise they are listed with a
+// trailing slash. With a pattern, only files whose name matches it (see
+// path.Match) are returned.
+func listFTP(rawURL string, opts ftpsource.Options, recursive bool, pattern string) ([]ftpFile, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid --include-pattern %q: %w", pattern, err)
+	}
+	src, err := ftpsource.New(rawURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []ftpFile
+	var walk func(rel string) error
+	walk = func(rel string) error {
+		entries, err := src.ListDirectory(path.Join("/", src.Path, rel))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			name := path.Join(rel, e.Name)
+			if e.Dir {
+				if !recursive {
+					files = append(files, ftpFile{Rel: name + "/", FTPEntry: e})
+				} else if err := walk(name); err != nil {
+					return err
+				}
+				continue
+			}
+			if ok, _ := path.Match(pattern, e.Name); pattern == "" || ok {
+				files = append(files, ftpFile{Rel: name, FTPEntry: e})
+			}
+		}
+		return nil
+	}
+	return files, walk("")
+}
+
+func printFTPListing(files []ftpFile) {
+	var total int64
+	n := 0
+	for _, f := range files {
+		if f.Dir {
+			fmt.Printf("%10s  %19s  %s\n", "-", "-", f.Rel)
+			continue
+		}
+		n++
+		modified := "-"
+		if !f.Time.IsZero() {
+			modified = f.Time.Format(time.DateTime)
+		}
+		fmt.Printf("%10s  %19s  %s\n", bytesize.Format(f.Size), modified, f.Rel)
+		total += f.Size
+	}
+	fmt.Printf("%d files, %s\n", n, bytesize.Format(total))
+}
+
+// downloadFTPDirectory downloads the files listed below the FTP directory
+// in cfg.Url into cfg.OutputDir, keeping their relative paths.
+func downloadFTPDirectory(cmd *cobra.Command, d *downloader.Downloader, cfg downloader.DownloadConfig) {
+	pattern, _ := cmd.Flags().GetString("include-pattern")
+	files, err := listFTP(cfg.Url, d.FTP, true, pattern)
+	if err != nil {
+		fmt.Println("Error listing directory:", err)
+		return
+	}
+	if listOnly, _ := cmd.Flags().GetBool("list-only"); listOnly {
+		printFTPListing(files)
+		return
+	}
+
+	base, _ := url.Parse(cfg.Url)
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/"
+	for _, f := range files {
+		fmt.Println("Processing:", f.Rel)
+		fileCfg := cfg
+		fileCfg.Url = base.ResolveReference(&url.URL{Path: f.Rel}).String()
+		fileCfg.OutputName = path.Base(f.Rel)
+		fileCfg.OutputDir = filepath.Join(cfg.OutputDir, filepath.FromSlash(path.Dir(f.Rel)))
+		if err := d.Download(fileCfg); err != nil {
+			fmt.Printf("Error downloading %s: %v\n", f.Rel, err)
+		}
+	}
+}
+
+// isFTPDirectory reports whether rawURL is an ftp:// URL naming a directory.
+func isFTPDirectory(rawURL string, opts ftpsource.Options) (bool, error) {
+	if !ftpsource.IsFTP(rawURL) {
+		return false, nil
+	}
+	src, err := ftpsource.New(rawURL, opts)
+	if err != nil {
+		return false, err
+	}
+	return src.IsDir()
+}
+
+func init() {
+	ftpListCmd.Flags().BoolP("recursive", "r", false, "List subdirectories too")
+	ftpListCmd.Flags().String("include-pattern", "", "Only list files whose name matches this glob, e.g. *.iso")
+	ftpListCmd.Flags().String("ftp-mode", "passive", "FTP data connection mode: active or passive")
+	ftpListCmd.Flags().String("ftp-passive-port-range", "", "Ports allowed for FTP data connections, e.g. 40000-41000")
+	ftpListCmd.Flags().Bool("ftp-tls", false, "Use explicit FTP over TLS (AUTH TLS) for ftp:// URLs")
+	rootCmd.AddCommand(ftpListCmd)
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+
+	"gdl/pkg/splitwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge [file.001]",
+	Short: "Join volumes written with --split-size into one file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		merged, err := splitwriter.Merge(args[0])
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("Merged into", merged)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+}
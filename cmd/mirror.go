@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"gdl/pkg/webdav"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror [url]",
+	Short: "Download every file below a WebDAV collection",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !webdav.IsWebDAV(args[0]) {
+			fmt.Println("Error: mirror only supports webdav:// and webdavs:// URLs")
+			return
+		}
+
+		d, err := newDownloader(cmd)
+		if err != nil {
+			fail(err)
+		}
+		base, err := downloadConfig(cmd)
+		if err != nil {
+			fail(err)
+		}
+
+		// PROPFIND goes through the same client and headers as the downloads.
+		client := &webdav.Client{HTTP: d.Client, Headers: d.GlobalHeaders}
+		root, err := webdav.NormalizeURL(args[0], client)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if base.WebDAVUser != "" {
+			client.User, client.Pass = base.WebDAVUser, base.WebDAVPass
+		}
+
+		files, err := client.Walk(root)
+		if err != nil {
+			fmt.Println("Error listing collection:", err)
+			return
+		}
+
+		rootUrl, _ := url.Parse(root)
+		rootPath := strings.TrimSuffix(rootUrl.Path, "/") + "/"
+
+		for _, f := range files {
+			fileUrl, err := url.Parse(f.URL)
+			if err != nil || !strings.HasPrefix(fileUrl.Path, rootPath) {
+				fmt.Println("Skipping entry outside collection:", f.URL)
+				continue
+			}
+			rel := path.Clean(strings.TrimPrefix(fileUrl.Path, rootPath))
+			if rel == "." || strings.HasPrefix(rel, "..") {
+				continue
+			}
+
+			// Go back to the webdav scheme so the resolver adds credentials.
+			if fileUrl.Scheme == "https" {
+				fileUrl.Scheme = "webdavs"
+			} else {
+				fileUrl.Scheme = "webdav"
+			}
+
+			fmt.Println("Processing:", rel)
+			cfg := base
+			cfg.Url = fileUrl.String()
+			cfg.OutputName = path.Base(rel)
+			cfg.OutputDir = filepath.Join(base.OutputDir, filepath.FromSlash(path.Dir(rel)))
+			cfg.WebDAVUser, cfg.WebDAVPass = client.User, client.Pass
+			if err := d.Download(cfg); err != nil {
+				fmt.Printf("Error downloading %s: %v\n", rel, err)
+			}
+		}
+	},
+}
+
+func init() {
+	mirrorCmd.Flags().IntP("concurrency", "c", 16, "Number of concurrent connections per download")
+	mirrorCmd.Flags().StringP("dir", "d", "", "Output directory")
+	addDownloadFlags(mirrorCmd)
+	rootCmd.AddCommand(mirrorCmd)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gdl/pkg/daemon"
+
+	"github.com/spf13/cobra"
+)
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause every running download until 'gdl resume'",
+	Long: `Pause every running download by creating ` + pausePath() + `.
+Downloads look for the file every --pause-poll and stop reading while it
+exists; removing it, with 'gdl resume' or otherwise, lets them continue.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path := pausePath()
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("Downloads paused")
+	},
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume downloads paused with 'gdl pause'",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := os.Remove(pausePath())
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Println("Downloads are not paused")
+			return
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("Downloads resumed")
+	},
+}
+
+// pausePath returns the file whose existence pauses all downloads.
+func pausePath() string {
+	return filepath.Join(daemon.Dir(), "PAUSE")
+}
+
+func init() {
+	rootCmd.AddCommand(pauseCmd)
+	rootCmd.AddCommand(resumeCmd)
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"gdl/pkg/proxy"
+
+	"github.com/spf13/cobra"
+)
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Serve files through a caching download proxy",
+	Long: `Starts an HTTP server that downloads the URL in the request path, e.g.
+
+  curl -O http://proxy.local:8080/https://example.com/file.zip
+
+and keeps the file in the cache directory, so that later requests for the
+same URL, from any machine, are served from there. It also works as an HTTP
+proxy for plain http:// URLs.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runProxy(cmd); err != nil {
+			fail(err)
+		}
+	},
+}
+
+func runProxy(cmd *cobra.Command) error {
+	addr, _ := cmd.Flags().GetString("addr")
+	cacheDir, _ := cmd.Flags().GetString("cache-dir")
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return err
+		}
+		cacheDir = filepath.Join(dir, "gdl", "proxy")
+	}
+
+	d, err := newDownloader(cmd)
+	if err != nil {
+		return err
+	}
+	base, err := downloadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	base.Quiet = true
+	s := &proxy.Server{
+		Cache: &proxy.Cache{Dir: cacheDir},
+		Fetch: func(ctx context.Context, url, dir string) (string, error) {
+			cfg := base
+			cfg.Url = url
+			cfg.OutputDir = dir
+			var file string
+			cfg.OnProgress = func(f string, downloaded, total int64) { file = f }
+			if err := d.DownloadContext(ctx, cfg); err != nil {
+				return "", err
+			}
+			return file, nil
+		},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{Addr: addr, Handler: s}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	fmt.Printf("Proxy listening on %s, caching in %s\n", addr, cacheDir)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func init() {
+	proxyCmd.Flags().String("addr", ":8080", "Address to listen on")
+	proxyCmd.Flags().String("cache-dir", "", "Where downloaded files are kept (default: the user cache directory)")
+	proxyCmd.Flags().IntP("concurrency", "c", 16, "Number of concurrent connections per download")
+	addDownloadFlags(proxyCmd)
+	rootCmd.AddCommand(proxyCmd)
+}
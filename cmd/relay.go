@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"gdl/pkg/downloader"
+	"gdl/pkg/relay"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+)
+
+var relayCmd = &cobra.Command{
+	Use:   "relay --src [url] --dst s3://bucket/key",
+	Short: "Download a file and upload it to S3 at the same time, without saving it to disk",
+	Long: `Download a file with the segmented downloader and upload it to S3 as a
+multipart upload while it downloads, for copying between cloud stores.
+Only the parts being filled are held in memory. AWS credentials and the
+region come from the usual environment variables, shared config files or
+instance role.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		src, _ := cmd.Flags().GetString("src")
+		dst, _ := cmd.Flags().GetString("dst")
+		if src == "" || dst == "" {
+			fmt.Println("Error: --src and --dst are required")
+			return
+		}
+		bucket, key, err := relay.ParseS3URL(dst)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		ctx := context.Background()
+		awsCfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		endpoint, _ := cmd.Flags().GetString("endpoint")
+		client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+			if endpoint != "" {
+				o.BaseEndpoint = &endpoint
+				o.UsePathStyle = true
+			}
+		})
+
+		d, err := newDownloader(cmd)
+		if err != nil {
+			fail(err)
+		}
+		cfg, err := downloadConfig(cmd)
+		if err != nil {
+			fail(err)
+		}
+		cfg.Url = src
+		cfg.NoTorrent = true
+		var upload *relay.S3Relay
+		cfg.Sink = func(info *downloader.FileInfo) (io.WriterAt, error) {
+			if upload != nil {
+				upload.Abort() // the download is starting over
+			}
+			u, err := relay.NewS3Relay(ctx, client, bucket, key, info.Size, info.ContentType)
+			if err != nil {
+				return nil, err
+			}
+			upload = u
+			return u, nil
+		}
+		if err := d.DownloadContext(ctx, cfg); err != nil {
+			if upload != nil {
+				upload.Abort()
+			}
+			fmt.Println("Error:", err)
+			return
+		}
+		if err := upload.Complete(); err != nil {
+			upload.Abort()
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("Uploaded %s to %s\n", src, dst)
+	},
+}
+
+func init() {
+	relayCmd.Flags().String("src", "", "URL to download")
+	relayCmd.Flags().String("dst", "", "S3 object to upload to, as s3://bucket/key")
+	relayCmd.Flags().String("endpoint", "", "URL of an S3-compatible service such as MinIO or R2, addressed path-style")
+	relayCmd.Flags().IntP("concurrency", "c", 16, "Number of concurrent connections")
+	addDownloadFlags(relayCmd)
+	rootCmd.AddCommand(relayCmd)
+}
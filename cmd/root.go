@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"fmt"
+	"gdl/pkg/config"
+	"gdl/pkg/logger"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -11,6 +14,32 @@ var rootCmd = &cobra.Command{
 	Short: "A high-performance CLI downloader",
 	Long: `A CLI downloader that supports segmented downloads,
 batch processing, and resumability.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		debug, _ := cmd.Flags().GetBool("debug")
+		logFile, _ := cmd.Flags().GetString("log-file")
+		if err := logger.Init(debug, logFile); err != nil {
+			return err
+		}
+
+		cfgFile, _ := cmd.Flags().GetString("config")
+		if err := config.Init(cfgFile); err != nil {
+			return err
+		}
+		// -H takes precedence over GDL_HEADER_ variables, which take
+		// precedence over the config file.
+		if err := config.AddGlobalHeaders(config.EnvHeaders(os.Environ())); err != nil {
+			return err
+		}
+		headers, _ := cmd.Flags().GetStringArray("header")
+		return config.AddGlobalHeaders(headers)
+	},
+}
+
+// fail reports err the way the commands report errors and exits with
+// status 1, for errors that stop a command before it does anything.
+func fail(err error) {
+	fmt.Println("Error:", err)
+	os.Exit(1)
 }
 
 func Execute() {
@@ -21,5 +50,10 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.Version = versionString()
+	rootCmd.PersistentFlags().Bool("debug", false, "Enable debug logging")
+	rootCmd.PersistentFlags().String("log-file", "", "Also append all log records, including debug, to this file")
+	rootCmd.PersistentFlags().String("config", "", "Config file, .yaml or .toml (default "+config.Dir()+"/config.yaml)")
+	rootCmd.PersistentFlags().StringArrayP("header", "H", nil, "Header sent with every request, as \"Key: Value\" (repeatable; GDL_HEADER_<NAME> variables set them too)")
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
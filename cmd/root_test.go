@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"gdl/pkg/testserver"
+)
+
+func TestEnvHeadersReachServer(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("GDL_HEADER_X_API_KEY", "secret")
+	t.Setenv("GDL_HEADER_X_TEAM", "from-env")
+	t.Setenv("GDL_HEADER_AUTHORIZATION", "Bearer env-token")
+	cfgFile := filepath.Join(dir, "config.yaml")
+	config := `global_headers:
+  - "X-Team: from-config"
+  - "X-Config: yes"
+  - "Authorization: Bearer config-token"
+`
+	if err := os.WriteFile(cfgFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := testserver.NewTestServer(t, testserver.RandomContent(20_000, 80))
+	out := filepath.Join(dir, "out")
+	rootCmd.SetArgs([]string{"download", srv.FileURL("data.bin"), "-d", out, "-c", "2",
+		"--config", cfgFile, "-H", "Authorization: Bearer flag-token"})
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	err = rootCmd.Execute()
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "data.bin")); err != nil {
+		t.Fatalf("nothing downloaded: %v", err)
+	}
+
+	log := srv.RequestLog()
+	if len(log) == 0 {
+		t.Fatal("the server got no requests")
+	}
+	// -H beats GDL_HEADER_ variables, which beat the config file.
+	want := map[string]string{
+		"X-Api-Key":     "secret",
+		"X-Team":        "from-env",
+		"X-Config":      "yes",
+		"Authorization": "Bearer flag-token",
+	}
+	for _, r := range log {
+		for k, v := range want {
+			if got := r.Header.Values(k); len(got) != 1 || got[0] != v {
+				t.Errorf("%s %s: %s = %q, want %q", r.Method, r.Header.Get("Range"), k, got, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gdl/pkg/downloader"
+
+	"github.com/spf13/cobra"
+)
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect .gdl.json state files of unfinished downloads",
+}
+
+var statePrometheusCmd = &cobra.Command{
+	Use:   "prometheus [state-file]",
+	Short: "Print a download's progress in Prometheus text format",
+	Long: `Prints the progress recorded in a .gdl.json state file in the Prometheus
+text exposition format, for a pushgateway or the node exporter's textfile
+collector, e.g.
+
+  gdl state prometheus big.iso.gdl.json > /var/lib/node_exporter/gdl.prom`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		state, err := downloader.LoadState(args[0])
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		writePrometheus(os.Stdout, state)
+	},
+}
+
+// writePrometheus writes state's metrics, labelled with its file and URL.
+func writePrometheus(w io.Writer, state *downloader.DownloadState) {
+	complete := 0
+	for _, c := range state.Chunks {
+		if c.Start+c.Downloaded > c.End {
+			complete++
+		}
+	}
+	url := state.OriginalURL
+	if url == "" {
+		url = state.URL
+	}
+	labels := fmt.Sprintf(`{file="%s",url="%s"}`, promEscape(state.File), promEscape(url))
+
+	metrics := []struct {
+		name, help string
+		value      int64
+	}{
+		{"gdl_state_total_bytes", "Size of the file being downloaded.", state.Size},
+		{"gdl_state_downloaded_bytes", "Bytes downloaded so far.", state.Downloaded()},
+		{"gdl_state_chunks_total", "Number of chunks the download is split into.", int64(len(state.Chunks))},
+		{"gdl_state_chunks_complete", "Number of chunks downloaded completely.", int64(complete)},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s%s %d\n", m.name, m.help, m.name, m.name, labels, m.value)
+	}
+}
+
+// promEscape escapes a label value for the text exposition format.
+var promEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+
+func init() {
+	stateCmd.AddCommand(statePrometheusCmd)
+	rootCmd.AddCommand(stateCmd)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"gdl/pkg/accounting"
+	"gdl/pkg/bytesize"
+	"gdl/pkg/daemon"
+	"gdl/pkg/downloader"
+
+	"github.com/spf13/cobra"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show how much has been downloaded today, this month and in total",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		t, err := bandwidthLedger().Load()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		now := time.Now()
+		fmt.Printf("Today:       %s\n", bytesize.Format(t.Day(now)))
+		fmt.Printf("This month:  %s\n", bytesize.Format(t.Month(now)))
+		fmt.Printf("All time:    %s\n", bytesize.Format(t.Total))
+		if len(t.Largest) == 0 {
+			return
+		}
+		fmt.Println("\nLargest downloads:")
+		for _, dl := range t.Largest {
+			name := dl.File
+			if name == "" {
+				name = dl.URL
+			}
+			fmt.Printf("  %10s  %s  %s\n", bytesize.Format(dl.Bytes), dl.Time.Format(time.DateOnly), name)
+		}
+	},
+}
+
+// bandwidthLedger returns the ledger kept next to the daemon's files.
+func bandwidthLedger() *accounting.BandwidthLedger {
+	return &accounting.BandwidthLedger{Path: filepath.Join(daemon.Dir(), "bandwidth.json")}
+}
+
+// trackBandwidth notes the file cfg is saved as and returns a function that,
+// once the download returns, records the bytes d received meanwhile in
+// ledger. Failed downloads are recorded too: their bytes were used all the
+// same.
+func trackBandwidth(ledger *accounting.BandwidthLedger, d *downloader.Downloader, cfg *downloader.DownloadConfig) func() {
+	before := d.BytesReceived()
+	var file string
+	onProgress := cfg.OnProgress
+	cfg.OnProgress = func(f string, downloaded, total int64) {
+		file = f
+		if onProgress != nil {
+			onProgress(f, downloaded, total)
+		}
+	}
+	return func() {
+		n := d.BytesReceived() - before
+		if n <= 0 {
+			return
+		}
+		if err := ledger.Record(cfg.Url, file, n); err != nil {
+			slog.Warn("could not update the bandwidth ledger", "error", err)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+}
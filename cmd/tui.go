@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"gdl/pkg/tui"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui [url...]",
+	Short: "Interactively manage several downloads",
+	Run: func(cmd *cobra.Command, args []string) {
+		base, err := downloadConfig(cmd)
+		if err != nil {
+			fail(err)
+		}
+		listFile, _ := cmd.Flags().GetString("file")
+
+		urls := args
+		if listFile != "" {
+			file, err := os.Open(listFile)
+			if err != nil {
+				fmt.Println("Error opening file:", err)
+				return
+			}
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				url := strings.TrimSpace(scanner.Text())
+				if url == "" || strings.HasPrefix(url, "#") {
+					continue
+				}
+				urls = append(urls, url)
+			}
+			file.Close()
+		}
+		if len(urls) == 0 {
+			fmt.Println("Error: no URLs given")
+			return
+		}
+
+		d, err := newDownloader(cmd)
+		if err != nil {
+			fail(err)
+		}
+		var sessions []*tui.DownloadSession
+		for _, url := range urls {
+			cfg := base
+			cfg.Url = url
+			sessions = append(sessions, tui.NewDownloadSession(d, cfg))
+		}
+
+		if err := tui.NewTUIDownloadManager(sessions).Run(); err != nil {
+			fmt.Println("Error:", err)
+		}
+	},
+}
+
+func init() {
+	tuiCmd.Flags().IntP("concurrency", "c", 16, "Number of concurrent connections per download")
+	tuiCmd.Flags().StringP("dir", "d", "", "Output directory")
+	tuiCmd.Flags().StringP("file", "f", "", "Read URLs from a file, one per line")
+	addDownloadFlags(tuiCmd)
+	rootCmd.AddCommand(tuiCmd)
+}
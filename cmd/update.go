@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"gdl/pkg/selfupdate"
+
+	"github.com/spf13/cobra"
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update gdl to the latest release",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := selfupdate.Update(Version, "biendo27", "download-tools")
+		switch {
+		case errors.Is(err, selfupdate.ErrUpToDate):
+			fmt.Println("gdl", Version, "is up to date")
+		case err != nil:
+			fmt.Println("Error:", err)
+		default:
+			fmt.Println("Updated; restart gdl to use the new version")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(updateCmd)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [file]",
+	Short: "Check a local file against its source's checksum without downloading it",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+		url, _ := cmd.Flags().GetString("url")
+		expected, _ := cmd.Flags().GetString("expected-sha256")
+
+		var (
+			algo    string
+			want    []byte
+			newHash func() hash.Hash
+		)
+		switch {
+		case expected != "":
+			sum, err := hex.DecodeString(strings.TrimSpace(expected))
+			if err != nil || len(sum) != sha256.Size {
+				fmt.Println("Error: --expected-sha256 must be 64 hex digits")
+				return
+			}
+			algo, want, newHash = "sha-256", sum, sha256.New
+		case url != "":
+			d, err := newDownloader(cmd)
+			if err != nil {
+				fail(err)
+			}
+			info, err := d.Probe(url, d.GlobalHeaders)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if stat, err := os.Stat(path); err == nil && info.Size >= 0 && stat.Size() != info.Size {
+				fmt.Printf("MISMATCH: %s is %d bytes, the server reports %d\n", path, stat.Size(), info.Size)
+				return
+			}
+			var ok bool
+			if algo, want, newHash, ok = info.StrongestDigest(); !ok {
+				fmt.Println("Error: the server sends no Content-MD5 or Digest header; use --expected-sha256")
+				return
+			}
+		default:
+			fmt.Println("Error: give --url or --expected-sha256")
+			return
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer f.Close()
+		h := newHash()
+		if _, err := io.Copy(h, f); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		got := h.Sum(nil)
+		if bytes.Equal(got, want) {
+			fmt.Printf("OK: %s matches (%s %x)\n", path, algo, got)
+		} else {
+			fmt.Printf("MISMATCH: %s has %s %x, expected %x\n", path, algo, got, want)
+		}
+	},
+}
+
+func init() {
+	verifyCmd.Flags().String("url", "", "Source URL whose Content-MD5 or Digest header to check against")
+	verifyCmd.Flags().String("expected-sha256", "", "Expected SHA-256 in hex, instead of asking the server")
+	verifyCmd.Flags().Int("sftp-port", 22, "Port for sftp:// URLs without an explicit port")
+	verifyCmd.Flags().String("identity-file", "", "SSH private key for sftp:// URLs (default ~/.ssh/id_rsa)")
+	verifyCmd.Flags().Bool("sftp-insecure", false, "Don't check the host key of sftp:// servers against ~/.ssh/known_hosts")
+	rootCmd.AddCommand(verifyCmd)
+}
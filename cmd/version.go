@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// Build information, set by the Makefile with
+// -ldflags "-X gdl/cmd.Version=v1.2.3 -X gdl/cmd.Commit=... -X gdl/cmd.Date=...".
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = "" // build time, RFC 3339
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version of gdl and what it was built from",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(versionString())
+	},
+}
+
+// versionString is the version with the commit and build date, if known.
+func versionString() string {
+	s := Version
+	if Commit != "" {
+		s += " (" + Commit
+		if Date != "" {
+			s += ", built " + Date
+		}
+		s += ")"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
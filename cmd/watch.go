@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"gdl/pkg/bytesize"
+	"gdl/pkg/daemon"
+	"gdl/pkg/downloader"
+	"gdl/pkg/filediff"
+	"gdl/pkg/fileutil"
+	"gdl/pkg/hook"
+	"gdl/pkg/watch"
+
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [url]",
+	Short: "Download a URL again every interval and report when it changes",
+	Long: `Download a URL now and again every --interval until interrupted. Each
+download is hashed and compared with the previous one, which is remembered in
+` + watchHistory().Path + `, so a restarted watch picks up where it left off.
+When the file changed, a summary is printed and the --on-change command runs
+with GDL_OLD_HASH, GDL_NEW_HASH, GDL_FILE and GDL_URL set.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if interval <= 0 {
+			fmt.Println("Error: --interval must be positive")
+			return
+		}
+		cfg, err := downloadConfig(cmd)
+		if err != nil {
+			fail(err)
+		}
+		d, err := newDownloader(cmd)
+		if err != nil {
+			fail(err)
+		}
+		w := &watcher{
+			d:       d,
+			cfg:     cfg,
+			history: watchHistory(),
+		}
+		w.cfg.Url = args[0]
+		w.output, _ = cmd.Flags().GetString("output")
+		w.onChange, _ = cmd.Flags().GetString("on-change")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := w.check(ctx); err != nil && ctx.Err() == nil {
+				fmt.Println("Error:", err)
+			}
+			fmt.Printf("Next check at %s\n", time.Now().Add(interval).Format(time.TimeOnly))
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	},
+}
+
+// watchHistory returns the history of watched URLs, kept next to the
+// daemon's files.
+func watchHistory() *watch.History {
+	return &watch.History{Path: filepath.Join(daemon.Dir(), "watch.json")}
+}
+
+// watcher downloads one URL for gdl watch.
+type watcher struct {
+	d        *downloader.Downloader
+	cfg      downloader.DownloadConfig
+	history  *watch.History
+	output   string
+	onChange string
+}
+
+// check downloads the URL into a temporary directory, compares it with the
+// last download and, unless it is unchanged, moves it into place.
+func (w *watcher) check(ctx context.Context) error {
+	dir := w.cfg.OutputDir
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(dir, ".gdl-watch-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	cfg := w.cfg
+	cfg.OutputDir = tmp
+	if w.output != "" {
+		cfg.OutputName = filepath.Base(w.output)
+	}
+	var file string
+	cfg.OnDone = func(name string) { file = name }
+	if err := w.d.DownloadContext(ctx, cfg); err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("nothing was saved for %s", cfg.Url)
+	}
+
+	final := filepath.Join(dir, filepath.Base(file))
+	if w.output != "" {
+		final = filepath.Join(dir, w.output)
+		if filepath.IsAbs(w.output) {
+			final = w.output
+		}
+	}
+	sum, size, err := watch.HashFile(file)
+	if err != nil {
+		return err
+	}
+	entries, err := w.history.Load()
+	if err != nil {
+		return err
+	}
+	prev, seen := entries[cfg.Url]
+	now := time.Now()
+	entry := watch.Entry{File: final, SHA256: sum, Size: size, Checked: now, Changed: prev.Changed}
+
+	switch {
+	case !seen:
+		fmt.Printf("First download of %s: %s, sha256 %s\n", cfg.Url, bytesize.Format(size), sum)
+		entry.Changed = now
+	case prev.SHA256 == sum:
+		fmt.Printf("Unchanged since %s: sha256 %s\n", prev.Changed.Format(time.DateTime), sum)
+		if _, err := os.Stat(final); err == nil {
+			return w.history.Record(cfg.Url, entry)
+		}
+	default:
+		fmt.Printf("Changed: %s\n", cfg.Url)
+		fmt.Printf("  size:   %s -> %s\n", bytesize.Format(prev.Size), bytesize.Format(size))
+		fmt.Printf("  sha256: %s -> %s\n", prev.SHA256, sum)
+		if r := filediff.Compare(final, file); r.Err == nil && r.HashA == prev.SHA256 {
+			fmt.Printf("  first difference at byte %d\n", r.Offset)
+		}
+		entry.Changed = now
+	}
+
+	if err := fileutil.MoveFile(file, final); err != nil {
+		return err
+	}
+	if err := w.history.Record(cfg.Url, entry); err != nil {
+		return err
+	}
+	if seen && prev.SHA256 != sum && w.onChange != "" {
+		env := []string{
+			"GDL_OLD_HASH=" + prev.SHA256,
+			"GDL_NEW_HASH=" + sum,
+			"GDL_FILE=" + final,
+			"GDL_URL=" + cfg.Url,
+		}
+		if err := hook.RunHook(w.onChange, env); err != nil {
+			fmt.Printf("Warning: hook %q failed: %v\n", w.onChange, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	watchCmd.Flags().Duration("interval", time.Hour, "Time between downloads")
+	watchCmd.Flags().String("on-change", "", "Shell command to run when the file changed, with GDL_OLD_HASH and GDL_NEW_HASH set")
+	watchCmd.Flags().IntP("concurrency", "c", 16, "Number of concurrent connections")
+	watchCmd.Flags().StringP("output", "o", "", "Output filename")
+	watchCmd.Flags().StringP("dir", "d", "", "Output directory")
+	addDownloadFlags(watchCmd)
+	rootCmd.AddCommand(watchCmd)
+}
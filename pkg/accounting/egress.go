@@ -0,0 +1,81 @@
+package accounting
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// egressPrices is the list price in USD per GiB of internet egress, first
+// pricing tier, from the major AWS regions and the GCP regions and GCS
+// multi-regions. AWS region names have a dash before the number
+// (us-east-1), GCP ones don't (us-east1), so one table holds both.
+var egressPrices = map[string]float64{
+	// AWS
+	"us-east-1":      0.09,
+	"us-east-2":      0.09,
+	"us-west-1":      0.09,
+	"us-west-2":      0.09,
+	"ca-central-1":   0.09,
+	"eu-west-1":      0.09,
+	"eu-west-2":      0.09,
+	"eu-west-3":      0.09,
+	"eu-central-1":   0.09,
+	"eu-north-1":     0.09,
+	"eu-south-1":     0.09,
+	"ap-northeast-1": 0.114,
+	"ap-northeast-2": 0.126,
+	"ap-northeast-3": 0.114,
+	"ap-southeast-1": 0.12,
+	"ap-southeast-2": 0.114,
+	"ap-south-1":     0.1093,
+	"sa-east-1":      0.15,
+	"me-south-1":     0.117,
+	"af-south-1":     0.154,
+
+	// GCP
+	"us":                      0.12,
+	"eu":                      0.12,
+	"asia":                    0.12,
+	"us-central1":             0.12,
+	"us-east1":                0.12,
+	"us-east4":                0.12,
+	"us-west1":                0.12,
+	"us-west2":                0.12,
+	"northamerica-northeast1": 0.12,
+	"europe-west1":            0.12,
+	"europe-west2":            0.12,
+	"europe-west3":            0.12,
+	"europe-west4":            0.12,
+	"europe-north1":           0.12,
+	"asia-east1":              0.12,
+	"asia-northeast1":         0.12,
+	"asia-southeast1":         0.12,
+	"asia-south1":             0.12,
+	"southamerica-east1":      0.12,
+	"australia-southeast1":    0.19,
+}
+
+// EgressPrice returns the price in USD per GiB of downloading from a cloud
+// region, such as "us-east-1" or "europe-west1", to the internet.
+func EgressPrice(region string) (float64, error) {
+	if p, ok := egressPrices[strings.ToLower(strings.TrimSpace(region))]; ok {
+		return p, nil
+	}
+	return 0, fmt.Errorf("no egress price for region %q (known: %s)", region, strings.Join(EgressRegions(), ", "))
+}
+
+// EgressRegions returns the regions EgressPrice knows, sorted.
+func EgressRegions() []string {
+	regions := make([]string, 0, len(egressPrices))
+	for r := range egressPrices {
+		regions = append(regions, r)
+	}
+	slices.Sort(regions)
+	return regions
+}
+
+// EstimateCost returns what downloading size bytes costs at pricePerGiB.
+func EstimateCost(size int64, pricePerGiB float64) float64 {
+	return float64(size) / (1 << 30) * pricePerGiB
+}
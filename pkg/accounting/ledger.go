@@ -0,0 +1,126 @@
+package accounting
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"gdl/pkg/fileutil"
+
+	"github.com/gofrs/flock"
+)
+
+// largestKept is how many of the biggest downloads the ledger remembers.
+const largestKept = 10
+
+// dailyKept is how many days of daily totals the ledger keeps.
+const dailyKept = 400
+
+// BandwidthLedger adds up the bytes downloaded in this session and, in a
+// JSON file shared by every gdl process, per day, per month and in total.
+type BandwidthLedger struct {
+	Path string
+
+	session atomic.Int64
+}
+
+// Download is one finished download in the ledger.
+type Download struct {
+	URL   string    `json:"url"`
+	File  string    `json:"file"`
+	Bytes int64     `json:"bytes"`
+	Time  time.Time `json:"time"`
+}
+
+// Totals is the content of the ledger file. Days and months are in local
+// time.
+type Totals struct {
+	Daily   map[string]int64 `json:"daily"`   // by day, 2006-01-02
+	Monthly map[string]int64 `json:"monthly"` // by month, 2006-01
+	Total   int64            `json:"total"`
+	Largest []Download       `json:"largest"` // biggest first
+}
+
+// Day returns the bytes downloaded on day.
+func (t *Totals) Day(day time.Time) int64 {
+	return t.Daily[day.Format(time.DateOnly)]
+}
+
+// Month returns the bytes downloaded in month.
+func (t *Totals) Month(month time.Time) int64 {
+	return t.Monthly[month.Format("2006-01")]
+}
+
+// Session returns the bytes recorded by this ledger since it was created.
+func (l *BandwidthLedger) Session() int64 {
+	return l.session.Load()
+}
+
+// Load reads the ledger file. A missing file gives empty totals.
+func (l *BandwidthLedger) Load() (*Totals, error) {
+	t := &Totals{Daily: make(map[string]int64), Monthly: make(map[string]int64)}
+	data, err := os.ReadFile(l.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	if t.Daily == nil {
+		t.Daily = make(map[string]int64)
+	}
+	if t.Monthly == nil {
+		t.Monthly = make(map[string]int64)
+	}
+	return t, nil
+}
+
+// Record adds a finished download of bytes bytes. The file is locked while
+// it is read and rewritten, and replaced in one rename, so concurrent gdl
+// processes neither lose updates nor see a half-written ledger.
+func (l *BandwidthLedger) Record(url, file string, bytes int64) error {
+	l.session.Add(bytes)
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0700); err != nil {
+		return err
+	}
+	lock := flock.New(l.Path + ".lock")
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	t, err := l.Load()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	t.Daily[now.Format(time.DateOnly)] += bytes
+	t.Monthly[now.Format("2006-01")] += bytes
+	t.Total += bytes
+	oldest := now.AddDate(0, 0, -dailyKept).Format(time.DateOnly)
+	for day := range t.Daily {
+		if day < oldest {
+			delete(t.Daily, day)
+		}
+	}
+
+	t.Largest = append(t.Largest, Download{URL: url, File: file, Bytes: bytes, Time: now})
+	slices.SortStableFunc(t.Largest, func(a, b Download) int { return cmp.Compare(b.Bytes, a.Bytes) })
+	if len(t.Largest) > largestKept {
+		t.Largest = t.Largest[:largestKept]
+	}
+
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(l.Path, data, 0600)
+}
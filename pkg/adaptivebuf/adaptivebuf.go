@@ -0,0 +1,62 @@
+// Package adaptivebuf reads into a buffer that grows while reads keep
+// filling it, so fast connections aren't held back by a small buffer.
+package adaptivebuf
+
+import "io"
+
+// Default sizes of the buffer.
+const (
+	DefaultMin = 256 << 10
+	DefaultMax = 16 << 20
+)
+
+// window is how many reads are looked at before deciding to grow.
+const window = 5
+
+// Reader reads from an io.Reader into a buffer of its own. The buffer
+// starts at the minimum size and doubles, up to the maximum, each time
+// window reads in a row filled it completely.
+type Reader struct {
+	r    io.Reader
+	buf  []byte
+	max  int
+	seen int // reads in the current window
+	full int // of which filled the buffer
+}
+
+// NewReader returns a Reader over r whose buffer grows from minSize to
+// maxSize bytes. Sizes that aren't positive take the defaults.
+func NewReader(r io.Reader, minSize, maxSize int) *Reader {
+	if minSize <= 0 {
+		minSize = DefaultMin
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMax
+	}
+	return &Reader{r: r, buf: make([]byte, minSize), max: maxSize}
+}
+
+// Next reads once and returns the bytes read, which stay valid until the
+// next call, with the error of the read.
+func (r *Reader) Next() ([]byte, error) {
+	n, err := r.r.Read(r.buf)
+	data := r.buf[:n]
+
+	r.seen++
+	if n == len(r.buf) {
+		r.full++
+	}
+	if r.seen == window {
+		if r.full == window && len(r.buf) < r.max {
+			// data must stay valid, so grow into a new buffer.
+			r.buf = make([]byte, min(2*len(r.buf), r.max))
+		}
+		r.seen, r.full = 0, 0
+	}
+	return data, err
+}
+
+// Size returns the current size of the buffer.
+func (r *Reader) Size() int {
+	return len(r.buf)
+}
@@ -0,0 +1,68 @@
+package adaptivebuf_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"gdl/pkg/adaptivebuf"
+)
+
+// drain reads r to the end and returns what it read.
+func drain(t *testing.T, r *adaptivebuf.Reader) []byte {
+	t.Helper()
+	var got []byte
+	for {
+		data, err := r.Next()
+		got = append(got, data...)
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReaderGrowsWhileReadsFillIt(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1<<10)
+	r := adaptivebuf.NewReader(bytes.NewReader(content), 16, 64)
+	var got []byte
+	// 5 full reads of 16 bytes, then of 32, then it stays at 64.
+	for _, want := range []int{16, 16, 16, 16, 16, 32, 32, 32, 32, 32, 64, 64, 64, 64, 64, 64} {
+		data, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != want {
+			t.Fatalf("read %d bytes, want %d", len(data), want)
+		}
+		got = append(got, data...)
+	}
+	if r.Size() != 64 {
+		t.Errorf("Size() = %d, want the maximum of 64", r.Size())
+	}
+	if got = append(got, drain(t, r)...); !bytes.Equal(got, content) {
+		t.Error("the bytes read differ from the content")
+	}
+}
+
+func TestReaderKeepsSizeForShortReads(t *testing.T) {
+	content := bytes.Repeat([]byte{7}, 4096)
+	// One full read in each window isn't enough to grow.
+	r := adaptivebuf.NewReader(iotest.HalfReader(bytes.NewReader(content)), 16, 64)
+	if got := drain(t, r); !bytes.Equal(got, content) {
+		t.Errorf("read %d bytes, want %d", len(got), len(content))
+	}
+	if r.Size() != 16 {
+		t.Errorf("Size() = %d after half reads, want 16", r.Size())
+	}
+}
+
+func TestReaderDefaults(t *testing.T) {
+	r := adaptivebuf.NewReader(bytes.NewReader(nil), 0, -1)
+	if r.Size() != adaptivebuf.DefaultMin {
+		t.Errorf("Size() = %d, want DefaultMin", r.Size())
+	}
+}
@@ -0,0 +1,125 @@
+package batchparser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gdl/pkg/config"
+	"gdl/pkg/downloader"
+	"gdl/pkg/queue"
+)
+
+// ParseURLList reads one URL per line. Blank lines and lines starting with
+// "#" are skipped, except for "# priority: high" lines, which set the
+// priority of the URLs that follow.
+func ParseURLList(r io.Reader) ([]downloader.DownloadConfig, error) {
+	var cfgs []downloader.DownloadConfig
+	priority := 0
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		url := strings.TrimSpace(scanner.Text())
+		if value, ok := priorityComment(url); ok {
+			p, err := queue.ParsePriority(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			priority = p
+			continue
+		}
+		if url == "" || strings.HasPrefix(url, "#") {
+			continue
+		}
+		cfgs = append(cfgs, downloader.DownloadConfig{Url: url, Priority: priority})
+	}
+	return cfgs, scanner.Err()
+}
+
+// priorityComment returns the value of a "# priority: <value>" line.
+func priorityComment(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "#")
+	if !ok {
+		return "", false
+	}
+	key, value, ok := strings.Cut(rest, ":")
+	if !ok || !strings.EqualFold(strings.TrimSpace(key), "priority") {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
+
+// ParseAria2Format reads an aria2c input file. Each unindented line starts a
+// new entry with its URL (only the first of several tab-separated mirrors is
+// used); the indented "key=value" lines that follow set options for it.
+// Supported options are out, dir, header, split, priority and post-script
+// (see DownloadConfig.PostDownloadScript); others are ignored.
+func ParseAria2Format(r io.Reader) ([]downloader.DownloadConfig, error) {
+	var cfgs []downloader.DownloadConfig
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			url, _, _ := strings.Cut(trimmed, "\t")
+			cfgs = append(cfgs, downloader.DownloadConfig{Url: url})
+			continue
+		}
+
+		if len(cfgs) == 0 {
+			return nil, fmt.Errorf("line %d: option before any URL", lineNo)
+		}
+		if err := applyOption(&cfgs[len(cfgs)-1], trimmed); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	return cfgs, scanner.Err()
+}
+
+func applyOption(cfg *downloader.DownloadConfig, opt string) error {
+	key, value, ok := strings.Cut(opt, "=")
+	if !ok {
+		return fmt.Errorf("invalid option %q, expected key=value", opt)
+	}
+
+	switch strings.TrimSpace(key) {
+	case "out":
+		cfg.OutputName = value
+	case "dir":
+		cfg.OutputDir = value
+	case "header":
+		k, v, err := config.ParseHeader(value)
+		if err != nil {
+			return err
+		}
+		if cfg.Headers == nil {
+			cfg.Headers = make(http.Header)
+		}
+		cfg.Headers.Add(k, v)
+	case "split":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid split %q", value)
+		}
+		cfg.Concurrency = n
+	case "priority":
+		p, err := queue.ParsePriority(value)
+		if err != nil {
+			return err
+		}
+		cfg.Priority = p
+	case "post-script":
+		cfg.PostDownloadScript = value
+	}
+	return nil
+}
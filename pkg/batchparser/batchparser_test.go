@@ -0,0 +1,114 @@
+package batchparser_test
+
+import (
+	"strings"
+	"testing"
+
+	"gdl/pkg/batchparser"
+	"gdl/pkg/queue"
+)
+
+func TestParseURLList(t *testing.T) {
+	input := `# mirrors for the release
+https://example.com/a.iso
+
+  https://example.com/b.iso
+# priority: high
+https://example.com/c.iso
+#Priority:LOW
+https://example.com/d.iso
+# not a priority: just a comment
+https://example.com/e.iso
+# priority: 5
+https://example.com/f.iso
+`
+	cfgs, err := batchparser.ParseURLList(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		url      string
+		priority int
+	}{
+		{"https://example.com/a.iso", 0},
+		{"https://example.com/b.iso", 0},
+		{"https://example.com/c.iso", queue.High},
+		{"https://example.com/d.iso", queue.Low},
+		{"https://example.com/e.iso", queue.Low},
+		{"https://example.com/f.iso", queue.Critical},
+	}
+	if len(cfgs) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(cfgs), len(want), cfgs)
+	}
+	for i, w := range want {
+		if cfgs[i].Url != w.url || cfgs[i].Priority != w.priority {
+			t.Errorf("entry %d = %q priority %d, want %q priority %d", i, cfgs[i].Url, cfgs[i].Priority, w.url, w.priority)
+		}
+	}
+}
+
+func TestParseURLListBadPriority(t *testing.T) {
+	input := "https://example.com/a.iso\n# priority: urgent\nhttps://example.com/b.iso\n"
+	_, err := batchparser.ParseURLList(strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ParseURLList() error = %v, want one for line 2", err)
+	}
+}
+
+func TestParseAria2Format(t *testing.T) {
+	input := "# exported by aria2\n" +
+		"https://example.com/a.iso\thttps://mirror.example.com/a.iso\n" +
+		"  out=renamed.iso\n" +
+		"  dir=/srv/isos\n" +
+		"\theader=Authorization: Bearer token\n" +
+		"  header=X-Trace: 1\n" +
+		"  split=8\n" +
+		"  priority=critical\n" +
+		"  post-script=./done.sh\n" +
+		"  max-tries=3\n" +
+		"\n" +
+		"https://example.com/b.iso\n"
+	cfgs, err := batchparser.ParseAria2Format(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfgs) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(cfgs), cfgs)
+	}
+	a := cfgs[0]
+	if a.Url != "https://example.com/a.iso" {
+		t.Errorf("Url = %q, want the first mirror only", a.Url)
+	}
+	if a.OutputName != "renamed.iso" || a.OutputDir != "/srv/isos" || a.Concurrency != 8 ||
+		a.Priority != queue.Critical || a.PostDownloadScript != "./done.sh" {
+		t.Errorf("options not applied: %+v", a)
+	}
+	if got := a.Headers.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization header = %q, want %q", got, "Bearer token")
+	}
+	if got := a.Headers.Get("X-Trace"); got != "1" {
+		t.Errorf("X-Trace header = %q, want %q", got, "1")
+	}
+	if b := cfgs[1]; b.Url != "https://example.com/b.iso" || b.OutputName != "" || b.Headers != nil {
+		t.Errorf("second entry = %+v, want only its URL", b)
+	}
+}
+
+func TestParseAria2FormatErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, input, line string
+	}{
+		{"option first", "  out=a.iso\nhttps://example.com/a.iso\n", "line 1"},
+		{"no equals sign", "https://example.com/a.iso\n  out\n", "line 2"},
+		{"bad split", "https://example.com/a.iso\n  split=0\n", "line 2"},
+		{"bad priority", "https://example.com/a.iso\n\n  priority=asap\n", "line 3"},
+		{"bad header", "https://example.com/a.iso\n  header=no colon\n", "line 2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := batchparser.ParseAria2Format(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.line) {
+				t.Errorf("ParseAria2Format() error = %v, want one for %s", err, tt.line)
+			}
+		})
+	}
+}
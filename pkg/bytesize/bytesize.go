@@ -0,0 +1,53 @@
+package bytesize
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var units = []struct {
+	suffix string
+	factor int64
+}{
+	// Longest suffixes first so "KB" isn't read as "B".
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// Parse reads a size such as "512", "100K", "1.5MB" or "2GiB". Units are
+// binary: 1KB = 1KiB = 1024 bytes.
+func Parse(s string) (int64, error) {
+	num := strings.ToUpper(strings.TrimSpace(s))
+	factor := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(num, u.suffix) {
+			num = strings.TrimSpace(strings.TrimSuffix(num, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * float64(factor)), nil
+}
+
+// Format writes n bytes in the largest binary unit that keeps the number at
+// least 1, e.g. "512 B", "1.50 KiB" or "2.00 GiB".
+func Format(n int64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, i := float64(n)/unit, 0
+	for v >= unit && i < 3 {
+		v /= unit
+		i++
+	}
+	return fmt.Sprintf("%.2f %ciB", v, "KMGT"[i])
+}
@@ -0,0 +1,109 @@
+package cdnfailover
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// DialFunc matches http.Transport.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+type hostIPs struct {
+	ips  []string
+	next int
+}
+
+// Resolver remembers every A/AAAA record of a hostname and hands them out in
+// turn, so a failed connection is retried against a different CDN node.
+// Requests keep using the hostname, so Host and SNI are unchanged.
+type Resolver struct {
+	mu    sync.Mutex
+	hosts map[string]*hostIPs
+}
+
+func New() *Resolver {
+	return &Resolver{hosts: make(map[string]*hostIPs)}
+}
+
+func (r *Resolver) lookup(ctx context.Context, host string) (*hostIPs, error) {
+	r.mu.Lock()
+	h, ok := r.hosts[host]
+	r.mu.Unlock()
+	if ok {
+		return h, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.hosts[host]; ok {
+		return h, nil
+	}
+	h = &hostIPs{ips: ips}
+	r.hosts[host] = h
+	return h, nil
+}
+
+// IPs returns all known addresses for host.
+func (r *Resolver) IPs(ctx context.Context, host string) ([]string, error) {
+	h, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), h.ips...), nil
+}
+
+// Current returns the address new connections to host will use.
+func (r *Resolver) Current(ctx context.Context, host string) (string, error) {
+	h, err := r.lookup(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return h.ips[h.next], nil
+}
+
+// Advance moves host on to its next address.
+func (r *Resolver) Advance(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.hosts[host]; ok {
+		h.next = (h.next + 1) % len(h.ips)
+	}
+}
+
+// DialContext wraps dial so that connections go to the current address of
+// the host, moving to the next one each time a dial fails.
+func (r *Resolver) DialContext(dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		h, err := r.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for range h.ips {
+			ip, _ := r.Current(ctx, host)
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			r.Advance(host)
+		}
+		return nil, lastErr
+	}
+}
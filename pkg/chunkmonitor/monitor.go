@@ -0,0 +1,123 @@
+package chunkmonitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultThreshold is the fraction of the median speed below which a
+	// chunk is considered slow.
+	DefaultThreshold = 0.2
+	// DefaultGrace is how long a chunk must stay slow before it is restarted.
+	DefaultGrace = 10 * time.Second
+)
+
+type chunk struct {
+	cancel    func()
+	bytes     int64 // Bytes since the last sample
+	speed     float64
+	slowSince time.Time
+}
+
+// Monitor tracks per-chunk throughput and cancels chunks that stay far below
+// the median speed, so they can be retried on a fresh connection.
+type Monitor struct {
+	Threshold float64
+	Grace     time.Duration
+
+	mu         sync.Mutex
+	chunks     map[int]*chunk
+	lastSample time.Time
+}
+
+func New() *Monitor {
+	return &Monitor{
+		Threshold:  DefaultThreshold,
+		Grace:      DefaultGrace,
+		chunks:     make(map[int]*chunk),
+		lastSample: time.Now(),
+	}
+}
+
+// Register starts tracking chunk id. cancel is called if it turns out slow.
+func (m *Monitor) Register(id int, cancel func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chunks[id] = &chunk{cancel: cancel}
+}
+
+// Unregister stops tracking chunk id.
+func (m *Monitor) Unregister(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.chunks, id)
+}
+
+// Add records n bytes received by chunk id.
+func (m *Monitor) Add(id int, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.chunks[id]; ok {
+		c.bytes += n
+	}
+}
+
+// Sample updates chunk speeds and cancels chunks that have been below
+// Threshold × median for longer than Grace. It returns the cancelled ids.
+func (m *Monitor) Sample(now time.Time) []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elapsed := now.Sub(m.lastSample).Seconds()
+	m.lastSample = now
+	if elapsed <= 0 {
+		return nil
+	}
+
+	speeds := make([]float64, 0, len(m.chunks))
+	for _, c := range m.chunks {
+		c.speed = float64(c.bytes) / elapsed
+		c.bytes = 0
+		speeds = append(speeds, c.speed)
+	}
+	// A median needs company to mean anything.
+	if len(speeds) < 3 {
+		return nil
+	}
+	sort.Float64s(speeds)
+	median := speeds[len(speeds)/2]
+
+	var cancelled []int
+	for id, c := range m.chunks {
+		if c.speed >= median*m.Threshold {
+			c.slowSince = time.Time{}
+			continue
+		}
+		if c.slowSince.IsZero() {
+			c.slowSince = now
+			continue
+		}
+		if now.Sub(c.slowSince) >= m.Grace {
+			c.cancel()
+			c.slowSince = time.Time{}
+			cancelled = append(cancelled, id)
+		}
+	}
+	return cancelled
+}
+
+// Run samples every interval until done is closed.
+func (m *Monitor) Run(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.Sample(now)
+		case <-done:
+			return
+		}
+	}
+}
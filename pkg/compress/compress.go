@@ -0,0 +1,55 @@
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Formats that files can be compressed to.
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// ParseFormat checks a --compress value.
+func ParseFormat(s string) (string, error) {
+	switch s {
+	case "", Gzip, Zstd:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown compression format %q (want gzip or zstd)", s)
+}
+
+// Ext returns the file extension for format.
+func Ext(format string) string {
+	if format == Zstd {
+		return ".zst"
+	}
+	return ".gz"
+}
+
+// NewWriter returns a writer that compresses to w in format. level is 1-9
+// for gzip and 1-22 for zstd, or 0 for the format's default. Closing the
+// writer flushes it but does not close w.
+func NewWriter(w io.Writer, format string, level int) (io.WriteCloser, error) {
+	switch format {
+	case Gzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case Zstd:
+		var opts []zstd.EOption
+		if level != 0 {
+			if level < 1 || level > 22 {
+				return nil, fmt.Errorf("zstd: invalid compression level: %d", level)
+			}
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	}
+	return nil, fmt.Errorf("unknown compression format %q", format)
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// KeyGlobalHeaders holds headers sent with every request, either as a list
+// of "Key: Value" strings or as a map of key to value(s).
+const KeyGlobalHeaders = "global_headers"
+
+// KeyMimeDirs maps MIME types, or "type/*" wildcards, to the directory files
+// of that type are saved in when no output directory is given.
+const KeyMimeDirs = "mime_dirs"
+
+// KeyRateSchedule maps "HH:MM-HH:MM" time ranges to the download speed
+// allowed during them, e.g. "2MB" or "unlimited".
+const KeyRateSchedule = "rate_schedule"
+
+// Dir returns the directory searched for the config file (~/.config/gdl on
+// Linux).
+func Dir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(dir, "gdl")
+}
+
+// formats maps config file extensions to their format, in the order the
+// default config file is looked up.
+var formats = []struct{ ext, format string }{
+	{".yaml", "yaml"},
+	{".yml", "yaml"},
+	{".toml", "toml"},
+}
+
+// FormatOf returns the format ("yaml" or "toml") of a config file from its
+// extension.
+func FormatOf(path string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range formats {
+		if f.ext == ext {
+			return f.format, nil
+		}
+	}
+	return "", fmt.Errorf("config %s: unsupported format %q, use .yaml, .yml or .toml", path, ext)
+}
+
+// DefaultPath returns the config file in Dir: the first of config.yaml,
+// config.yml and config.toml that exists, or config.yaml if none does.
+func DefaultPath() (path string, exists bool) {
+	for _, f := range formats {
+		path := filepath.Join(Dir(), "config"+f.ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return filepath.Join(Dir(), "config.yaml"), false
+}
+
+// Init loads the config file at path, or the DefaultPath if path is empty.
+// The format follows the file extension. A missing default config file is
+// not an error.
+func Init(path string) error {
+	if path == "" {
+		var exists bool
+		if path, exists = DefaultPath(); !exists {
+			return nil
+		}
+	}
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+
+	viper.SetConfigFile(path)
+	viper.SetConfigType(format)
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+	return nil
+}
+
+// Template returns a commented starter config file in format.
+func Template(format string) (string, error) {
+	switch format {
+	case "yaml":
+		return `# gdl configuration
+
+# Headers sent with every request, as a list of "Key: Value" strings
+# or as a map of key to value(s).
+# global_headers:
+#   - "Authorization: Bearer <token>"
+
+# Directories for files of a MIME type when --dir isn't given.
+# mime_dirs:
+#   video/*: ~/Videos
+#   audio/*: ~/Music
+#   image/*: ~/Pictures
+
+# Download speed limits by time of day, per second.
+# rate_schedule:
+#   "00:00-08:00": unlimited
+#   "08:00-18:00": 2MB
+#   "18:00-24:00": 5MB
+
+# Connections per download for some hosts instead of --concurrency;
+# "*.example.com" matches any subdomain. Add entries with
+# "gdl config set-host-concurrency".
+# per_host_concurrency:
+#   cdn.example.com: 32
+#   "*.amazonaws.com": 8
+`, nil
+	case "toml":
+		return `# gdl configuration
+
+# Headers sent with every request, as a list of "Key: Value" strings
+# or as a table of key to value(s).
+# global_headers = ["Authorization: Bearer <token>"]
+
+# Directories for files of a MIME type when --dir isn't given.
+# [mime_dirs]
+# "video/*" = "~/Videos"
+# "audio/*" = "~/Music"
+# "image/*" = "~/Pictures"
+
+# Download speed limits by time of day, per second.
+# [rate_schedule]
+# "00:00-08:00" = "unlimited"
+# "08:00-18:00" = "2MB"
+# "18:00-24:00" = "5MB"
+
+# Connections per download for some hosts instead of --concurrency;
+# "*.example.com" matches any subdomain. Add entries with
+# "gdl config set-host-concurrency".
+# [per_host_concurrency]
+# "cdn.example.com" = 32
+# "*.amazonaws.com" = 8
+`, nil
+	}
+	return "", fmt.Errorf("unsupported config format %q, use yaml or toml", format)
+}
+
+// ParseHeader splits a "Key: Value" header line.
+func ParseHeader(line string) (string, string, error) {
+	k, v, ok := strings.Cut(line, ":")
+	k = strings.TrimSpace(k)
+	if !ok || k == "" {
+		return "", "", fmt.Errorf("invalid header %q, expected \"Key: Value\"", line)
+	}
+	return http.CanonicalHeaderKey(k), strings.TrimSpace(v), nil
+}
+
+// EnvHeaderPrefix starts the names of environment variables that set
+// headers: GDL_HEADER_X_API_KEY=secret sends "X-Api-Key: secret".
+const EnvHeaderPrefix = "GDL_HEADER_"
+
+// EnvHeaders returns the headers set by EnvHeaderPrefix variables in
+// environ, as "Key: Value" lines for AddGlobalHeaders, in the order given.
+// Underscores in the name become dashes.
+func EnvHeaders(environ []string) []string {
+	var lines []string
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvHeaderPrefix) {
+			continue
+		}
+		key := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(name, EnvHeaderPrefix), "_", "-"))
+		if strings.Trim(key, "-") == "" {
+			continue
+		}
+		lines = append(lines, http.CanonicalHeaderKey(key)+": "+value)
+	}
+	return lines
+}
+
+// GlobalHeaders returns the headers stored under KeyGlobalHeaders.
+func GlobalHeaders() (http.Header, error) {
+	h := make(http.Header)
+	switch v := viper.Get(KeyGlobalHeaders).(type) {
+	case nil:
+	case []string:
+		for _, line := range v {
+			k, val, err := ParseHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			h.Add(k, val)
+		}
+	case []any:
+		for _, line := range v {
+			k, val, err := ParseHeader(fmt.Sprint(line))
+			if err != nil {
+				return nil, err
+			}
+			h.Add(k, val)
+		}
+	case map[string]any:
+		for k, val := range v {
+			switch vals := val.(type) {
+			case []any:
+				for _, one := range vals {
+					h.Add(k, fmt.Sprint(one))
+				}
+			case []string:
+				for _, one := range vals {
+					h.Add(k, one)
+				}
+			default:
+				h.Add(k, fmt.Sprint(vals))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported value %T", KeyGlobalHeaders, v)
+	}
+	return h, nil
+}
+
+// MimeDirs returns the mapping stored under KeyMimeDirs, with a leading "~"
+// in the directories replaced by the home directory.
+func MimeDirs() map[string]string {
+	dirs := viper.GetStringMapString(KeyMimeDirs)
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return dirs
+	}
+	for k, dir := range dirs {
+		if dir == "~" || strings.HasPrefix(dir, "~/") {
+			dirs[k] = filepath.Join(home, dir[1:])
+		}
+	}
+	return dirs
+}
+
+// RateSchedule returns the time ranges and rates stored under
+// KeyRateSchedule, unparsed.
+func RateSchedule() map[string]string {
+	return viper.GetStringMapString(KeyRateSchedule)
+}
+
+// AddGlobalHeaders merges "Key: Value" lines into KeyGlobalHeaders. Keys
+// given here replace the same keys from the config file; repeating a key
+// adds more values.
+func AddGlobalHeaders(lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	h, err := GlobalHeaders()
+	if err != nil {
+		return err
+	}
+	added := make(http.Header)
+	for _, line := range lines {
+		k, v, err := ParseHeader(line)
+		if err != nil {
+			return err
+		}
+		added.Add(k, v)
+	}
+	for k, vs := range added {
+		h[k] = vs
+	}
+
+	merged := make(map[string]any, len(h))
+	for k, vs := range h {
+		merged[k] = vs
+	}
+	viper.Set(KeyGlobalHeaders, merged)
+	return nil
+}
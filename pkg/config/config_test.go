@@ -0,0 +1,192 @@
+package config_test
+
+import (
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"gdl/pkg/config"
+)
+
+const tomlConfig = `# gdl configuration
+global_headers = ["Authorization: Bearer abc", "X-Team: data"]
+
+[mime_dirs]
+"video/*" = "~/Videos"
+"application/pdf" = "/srv/docs"
+
+[rate_schedule]
+"00:00-08:00" = "unlimited"
+"08:00-18:00" = "2MB"
+
+[per_host_concurrency]
+"cdn.example.com" = 32
+"*.amazonaws.com" = 8
+`
+
+const yamlConfig = `# gdl configuration
+global_headers:
+  - "Authorization: Bearer abc"
+  - "X-Team: data"
+mime_dirs:
+  video/*: ~/Videos
+  application/pdf: /srv/docs
+rate_schedule:
+  "00:00-08:00": unlimited
+  "08:00-18:00": 2MB
+per_host_concurrency:
+  cdn.example.com: 32
+  "*.amazonaws.com": 8
+`
+
+// loadConfig writes content to a file named name and loads it, with viper
+// reset afterwards.
+func loadConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	t.Cleanup(viper.Reset)
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Init(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checkSettings fails t unless the loaded config holds the settings of
+// tomlConfig and yamlConfig.
+func checkSettings(t *testing.T) {
+	t.Helper()
+	headers, err := config.GlobalHeaders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHeaders := http.Header{"Authorization": {"Bearer abc"}, "X-Team": {"data"}}
+	if !reflect.DeepEqual(headers, wantHeaders) {
+		t.Errorf("GlobalHeaders() = %v, want %v", headers, wantHeaders)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDirs := map[string]string{"video/*": filepath.Join(home, "Videos"), "application/pdf": "/srv/docs"}
+	if dirs := config.MimeDirs(); !maps.Equal(dirs, wantDirs) {
+		t.Errorf("MimeDirs() = %v, want %v", dirs, wantDirs)
+	}
+
+	wantRates := map[string]string{"00:00-08:00": "unlimited", "08:00-18:00": "2MB"}
+	if rates := config.RateSchedule(); !maps.Equal(rates, wantRates) {
+		t.Errorf("RateSchedule() = %v, want %v", rates, wantRates)
+	}
+
+	hosts, err := config.PerHostConcurrency()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHosts := map[string]int{"cdn.example.com": 32, "*.amazonaws.com": 8}
+	if !maps.Equal(hosts, wantHosts) {
+		t.Errorf("PerHostConcurrency() = %v, want %v", hosts, wantHosts)
+	}
+}
+
+func TestTOMLConfig(t *testing.T) {
+	loadConfig(t, "config.toml", tomlConfig)
+	checkSettings(t)
+}
+
+func TestYAMLConfig(t *testing.T) {
+	loadConfig(t, "config.yml", yamlConfig)
+	checkSettings(t)
+}
+
+func TestSetHostConcurrencyRoundTrip(t *testing.T) {
+	for _, tc := range []struct{ name, content string }{
+		{"config.toml", tomlConfig},
+		{"config.yaml", yamlConfig},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := loadConfig(t, tc.name, tc.content)
+			if err := config.SetHostConcurrency(path, "cdn.example.com", 4); err != nil {
+				t.Fatal(err)
+			}
+			if err := config.SetHostConcurrency(path, "Mirror.Example.org", 2); err != nil {
+				t.Fatal(err)
+			}
+
+			viper.Reset()
+			if err := config.Init(path); err != nil {
+				t.Fatal(err)
+			}
+			hosts, err := config.PerHostConcurrency()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]int{"cdn.example.com": 4, "*.amazonaws.com": 8, "mirror.example.org": 2}
+			if !maps.Equal(hosts, want) {
+				t.Errorf("PerHostConcurrency() = %v, want %v", hosts, want)
+			}
+			// The other settings and the comment survive the edit.
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(data), "# gdl configuration") {
+				t.Errorf("the leading comment was lost:\n%s", data)
+			}
+			if rates := config.RateSchedule(); len(rates) != 2 {
+				t.Errorf("RateSchedule() = %v after the edit", rates)
+			}
+		})
+	}
+}
+
+func TestSetHostConcurrencyNewFile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	path := filepath.Join(t.TempDir(), "gdl", "config.toml")
+	if err := config.SetHostConcurrency(path, "example.com", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Init(path); err != nil {
+		t.Fatal(err)
+	}
+	if hosts, err := config.PerHostConcurrency(); err != nil || hosts["example.com"] != 3 {
+		t.Errorf("PerHostConcurrency() = %v, %v; want example.com: 3", hosts, err)
+	}
+}
+
+func TestTemplatesParse(t *testing.T) {
+	for _, format := range []string{"yaml", "toml"} {
+		tmpl, err := config.Template(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := viper.New()
+		v.SetConfigType(format)
+		if err := v.ReadConfig(strings.NewReader(tmpl)); err != nil {
+			t.Errorf("%s template: %v", format, err)
+		}
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for path, want := range map[string]string{
+		"config.yaml":   "yaml",
+		"config.YML":    "yaml",
+		"/etc/gdl.toml": "toml",
+		"config.json":   "",
+		"config":        "",
+	} {
+		got, err := config.FormatOf(path)
+		if got != want || (err != nil) != (want == "") {
+			t.Errorf("FormatOf(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+}
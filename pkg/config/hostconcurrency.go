@@ -0,0 +1,179 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// KeyPerHostConcurrency maps hostnames, or "*.suffix" wildcards, to the
+// number of connections used for downloads from them.
+const KeyPerHostConcurrency = "per_host_concurrency"
+
+// PerHostConcurrency returns the mapping stored under KeyPerHostConcurrency.
+func PerHostConcurrency() (map[string]int, error) {
+	hosts := make(map[string]int)
+	for host, v := range viper.GetStringMapString(KeyPerHostConcurrency) {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%s: invalid concurrency %q for %s", KeyPerHostConcurrency, v, host)
+		}
+		hosts[host] = n
+	}
+	return hosts, nil
+}
+
+// SetHostConcurrency adds host, or replaces it, under KeyPerHostConcurrency
+// in the config file at path, which is created if it doesn't exist. The
+// rest of the file keeps its settings and comments.
+func SetHostConcurrency(path, host string, n int) error {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	host = strings.ToLower(host)
+	if format == "toml" {
+		data = setTOMLKey(data, KeyPerHostConcurrency, host, n)
+	} else if data, err = setYAMLKey(data, KeyPerHostConcurrency, host, n); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+
+	// Make sure the edit reads back as intended before saving it.
+	v := viper.New()
+	v.SetConfigType(format)
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	if got := v.GetStringMapString(KeyPerHostConcurrency)[host]; got != strconv.Itoa(n) {
+		return fmt.Errorf("config %s: could not set %s for %s, edit the file by hand", path, KeyPerHostConcurrency, host)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// setYAMLKey sets key.sub to n in a YAML document.
+func setYAMLKey(data []byte, key, sub string, n int) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(n)}
+	if len(doc.Content) == 0 {
+		// Nothing but comments, which the decoder drops: append instead.
+		section, err := encodeYAML(map[string]map[string]int{key: {sub: n}})
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		return append(data, section...), nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("top level is not a mapping")
+	}
+	table := mappingValue(root, key)
+	if table == nil {
+		table = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, table)
+	} else if table.Kind != yaml.MappingNode {
+		// e.g. "per_host_concurrency:" with nothing under it yet.
+		*table = yaml.Node{Kind: yaml.MappingNode}
+	}
+	if old := mappingValue(table, sub); old != nil {
+		*old = *value
+	} else {
+		table.Content = append(table.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: sub}, value)
+	}
+
+	return encodeYAML(&doc)
+}
+
+// encodeYAML encodes v with the two-space indent of the config template.
+func encodeYAML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	err := enc.Close()
+	return buf.Bytes(), err
+}
+
+// mappingValue returns the value of key in a YAML mapping node, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setTOMLKey sets sub to n in the [key] table of a TOML document, adding
+// the table at the end if there is none. It edits the text line by line so
+// that comments survive.
+func setTOMLKey(data []byte, key, sub string, n int) []byte {
+	entry := strconv.Quote(sub) + " = " + strconv.Itoa(n)
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+
+	start := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "["+key+"]" {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+key+"]", entry)
+		return []byte(strings.Join(lines, "\n") + "\n")
+	}
+
+	last := start // the last key of the table
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		k, _, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k = strings.TrimSpace(k)
+		if unquoted, err := strconv.Unquote(k); err == nil {
+			k = unquoted
+		} else {
+			k = strings.Trim(k, "'")
+		}
+		if strings.EqualFold(k, sub) {
+			lines[i] = entry
+			return []byte(strings.Join(lines, "\n") + "\n")
+		}
+		last = i
+	}
+	lines = append(lines[:last+1], append([]string{entry}, lines[last+1:]...)...)
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
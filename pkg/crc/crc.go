@@ -0,0 +1,47 @@
+package crc
+
+import (
+	"hash/crc32"
+	"io"
+)
+
+// polynomial is CRC-32C, which has hardware support on amd64 and arm64.
+const polynomial = crc32.Castagnoli
+
+var table = crc32.MakeTable(polynomial)
+
+// ChunkCRC is the running CRC-32C of a chunk's bytes. It can continue from
+// a value saved in a state file.
+type ChunkCRC struct {
+	sum uint32
+}
+
+// Resume returns a ChunkCRC that continues from sum.
+func Resume(sum uint32) *ChunkCRC {
+	return &ChunkCRC{sum: sum}
+}
+
+// Write adds p to the checksum.
+func (c *ChunkCRC) Write(p []byte) (int, error) {
+	c.sum = crc32.Update(c.sum, table, p)
+	return len(p), nil
+}
+
+// Sum32 returns the checksum of everything written so far.
+func (c *ChunkCRC) Sum32() uint32 {
+	return c.sum
+}
+
+// Update returns sum extended with p.
+func Update(sum uint32, p []byte) uint32 {
+	return crc32.Update(sum, table, p)
+}
+
+// Range returns the CRC-32C of the n bytes of r at off.
+func Range(r io.ReaderAt, off, n int64) (uint32, error) {
+	c := &ChunkCRC{}
+	if _, err := io.Copy(c, io.NewSectionReader(r, off, n)); err != nil {
+		return 0, err
+	}
+	return c.sum, nil
+}
@@ -0,0 +1,78 @@
+package crc_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"gdl/pkg/crc"
+)
+
+// check is the CRC-32C of "123456789", from RFC 3720.
+const check = 0xE3069283
+
+func TestChunkCRC(t *testing.T) {
+	c := &crc.ChunkCRC{}
+	c.Write([]byte("123456789"))
+	if got := c.Sum32(); got != check {
+		t.Errorf("Sum32() = %#x, want %#x", got, check)
+	}
+	if got := (&crc.ChunkCRC{}).Sum32(); got != 0 {
+		t.Errorf("Sum32() of nothing = %#x, want 0", got)
+	}
+}
+
+func TestResume(t *testing.T) {
+	data := []byte("123456789")
+	for split := 0; split <= len(data); split++ {
+		first := &crc.ChunkCRC{}
+		first.Write(data[:split])
+		// As if the first part's sum was read back from a state file.
+		c := crc.Resume(first.Sum32())
+		c.Write(data[split:])
+		if got := c.Sum32(); got != check {
+			t.Errorf("resumed after %d bytes: Sum32() = %#x, want %#x", split, got, check)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	sum := crc.Update(0, []byte("1234"))
+	sum = crc.Update(sum, []byte("56789"))
+	if sum != check {
+		t.Errorf("Update() = %#x, want %#x", sum, check)
+	}
+}
+
+func TestRange(t *testing.T) {
+	r := bytes.NewReader([]byte("xx123456789yy"))
+	for _, tt := range []struct {
+		name   string
+		off, n int64
+		want   uint32
+	}{
+		{"middle", 2, 9, check},
+		{"empty", 5, 0, 0},
+		{"whole", 0, 13, crc.Update(0, []byte("xx123456789yy"))},
+		// A file shorter than its chunk claims is checked as far as it goes.
+		{"past the end", 11, 10, crc.Update(0, []byte("yy"))},
+	} {
+		got, err := crc.Range(r, tt.off, tt.n)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Range(%d, %d) = %#x, %v; want %#x", tt.name, tt.off, tt.n, got, err, tt.want)
+		}
+	}
+}
+
+// failingReader fails every read.
+type failingReader struct{}
+
+var errRead = errors.New("read failed")
+
+func (failingReader) ReadAt(p []byte, off int64) (int, error) { return 0, errRead }
+
+func TestRangeReadError(t *testing.T) {
+	if _, err := crc.Range(failingReader{}, 0, 10); !errors.Is(err, errRead) {
+		t.Errorf("Range() error = %v, want %v", err, errRead)
+	}
+}
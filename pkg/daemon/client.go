@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Client talks to a running daemon.
+type Client struct {
+	Path string // socket path, SocketPath() if empty
+}
+
+func (c *Client) dial() (net.Conn, error) {
+	path := c.Path
+	if path == "" {
+		path = SocketPath()
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("no daemon running on %s (start one with 'gdl daemon start'): %w", path, err)
+	}
+	return conn, nil
+}
+
+// call sends req and returns the daemon's single response.
+func (c *Client) call(req Request) (*Response, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// Submit queues spec and returns the new job.
+func (c *Client) Submit(spec JobSpec) (*Job, error) {
+	resp, err := c.call(Request{Op: OpSubmit, Job: &spec})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Job, nil
+}
+
+func (c *Client) Status() (*Status, error) {
+	resp, err := c.call(Request{Op: OpStatus})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Status, nil
+}
+
+// Queue returns every job the daemon knows of, oldest first.
+func (c *Client) Queue() ([]*Job, error) {
+	resp, err := c.call(Request{Op: OpQueue})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Jobs, nil
+}
+
+func (c *Client) Stop() error {
+	_, err := c.call(Request{Op: OpStop})
+	return err
+}
+
+// Watch calls fn with job id's state as it changes and returns the final
+// state once the job has finished.
+func (c *Client) Watch(id int, fn func(Job)) (*Job, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(Request{Op: OpWatch, ID: id}); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(conn)
+	var last *Job
+	for {
+		var resp Response
+		if err := dec.Decode(&resp); err == io.EOF {
+			if last == nil || !last.Done() {
+				return last, errors.New("daemon closed the connection")
+			}
+			return last, nil
+		} else if err != nil {
+			return last, err
+		}
+		if resp.Error != "" {
+			return last, errors.New(resp.Error)
+		}
+		last = resp.Job
+		fn(*last)
+	}
+}
@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Ops understood by the daemon.
+const (
+	OpSubmit = "submit" // queue Request.Job
+	OpStatus = "status" // report Response.Status
+	OpQueue  = "queue"  // list all jobs in Response.Jobs
+	OpWatch  = "watch"  // stream Request.ID's progress
+	OpStop   = "stop"   // shut the daemon down
+)
+
+// Job states.
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// JobSpec describes a download to run.
+type JobSpec struct {
+	URL         string              `json:"url"`
+	OutputName  string              `json:"output,omitempty"`
+	OutputDir   string              `json:"dir,omitempty"` // absolute, as the daemon has its own working directory
+	Concurrency int                 `json:"concurrency,omitempty"`
+	Headers     map[string][]string `json:"headers,omitempty"`
+	Priority    int                 `json:"priority,omitempty"` // 1-5, queue.Normal if unset
+}
+
+// Job is a submitted download and how far it has got.
+type Job struct {
+	ID         int       `json:"id"`
+	Spec       JobSpec   `json:"spec"`
+	Status     string    `json:"status"`
+	File       string    `json:"file,omitempty"`
+	Downloaded int64     `json:"downloaded"`
+	Total      int64     `json:"total"`
+	Error      string    `json:"error,omitempty"`
+	Submitted  time.Time `json:"submitted"`
+	Finished   time.Time `json:"finished,omitzero"`
+}
+
+// Done reports whether the job has stopped, successfully or not.
+func (j *Job) Done() bool {
+	return j.Status == StatusDone || j.Status == StatusFailed
+}
+
+// Status describes the daemon itself.
+type Status struct {
+	PID      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	Parallel int       `json:"parallel"`
+	Queued   int       `json:"queued"`
+	Running  int       `json:"running"`
+	Done     int       `json:"done"`
+	Failed   int       `json:"failed"`
+}
+
+// Request is what a client sends over the socket, one per connection. It is
+// answered by one Response, except for OpWatch, which gets a Response per
+// progress event until the job finishes.
+type Request struct {
+	Op  string   `json:"op"`
+	Job *JobSpec `json:"job,omitempty"`
+	ID  int      `json:"id,omitempty"`
+}
+
+type Response struct {
+	Error  string  `json:"error,omitempty"`
+	Job    *Job    `json:"job,omitempty"`
+	Jobs   []*Job  `json:"jobs,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
+
+// Dir returns where the daemon keeps its socket and job history:
+// $XDG_DATA_HOME/gdl, or ~/.local/share/gdl.
+func Dir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "gdl")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "gdl")
+	}
+	return filepath.Join(home, ".local", "share", "gdl")
+}
+
+// SocketPath returns the daemon's socket in Dir.
+func SocketPath() string {
+	return filepath.Join(Dir(), "gdl.sock")
+}
+
+// historyPath returns the job history file in Dir.
+func historyPath() string {
+	return filepath.Join(Dir(), "history.json")
+}
@@ -0,0 +1,336 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gdl/pkg/queue"
+)
+
+// maxHistory is how many finished jobs are kept in the history file.
+const maxHistory = 500
+
+// RunFunc downloads spec, calling progress about once a second, and returns
+// the path of the downloaded file. It must stop when ctx is cancelled.
+type RunFunc func(ctx context.Context, spec JobSpec, progress func(downloaded, total int64)) (string, error)
+
+// Server runs submitted jobs, at most Parallel at a time, highest priority
+// first.
+type Server struct {
+	Path     string // socket path, SocketPath() if empty
+	Parallel int
+	Run      RunFunc
+
+	mu       sync.Mutex
+	jobs     []*Job
+	nextID   int
+	watchers map[int][]chan Job
+	queue    queue.PriorityQueue[*Job] // guarded by mu
+	ready    chan struct{}             // one token per job in queue
+	started  time.Time
+	ctx      context.Context
+	stop     context.CancelFunc
+}
+
+// Serve listens on the socket and runs jobs until a stop request arrives or
+// ctx is cancelled. Running downloads are cancelled, which keeps their state
+// files so they can be resumed.
+func (s *Server) Serve(ctx context.Context) error {
+	if s.Path == "" {
+		s.Path = SocketPath()
+	}
+	if s.Parallel < 1 {
+		s.Parallel = 1
+	}
+	ln, err := listen(s.Path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(s.Path)
+
+	s.ctx, s.stop = context.WithCancel(ctx)
+	defer s.stop()
+	s.started = time.Now()
+	s.watchers = make(map[int][]chan Job)
+	s.ready = make(chan struct{}, 1024)
+	s.loadHistory()
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.Parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.worker()
+		}()
+	}
+
+	go func() {
+		<-s.ctx.Done()
+		ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				break
+			}
+			slog.Warn("daemon accept failed", "error", err)
+			continue
+		}
+		go s.handle(conn)
+	}
+	wg.Wait()
+	s.saveHistory()
+	return nil
+}
+
+// listen opens the socket, replacing a stale one left by a daemon that did
+// not shut down cleanly.
+func listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	os.Remove(path)
+	return net.Listen("unix", path)
+}
+
+func (s *Server) worker() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.ready:
+			s.mu.Lock()
+			job, _ := s.queue.Pop()
+			s.mu.Unlock()
+			s.runJob(job)
+		}
+	}
+}
+
+func (s *Server) runJob(job *Job) {
+	s.update(job, func(j *Job) { j.Status = StatusRunning })
+	file, err := s.Run(s.ctx, job.Spec, func(downloaded, total int64) {
+		s.update(job, func(j *Job) { j.Downloaded, j.Total = downloaded, total })
+	})
+	s.update(job, func(j *Job) {
+		j.File = file
+		j.Finished = time.Now()
+		if err != nil {
+			j.Status, j.Error = StatusFailed, err.Error()
+		} else {
+			j.Status = StatusDone
+			if j.Total > 0 {
+				j.Downloaded = j.Total
+			}
+		}
+	})
+	s.saveHistory()
+}
+
+// update changes job under the lock and sends the result to its watchers.
+func (s *Server) update(job *Job, change func(*Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change(job)
+	for _, ch := range s.watchers[job.ID] {
+		select {
+		case ch <- *job:
+		default: // a slow client skips an event rather than stalling the job
+		}
+	}
+	if job.Done() {
+		for _, ch := range s.watchers[job.ID] {
+			close(ch)
+		}
+		delete(s.watchers, job.ID)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	enc := json.NewEncoder(conn)
+
+	switch req.Op {
+	case OpSubmit:
+		if req.Job == nil || req.Job.URL == "" {
+			enc.Encode(Response{Error: "no URL to download"})
+			return
+		}
+		enc.Encode(Response{Job: s.submit(*req.Job)})
+	case OpStatus:
+		enc.Encode(Response{Status: s.status()})
+	case OpQueue:
+		s.mu.Lock()
+		jobs := make([]*Job, len(s.jobs))
+		for i, j := range s.jobs {
+			c := *j
+			jobs[i] = &c
+		}
+		s.mu.Unlock()
+		enc.Encode(Response{Jobs: jobs})
+	case OpWatch:
+		s.watch(req.ID, enc)
+	case OpStop:
+		enc.Encode(Response{})
+		s.stop()
+	default:
+		enc.Encode(Response{Error: fmt.Sprintf("unknown op %q", req.Op)})
+	}
+}
+
+func (s *Server) submit(spec JobSpec) *Job {
+	s.mu.Lock()
+	s.nextID++
+	job := &Job{ID: s.nextID, Spec: spec, Status: StatusQueued, Total: -1, Submitted: time.Now()}
+	s.jobs = append(s.jobs, job)
+	priority := spec.Priority
+	if priority == 0 {
+		priority = queue.Normal
+	}
+	s.queue.Push(job, priority)
+	c := *job
+	s.mu.Unlock()
+
+	s.ready <- struct{}{}
+	return &c
+}
+
+func (s *Server) status() *Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &Status{PID: os.Getpid(), Started: s.started, Parallel: s.Parallel}
+	for _, j := range s.jobs {
+		switch j.Status {
+		case StatusQueued:
+			st.Queued++
+		case StatusRunning:
+			st.Running++
+		case StatusDone:
+			st.Done++
+		case StatusFailed:
+			st.Failed++
+		}
+	}
+	return st
+}
+
+// watch sends job id's state now and on every change until it finishes or
+// the client goes away.
+func (s *Server) watch(id int, enc *json.Encoder) {
+	s.mu.Lock()
+	var job *Job
+	for _, j := range s.jobs {
+		if j.ID == id {
+			job = j
+		}
+	}
+	if job == nil {
+		s.mu.Unlock()
+		enc.Encode(Response{Error: fmt.Sprintf("no job %d", id)})
+		return
+	}
+	current := *job
+	var ch chan Job
+	if !job.Done() {
+		ch = make(chan Job, 16)
+		s.watchers[id] = append(s.watchers[id], ch)
+	}
+	s.mu.Unlock()
+
+	if enc.Encode(Response{Job: &current}) != nil || ch == nil {
+		s.unwatch(id, ch)
+		return
+	}
+	for {
+		select {
+		case j, ok := <-ch:
+			if !ok {
+				// Events may have been skipped; the final state must not be.
+				s.mu.Lock()
+				final := *job
+				s.mu.Unlock()
+				enc.Encode(Response{Job: &final})
+				return
+			}
+			if enc.Encode(Response{Job: &j}) != nil {
+				s.unwatch(id, ch)
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Server) unwatch(id int, ch chan Job) {
+	if ch == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chans := s.watchers[id]
+	for i, c := range chans {
+		if c == ch {
+			s.watchers[id] = append(chans[:i], chans[i+1:]...)
+			break
+		}
+	}
+}
+
+// loadHistory restores earlier jobs. Ones that were still queued or running
+// when the last daemon stopped are marked failed; resubmitting them resumes
+// from their state files.
+func (s *Server) loadHistory() {
+	data, err := os.ReadFile(historyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var jobs []*Job
+	if err == nil {
+		err = json.Unmarshal(data, &jobs)
+	}
+	if err != nil {
+		slog.Warn("could not read daemon history", "error", err)
+		return
+	}
+	for _, j := range jobs {
+		if !j.Done() {
+			j.Status, j.Error = StatusFailed, "interrupted: the daemon stopped"
+		}
+		s.nextID = max(s.nextID, j.ID)
+	}
+	s.jobs = jobs
+}
+
+func (s *Server) saveHistory() {
+	s.mu.Lock()
+	jobs := s.jobs
+	if len(jobs) > maxHistory {
+		jobs = jobs[len(jobs)-maxHistory:]
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	s.mu.Unlock()
+	if err == nil {
+		err = os.WriteFile(historyPath(), data, 0600)
+	}
+	if err != nil {
+		slog.Warn("could not save daemon history", "error", err)
+	}
+}
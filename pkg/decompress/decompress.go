@@ -0,0 +1,75 @@
+package decompress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// formats lists the recognised compression formats by magic bytes and the
+// file extension they usually carry.
+var formats = []struct {
+	name  string
+	magic []byte
+	ext   string
+}{
+	{"gzip", []byte{0x1f, 0x8b}, ".gz"},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}, ".zst"},
+	{"bzip2", []byte{0x42, 0x5a, 0x68}, ".bz2"},
+}
+
+// Detect returns the compression format that header starts with, or "" if
+// it is not compressed in a recognised format.
+func Detect(header []byte) string {
+	for _, f := range formats {
+		if bytes.HasPrefix(header, f.magic) {
+			return f.name
+		}
+	}
+	return ""
+}
+
+// NewReader returns a reader of the decompressed bytes of r and the format
+// detected from its magic bytes. If r is not compressed, its bytes are
+// returned unchanged and format is "".
+func NewReader(r io.Reader) (rc io.ReadCloser, format string, err error) {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(4)
+	switch format = Detect(header); format {
+	case "gzip":
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, format, err
+		}
+		return zr, format, nil
+	case "zstd":
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, format, err
+		}
+		return zr.IOReadCloser(), format, nil
+	case "bzip2":
+		return io.NopCloser(bzip2.NewReader(br)), format, nil
+	}
+	return io.NopCloser(br), "", nil
+}
+
+// StripExt removes a compression extension (.gz, .zst, .bz2) from name. A
+// .tgz becomes .tar.
+func StripExt(name string) string {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".tgz") {
+		return name[:len(name)-len(".tgz")] + ".tar"
+	}
+	for _, f := range formats {
+		if strings.HasSuffix(lower, f.ext) {
+			return name[:len(name)-len(f.ext)]
+		}
+	}
+	return name
+}
@@ -0,0 +1,257 @@
+package diag
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/useragent"
+)
+
+// Status is the outcome of a single check.
+type Status int
+
+const (
+	Pass Status = iota
+	Warn
+	Fail
+	Skip
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "PASS"
+	case Warn:
+		return "WARN"
+	case Fail:
+		return "FAIL"
+	default:
+		return "SKIP"
+	}
+}
+
+// Check is one line of the report card.
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// DiagReport collects the checks run against a URL.
+type DiagReport struct {
+	URL    string
+	Checks []Check
+}
+
+// Failed reports whether any check failed.
+func (r DiagReport) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *DiagReport) add(name string, status Status, format string, a ...any) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: status, Detail: fmt.Sprintf(format, a...)})
+}
+
+const (
+	checkTimeout = 30 * time.Second
+	// speedSample is how much the throughput check downloads.
+	speedSample = 8 << 20
+	// certWarnWindow is how close to expiry a certificate is flagged.
+	certWarnWindow = 14 * 24 * time.Hour
+)
+
+// RunDiagnostics checks how url's server handles the requests gdl relies on:
+// HEAD, single-byte and out-of-range Range requests, sustained throughput and
+// the TLS certificate.
+func RunDiagnostics(d *downloader.Downloader, url string) DiagReport {
+	r := DiagReport{URL: url}
+	c := checker{d: d, url: url}
+
+	size := int64(-1)
+	resp, err := c.do("HEAD", "")
+	switch {
+	case err != nil:
+		r.add("HEAD", Fail, "%v", err)
+	case resp.StatusCode != http.StatusOK:
+		r.add("HEAD", Fail, "server returned %s", resp.Status)
+	default:
+		size = resp.ContentLength
+		r.add("HEAD", Pass, "%s, Content-Length %d", resp.Status, size)
+		if etag := resp.Header.Get("ETag"); etag == "" && resp.Header.Get("Last-Modified") == "" {
+			r.add("Validators", Warn, "no ETag or Last-Modified; changes can't be detected on resume")
+		} else {
+			r.add("Validators", Pass, "ETag %q, Last-Modified %q", etag, resp.Header.Get("Last-Modified"))
+		}
+		if size < 0 {
+			r.add("Content-Length", Warn, "unknown size; gdl falls back to a single connection")
+		}
+	}
+	c.checkTLS(&r, resp)
+
+	c.checkRange(&r, "Range 0-0", 0)
+	c.checkRange(&r, "Range 1-1", 1)
+
+	if size < 0 {
+		r.add("Range past end", Skip, "size unknown")
+	} else if resp, err := c.do("GET", fmt.Sprintf("bytes=%d-", size)); err != nil {
+		r.add("Range past end", Fail, "%v", err)
+	} else if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		r.add("Range past end", Pass, "%s", resp.Status)
+	} else {
+		r.add("Range past end", Warn, "expected 416, server returned %s", resp.Status)
+	}
+
+	c.checkSpeed(&r, size)
+	return r
+}
+
+type checker struct {
+	d   *downloader.Downloader
+	url string
+}
+
+// do sends a request and reads at most a few bytes of the body.
+func (c checker) do(method, rangeHeader string) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	req, err := c.newRequest(ctx, method, rangeHeader)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.d.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.CopyN(io.Discard, resp.Body, 64)
+	return resp, nil
+}
+
+func (c checker) newRequest(ctx context.Context, method, rangeHeader string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", useragent.Default)
+	for k, vs := range c.d.GlobalHeaders {
+		req.Header[k] = vs
+	}
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	return req, nil
+}
+
+// checkRange asks for the single byte at off and checks the server answers
+// with exactly that byte.
+func (c checker) checkRange(r *DiagReport, name string, off int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("bytes=%d-%d", off, off))
+	if err != nil {
+		r.add(name, Fail, "%v", err)
+		return
+	}
+	resp, err := c.d.Client.Do(req)
+	if err != nil {
+		r.add(name, Fail, "%v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		r.add(name, Fail, "Range ignored (200 OK); only single-connection downloads will work")
+		return
+	default:
+		r.add(name, Fail, "server returned %s", resp.Status)
+		return
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 2))
+	want := fmt.Sprintf("bytes %d-%d/", off, off)
+	cr := resp.Header.Get("Content-Range")
+	if !strings.HasPrefix(cr, want) || len(body) != 1 {
+		r.add(name, Fail, "got Content-Range %q and %d bytes, want %q and 1 byte", cr, len(body), want+"*")
+		return
+	}
+	r.add(name, Pass, "Content-Range %s", cr)
+}
+
+// checkSpeed times a download of up to speedSample bytes.
+func (c checker) checkSpeed(r *DiagReport, size int64) {
+	const name = "Throughput"
+	n := int64(speedSample)
+	if size >= 0 && size < n {
+		n = size
+	}
+	if n == 0 {
+		r.add(name, Skip, "empty file")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("bytes=0-%d", n-1))
+	if err != nil {
+		r.add(name, Fail, "%v", err)
+		return
+	}
+	start := time.Now()
+	resp, err := c.d.Client.Do(req)
+	if err != nil {
+		r.add(name, Fail, "%v", err)
+		return
+	}
+	defer resp.Body.Close()
+	got, err := io.Copy(io.Discard, io.LimitReader(resp.Body, n))
+	elapsed := time.Since(start)
+	if got == 0 {
+		r.add(name, Fail, "no data received: %v", err)
+		return
+	}
+
+	rate := float64(got) / elapsed.Seconds()
+	status := Pass
+	if err != nil {
+		status = Warn
+	}
+	r.add(name, status, "%d bytes in %s (%.2f MiB/s, one connection)", got, elapsed.Round(time.Millisecond), rate/(1<<20))
+}
+
+// checkTLS reports on the certificate seen by the HEAD request.
+func (c checker) checkTLS(r *DiagReport, resp *http.Response) {
+	const name = "TLS certificate"
+	if !strings.HasPrefix(strings.ToLower(c.url), "https://") {
+		r.add(name, Skip, "not an https URL")
+		return
+	}
+	if resp == nil || resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		r.add(name, Fail, "no certificate seen (see HEAD)")
+		return
+	}
+
+	cert := resp.TLS.PeerCertificates[0]
+	left := time.Until(cert.NotAfter)
+	detail := fmt.Sprintf("%s, %s, expires %s", cert.Subject.CommonName, tls.VersionName(resp.TLS.Version), cert.NotAfter.Format(time.DateOnly))
+	switch {
+	case left <= 0:
+		r.add(name, Fail, "%s (expired)", detail)
+	case left < certWarnWindow:
+		r.add(name, Warn, "%s (in %d days)", detail, int(left.Hours()/24))
+	default:
+		r.add(name, Pass, "%s", detail)
+	}
+}
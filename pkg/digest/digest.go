@@ -0,0 +1,96 @@
+// Package digest names the hash algorithms gdl checksums files with.
+package digest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+)
+
+var algorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+}
+
+// Names lists the algorithms NewHash accepts.
+const Names = "md5, sha1, sha256, sha512 or crc32"
+
+// labels are how sums are labelled when printed.
+var labels = map[string]string{
+	"md5":    "MD5",
+	"sha1":   "SHA-1",
+	"sha256": "SHA-256",
+	"sha512": "SHA-512",
+	"crc32":  "CRC-32",
+}
+
+// Label returns the printed name of algorithm, e.g. "SHA-256" for
+// "sha256".
+func Label(algorithm string) string {
+	if algo, err := Normalize(algorithm); err == nil {
+		return labels[algo]
+	}
+	return algorithm
+}
+
+// Normalize returns the canonical name of algorithm: lower case, without
+// dashes, so "SHA-256" is "sha256". It is an error if the algorithm isn't
+// known.
+func Normalize(algorithm string) (string, error) {
+	algo := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(algorithm)), "-", "")
+	if _, ok := algorithms[algo]; !ok {
+		return "", fmt.Errorf("invalid checksum algorithm %q (want %s)", algorithm, Names)
+	}
+	return algo, nil
+}
+
+// New returns the constructor of algorithm's hash, named as for Normalize.
+func New(algorithm string) (func() hash.Hash, error) {
+	algo, err := Normalize(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return algorithms[algo], nil
+}
+
+// NewHash returns a new hash for algorithm, named as for Normalize.
+func NewHash(algorithm string) (hash.Hash, error) {
+	newHash, err := New(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return newHash(), nil
+}
+
+// ParseChecksum reads an expected checksum written "algorithm:hex", e.g.
+// "sha1:2fd4e1c6...". A bare hex value is taken as defaultAlgorithm or, if
+// that is empty, as MD5, which is what older checksum lists give.
+func ParseChecksum(s, defaultAlgorithm string) (algorithm string, sum []byte, err error) {
+	algorithm, value, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		algorithm, value = defaultAlgorithm, algorithm
+		if algorithm == "" {
+			algorithm = "md5"
+		}
+	}
+	if algorithm, err = Normalize(algorithm); err != nil {
+		return "", nil, err
+	}
+	sum, err = hex.DecodeString(value)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid checksum %q: not hex", s)
+	}
+	if want := algorithms[algorithm]().Size(); len(sum) != want {
+		return "", nil, fmt.Errorf("invalid %s checksum %q: want %d hex digits", algorithm, value, 2*want)
+	}
+	return algorithm, sum, nil
+}
@@ -0,0 +1,66 @@
+package digest_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"gdl/pkg/digest"
+)
+
+func TestParseChecksum(t *testing.T) {
+	md5Hex := strings.Repeat("ab", 16)
+	sha256Hex := strings.Repeat("cd", 32)
+	for _, tc := range []struct {
+		s, defaultAlgorithm string
+		wantAlgo, wantHex   string
+	}{
+		{"sha256:" + sha256Hex, "", "sha256", sha256Hex},
+		{"SHA-256:" + sha256Hex, "md5", "sha256", sha256Hex},
+		{md5Hex, "", "md5", md5Hex},
+		{" " + md5Hex + "\n", "", "md5", md5Hex},
+		// Bare hex takes --checksum-algorithm rather than MD5.
+		{sha256Hex, "sha256", "sha256", sha256Hex},
+		{"deadbeef", "crc32", "crc32", "deadbeef"},
+	} {
+		algo, sum, err := digest.ParseChecksum(tc.s, tc.defaultAlgorithm)
+		if err != nil {
+			t.Errorf("ParseChecksum(%q, %q): %v", tc.s, tc.defaultAlgorithm, err)
+			continue
+		}
+		if algo != tc.wantAlgo || hex.EncodeToString(sum) != tc.wantHex {
+			t.Errorf("ParseChecksum(%q, %q) = %s:%x, want %s:%s", tc.s, tc.defaultAlgorithm, algo, sum, tc.wantAlgo, tc.wantHex)
+		}
+	}
+}
+
+func TestParseChecksumErrors(t *testing.T) {
+	for _, tc := range []struct{ s, defaultAlgorithm string }{
+		{strings.Repeat("cd", 32), ""},           // bare sha256 taken as MD5
+		{strings.Repeat("ab", 16), "sha256"},     // bare MD5 taken as SHA-256
+		{"sha3:" + strings.Repeat("ab", 32), ""}, // unknown algorithm
+		{"sha1:not-hex", ""},
+	} {
+		if algo, _, err := digest.ParseChecksum(tc.s, tc.defaultAlgorithm); err == nil {
+			t.Errorf("ParseChecksum(%q, %q) = %s, want an error", tc.s, tc.defaultAlgorithm, algo)
+		}
+	}
+}
+
+func TestNewHash(t *testing.T) {
+	for algo, size := range map[string]int{"md5": 16, "SHA1": 20, "sha-256": 32, "sha512": 64, "crc32": 4} {
+		h, err := digest.NewHash(algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Size() != size {
+			t.Errorf("NewHash(%q).Size() = %d, want %d", algo, h.Size(), size)
+		}
+	}
+	if _, err := digest.New("blake3"); err == nil {
+		t.Error("New(blake3) succeeded")
+	}
+	if got := digest.Label("sha-512"); got != "SHA-512" {
+		t.Errorf(`Label("sha-512") = %q`, got)
+	}
+}
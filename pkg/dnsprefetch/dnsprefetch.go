@@ -0,0 +1,93 @@
+// Package dnsprefetch resolves hostnames ahead of time so that a batch
+// learns about DNS failures up front and its downloads skip the lookups.
+package dnsprefetch
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// lookups is how many hostnames PrefetchAll resolves at the same time.
+const lookups = 16
+
+// timeout bounds each lookup.
+const timeout = 10 * time.Second
+
+// DialFunc matches http.Transport.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// PrefetchAll looks up the addresses of hostnames concurrently. It returns
+// the addresses of those that resolved and an error for each that didn't.
+// Duplicates and IP addresses are skipped.
+func PrefetchAll(hostnames []string) (map[string][]string, []error) {
+	var (
+		mu    sync.Mutex
+		addrs = make(map[string][]string)
+		errs  []error
+		wg    sync.WaitGroup
+	)
+	seen := make(map[string]bool)
+	sem := make(chan struct{}, lookups)
+	for _, host := range hostnames {
+		if host == "" || seen[host] || net.ParseIP(host) != nil {
+			continue
+		}
+		seen[host] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			ips, err := net.DefaultResolver.LookupHost(ctx, host)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			addrs[host] = ips
+		}()
+	}
+	wg.Wait()
+	return addrs, errs
+}
+
+// Resolver dials hosts at addresses looked up earlier, e.g. by PrefetchAll.
+// Requests keep using the hostname, so Host and SNI are unchanged.
+type Resolver struct {
+	addrs map[string][]string
+}
+
+// NewResolver returns a Resolver for addrs, a map of hostname to addresses.
+func NewResolver(addrs map[string][]string) *Resolver {
+	return &Resolver{addrs: addrs}
+}
+
+// DialContext wraps dial so that connections to a known host go to its
+// addresses in turn until one answers. Other hosts are dialed as before.
+func (r *Resolver) DialContext(dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		ips := r.addrs[host]
+		if err != nil || len(ips) == 0 {
+			return dial(ctx, network, addr)
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, lastErr
+	}
+}
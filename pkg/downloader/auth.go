@@ -0,0 +1,54 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+)
+
+// AuthProvider supplies credentials for the requests of a download, such as
+// an OAuth2 access token that it renews when it expires.
+type AuthProvider interface {
+	// Authorization returns the value of the Authorization header.
+	Authorization(ctx context.Context) (string, error)
+}
+
+type authKey struct{}
+
+// authScope is an AuthProvider limited to one host.
+type authScope struct {
+	provider AuthProvider
+	host     string
+}
+
+// withAuth returns a context whose requests to rawURL's host get p's
+// Authorization header. Other hosts, such as the storage a download
+// redirects to, don't get the credentials.
+func withAuth(ctx context.Context, p AuthProvider, rawURL string) context.Context {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, authKey{}, authScope{provider: p, host: u.Host})
+}
+
+// authTransport adds the Authorization header of the request context's
+// AuthProvider, unless the request already has one.
+type authTransport struct {
+	Base http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	scope, ok := req.Context().Value(authKey{}).(authScope)
+	if !ok || req.URL.Host != scope.host || req.Header.Get("Authorization") != "" {
+		return t.Base.RoundTrip(req)
+	}
+	auth, err := scope.provider.Authorization(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("getting credentials: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", auth)
+	return t.Base.RoundTrip(req)
+}
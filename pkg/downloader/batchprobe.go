@@ -0,0 +1,43 @@
+package downloader
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// BatchProbe probes the URLs of configs, at most parallel at a time, with
+// the headers each download would send. With WithProbeCache the downloads
+// that follow reuse the results instead of probing one by one. The results
+// are in the order of configs; a config whose URL isn't plain HTTP(S), such
+// as a magnet link, is skipped and gets a zero FileInfo and a nil error.
+func BatchProbe(ctx context.Context, d *Downloader, configs []DownloadConfig, parallel int) ([]FileInfo, []error) {
+	infos := make([]FileInfo, len(configs))
+	errs := make([]error, len(configs))
+	sem := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+	for i, cfg := range configs {
+		if u, err := url.Parse(cfg.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			info, _, err := d.probeWithFallback(ctx, cfg.Url, mergeHeaders(d.GlobalHeaders, cfg.Headers), cfg.BrowserMode)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			infos[i] = *info
+		}()
+	}
+	wg.Wait()
+	return infos, errs
+}
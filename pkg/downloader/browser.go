@@ -0,0 +1,89 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"gdl/pkg/useragent"
+)
+
+// probeWithFallback probes url and, when the server answers 403, retries with
+// the browser profiles from useragent.Profiles. If the 403 page looks like a
+// bot-detection challenge the full browser header set is sent, otherwise only
+// the User-Agent is rotated. It returns the headers that worked so chunk
+// requests use the same identity.
+func (d *Downloader) probeWithFallback(ctx context.Context, url string, headers http.Header, browserMode bool) (*FileInfo, http.Header, error) {
+	if browserMode {
+		headers = mergeHeaders(headerFromMap(useragent.BrowserHeaders(useragent.Profiles[0], url)), headers)
+	}
+
+	info, err := d.ProbeContext(ctx, url, headers)
+	var statusErr *StatusError
+	if browserMode || !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		return info, headers, err
+	}
+
+	challenge := useragent.IsBotChallenge(d.fetchSnippet(ctx, url, headers))
+	for _, p := range useragent.Profiles {
+		extra := useragent.UserAgentOnly(p)
+		if challenge {
+			extra = useragent.BrowserHeaders(p, url)
+		}
+		h := mergeHeaders(headerFromMap(extra), headers)
+		if retryInfo, retryErr := d.ProbeContext(ctx, url, h); retryErr == nil {
+			return retryInfo, h, nil
+		}
+	}
+	return nil, headers, err
+}
+
+// fetchSnippet returns the first few KiB of the response body for url.
+func (d *Downloader) fetchSnippet(ctx context.Context, url string, headers http.Header) []byte {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Range", "bytes=0-4095")
+	req.Header.Set("User-Agent", useragent.Default)
+	setHeaders(req, headers)
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return body
+}
+
+// mergeHeaders returns base with override applied on top. A key present in
+// override replaces all of its values in base.
+func mergeHeaders(base, override http.Header) http.Header {
+	h := base.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	for k, vs := range override {
+		h[http.CanonicalHeaderKey(k)] = append([]string(nil), vs...)
+	}
+	return h
+}
+
+func headerFromMap(m map[string]string) http.Header {
+	h := make(http.Header, len(m))
+	for k, v := range m {
+		h.Set(k, v)
+	}
+	return h
+}
+
+// setHeaders replaces the request headers named in h.
+func setHeaders(req *http.Request, h http.Header) {
+	for k, vs := range h {
+		req.Header.Del(k)
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+}
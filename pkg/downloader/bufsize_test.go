@@ -0,0 +1,55 @@
+package downloader_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"gdl/pkg/adaptivebuf"
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+)
+
+// discardSink is a DownloadConfig.Sink that throws the chunks away, so the
+// disk doesn't get in the way of measuring the network side.
+type discardSink struct{}
+
+func (discardSink) WriteAt(p []byte, off int64) (int, error) { return len(p), nil }
+
+// BenchmarkBufferSize downloads 256 MiB from a loopback server with fixed
+// read buffers of several sizes and with the default adaptive one, e.g.
+//
+//	go test -run x -bench BufferSize ./pkg/downloader
+func BenchmarkBufferSize(b *testing.B) {
+	const size = 256 << 20
+	srv := testserver.NewTestServer(b, make([]byte, size))
+	for _, bc := range []struct {
+		name     string
+		min, max int
+	}{
+		{"fixed-32KiB", 32 << 10, 32 << 10},
+		{"fixed-256KiB", 256 << 10, 256 << 10},
+		{"fixed-1MiB", 1 << 20, 1 << 20},
+		{"fixed-4MiB", 4 << 20, 4 << 20},
+		{fmt.Sprintf("adaptive-%dKiB-%dMiB", adaptivebuf.DefaultMin>>10, adaptivebuf.DefaultMax>>20), 0, 0},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(size)
+			for range b.N {
+				cfg := downloader.DownloadConfig{
+					Url:         srv.FileURL("data.bin"),
+					Concurrency: 1,
+					Quiet:       true,
+					MinBufSize:  bc.min,
+					MaxBufSize:  bc.max,
+					Sink: func(*downloader.FileInfo) (io.WriterAt, error) {
+						return discardSink{}, nil
+					},
+				}
+				if err := downloader.NewDownloader().Download(cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package downloader
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ParseChunkRanges parses chunk boundaries given as "start-end", inclusive
+// byte offsets like an HTTP Range, into chunks ordered by start. The ranges
+// must not overlap; that they cover the whole file is checked once its size
+// is known.
+func ParseChunkRanges(specs []string) ([]*ChunkState, error) {
+	chunks := make([]*ChunkState, 0, len(specs))
+	for _, spec := range specs {
+		first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+		start, err1 := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+		end, err2 := strconv.ParseInt(strings.TrimSpace(last), 10, 64)
+		if !ok || err1 != nil || err2 != nil || start < 0 || end < start {
+			return nil, fmt.Errorf("invalid chunk range %q (want start-end, e.g. 0-1048575)", spec)
+		}
+		chunks = append(chunks, &ChunkState{Start: start, End: end})
+	}
+	slices.SortFunc(chunks, func(a, b *ChunkState) int {
+		return int(min(max(a.Start-b.Start, -1), 1))
+	})
+	for i, c := range chunks {
+		c.ID = i
+		if i > 0 && c.Start <= chunks[i-1].End {
+			return nil, fmt.Errorf("chunk ranges %d-%d and %d-%d overlap", chunks[i-1].Start, chunks[i-1].End, c.Start, c.End)
+		}
+	}
+	return chunks, nil
+}
+
+// checkChunkRanges returns an error unless chunks, as returned by
+// ParseChunkRanges, cover bytes 0 to size-1 with no gaps.
+func checkChunkRanges(chunks []*ChunkState, size int64) error {
+	next := int64(0)
+	for _, c := range chunks {
+		if c.Start != next {
+			return fmt.Errorf("chunk ranges leave bytes %d-%d out", next, c.Start-1)
+		}
+		next = c.End + 1
+	}
+	if next != size {
+		if next < size {
+			return fmt.Errorf("chunk ranges leave bytes %d-%d of the %d-byte file out", next, size-1, size)
+		}
+		return fmt.Errorf("chunk ranges go past the end of the %d-byte file", size)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package downloader
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+)
+
+// ErrCloudflareChallenge means the server answered with Cloudflare's
+// browser check, a JavaScript page that only a real browser gets past.
+// Retrying does not help.
+var ErrCloudflareChallenge = errors.New("this URL is behind Cloudflare's bot protection. Try passing a browser session's cookies with -H \"Cookie: ...\"")
+
+// isCloudflareChallenge reports whether resp is a Cloudflare challenge page
+// rather than the file: a 403 or 503 HTML page with a CF-Ray header.
+func isCloudflareChallenge(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusServiceUnavailable {
+		return false
+	}
+	if resp.Header.Get("Cf-Ray") == "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/html"
+}
+
+// statusError returns the error for a response with an unexpected status.
+func statusError(resp *http.Response) *StatusError {
+	return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, challenge: isCloudflareChallenge(resp)}
+}
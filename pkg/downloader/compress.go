@@ -0,0 +1,43 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"gdl/pkg/compress"
+)
+
+// compressFile replaces the downloaded file name with a compressed copy,
+// named with the format's extension, and returns the new name.
+func compressFile(name string, cfg DownloadConfig) (string, error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return name, err
+	}
+	defer in.Close()
+
+	outName := name + compress.Ext(cfg.Compress)
+	out, err := os.Create(outName)
+	if err != nil {
+		return name, err
+	}
+	zw, err := compress.NewWriter(out, cfg.Compress, cfg.CompressLevel)
+	if err == nil {
+		_, err = io.Copy(zw, in)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(outName)
+		return name, fmt.Errorf("compressing %s: %w", name, err)
+	}
+	in.Close()
+	os.Remove(name)
+	cfg.printf("Compressed %s (%s) to %s\n", name, cfg.Compress, outName)
+	return outName, nil
+}
@@ -0,0 +1,39 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"gdl/pkg/useragent"
+)
+
+// ErrNotModified is returned with DownloadConfig.IfModifiedSince when the
+// server answers 304 Not Modified: the file hasn't changed since then.
+var ErrNotModified = errors.New("file not modified")
+
+// checkModified sends a HEAD request for url with If-Modified-Since set to
+// since and returns ErrNotModified if the server answers 304. Any other
+// answer, including errors, leaves it to the probe that follows. It is a
+// request of its own so the header never reaches the cached probe or the
+// chunk requests, where a 304 would be mistaken for a failure.
+func (d *Downloader) checkModified(ctx context.Context, url string, headers http.Header, since time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", useragent.Default)
+	setHeaders(req, headers)
+	req.Header.Set("If-Modified-Since", since.UTC().Format(http.TimeFormat))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return ErrNotModified
+	}
+	return nil
+}
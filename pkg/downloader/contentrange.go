@@ -0,0 +1,123 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// What to do when a server reports a different file size part way through a
+// download, see DownloadConfig.OnSizeChange.
+const (
+	SizeChangeAbort    = "abort"    // fail, keeping the partial file and state
+	SizeChangeRestart  = "restart"  // throw the partial file away and start over
+	SizeChangeContinue = "continue" // keep going, assuming only the end changed
+)
+
+// ParseSizeChangePolicy checks an --on-size-change value. Empty means
+// SizeChangeRestart.
+func ParseSizeChangePolicy(s string) (string, error) {
+	switch s {
+	case "":
+		return SizeChangeRestart, nil
+	case SizeChangeAbort, SizeChangeRestart, SizeChangeContinue:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown size change policy %q (want abort, restart or continue)", s)
+}
+
+// SizeChangedError means the server now reports a different size for the
+// file than when the download started, so it was most likely replaced.
+type SizeChangedError struct {
+	Old, New int64
+}
+
+func (e *SizeChangedError) Error() string {
+	return fmt.Sprintf("the file on the server changed size from %d to %d bytes since the download started", e.Old, e.New)
+}
+
+// errRangeMismatch means a 206 response holds other bytes than the range
+// requested, as from servers that take "bytes=100-200" for the last 100
+// bytes. Retrying the same server won't help, so it is not retried; the
+// download falls back to a single connection without ranges.
+var errRangeMismatch = errors.New("server sent a different range than requested")
+
+// parseContentRange parses "bytes start-end/total". total is -1 for "*".
+func parseContentRange(header string) (start, end, total int64, err error) {
+	invalid := fmt.Errorf("invalid Content-Range %q", header)
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes ")
+	if !found {
+		return 0, 0, 0, invalid
+	}
+	rng, size, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, 0, invalid
+	}
+	a, b, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, 0, invalid
+	}
+	var err1, err2, err3 error
+	start, err1 = strconv.ParseInt(a, 10, 64)
+	end, err2 = strconv.ParseInt(b, 10, 64)
+	total = -1
+	if size != "*" {
+		total, err3 = strconv.ParseInt(size, 10, 64)
+	}
+	if err1 != nil || err2 != nil || err3 != nil || end < start {
+		return 0, 0, 0, invalid
+	}
+	return start, end, total, nil
+}
+
+// checkContentRange compares a 206 response's Content-Range with the range
+// start-end asked for. It may end early only where the file does. size is
+// the file size the download started with; a negative size skips that
+// check. A missing or malformed header is let through, as some servers
+// send none.
+func checkContentRange(h string, start, end, size int64) error {
+	first, last, total, err := parseContentRange(h)
+	if err != nil {
+		return nil
+	}
+	if first != start || last > end || (last < end && last != total-1) {
+		return fmt.Errorf("%w: asked for bytes %d-%d, got %q", errRangeMismatch, start, end, h)
+	}
+	if size >= 0 && total >= 0 && total != size {
+		return &SizeChangedError{Old: size, New: total}
+	}
+	return nil
+}
+
+// isPermanent reports whether a chunk error is one that retrying, or
+// handing the range to another connection, cannot fix.
+func isPermanent(err error) bool {
+	var sizeChanged *SizeChangedError
+	return errors.Is(err, ErrContentChanged) || errors.Is(err, errRangeMismatch) ||
+		errors.Is(err, ErrCloudflareChallenge) || errors.Is(err, ErrRetryBudgetExhausted) ||
+		errors.As(err, &sizeChanged)
+}
+
+// expectedSize returns the size Content-Range totals are checked against,
+// or -1 once the check has been turned off.
+func (t *transfer) expectedSize() int64 {
+	if t.ignoreSize.Load() {
+		return -1
+	}
+	return t.state.Size
+}
+
+// sizeChanged applies the continue policy to err: it warns once and stops
+// checking sizes, returning true if the request should be made again.
+func (t *transfer) sizeChanged(err error) bool {
+	var sc *SizeChangedError
+	if t.onSizeChange != SizeChangeContinue || !errors.As(err, &sc) {
+		return false
+	}
+	if !t.ignoreSize.Swap(true) {
+		slog.Warn("file size changed on the server, continuing with the original size", "old", sc.Old, "new", sc.New)
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+package downloader_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/splitwriter"
+	"gdl/pkg/testserver"
+)
+
+// requestCount returns how many method requests srv received.
+func requestCount(srv *testserver.TestServer, method string) int {
+	n := 0
+	for _, r := range srv.RequestLog() {
+		if r.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDownloadRangeShiftFallsBack(t *testing.T) {
+	content := testserver.RandomContent(300_000, 30)
+	srv := testserver.NewTestServer(t, content)
+	srv.SetRangeShift(1) // off by one: bytes=100-199 comes back as 101-199
+
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 4)
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(cfg.OutputDir, "data.bin")
+	checkFile(t, path, content)
+	checkNoState(t, path)
+	// The misplaced bytes were refused, and the file came whole in one
+	// request without a Range header.
+	ranges := rangeGETs(srv)
+	if len(ranges) < 2 || ranges[0] == "" || ranges[len(ranges)-1] != "" {
+		t.Errorf("GET ranges = %q, want range requests, then one without a range", ranges)
+	}
+}
+
+func TestDownloadSizeChange(t *testing.T) {
+	content := testserver.RandomContent(300_000, 31)
+	size := int64(len(content))
+
+	for _, tt := range []struct {
+		policy string
+		heads  int  // probes: one more for each restart
+		ok     bool // whether the download succeeds
+	}{
+		{downloader.SizeChangeAbort, 1, false},
+		// The restart finds the size changed again and gives up.
+		{downloader.SizeChangeRestart, 2, false},
+		{downloader.SizeChangeContinue, 1, true},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			srv := testserver.NewTestServer(t, content)
+			// HEAD still reports the old size, ranges the new one.
+			srv.SetReportedSize(size + 1000)
+
+			cfg := quietConfig(t, srv.FileURL("data.bin"), 4)
+			cfg.OnSizeChange = tt.policy
+			err := downloader.NewDownloader().Download(cfg)
+			path := filepath.Join(cfg.OutputDir, "data.bin")
+
+			if tt.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkFile(t, path, content)
+				checkNoState(t, path)
+			} else {
+				var sc *downloader.SizeChangedError
+				if !errors.As(err, &sc) {
+					t.Fatalf("Download() error = %v, want a *SizeChangedError", err)
+				}
+				if sc.Old != size || sc.New != size+1000 {
+					t.Errorf("SizeChangedError = %d to %d, want %d to %d", sc.Old, sc.New, size, size+1000)
+				}
+				// The partial download stays for a later resume.
+				if _, err := os.Stat(path + ".gdl.json"); err != nil {
+					t.Errorf("state file: %v", err)
+				}
+			}
+			if n := requestCount(srv, http.MethodHead); n != tt.heads {
+				t.Errorf("got %d HEAD requests, want %d", n, tt.heads)
+			}
+		})
+	}
+}
+
+func TestResumeAfterSizeChange(t *testing.T) {
+	content := testserver.RandomContent(200_000, 32)
+	for _, tt := range []struct {
+		policy string
+		ok     bool
+	}{
+		{downloader.SizeChangeAbort, false},
+		{downloader.SizeChangeRestart, true},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			srv := testserver.NewTestServer(t, content)
+			cfg := quietConfig(t, srv.FileURL("data.bin"), 2)
+			cfg.OnSizeChange = tt.policy
+			path := filepath.Join(cfg.OutputDir, "data.bin")
+			// A state file left by a download of an older, smaller version.
+			writeFile(t, path, make([]byte, 150_000))
+			state := &downloader.DownloadState{
+				URL:         cfg.Url,
+				File:        path,
+				Size:        150_000,
+				Concurrency: 2,
+				Chunks: []*downloader.ChunkState{
+					{ID: 0, Start: 0, End: 74_999, Downloaded: 75_000},
+					{ID: 1, Start: 75_000, End: 149_999, Downloaded: 25_000},
+				},
+			}
+			if err := state.Save(path + ".gdl.json"); err != nil {
+				t.Fatal(err)
+			}
+
+			err := downloader.NewDownloader().Download(cfg)
+			if tt.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkFile(t, path, content)
+				checkNoState(t, path)
+				return
+			}
+			var sc *downloader.SizeChangedError
+			if !errors.As(err, &sc) || sc.Old != 150_000 || sc.New != int64(len(content)) {
+				t.Fatalf("Download() error = %v, want a size change from 150000 to %d", err, len(content))
+			}
+			if n := len(rangeGETs(srv)); n != 0 {
+				t.Errorf("got %d GET requests after aborting", n)
+			}
+		})
+	}
+}
+
+func TestDownloadRangeShiftFallsBackToSink(t *testing.T) {
+	content := testserver.RandomContent(300_000, 31)
+	srv := testserver.NewTestServer(t, content)
+	srv.SetRangeShift(1)
+
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 4)
+	sink := &memSink{}
+	calls := 0
+	cfg.Sink = func(info *downloader.FileInfo) (io.WriterAt, error) {
+		calls++
+		sink.buf = make([]byte, info.Size)
+		return sink, nil
+	}
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sink.buf, content) {
+		t.Error("sink did not get the file")
+	}
+	// Once for the chunks, then again to start over without ranges.
+	if calls != 2 {
+		t.Errorf("Sink called %d times, want 2", calls)
+	}
+	if entries, _ := os.ReadDir(cfg.OutputDir); len(entries) > 0 {
+		t.Errorf("a sink download wrote to disk: %v", entries)
+	}
+}
+
+func TestDownloadRangeShiftFallsBackToVolumes(t *testing.T) {
+	content := testserver.RandomContent(300_000, 32)
+	srv := testserver.NewTestServer(t, content)
+	srv.SetRangeShift(1)
+
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 4)
+	cfg.SplitSize = 128 << 10
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(cfg.OutputDir, "data.bin")
+	var joined []byte
+	for i := 0; i < 3; i++ {
+		data, err := os.ReadFile(splitwriter.VolumeName(path, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		joined = append(joined, data...)
+	}
+	if !bytes.Equal(joined, content) {
+		t.Error("the volumes don't hold the file")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s was written besides its volumes", path)
+	}
+	checkNoState(t, path)
+}
+
+func TestDownloadUnknownSizeRefusesVolumes(t *testing.T) {
+	srv := testserver.NewTestServer(t, []byte("generated"))
+	srv.SetUnknownSize(true)
+
+	cfg := quietConfig(t, srv.FileURL("feed.xml"), 1)
+	cfg.SplitSize = 4
+	if err := downloader.NewDownloader().Download(cfg); err == nil {
+		t.Fatal("Download() succeeded without a size to split by")
+	}
+}
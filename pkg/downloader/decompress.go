@@ -0,0 +1,52 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"gdl/pkg/decompress"
+)
+
+// decompressFile replaces the downloaded file name with its decompressed
+// contents, named without the compression extension, and returns the new
+// name. Files that are not compressed are left alone.
+func decompressFile(name string, cfg DownloadConfig) (string, error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return name, err
+	}
+	defer in.Close()
+
+	r, format, err := decompress.NewReader(in)
+	if err != nil {
+		return name, fmt.Errorf("decompressing %s: %w", name, err)
+	}
+	defer r.Close()
+	if format == "" {
+		cfg.printf("%s is not compressed, keeping it as is\n", name)
+		return name, nil
+	}
+
+	outName := decompress.StripExt(name)
+	if outName == name {
+		outName = name + ".out"
+	}
+	out, err := os.Create(outName)
+	if err != nil {
+		return name, err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(outName)
+		return name, fmt.Errorf("decompressing %s: %w", name, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(outName)
+		return name, err
+	}
+	in.Close()
+	os.Remove(name)
+	cfg.printf("Decompressed %s (%s) to %s\n", name, format, outName)
+	return outName, nil
+}
@@ -0,0 +1,50 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gdl/pkg/bytesize"
+	"gdl/pkg/filediff"
+)
+
+// diffDownload downloads cfg.Url to a temporary file next to existing,
+// compares the two and reports how they differ, leaving existing as it is.
+// The temporary file is removed afterwards.
+func (d *Downloader) diffDownload(ctx context.Context, cfg DownloadConfig, existing, url string) (*FileInfo, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(existing), "."+filepath.Base(existing)+".*.gdl-diff")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	defer os.Remove(tmp.Name() + ".gdl.json")
+
+	cfg.Url = url
+	cfg.OutputDir = ""
+	cfg.OutputName = tmp.Name()
+	cfg.DiffOnly = false
+	cfg.BeforeDownload = nil // already asked
+	_, info, err := d.download(ctx, cfg)
+	if err != nil {
+		return info, err
+	}
+	info.compared = true
+
+	res := filediff.Compare(existing, tmp.Name())
+	switch {
+	case res.Err != nil:
+		return info, fmt.Errorf("comparing with %s: %w", existing, res.Err)
+	case res.Identical:
+		cfg.printf("%s is identical to the remote file (sha256 %s)\n", existing, res.HashA)
+	case !res.SameSize():
+		cfg.printf("%s differs from the remote file: different sizes, %s locally and %s remotely; first difference at byte %d\n",
+			existing, bytesize.Format(res.SizeA), bytesize.Format(res.SizeB), res.Offset)
+	default:
+		cfg.printf("%s differs from the remote file: same size, different hash (sha256 %s locally, %s remotely); first difference at byte %d\n",
+			existing, res.HashA, res.HashB, res.Offset)
+	}
+	return info, nil
+}
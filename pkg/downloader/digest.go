@@ -0,0 +1,65 @@
+package downloader
+
+import (
+	"encoding/base64"
+	"hash"
+	"net/http"
+	"strings"
+
+	"gdl/pkg/digest"
+)
+
+// digestAlgorithms maps the algorithm names of Digest and Repr-Digest
+// headers to those of package digest, strongest first.
+var digestAlgorithms = []struct {
+	name string
+	algo string
+}{
+	{"sha-512", "sha512"},
+	{"sha-256", "sha256"},
+	{"sha", "sha1"},
+	{"md5", "md5"},
+}
+
+// parseDigests collects the checksums a response advertises in its
+// Content-MD5 (RFC 1864), Digest (RFC 3230) and Repr-Digest (RFC 9530)
+// headers, keyed by lower-case algorithm name.
+func parseDigests(h http.Header) map[string][]byte {
+	digests := make(map[string][]byte)
+	if v := h.Get("Content-MD5"); v != "" {
+		if sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v)); err == nil {
+			digests["md5"] = sum
+		}
+	}
+	for _, key := range []string{"Digest", "Repr-Digest"} {
+		for _, line := range h.Values(key) {
+			for _, entry := range strings.Split(line, ",") {
+				algo, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, ":") // Repr-Digest wraps values in colons
+				if sum, err := base64.StdEncoding.DecodeString(value); err == nil {
+					digests[strings.ToLower(algo)] = sum
+				}
+			}
+		}
+	}
+	if len(digests) == 0 {
+		return nil
+	}
+	return digests
+}
+
+// StrongestDigest returns the strongest of info's advertised checksums,
+// with a constructor for its hash. ok is false if there are none.
+func (info *FileInfo) StrongestDigest() (algo string, sum []byte, newHash func() hash.Hash, ok bool) {
+	for _, a := range digestAlgorithms {
+		if sum, found := info.Digests[a.name]; found {
+			if newHash, err := digest.New(a.algo); err == nil {
+				return a.name, sum, newHash, true
+			}
+		}
+	}
+	return "", nil, nil, false
+}
@@ -0,0 +1,23 @@
+package downloader_test
+
+import (
+	"testing"
+
+	"gdl/pkg/downloader"
+)
+
+func TestStrongestDigest(t *testing.T) {
+	info := &downloader.FileInfo{Digests: map[string][]byte{
+		"md5":     make([]byte, 16),
+		"sha":     make([]byte, 20),
+		"sha-256": make([]byte, 32),
+	}}
+	algo, sum, newHash, ok := info.StrongestDigest()
+	if !ok || algo != "sha-256" || len(sum) != 32 || newHash().Size() != 32 {
+		t.Errorf("StrongestDigest() = %s, %d bytes, ok %v; want sha-256", algo, len(sum), ok)
+	}
+
+	if _, _, _, ok := (&downloader.FileInfo{}).StrongestDigest(); ok {
+		t.Error("StrongestDigest() found a digest in none")
+	}
+}
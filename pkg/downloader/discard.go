@@ -0,0 +1,47 @@
+package downloader
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// IsDiscard reports whether name is the null device: /dev/null, or nul on
+// Windows. Downloads to it are discarded without touching the disk.
+func IsDiscard(name string) bool {
+	return name == "/dev/null" || strings.EqualFold(name, "nul")
+}
+
+// discardFile is the outputFile of a download to the null device.
+type discardFile struct{}
+
+func (discardFile) WriteAt(p []byte, off int64) (int, error) { return len(p), nil }
+
+func (discardFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, errors.New("discarded output can't be read back")
+}
+
+func (discardFile) Close() error { return nil }
+
+// sinkFile is the outputFile of a download to DownloadConfig.Sink.
+type sinkFile struct {
+	io.WriterAt
+}
+
+func (sinkFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, errors.New("output written to a sink can't be read back")
+}
+
+func (sinkFile) Close() error { return nil }
+
+// writeOnly reports whether out can't be read back, so that chunks can't
+// be checked against their CRCs.
+func writeOnly(out outputFile) bool {
+	switch out := out.(type) {
+	case discardFile, sinkFile:
+		return true
+	case *teeFile:
+		return writeOnly(out.outputFile)
+	}
+	return false
+}
@@ -1,23 +1,58 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"mime"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/vbauerster/mpb/v8"
 	"github.com/vbauerster/mpb/v8/decor"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 
 	"sync/atomic"
 
+	"gdl/pkg/adaptivebuf"
+	"gdl/pkg/cdnfailover"
+	"gdl/pkg/chunkmonitor"
+	"gdl/pkg/crc"
+	"gdl/pkg/digest"
+	"gdl/pkg/dnsprefetch"
+	"gdl/pkg/fileutil"
+	"gdl/pkg/hashwriter"
+	"gdl/pkg/hook"
+	"gdl/pkg/hostmatch"
+	"gdl/pkg/ioprofile"
+	"gdl/pkg/kaprobe"
+	"gdl/pkg/mimedirs"
+	"gdl/pkg/pausefile"
+	"gdl/pkg/progressfile"
 	"gdl/pkg/resolver"
+	"gdl/pkg/resolver/magnet"
+	"gdl/pkg/schedule"
+	ftpsource "gdl/pkg/source/ftp"
+	sftpsource "gdl/pkg/source/sftp"
+	"gdl/pkg/splitwriter"
+	"gdl/pkg/statecodec"
+	"gdl/pkg/template"
+	"gdl/pkg/useragent"
+	"gdl/pkg/webdav"
+	"gdl/pkg/workqueue"
 )
 
 type FileInfo struct {
@@ -25,13 +60,60 @@ type FileInfo struct {
 	Name           string
 	Size           int64
 	RangeSupported bool
+	Digests        map[string][]byte // advertised checksums by algorithm, e.g. "sha-256"
+	ContentType    string
+	ETag           string
+	Expires        time.Time // when the URL stops working, if it is signed
+	Mirrors        []string  // other URLs of the file, from Link rel=duplicate headers
+
+	compared bool // DiffOnly compared it with an existing file instead of saving it
+}
+
+// StatusError is returned by Probe when the server answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+
+	challenge bool // the response was a Cloudflare challenge page
+}
+
+func (e *StatusError) Error() string {
+	if e.challenge {
+		return fmt.Sprintf("server returned %s: %v", e.Status, ErrCloudflareChallenge)
+	}
+	return fmt.Sprintf("server returned %s", e.Status)
+}
+
+// Unwrap returns ErrCloudflareChallenge for a Cloudflare challenge page.
+func (e *StatusError) Unwrap() error {
+	if e.challenge {
+		return ErrCloudflareChallenge
+	}
+	return nil
 }
 
 type Downloader struct {
 	Client *http.Client
+	SFTP   sftpsource.Options
+	FTP    ftpsource.Options
+	// GlobalHeaders are sent with every request. DownloadConfig.Headers
+	// override them per key.
+	GlobalHeaders http.Header
+
+	sftpSources sync.Map
+	metrics     *MetricRoundTripper
+	transport   *http.Transport
+	dialer      *net.Dialer
+	cdn         *cdnfailover.Resolver
+	dns         *dnsprefetch.Resolver
+	maxConnAge  time.Duration
+	push        *PushCachingTransport
+	probeCache  *probeCache
+	resolve     map[string]string
+	inflight    singleflight.Group // downloads running, by downloadKey
 }
 
-func NewDownloader() *Downloader {
+func NewDownloader(opts ...DownloaderOption) *Downloader {
 	t := &http.Transport{
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 100,
@@ -40,29 +122,72 @@ func NewDownloader() *Downloader {
 		ForceAttemptHTTP2:   false,
 		TLSNextProto:        make(map[string]func(authority string, c *tls.Conn) http.RoundTripper), // Disable HTTP/2
 	}
-	return &Downloader{
+	metrics := &MetricRoundTripper{Base: t}
+	d := &Downloader{
 		Client: &http.Client{
-			Transport: t,
+			Transport: &authTransport{Base: metrics},
+		},
+		metrics:   metrics,
+		transport: t,
+		dialer: &net.Dialer{
+			Timeout:       30 * time.Second,
+			KeepAlive:     30 * time.Second,
+			FallbackDelay: 300 * time.Millisecond,
 		},
 	}
+	t.DialContext = d.dialContext
+	t.DialTLSContext = d.dialTLSContext
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// EnableCDNFailover makes failed connections retry against the other A/AAAA
+// records of the host instead of the same address.
+func (d *Downloader) EnableCDNFailover() {
+	d.cdn = cdnfailover.New()
 }
 
 // ... Probe and Download methods ...
 
+func (d *Downloader) Probe(url string, headers http.Header) (*FileInfo, error) {
+	return d.ProbeContext(context.Background(), url, headers)
+}
 
-func (d *Downloader) Probe(url string, headers map[string]string) (*FileInfo, error) {
-	req, err := http.NewRequest("HEAD", url, nil)
+// ProbeContext is Probe with a context for the HEAD request.
+func (d *Downloader) ProbeContext(ctx context.Context, url string, headers http.Header) (*FileInfo, error) {
+	if d.probeCache == nil {
+		return d.probe(ctx, url, headers)
+	}
+	if info, ok := d.probeCache.get(url); ok {
+		return info, nil
+	}
+	info, err := d.probe(ctx, url, headers)
 	if err != nil {
 		return nil, err
 	}
-	
-	// Set default User-Agent
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	
-	for k, v := range headers {
-		req.Header.Set(k, v)
+	d.probeCache.put(url, info)
+	return info, nil
+}
+
+func (d *Downloader) probe(ctx context.Context, url string, headers http.Header) (*FileInfo, error) {
+	if ftpsource.IsFTP(url) {
+		return d.probeFTP(url)
+	}
+	if sftpsource.IsSFTP(url) {
+		return d.probeSFTP(url)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return nil, err
 	}
 
+	// Set default User-Agent
+	req.Header.Set("User-Agent", useragent.Default)
+	setHeaders(req, headers)
+
 	resp, err := d.Client.Do(req)
 	if err != nil {
 		return nil, err
@@ -70,194 +195,1164 @@ func (d *Downloader) Probe(url string, headers map[string]string) (*FileInfo, er
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned %s", resp.Status)
+		return nil, statusError(resp)
 	}
 
 	size := resp.ContentLength
 	rangeSupported := resp.Header.Get("Accept-Ranges") == "bytes"
 
 	name := parseFilename(resp.Header.Get("Content-Disposition"), url)
+	expires, _ := signedURLExpiry(url)
 
 	return &FileInfo{
 		Url:            url,
 		Name:           name,
 		Size:           size,
 		RangeSupported: rangeSupported,
+		Digests:        parseDigests(resp.Header),
+		ContentType:    resp.Header.Get("Content-Type"),
+		ETag:           resp.Header.Get("ETag"),
+		Expires:        expires,
+		Mirrors:        linkMirrors(resp.Header, url),
 	}, nil
 }
 
-func parseFilename(contentDisposition, url string) string {
+func parseFilename(contentDisposition, rawUrl string) string {
 	if contentDisposition != "" {
 		_, params, err := mime.ParseMediaType(contentDisposition)
 		if err == nil {
 			if filename, ok := params["filename"]; ok {
-				return filename
+				return sanitizeFilename(filename)
 			}
 		}
 	}
-	return filepath.Base(url)
+
+	// Only the path names the file; query and fragment are often long
+	// tokens that aren't valid in filenames.
+	name := ""
+	if u, err := neturl.Parse(rawUrl); err == nil {
+		name = path.Base(u.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "download"
+	}
+	return sanitizeFilename(name)
+}
+
+// sanitizeFilename replaces characters that are illegal in Windows filenames,
+// and path separators, with underscores.
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		return "download"
+	}
+	return name
 }
 
 type DownloadConfig struct {
 	Url         string
+	Headers     http.Header // Extra request headers for this download
 	Concurrency int
 	OutputName  string
 	OutputDir   string
+	// OutputTemplate builds the filename from tokens such as {domain} and
+	// {date}. It is ignored when OutputName is set.
+	OutputTemplate string
+	OnComplete     string // Shell command run after a successful download
+	OnError        string // Shell command run after a failed download
+	WebDAVUser     string
+	WebDAVPass     string
+	BrowserMode    bool // Send a full browser header set on every request
+	// TorrentDataDir holds partial data for torrents and for magnet links
+	// without an HTTP seed.
+	TorrentDataDir string
+	// NoTorrent saves .torrent files as they are instead of downloading the
+	// torrent they describe.
+	NoTorrent bool
+	// TorrentSeedTime keeps seeding a finished torrent for this long.
+	TorrentSeedTime time.Duration
+	// Quiet disables the progress bar and status messages, for callers
+	// that render their own UI.
+	Quiet bool
+	// OnProgress, if set, is called about once a second during a download,
+	// and once with nothing downloaded as soon as the output file is named,
+	// before it is written to.
+	OnProgress func(file string, downloaded, total int64)
+	// SHA256 computes the file's SHA-256 while it downloads.
+	SHA256 bool
+	// Sparkline shows a graph of the last minute's speed next to the ETA.
+	Sparkline bool
+	// SplitSize, if positive, writes the file as volumes name.001,
+	// name.002, ... of at most this many bytes each.
+	SplitSize int64
+	// SNIHostname, if set, is sent as the TLS server name instead of the
+	// URL's host, e.g. when the URL names a CDN node by IP address.
+	SNIHostname string
+	// SanitizeURL removes analytics parameters such as utm_source and
+	// fbclid from Url before it is used, except those named in KeepParams.
+	SanitizeURL bool
+	KeepParams  []string
+	// AuthProvider, if set, supplies the Authorization header of every
+	// request to Url's host, e.g. an OAuth2 access token.
+	AuthProvider AuthProvider
+	// Priority orders downloads waiting in a batch or in the daemon, from
+	// 1 (background) to 5 (critical); 0 leaves it to the caller's default.
+	// Download itself ignores it.
+	Priority int
+	// URLRefresher returns a new signed URL for Url once the current one
+	// (S3, GCS or Azure SAS) has expired. If nil, Url is resolved again.
+	URLRefresher func(original string) (string, error)
+	// ProfileIO times every write to the output file and prints latency
+	// statistics to stderr when the download finishes.
+	ProfileIO bool
+	// ProgressDir, if set, receives a JSON progress file for the download,
+	// named by a hash of Url and updated about once a second.
+	ProgressDir string
+	// Mirrors serve the same file as Url. Chunks are spread over Url and
+	// all mirrors at once, and a failing chunk moves to the next source.
+	Mirrors []string
+	// RetryWithRange, when a download from a server without range support
+	// fails part way, checks whether a range request from there works after
+	// all and, if so, continues in several chunks instead of failing.
+	RetryWithRange bool
+	// LockWait limits how long to wait for another gdl instance that is
+	// downloading the same file. Zero waits until it is done.
+	LockWait time.Duration
+	// OnSizeChange is what happens when a range response reports a file
+	// size other than the one the download started with: SizeChangeAbort,
+	// SizeChangeRestart (the default) or SizeChangeContinue.
+	OnSizeChange string
+	// Decompress replaces a gzip, zstd or bzip2 file with its contents once
+	// it is downloaded, dropping the compression extension from its name.
+	// Output to stdout is decompressed as it streams.
+	Decompress bool
+	// Compress, "gzip" or "zstd", compresses the file once it is downloaded,
+	// so that an interrupted download can still be resumed, and adds .gz or
+	// .zst to its name. Output to stdout is compressed as it streams.
+	// CompressLevel is the level, 0 for the format's default.
+	Compress      string
+	CompressLevel int
+	// BeforeDownload, if set, is called once the file has been probed and
+	// before any of it is downloaded, e.g. to confirm a costly download. An
+	// error stops the download and is returned.
+	BeforeDownload func(info *FileInfo) error
+	// PipelineDepth, if above 1, fetches each chunk as a series of smaller
+	// range requests with up to this many in flight, so that the next one
+	// is on its way while the current one is received. It works best over
+	// HTTP/2 (see WithHTTP2), where the requests share a connection.
+	PipelineDepth int
+	// UseMirrors adds the mirrors the server advertises in Link
+	// rel=duplicate headers to Mirrors.
+	UseMirrors bool
+	// Extract unpacks a zip, 7z or (compressed) tar archive into OutputDir,
+	// or the directory it was saved in, once it is downloaded.
+	// StripComponents drops that many leading path elements from its
+	// entries.
+	Extract         bool
+	StripComponents int
+	// StateFormat is the format of the .gdl.json state file:
+	// statecodec.JSON (the default) or the more compact statecodec.Proto.
+	// Either is read back, whatever the setting.
+	StateFormat string
+	// OnDone, if set, is called with the name of the file once it has been
+	// downloaded, after any decompressing, extracting and compressing.
+	OnDone func(file string)
+	// DiffOnly leaves an existing output file alone: the download goes to a
+	// temporary file, which is compared with it and removed, and how the
+	// two differ is printed. Without an existing file it downloads as usual.
+	DiffOnly bool
+	// ChunkRanges, from ParseChunkRanges, replaces the even split into
+	// Concurrency chunks with these chunks, one connection each. They
+	// must cover the whole file, and the server must accept ranges.
+	ChunkRanges []*ChunkState
+	// RetryBudget, if positive, caps the retries of all chunks together,
+	// on top of the per-chunk limit, so that many chunks failing at once
+	// don't hammer a struggling server. Once it is spent, failing chunks
+	// give up with ErrRetryBudgetExhausted.
+	RetryBudget int
+	// Sink, if set, is called once the file's size is known and returns
+	// what the chunks are written to, at their offsets, instead of a file.
+	// Nothing is written to disk and there is no state file, so such a
+	// download can't be resumed; nor is it decompressed and the like.
+	Sink func(info *FileInfo) (io.WriterAt, error)
+	// NoClobber refuses to overwrite an existing file, whatever its size
+	// or contents, with an error wrapping ErrFileExists, like wget's
+	// --no-clobber. A partial download with a state file still resumes.
+	NoClobber bool
+	// Warmup opens the connections for the chunks one at a time, 50 ms
+	// apart, before any chunk is requested, for servers that rate-limit a
+	// burst of new connections.
+	Warmup bool
+	// IfModifiedSince, if not zero, first asks the server whether the file
+	// changed since then. If it answers 304 Not Modified, nothing is
+	// downloaded and the error is ErrNotModified.
+	IfModifiedSince time.Time
+	// PostDownloadScript, if not empty, is run through the shell after a
+	// successful download with the file in $GDL_FILE, like OnComplete but
+	// settable per URL in a batch file. Its output is logged at debug level
+	// and a non-zero exit fails the download.
+	PostDownloadScript string
+	// MimeDirs maps MIME types to directories, as for mimedirs.Lookup. If
+	// OutputDir is empty, the file goes to the directory of its
+	// Content-Type, or the current directory if none matches.
+	MimeDirs map[string]string
+	// RateSchedule limits the download speed by the time of day. The rate
+	// is checked every minute, so a long download slows down or speeds up
+	// as it crosses from one range into the next.
+	RateSchedule schedule.RateSchedule
+	// MinBufSize and MaxBufSize bound the read buffer of each chunk, which
+	// starts small and doubles while reads keep filling it. Zero means
+	// 256 KiB and 16 MiB.
+	MinBufSize, MaxBufSize int
+	// PauseFile, if set, pauses the download while that file exists. It is
+	// looked for every PauseInterval (5s if zero).
+	PauseFile     string
+	PauseInterval time.Duration
+	// ChecksumAlgorithm hashes the file while it downloads and prints the
+	// sum: md5, sha1, sha256, sha512 or crc32 (see digest.NewHash). SHA256
+	// is the same as "sha256".
+	ChecksumAlgorithm string
+	// Checksum, if set, is the expected ChecksumAlgorithm sum of the file.
+	// A file that doesn't match fails with ErrChecksumMismatch.
+	Checksum []byte
+	// Tee lists more outputs that get the downloaded bytes as they arrive,
+	// like tee(1): files, which are truncated first, or Unix sockets. A
+	// socket only takes the bytes in order, so the download then uses one
+	// connection.
+	Tee []string
+	// PerHostConcurrency maps hostnames, or "*.suffix" wildcards, to the
+	// Concurrency for downloads whose resolved URL is on that host (see
+	// hostmatch.Lookup). Other hosts use Concurrency.
+	PerHostConcurrency map[string]int
+	// LiveServer, if set, serves the file over HTTP while it downloads, and
+	// the finished file afterwards. This needs the file's size, and a
+	// plain file on disk rather than volumes or a sink.
+	LiveServer *LiveServer
+	// KeepalivePeriod, if positive, sends a one-byte range request to the
+	// server over another connection whenever no bytes have arrived for
+	// this long, for links where idle connections get dropped after 30
+	// to 60 seconds (see kaprobe).
+	KeepalivePeriod time.Duration
+}
+
+// checksumAlgorithm returns the algorithm to hash the download with, or ""
+// for none.
+func (cfg *DownloadConfig) checksumAlgorithm() string {
+	if cfg.ChecksumAlgorithm != "" {
+		return cfg.ChecksumAlgorithm
+	}
+	if cfg.SHA256 || cfg.Checksum != nil {
+		return "sha256"
+	}
+	return ""
+}
+
+// ErrChecksumMismatch is returned when a file doesn't match
+// DownloadConfig.Checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// verifyChecksum compares sum with the expected DownloadConfig.Checksum, if
+// there is one.
+func (cfg *DownloadConfig) verifyChecksum(sum []byte) error {
+	if cfg.Checksum == nil || bytes.Equal(sum, cfg.Checksum) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is %x, expected %x", ErrChecksumMismatch, digest.Label(cfg.checksumAlgorithm()), sum, cfg.Checksum)
+}
+
+func (cfg *DownloadConfig) printf(format string, a ...any) {
+	if cfg.Quiet {
+		return
+	}
+	if cfg.OutputName == StdoutName {
+		// Keep stdout clean for the file contents.
+		fmt.Fprintf(os.Stderr, format, a...)
+		return
+	}
+	fmt.Printf(format, a...)
 }
 
 // ...
 
 func (d *Downloader) Download(cfg DownloadConfig) error {
-	resolvedUrl, headers, err := resolver.Resolve(cfg.Url)
+	return d.DownloadContext(context.Background(), cfg)
+}
+
+// DownloadContext is like Download but stops when ctx is cancelled. The state
+// file is kept in that case, so a later call resumes where it left off.
+//
+// A call for a URL and output that another goroutine is already downloading
+// waits for it. If that download succeeds, the call does nothing; if it
+// fails, the call tries again on its own.
+func (d *Downloader) DownloadContext(ctx context.Context, cfg DownloadConfig) error {
+	if cfg.SanitizeURL {
+		cfg.Url = stripTracking(cfg)
+	}
+	if cfg.OutputName == StdoutName || IsDiscard(cfg.OutputName) {
+		return d.downloadContext(ctx, cfg)
+	}
+	led := false
+	_, err, shared := d.inflight.Do(downloadKey(cfg), func() (any, error) {
+		led = true
+		return nil, d.downloadContext(ctx, cfg)
+	})
+	if !shared || led {
+		return err
+	}
+	if err == nil {
+		slog.Info("download skipped, the same download just finished", "url", cfg.Url)
+		return nil
+	}
+	return d.downloadContext(ctx, cfg)
+}
+
+// downloadKey identifies a download for DownloadContext: its URL and where
+// it is saved.
+func downloadKey(cfg DownloadConfig) string {
+	return cfg.Url + "\x00" + cfg.OutputDir + "\x00" + cfg.OutputName
+}
+
+func (d *Downloader) downloadContext(ctx context.Context, cfg DownloadConfig) error {
+	if cfg.AuthProvider != nil {
+		ctx = withAuth(ctx, cfg.AuthProvider, cfg.Url)
+	}
+	start := time.Now()
+	slog.Info("download started", "url", cfg.Url)
+	var progress *progressfile.Writer
+	if cfg.ProgressDir != "" {
+		progress = progressfile.New(cfg.ProgressDir, cfg.Url)
+		onProgress := cfg.OnProgress
+		cfg.OnProgress = func(file string, downloaded, total int64) {
+			if err := progress.Update(file, downloaded, total); err != nil {
+				slog.Warn("writing progress file failed", "error", err)
+			}
+			if onProgress != nil {
+				onProgress(file, downloaded, total)
+			}
+		}
+	}
+	newBefore, reusedBefore := d.ConnectionStats()
+	fileName, info, err := d.download(ctx, cfg)
+	// Nothing to process when the file went to stdout, a Sink or nowhere,
+	// or was only compared with an existing one.
+	saved := fileName != StdoutName && !IsDiscard(fileName) && cfg.Sink == nil && (info == nil || !info.compared)
+	if err == nil && cfg.Decompress && saved {
+		if cfg.SplitSize > 0 {
+			cfg.printf("Warning: --decompress is ignored with --split-size; merge the volumes first\n")
+		} else {
+			fileName, err = decompressFile(fileName, cfg)
+		}
+	}
+	if err == nil && cfg.Extract && saved {
+		if cfg.SplitSize > 0 {
+			cfg.printf("Warning: --extract is ignored with --split-size; merge the volumes first\n")
+		} else {
+			err = extractFile(fileName, cfg)
+		}
+	}
+	if err == nil && cfg.Compress != "" && saved {
+		if cfg.SplitSize > 0 {
+			cfg.printf("Warning: --compress is ignored with --split-size; merge the volumes first\n")
+		} else {
+			fileName, err = compressFile(fileName, cfg)
+		}
+	}
+	if err == nil && cfg.PostDownloadScript != "" && saved {
+		err = runPostDownloadScript(cfg.PostDownloadScript, fileName, cfg.Url)
+	}
+	if err == nil && cfg.OnDone != nil && saved {
+		cfg.OnDone(fileName)
+	}
+	newAfter, reusedAfter := d.ConnectionStats()
+	slog.Debug(fmt.Sprintf("Connections: %d new, %d reused", newAfter-newBefore, reusedAfter-reusedBefore))
+
+	attrs := []any{"url", cfg.Url, "file", fileName, "duration", time.Since(start)}
+	if info != nil {
+		attrs = append(attrs, "size", info.Size)
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	slog.Info("download finished", attrs...)
+	if progress != nil {
+		if err := progress.Finish(fileName, err); err != nil {
+			slog.Warn("writing progress file failed", "error", err)
+		}
+	}
+
+	d.runHooks(cfg, fileName, info, time.Since(start), err)
+	return err
+}
+
+// runPostDownloadScript runs DownloadConfig.PostDownloadScript for file.
+func runPostDownloadScript(script, file, url string) error {
+	stdout, stderr, err := hook.RunScript(script, []string{"GDL_FILE=" + file, "GDL_URL=" + url})
+	slog.Debug("post-download script finished", "file", file, "stdout", string(stdout), "stderr", string(stderr))
 	if err != nil {
-		fmt.Printf("Warning: Failed to resolve URL %s: %v. Using original.\n", cfg.Url, err)
+		return fmt.Errorf("post-download script: %w", err)
+	}
+	return nil
+}
+
+func (d *Downloader) runHooks(cfg DownloadConfig, fileName string, info *FileInfo, elapsed time.Duration, dlErr error) {
+	command := cfg.OnComplete
+	if dlErr != nil {
+		command = cfg.OnError
+	}
+	if command == "" {
+		return
+	}
+
+	var size int64
+	if info != nil {
+		size = info.Size
+	}
+	env := []string{
+		"GDL_FILE=" + fileName,
+		"GDL_URL=" + cfg.Url,
+		fmt.Sprintf("GDL_SIZE=%d", size),
+		fmt.Sprintf("GDL_DURATION_MS=%d", elapsed.Milliseconds()),
+	}
+	if dlErr != nil {
+		env = append(env, "GDL_ERROR="+dlErr.Error())
+	}
+
+	if err := hook.RunHook(command, env); err != nil {
+		cfg.printf("Warning: hook %q failed: %v\n", command, err)
+	}
+}
+
+func (d *Downloader) download(ctx context.Context, cfg DownloadConfig) (string, *FileInfo, error) {
+	if cfg.SNIHostname != "" {
+		ctx = withSNI(ctx, cfg.SNIHostname)
+	}
+	spin := cfg.spinner("Resolving URL...")
+	defer spin.stop()
+	resolvedUrl, resolvedHeaders, err := resolver.Resolve(cfg.Url, resolver.Options{
+		WebDAVUser:     cfg.WebDAVUser,
+		WebDAVPass:     cfg.WebDAVPass,
+		TorrentDataDir: cfg.TorrentDataDir,
+		HTTP:           d.Client,
+		Headers:        mergeHeaders(d.GlobalHeaders, cfg.Headers),
+	})
+	if errors.Is(err, magnet.ErrNoHTTPSeed) {
+		return d.downloadMagnet(ctx, cfg)
+	}
+	if errors.Is(err, resolver.ErrURLExpired) && cfg.URLRefresher != nil {
+		// Handled below like any other expired signed URL.
+		resolvedUrl, err = cfg.Url, nil
+	}
+	if err != nil && (webdav.IsWebDAV(cfg.Url) || magnet.IsMagnet(cfg.Url) || errors.Is(err, resolver.ErrURLExpired)) {
+		// webdav:// and magnet: URLs can't be fetched as-is, and an expired signed
+		// URL would only get a 403, so there is nothing to fall back to.
+		return "", nil, err
+	} else if err != nil {
+		spin.printf("Warning: Failed to resolve URL %s: %v. Using original.\n", cfg.Url, err)
 		resolvedUrl = cfg.Url
 	} else if resolvedUrl != cfg.Url {
-		fmt.Printf("Resolved URL: %s\n", resolvedUrl)
+		spin.printf("Resolved URL: %s\n", resolvedUrl)
+	}
+	if urlExpired(resolvedUrl) && cfg.URLRefresher != nil {
+		fresh, err := cfg.URLRefresher(cfg.Url)
+		if err != nil {
+			return "", nil, fmt.Errorf("refreshing expired URL: %w", err)
+		}
+		resolvedUrl = fresh
 	}
 
-	info, err := d.Probe(resolvedUrl, headers)
+	// Precedence: global < per-download < resolver (e.g. session cookies)
+	headers := mergeHeaders(mergeHeaders(d.GlobalHeaders, cfg.Headers), headerFromMap(resolvedHeaders))
+
+	if !cfg.IfModifiedSince.IsZero() && !ftpsource.IsFTP(resolvedUrl) && !sftpsource.IsSFTP(resolvedUrl) {
+		if err := d.checkModified(ctx, resolvedUrl, headers, cfg.IfModifiedSince); err != nil {
+			return "", nil, err
+		}
+	}
+	info, headers, err := d.probeWithFallback(ctx, resolvedUrl, headers, cfg.BrowserMode)
+	spin.stop()
 	if err != nil {
-		return err
+		return "", nil, err
+	}
+	if cfg.BeforeDownload != nil {
+		if err := cfg.BeforeDownload(info); err != nil {
+			return "", info, err
+		}
+	}
+
+	// A .torrent file for stdout, the null device or a Sink is passed on
+	// as it is: BitTorrent only saves to files.
+	if !cfg.NoTorrent && cfg.OutputName != StdoutName && !IsDiscard(cfg.OutputName) && cfg.Sink == nil && isTorrentFile(resolvedUrl, info) {
+		return d.downloadTorrentFile(ctx, cfg, resolvedUrl, headers)
 	}
 
-	if !info.RangeSupported {
+	if cfg.OutputName == StdoutName {
+		return StdoutName, info, d.streamTo(ctx, os.Stdout, resolvedUrl, headers, info, cfg)
+	}
+
+	if cfg.UseMirrors && len(info.Mirrors) > 0 {
+		cfg.Mirrors = addMirrors(cfg.Mirrors, info.Mirrors, resolvedUrl)
+		cfg.printf("The server advertises %d mirrors: %s\n", len(info.Mirrors), strings.Join(info.Mirrors, ", "))
+	}
+
+	if u, err := neturl.Parse(resolvedUrl); err == nil {
+		if n, ok := hostmatch.Lookup(u.Hostname(), cfg.PerHostConcurrency); ok {
+			cfg.Concurrency = n
+		}
+	}
+	requestedConcurrency := cfg.Concurrency
+	if !info.RangeSupported || teeStreams(cfg.Tee) {
 		cfg.Concurrency = 1
 	}
 
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = mimedirs.Lookup(info.ContentType, cfg.MimeDirs)
+	}
+
 	fileName := info.Name
 	if cfg.OutputName != "" {
 		fileName = cfg.OutputName
+	} else if cfg.OutputTemplate != "" {
+		fileName = template.ExpandFilename(cfg.OutputTemplate, &template.FileInfo{
+			Url:  cfg.Url,
+			Name: info.Name,
+			Size: info.Size,
+		})
 	}
 
-	if cfg.OutputDir != "" {
-		if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
-			return err
+	// Writing to the null device benchmarks the network alone: nothing is
+	// written, and there is no state file to save or resume from. The same
+	// goes for the disk with a Sink.
+	discard := IsDiscard(fileName) || cfg.Sink != nil
+	if !discard {
+		// A name from the server, a template or a batch file must not lead
+		// out of the output directory. Without one, the directory of an
+		// explicit --output is where the user wants the file, but the file
+		// must still not be a symlink pointing elsewhere.
+		base, name := cfg.OutputDir, fileName
+		if cfg.OutputName != "" && cfg.OutputDir == "" {
+			base, name = filepath.Dir(fileName), filepath.Base(fileName)
+		}
+		if fileName, err = fileutil.SafeJoin(base, name); err != nil {
+			return name, info, fmt.Errorf("refusing to write %s: %w", name, err)
+		}
+	}
+	if dir := filepath.Dir(fileName); dir != "." && !discard {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fileName, info, err
+		}
+	}
+
+	unlock := func() {}
+	if !discard {
+		if unlock, err = lockOutput(ctx, fileName, cfg); err != nil {
+			return fileName, info, err
 		}
-		fileName = filepath.Join(cfg.OutputDir, fileName)
+		defer unlock()
+	}
+
+	if cfg.DiffOnly && !discard {
+		if _, err := os.Stat(fileName); err == nil {
+			info, err := d.diffDownload(ctx, cfg, fileName, resolvedUrl)
+			return fileName, info, err
+		}
+	}
+
+	if cfg.NoClobber && !discard {
+		if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+			if _, err := os.Stat(fileName + ".gdl.json"); err != nil {
+				return fileName, info, fmt.Errorf("%s: %w", fileName, ErrFileExists)
+			}
+		}
+	}
+
+	if info.Size < 0 && cfg.Sink != nil {
+		return fileName, info, errors.New("the server did not report the file size, which writing to a sink needs")
+	}
+	if info.Size < 0 && cfg.SplitSize > 0 && !discard {
+		return fileName, info, errors.New("the server did not report the file size, which splitting into volumes needs")
+	}
+	if cfg.OnProgress != nil {
+		cfg.OnProgress(fileName, 0, info.Size)
+	}
+	if info.Size < 0 {
+		return fileName, info, d.downloadUnknownSize(ctx, fileName, resolvedUrl, headers, info, cfg)
 	}
 
 	stateFile := fileName + ".gdl.json"
+	if discard {
+		stateFile = ""
+	}
 	var state *DownloadState
+	saveState := func() {
+		if stateFile != "" {
+			state.Save(stateFile)
+		}
+	}
 
 	// Try to load existing state
 	if loadedState, err := LoadState(stateFile); err == nil {
+		if loadedState.File == fileName && loadedState.Size != info.Size {
+			sizeChanged := &SizeChangedError{Old: loadedState.Size, New: info.Size}
+			if cfg.OnSizeChange == SizeChangeAbort {
+				return fileName, info, sizeChanged
+			}
+			cfg.printf("Warning: %v, starting over\n", sizeChanged)
+		}
 		// Verify if state matches current file
-		if loadedState.Size == info.Size && loadedState.File == fileName {
-			fmt.Println("Resuming download from state file...")
+		if loadedState.Size == info.Size && loadedState.File == fileName && loadedState.SplitSize == cfg.SplitSize {
+			if loadedState.ETag != "" && info.ETag != "" && !sameETag(loadedState.ETag, info.ETag) {
+				return fileName, info, ErrContentChanged
+			}
+			cfg.printf("Resuming download from state file...\n")
 			state = loadedState
 			// Update URL in case it changed (e.g. signed link expired)
-			state.URL = resolvedUrl 
+			state.setURL(resolvedUrl)
+			state.OriginalURL = cfg.Url
 		}
 	}
 
 	// Initialize new state if needed
 	if state == nil {
 		state = &DownloadState{
-			URL:         resolvedUrl,
+			OriginalURL: cfg.Url,
 			File:        fileName,
 			Size:        info.Size,
+			ETag:        info.ETag,
 			Concurrency: cfg.Concurrency,
+			SplitSize:   cfg.SplitSize,
 			Chunks:      make([]*ChunkState, cfg.Concurrency),
 		}
+		state.setURL(resolvedUrl)
 
-		chunkSize := info.Size / int64(cfg.Concurrency)
-		for i := 0; i < cfg.Concurrency; i++ {
-			start := int64(i) * chunkSize
-			end := start + chunkSize - 1
-			if i == cfg.Concurrency-1 {
-				end = info.Size - 1
+		if len(cfg.ChunkRanges) > 0 {
+			if !info.RangeSupported {
+				return fileName, info, errors.New("the server does not accept ranges, so chunk ranges cannot be used")
+			}
+			if err := checkChunkRanges(cfg.ChunkRanges, info.Size); err != nil {
+				return fileName, info, err
 			}
-			state.Chunks[i] = &ChunkState{
-				ID:    i,
-				Start: start,
-				End:   end,
-				Downloaded: 0,
+			state.Concurrency = len(cfg.ChunkRanges)
+			state.Chunks = make([]*ChunkState, len(cfg.ChunkRanges))
+			for i, c := range cfg.ChunkRanges {
+				state.Chunks[i] = &ChunkState{ID: c.ID, Start: c.Start, End: c.End}
+			}
+		} else {
+			chunkSize := info.Size / int64(cfg.Concurrency)
+			for i := 0; i < cfg.Concurrency; i++ {
+				start := int64(i) * chunkSize
+				end := start + chunkSize - 1
+				if i == cfg.Concurrency-1 {
+					end = info.Size - 1
+				}
+				state.Chunks[i] = &ChunkState{
+					ID:         i,
+					Start:      start,
+					End:        end,
+					Downloaded: 0,
+				}
 			}
 		}
 	}
+	state.codec = statecodec.New(cfg.StateFormat)
 
-	out, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return err
+	var out outputFile
+	if cfg.Sink != nil {
+		w, err := cfg.Sink(info)
+		if err != nil {
+			return fileName, info, err
+		}
+		out = sinkFile{w}
+	} else if discard {
+		out = discardFile{}
+	} else if cfg.SplitSize > 0 {
+		volumes, err := splitwriter.Open(fileName, cfg.SplitSize, info.Size)
+		if err != nil {
+			return fileName, info, err
+		}
+		state.Volumes = volumes.Volumes()
+		out = volumes
+	} else {
+		f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return fileName, info, err
+		}
+		out = f
+
+		if info.Size > 0 {
+			// Only truncate if new file, otherwise we might wipe existing data?
+			// Actually os.Create truncates. os.OpenFile with O_CREATE doesn't if exists.
+			// But we need to ensure size.
+			stat, _ := f.Stat()
+			if stat.Size() != info.Size {
+				if err := f.Truncate(info.Size); err != nil {
+					f.Close()
+					return fileName, info, err
+				}
+			}
+		}
+	}
+	if len(cfg.Tee) > 0 {
+		tee, err := newTeeFile(out, cfg.Tee, state.Chunks)
+		if err != nil {
+			out.Close()
+			return fileName, info, err
+		}
+		out = tee
 	}
 	defer out.Close()
 
-	if info.Size > 0 {
-		// Only truncate if new file, otherwise we might wipe existing data?
-		// Actually os.Create truncates. os.OpenFile with O_CREATE doesn't if exists.
-		// But we need to ensure size.
-		stat, _ := out.Stat()
-		if stat.Size() != info.Size {
-			if err := out.Truncate(info.Size); err != nil {
-				return err
-			}
+	if cfg.LiveServer != nil {
+		if writeOnly(out) || len(state.Volumes) > 0 {
+			cfg.printf("Warning: this output can't be streamed while it downloads\n")
+		} else {
+			cfg.LiveServer.start(out, state, filepath.Base(fileName), info.Size)
+			// Runs before out is closed; a no-op once finished below.
+			defer cfg.LiveServer.finish("", errors.New("download stopped"))
 		}
 	}
 
-	p := mpb.New(mpb.WithWidth(64))
-	bar := p.AddBar(info.Size,
+	var profiler *ioprofile.WriteProfiler
+	if cfg.ProfileIO && !discard {
+		profiler = ioprofile.New(out)
+		out = profiler
+	}
+
+	var barOutput io.Writer = os.Stdout
+	if cfg.Quiet {
+		barOutput = io.Discard
+	}
+	appended := []decor.Decorator{decor.EwmaETA(decor.ET_STYLE_GO, 90)}
+	var graph *speedGraph
+	if cfg.Sparkline {
+		graph = &speedGraph{}
+		appended = append(appended, graph.decorator())
+	}
+	appended = append(appended,
+		decor.Name(" ] "),
+		decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 60),
+	)
+
+	var pause *pausefile.Watcher
+	if cfg.PauseFile != "" {
+		pause = pausefile.New(cfg.PauseFile, cfg.PauseInterval)
+	}
+
+	p := mpb.New(mpb.WithWidth(64), mpb.WithOutput(barOutput))
+	// The bar is completed by hand once the workers are done: a chunk that
+	// fails verification after the bar is full is taken off it again and
+	// downloaded once more, which a completed bar no longer tracks.
+	bar := p.AddBar(0,
 		mpb.PrependDecorators(
 			decor.Name(filepath.Base(fileName)),
 			decor.Percentage(decor.WCSyncSpace),
+			decor.Any(func(decor.Statistics) string {
+				if pause != nil && pause.Paused() {
+					return " PAUSED"
+				}
+				return ""
+			}),
 		),
-		mpb.AppendDecorators(
-			decor.EwmaETA(decor.ET_STYLE_GO, 90),
-			decor.Name(" ] "),
-			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 60),
-		),
+		mpb.AppendDecorators(appended...),
 	)
 
+	// Bytes from an earlier run only count if they still match their CRC.
+	if !writeOnly(out) {
+		for _, c := range state.Chunks {
+			if c.Downloaded == 0 {
+				continue
+			}
+			sum, err := crc.Range(out, c.Start, c.Downloaded)
+			switch {
+			case err != nil || (c.CRC != 0 && sum != c.CRC):
+				cfg.printf("Chunk %d failed verification, downloading it again\n", c.ID)
+				state.reset(c)
+			case c.CRC == 0:
+				// A state file from before chunks had CRCs: take its bytes
+				// on trust, as that version did, so that the CRC of the
+				// whole chunk can be checked once it is done.
+				c.CRC = sum
+			}
+		}
+	}
+
+	bar.SetTotal(info.Size, false)
+
 	// Pre-fill bar with already downloaded amount
 	var totalDownloaded int64
 	for _, chunk := range state.Chunks {
-		totalDownloaded += chunk.Downloaded
+		totalDownloaded += atomic.LoadInt64(&chunk.Downloaded)
 	}
 	bar.IncrInt64(totalDownloaded)
 
 	// Start background saver
 	done := make(chan struct{})
+	if graph != nil {
+		go graph.run(bar, done)
+	}
 	go func() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				state.Save(stateFile)
+				saveState()
+				if cfg.OnProgress != nil {
+					cfg.OnProgress(fileName, state.Downloaded(), info.Size)
+				}
 			case <-done:
 				return
 			}
 		}
 	}()
 
-	var wg sync.WaitGroup
-	for i, chunk := range state.Chunks {
+	if pause != nil {
+		go pause.Run(done)
+	}
+
+	// Restart chunks that fall far behind the others
+	monitor := chunkmonitor.New()
+	go monitor.Run(1*time.Second, done)
+
+	t := &transfer{
+		ctx:     ctx,
+		url:     resolvedUrl,
+		refresh: func() (string, error) { return d.refreshURL(cfg) },
+		state:   state,
+		headers: headers,
+		file:    out,
+		bar:     bar,
+		monitor: monitor,
+
+		onSizeChange: cfg.OnSizeChange,
+
+		pipelineDepth: cfg.PipelineDepth,
+
+		minBuf: cfg.MinBufSize,
+		maxBuf: cfg.MaxBufSize,
+		pause:  pause,
+	}
+	if cfg.KeepalivePeriod > 0 {
+		t.keepalive = kaprobe.New(cfg.KeepalivePeriod, func() {
+			sendKeepalive(ctx, d, t.currentURL(), t.headers, cfg.KeepalivePeriod)
+		})
+		go t.keepalive.Run(done)
+	}
+	if len(cfg.RateSchedule) > 0 {
+		t.throttle = newThrottle(cfg.RateSchedule.CurrentRate(time.Now()))
+		go followSchedule(t.throttle, cfg.RateSchedule, done)
+	}
+	if cfg.RetryBudget > 0 {
+		t.retryBudget = new(atomic.Int32)
+		t.retryBudget.Store(int32(min(cfg.RetryBudget, math.MaxInt32)))
+	}
+	if len(cfg.Mirrors) > 0 && info.RangeSupported && info.Size > 0 {
+		if mirrors := d.probeMirrors(ctx, cfg.Mirrors, headers, info.Size, cfg); len(mirrors) > 0 {
+			t.sources = newSourceSet(append([]string{resolvedUrl}, mirrors...), len(state.Chunks))
+			cfg.printf("Downloading from %d sources in parallel\n", len(t.sources.urls))
+		}
+	} else if len(cfg.Mirrors) > 0 {
+		cfg.printf("Warning: the server does not support ranges, ignoring parallel mirrors\n")
+	}
+	// Mirrors have ETags of their own, so If-Match only works with one source.
+	if etag := ifMatch(state.ETag); etag != "" && t.sources == nil {
+		// Ranges of a newer version of the file would corrupt it.
+		t.headers = headers.Clone()
+		if t.headers == nil {
+			t.headers = make(http.Header)
+		}
+		t.headers.Set("If-Match", etag)
+	}
+	if algo := cfg.checksumAlgorithm(); algo != "" {
+		h, err := digest.NewHash(algo)
+		if err != nil {
+			return fileName, info, err
+		}
+		// Bytes from an earlier run are hashed by reading them back.
+		t.hasher = hashwriter.New(h, out, hashwriter.DefaultMaxBuffered)
+		for _, c := range state.Chunks {
+			t.hasher.Mark(c.Start, c.Downloaded)
+		}
+	}
+
+	var pending []*ChunkState
+	for _, chunk := range state.Chunks {
 		if chunk.Downloaded >= (chunk.End - chunk.Start + 1) {
 			continue // Chunk already done
 		}
+		state.clearFailure(chunk)
+		pending = append(pending, chunk)
+	}
+
+	if cfg.Warmup && len(pending) > 1 && t.sources == nil {
+		warmupConnections(ctx, d, resolvedUrl, t.headers, len(pending), warmupDelay)
+	}
 
+	started := time.Now()
+	queue := workqueue.New(len(pending))
+	errCh := make(chan error, len(state.Chunks))
+	var wg sync.WaitGroup
+	for _, chunk := range pending {
 		wg.Add(1)
-		go func(i int, c *ChunkState) {
+		go func(c *ChunkState) {
 			defer wg.Done()
-			// Resume from Start + Downloaded
-			currentStart := c.Start + c.Downloaded
-			if err := d.downloadChunkWithRetry(resolvedUrl, out, currentStart, c.End, bar, headers, c); err != nil {
-				fmt.Printf("Error downloading chunk %d: %v\n", i, err)
-			}
-		}(i, chunk)
+			errCh <- d.runChunkWorker(t, state, queue, c, &cfg)
+		}(chunk)
 	}
 
 	wg.Wait()
+	close(errCh)
 	close(done)
+	bar.EnableTriggerComplete()
+	if !bar.Completed() {
+		bar.Abort(false)
+	}
 	p.Wait()
 
+	if ctx.Err() != nil {
+		// Paused or cancelled: keep the state so the download can resume.
+		saveState()
+		return fileName, info, ctx.Err()
+	}
+
+	var errs []error
+	for err := range errCh {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, c := range state.Chunks {
+		// A range handed off when no other worker was left to take it.
+		if atomic.LoadInt64(&c.Downloaded) < c.End-c.Start+1 && !c.Failed {
+			err := fmt.Errorf("chunk %d: incomplete", c.ID)
+			state.MarkFailed(c, err)
+			errs = append(errs, err)
+		}
+	}
+	for _, err := range errs {
+		if !errors.Is(err, errRangeMismatch) {
+			continue
+		}
+		// The bytes received so far can't be trusted either.
+		cfg.printf("Warning: %v\nDownloading again over a single connection without ranges\n", err)
+		if cfg.LiveServer != nil {
+			cfg.LiveServer.finish("", err)
+		}
+		out.Close()
+		if stateFile != "" {
+			os.Remove(stateFile)
+		}
+		return fileName, info, d.downloadUnknownSize(ctx, fileName, t.currentURL(), headers, info, cfg)
+	}
+	if len(errs) > 0 && cfg.RetryWithRange && !info.RangeSupported && !teeStreams(cfg.Tee) &&
+		d.splitForRanges(ctx, t.currentURL(), headers, state, requestedConcurrency) {
+		cfg.printf("The server accepts ranges after all, continuing in %d chunks\n", len(state.Chunks)-1)
+		saveState()
+		out.Close()
+		unlock()
+		cfg.BeforeDownload = nil // same file, already approved
+		return d.download(ctx, cfg)
+	}
+	if len(errs) > 0 {
+		saveState()
+		for _, err := range errs {
+			var sizeChanged *SizeChangedError
+			if errors.As(err, &sizeChanged) && cfg.OnSizeChange != SizeChangeAbort && cfg.OnSizeChange != SizeChangeContinue {
+				cfg.printf("Warning: %v, starting over\n", sizeChanged)
+				out.Close()
+				os.Remove(stateFile)
+				if d.probeCache != nil {
+					d.probeCache.remove(resolvedUrl)
+				}
+				// Should the size change again, give up rather than loop.
+				cfg.OnSizeChange = SizeChangeAbort
+				unlock()
+				return d.download(ctx, cfg)
+			}
+			if errors.As(err, &sizeChanged) {
+				return fileName, info, sizeChanged
+			}
+			if errors.Is(err, ErrContentChanged) {
+				return fileName, info, ErrContentChanged
+			}
+			if errors.Is(err, ErrCloudflareChallenge) {
+				return fileName, info, ErrCloudflareChallenge
+			}
+		}
+		return fileName, info, fmt.Errorf("download incomplete: %w", errors.Join(errs...))
+	}
+
+	if cfg.OnProgress != nil {
+		cfg.OnProgress(fileName, state.Downloaded(), info.Size)
+	}
+	if t.hasher != nil {
+		label := digest.Label(cfg.checksumAlgorithm())
+		sum, err := t.hasher.Sum(info.Size)
+		switch {
+		case err != nil && cfg.Checksum != nil:
+			return fileName, info, fmt.Errorf("could not compute %s to verify: %w", label, err)
+		case err != nil:
+			cfg.printf("Warning: could not compute %s: %v\n", label, err)
+		default:
+			cfg.printf("%s: %x\n", label, sum)
+			if err := cfg.verifyChecksum(sum); err != nil {
+				// Resuming would only keep the bad bytes.
+				if stateFile != "" {
+					os.Remove(stateFile)
+				}
+				return fileName, info, err
+			}
+		}
+	}
+
+	if profiler != nil {
+		profiler.Report(os.Stderr)
+	}
+	if len(state.Volumes) > 0 {
+		cfg.printf("Saved as %d volumes: %s ... %s\n", len(state.Volumes), state.Volumes[0], state.Volumes[len(state.Volumes)-1])
+	}
+	if discard && cfg.Sink == nil {
+		elapsed := time.Since(started)
+		cfg.printf("Discarded %d bytes in %s (%.2f MiB/s)\n", info.Size, elapsed.Round(time.Millisecond), float64(info.Size)/elapsed.Seconds()/(1<<20))
+	}
+	if d.push != nil && !discard {
+		d.savePushed(ctx, resolvedUrl, headers, filepath.Dir(fileName), cfg)
+	}
+
 	// Clean up state file if successful
-	os.Remove(stateFile)
+	if stateFile != "" {
+		os.Remove(stateFile)
+	}
+	if cfg.LiveServer != nil {
+		cfg.LiveServer.finish(fileName, nil)
+	}
+	return fileName, info, nil
+}
+
+// outputFile is where chunks are written: the output file itself or, with
+// DownloadConfig.SplitSize, its volumes.
+type outputFile interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+}
+
+// transfer holds what the chunk goroutines of a single download share.
+type transfer struct {
+	ctx     context.Context
+	urlMu   sync.Mutex
+	url     string // may be replaced once a signed URL expires; use currentURL
+	refresh func() (string, error)
+	state   *DownloadState
+	headers http.Header
+	file    outputFile
+	bar     *mpb.Bar
+	monitor *chunkmonitor.Monitor
+	hasher  *hashwriter.OrderedHashWriter
+	sources *sourceSet // with parallel mirrors, which chunk uses which
+
+	onSizeChange string
+	ignoreSize   atomic.Bool // set once a size change was accepted
+
+	pipelineDepth int // requests in flight per chunk; see openChunk
+
+	retryBudget *atomic.Int32 // retries left for all chunks; nil if unlimited
+	throttle    *rate.Limiter // shared by all chunks; nil without a RateSchedule
+
+	minBuf, maxBuf int                // read buffer sizes; see adaptivebuf.NewReader
+	pause          *pausefile.Watcher // nil without a PauseFile
+	keepalive      *kaprobe.Prober    // nil without a KeepalivePeriod
+}
+
+// ErrFileExists is returned with DownloadConfig.NoClobber for a file that
+// is already there.
+var ErrFileExists = errors.New("file already exists, not overwriting it (--no-clobber)")
+
+// ErrRetryBudgetExhausted is returned for a chunk that failed after the
+// retries allowed by DownloadConfig.RetryBudget were used up.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+var (
+	errIdleTimeout = errors.New("no data received for 30s")
+	errShortWrite  = errors.New("short write")
+	errSlowChunk   = errors.New("chunk restarted: far slower than the others")
+)
+
+// verifyChunk re-reads a finished chunk from disk and compares it with the
+// CRC of the bytes received. A mismatch means the data was corrupted on the
+// way to disk; the chunk is then marked for a fresh download.
+func (t *transfer) verifyChunk(c *ChunkState) error {
+	if writeOnly(t.file) || c.CRC == 0 {
+		return nil
+	}
+	sum, err := crc.Range(t.file, c.Start, c.End-c.Start+1)
+	if err != nil {
+		return fmt.Errorf("verifying chunk %d: %w", c.ID, err)
+	}
+	if sum != c.CRC {
+		t.bar.IncrInt64(-t.state.reset(c))
+		return fmt.Errorf("chunk %d: CRC mismatch after writing, data corrupted on disk", c.ID)
+	}
 	return nil
 }
 
-func (d *Downloader) downloadChunkWithRetry(url string, file *os.File, start, end int64, bar *mpb.Bar, headers map[string]string, chunkState *ChunkState) error {
+// maxHandoffs limits how many times a failed range is passed on to another
+// worker before it is given up.
+const maxHandoffs = 3
+
+// maxSlowRestarts is how many times a chunk is restarted for being slow
+// before further restarts count as failed attempts. A chunk that stays
+// slow on every fresh connection is more likely a slow server than an
+// unlucky one.
+const maxSlowRestarts = 3
+
+// runChunkWorker downloads c, then keeps taking ranges from the queue until
+// none are left. A failed range goes to a worker that is already idle, or
+// else is queued for whichever is free first, which may be this one when no
+// other worker is left. The returned error is
+// non-nil only for a range that has been handed off too often.
+func (d *Downloader) runChunkWorker(t *transfer, state *DownloadState, queue *workqueue.ChunkQueue, c *ChunkState, cfg *DownloadConfig) error {
+	handoffs := 0
+	for {
+		err := d.downloadChunkWithRetry(t, c)
+		if err == nil {
+			err = t.verifyChunk(c)
+		}
+		if err != nil {
+			if t.ctx.Err() != nil {
+				queue.Leave()
+				return nil
+			}
+			if handoffs >= maxHandoffs || isPermanent(err) {
+				queue.Leave()
+				err = fmt.Errorf("chunk %d: %w", c.ID, err)
+				state.MarkFailed(c, err)
+				return err
+			}
+			cfg.printf("Chunk %d failed (%v), handing its remaining bytes to another connection\n", c.ID, err)
+			queue.Push(workqueue.PendingRange{
+				Start:    c.Start + atomic.LoadInt64(&c.Downloaded),
+				End:      c.End,
+				ChunkID:  c.ID,
+				Attempts: handoffs + 1,
+			})
+		}
+
+		r, ok := queue.Pop()
+		if !ok {
+			return nil
+		}
+		c, handoffs = state.chunk(r.ChunkID), r.Attempts
+	}
+}
+
+func (d *Downloader) downloadChunkWithRetry(t *transfer, chunkState *ChunkState) error {
 	maxRetries := 5
+	slowRestarts := 0
 	var lastErr error
 
 	for i := 0; i < maxRetries; i++ {
@@ -267,86 +1362,194 @@ func (d *Downloader) downloadChunkWithRetry(url string, file *os.File, start, en
 			return nil
 		}
 
-		_, err := d.downloadChunk(url, file, currentStart, end, bar, headers, chunkState)
-		
-		// downloadChunk now updates chunkState.Downloaded atomically or via mutex?
-		// We'll pass chunkState to it.
-		
-		if chunkState.Start + chunkState.Downloaded > chunkState.End {
+		_, err := d.downloadChunk(t, currentStart, chunkState.End, chunkState)
+		if t.ctx.Err() != nil {
+			return t.ctx.Err()
+		}
+
+		if chunkState.Start+chunkState.Downloaded > chunkState.End {
 			return nil
 		}
 		if err == nil {
 			return nil
 		}
-		
+		if isPermanent(err) {
+			return err
+		}
+		if errors.Is(err, errSlowChunk) && slowRestarts < maxSlowRestarts {
+			// A fresh connection is the whole point, so don't back off
+			// or count this against the retry limit.
+			slowRestarts++
+			i--
+			continue
+		}
+
 		lastErr = err
-		time.Sleep(time.Duration(i+1) * time.Second)
+		t.failSource(chunkState, err)
+		var opErr *net.OpError
+		if d.cdn != nil && errors.As(err, &opErr) {
+			if u, perr := neturl.Parse(t.chunkURL(chunkState)); perr == nil {
+				d.cdn.Advance(u.Hostname())
+			}
+		}
+		if i+1 < maxRetries && t.retryBudget != nil && t.retryBudget.Add(-1) < 0 {
+			return fmt.Errorf("%w, last error: %v", ErrRetryBudgetExhausted, err)
+		}
+		select {
+		case <-time.After(time.Duration(i+1) * time.Second):
+		case <-t.ctx.Done():
+			return t.ctx.Err()
+		}
 	}
 	return fmt.Errorf("failed after %d retries, last error: %v", maxRetries, lastErr)
 }
 
-func (d *Downloader) downloadChunk(url string, file *os.File, start, end int64, bar *mpb.Bar, headers map[string]string, chunkState *ChunkState) (int64, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+func (d *Downloader) downloadChunk(t *transfer, start, end int64, chunkState *ChunkState) (int64, error) {
+	ctx, cancel := context.WithCancelCause(t.ctx)
+	defer cancel(nil)
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return 0, err
-	}
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
-
-	resp, err := d.Client.Do(req)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
+	t.monitor.Register(chunkState.ID, func() { cancel(errSlowChunk) })
+	defer t.monitor.Unregister(chunkState.ID)
 
-	if resp.StatusCode == http.StatusOK {
-		return 0, fmt.Errorf("server returned 200 OK instead of 206 Partial Content (Range ignored)")
+	url := t.chunkURL(chunkState)
+	body, err := d.openChunk(ctx, t, url, start, end, t.expectedSize())
+	if t.sizeChanged(err) {
+		body, err = d.openChunk(ctx, t, url, start, end, -1)
 	}
-	if resp.StatusCode != http.StatusPartialContent {
-		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
-			return 0, nil
+	if err != nil || body == nil {
+		if cause := context.Cause(ctx); cause != nil {
+			return 0, cause
 		}
-		return 0, fmt.Errorf("unexpected status: %s", resp.Status)
+		return 0, err
 	}
+	defer body.Close()
+	// Closing the body unblocks a stalled Read once the context is cancelled.
+	stop := context.AfterFunc(ctx, func() { body.Close() })
+	defer stop()
 
-	reader := bar.ProxyReader(resp.Body)
-	buf := make([]byte, 256*1024)
+	var src io.Reader = body
+	if t.throttle != nil {
+		src = &throttledReader{ctx: ctx, r: body, limiter: t.throttle}
+	}
+	reader := adaptivebuf.NewReader(t.bar.ProxyReader(src), t.minBuf, t.maxBuf)
 	var totalWritten int64
 
 	timer := time.AfterFunc(30*time.Second, func() {
-		cancel()
+		cancel(errIdleTimeout)
 	})
 	defer timer.Stop()
 
 	for {
+		if t.pause != nil && t.pause.Paused() {
+			// Waiting isn't idling: the timeout starts again on resume.
+			timer.Stop()
+			if err := t.pause.Wait(ctx); err != nil {
+				if cause := context.Cause(ctx); cause != nil {
+					return totalWritten, cause
+				}
+				return totalWritten, err
+			}
+		}
 		timer.Reset(30 * time.Second)
-		n, err := reader.Read(buf)
+		buf, err := reader.Next()
+		n := len(buf)
 		if n > 0 {
-			_, wErr := file.WriteAt(buf[:n], start+totalWritten)
+			wWritten, wErr := t.file.WriteAt(buf, start+totalWritten)
 			if wErr != nil {
 				return totalWritten, wErr
 			}
+			if wWritten != n {
+				// Some network filesystems write less without an error.
+				// Keep what was written and let the retry request the
+				// rest again from where the write stopped.
+				t.bar.IncrInt64(-int64(n - wWritten))
+				err = fmt.Errorf("%w at offset %d: %d of %d bytes", errShortWrite, start+totalWritten, wWritten, n)
+				n = wWritten
+			}
+			if t.hasher != nil {
+				t.hasher.WriteAt(buf[:n], start+totalWritten)
+			}
 			nInt64 := int64(n)
 			totalWritten += nInt64
-			
+			t.monitor.Add(chunkState.ID, nInt64)
+			t.keepalive.Touch()
+
 			// Update state safely
 			// Since we are the only writer to this ChunkState (one goroutine per chunk),
 			// we can just update it. But SaveState reads it concurrently.
-			// Atomic store is safest.
-			atomic.AddInt64(&chunkState.Downloaded, nInt64)
+			// advance keeps the count and its CRC in step.
+			t.state.advance(chunkState, nInt64, crc.Update(chunkState.CRC, buf[:n]))
 		}
 		if err == io.EOF {
 			return totalWritten, nil
 		}
 		if err != nil {
+			if cause := context.Cause(ctx); cause != nil {
+				return totalWritten, cause
+			}
 			return totalWritten, err
 		}
 	}
 }
+
+// limitedBody reads part of a response body and closes the whole body.
+type limitedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// openRange returns a reader for bytes start..end of url. A nil reader with a
+// nil error means there is nothing left to read. If size is not negative,
+// a Content-Range total other than size is a *SizeChangedError.
+func (d *Downloader) openRange(ctx context.Context, url string, start, end int64, headers http.Header, size int64) (io.ReadCloser, error) {
+	if ftpsource.IsFTP(url) {
+		return d.openFTPRange(url, start, end)
+	}
+	if sftpsource.IsSFTP(url) {
+		return d.openSFTPRange(url, start, end)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	req.Header.Set("User-Agent", useragent.Default)
+	setHeaders(req, headers)
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		if start == 0 {
+			// The whole file still starts with the bytes we asked for.
+			return &limitedBody{Reader: io.LimitReader(resp.Body, end+1), body: resp.Body}, nil
+		}
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned 200 OK instead of 206 Partial Content (Range ignored)")
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		if isCloudflareChallenge(resp) {
+			return nil, ErrCloudflareChallenge
+		}
+		if resp.StatusCode == http.StatusPreconditionFailed && req.Header.Get("If-Match") != "" {
+			return nil, ErrContentChanged
+		}
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	if err := checkContentRange(resp.Header.Get("Content-Range"), start, end, size); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,346 @@
+package downloader_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+)
+
+// quietConfig returns the config for a quiet download of url into a new
+// temporary directory.
+func quietConfig(t *testing.T, url string, concurrency int) downloader.DownloadConfig {
+	t.Helper()
+	return downloader.DownloadConfig{
+		Url:         url,
+		OutputDir:   t.TempDir(),
+		Concurrency: concurrency,
+		Quiet:       true,
+	}
+}
+
+// checkFile fails t unless the file at path holds want.
+func checkFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s: got %d bytes, want %d matching bytes", path, len(got), len(want))
+	}
+}
+
+// checkNoState fails t if a state file was left next to path.
+func checkNoState(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path + ".gdl.json"); !os.IsNotExist(err) {
+		t.Errorf("state file left behind: %v", err)
+	}
+}
+
+// rangeGETs returns the Range headers of the GET requests srv received.
+func rangeGETs(srv *testserver.TestServer) []string {
+	var ranges []string
+	for _, r := range srv.RequestLog() {
+		if r.Method == http.MethodGet {
+			ranges = append(ranges, r.Header.Get("Range"))
+		}
+	}
+	return ranges
+}
+
+func TestProbe(t *testing.T) {
+	srv := testserver.NewTestServer(t, testserver.RandomContent(1000, 1))
+	srv.SetFilename("report.pdf")
+
+	info, err := downloader.NewDownloader().Probe(srv.FileURL("download?id=7"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 1000 || !info.RangeSupported || info.Name != "report.pdf" {
+		t.Errorf("Probe() = size %d, ranges %v, name %q; want 1000, true, report.pdf", info.Size, info.RangeSupported, info.Name)
+	}
+
+	srv.SetRangeSupport(false)
+	if info, err = downloader.NewDownloader().Probe(srv.FileURL("data.bin"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if info.RangeSupported {
+		t.Error("Probe() reports range support for a server without it")
+	}
+}
+
+func TestDownloadInChunks(t *testing.T) {
+	content := testserver.RandomContent(1<<20, 2)
+	srv := testserver.NewTestServer(t, content)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 8)
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(cfg.OutputDir, "data.bin")
+	checkFile(t, path, content)
+	checkNoState(t, path)
+
+	ranges := rangeGETs(srv)
+	if len(ranges) != 8 {
+		t.Fatalf("got %d GET requests, want one per chunk: %q", len(ranges), ranges)
+	}
+	for _, r := range ranges {
+		if !strings.HasPrefix(r, "bytes=") {
+			t.Errorf("GET without a range: %q", r)
+		}
+	}
+}
+
+func TestDownloadWithoutRangeSupport(t *testing.T) {
+	content := testserver.RandomContent(300_000, 3)
+	srv := testserver.NewTestServer(t, content)
+	srv.SetRangeSupport(false)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 8)
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(cfg.OutputDir, "data.bin"), content)
+	if n := len(rangeGETs(srv)); n != 1 {
+		t.Errorf("got %d GET requests, want 1 without range support", n)
+	}
+}
+
+func TestDownloadNamedByContentDisposition(t *testing.T) {
+	content := []byte("%PDF-1.7 not really")
+	srv := testserver.NewTestServer(t, content)
+	srv.SetFilename("Quarterly report.pdf")
+	cfg := quietConfig(t, srv.FileURL("export?format=pdf"), 1)
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(cfg.OutputDir, "Quarterly report.pdf"), content)
+}
+
+func TestDownloadOutputName(t *testing.T) {
+	content := testserver.RandomContent(50_000, 4)
+	srv := testserver.NewTestServer(t, content)
+	srv.SetFilename("server-name.bin")
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 2)
+	cfg.OutputName = "mine.bin"
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(cfg.OutputDir, "mine.bin"), content)
+	if _, err := os.Stat(filepath.Join(cfg.OutputDir, "server-name.bin")); !os.IsNotExist(err) {
+		t.Errorf("the server's name was used too: %v", err)
+	}
+}
+
+func TestDownloadRetriesFailedRequests(t *testing.T) {
+	content := testserver.RandomContent(200_000, 5)
+	srv := testserver.NewTestServer(t, content)
+	srv.SetFailFirst(2)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 2)
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(cfg.OutputDir, "data.bin"), content)
+	if n := len(rangeGETs(srv)); n < 4 {
+		t.Errorf("got %d GET requests, want the 2 failed ones retried", n)
+	}
+}
+
+func TestDownloadResumesDroppedConnections(t *testing.T) {
+	content := testserver.RandomContent(256<<10, 6)
+	srv := testserver.NewTestServer(t, content)
+	// Each response stops after 96 KiB, so each 128 KiB chunk needs a
+	// second request that picks up where the first stopped.
+	srv.SetDropAfter(96 << 10)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 2)
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(cfg.OutputDir, "data.bin"), content)
+
+	resumed := map[string]bool{}
+	for _, r := range rangeGETs(srv) {
+		resumed[r] = true
+	}
+	for _, want := range []string{"bytes=98304-131071", "bytes=229376-262143"} {
+		if !resumed[want] {
+			t.Errorf("no request resumed the chunk with %s; requests: %v", want, rangeGETs(srv))
+		}
+	}
+}
+
+func TestDownloadResumesFromStateFile(t *testing.T) {
+	content := testserver.RandomContent(1<<20, 7)
+	srv := testserver.NewTestServer(t, content)
+	// Each chunk would take 4s; the first run is stopped well before.
+	srv.SetThrottleBps(128 << 10)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 2)
+	path := filepath.Join(cfg.OutputDir, "data.bin")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1200*time.Millisecond)
+	defer cancel()
+	downloader.NewDownloader().DownloadContext(ctx, cfg)
+	if _, err := os.Stat(path + ".gdl.json"); err != nil {
+		t.Fatalf("no state file after an interrupted download: %v", err)
+	}
+
+	srv.SetThrottleBps(0)
+	before := len(srv.RequestLog())
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, content)
+	checkNoState(t, path)
+
+	for _, r := range srv.RequestLog()[before:] {
+		if r.Method == http.MethodGet && (r.Header.Get("Range") == "bytes=0-524287" || r.Header.Get("Range") == "bytes=524288-1048575") {
+			t.Errorf("resumed download asked for a whole chunk again: %s", r.Header.Get("Range"))
+		}
+	}
+}
+
+func TestDownloadResumesStateWithoutCRCs(t *testing.T) {
+	content := testserver.RandomContent(100_000, 72)
+	srv := testserver.NewTestServer(t, content)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 2)
+	path := filepath.Join(cfg.OutputDir, "data.bin")
+
+	// A state file from before chunks had CRCs, with one chunk half done.
+	partial := make([]byte, len(content))
+	copy(partial, content[:25_000])
+	writeFile(t, path, partial)
+	state := &downloader.DownloadState{
+		URL:         cfg.Url,
+		File:        path,
+		Size:        int64(len(content)),
+		Concurrency: 2,
+		Chunks: []*downloader.ChunkState{
+			{ID: 0, Start: 0, End: 49_999, Downloaded: 25_000},
+			{ID: 1, Start: 50_000, End: 99_999},
+		},
+	}
+	if err := state.Save(path + ".gdl.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, content)
+	checkNoState(t, path)
+	if got, want := rangeGETs(srv), []string{"bytes=25000-49999", "bytes=50000-99999"}; !slices.Equal(slices.Sorted(slices.Values(got)), want) {
+		t.Errorf("GET ranges = %q, want %q", got, want)
+	}
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	content := testserver.RandomContent(100_000, 8)
+	srv := testserver.NewTestServer(t, content)
+	sum := sha256.Sum256(content)
+
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 4)
+	cfg.Checksum = sum[:]
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatalf("matching checksum: %v", err)
+	}
+
+	cfg = quietConfig(t, srv.FileURL("data.bin"), 4)
+	cfg.Checksum = make([]byte, sha256.Size)
+	if err := downloader.NewDownloader().Download(cfg); !errors.Is(err, downloader.ErrChecksumMismatch) {
+		t.Fatalf("wrong checksum: got %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestDownloadToSink(t *testing.T) {
+	content := testserver.RandomContent(300_000, 9)
+	srv := testserver.NewTestServer(t, content)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 4)
+	sink := &memSink{}
+	cfg.Sink = func(info *downloader.FileInfo) (io.WriterAt, error) {
+		sink.buf = make([]byte, info.Size)
+		return sink, nil
+	}
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sink.buf, content) {
+		t.Fatal("sink did not get the file")
+	}
+	if entries, _ := os.ReadDir(cfg.OutputDir); len(entries) > 0 {
+		t.Errorf("a sink download wrote to disk: %v", entries)
+	}
+}
+
+// memSink is an in-memory io.WriterAt for DownloadConfig.Sink.
+type memSink struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (s *memSink) WriteAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copy(s.buf[off:], p), nil
+}
+
+func TestProbeHeaderTimeout(t *testing.T) {
+	srv := testserver.NewTestServer(t, []byte("slow"))
+	srv.SetDelay(500 * time.Millisecond)
+
+	d := downloader.NewDownloader(downloader.WithResponseHeaderTimeout(50 * time.Millisecond))
+	if _, err := d.Probe(srv.FileURL("data.bin"), nil); err == nil {
+		t.Fatal("Probe() succeeded although the headers came after the timeout")
+	}
+	if _, err := downloader.NewDownloader().Probe(srv.FileURL("data.bin"), nil); err != nil {
+		t.Fatalf("Probe() without a timeout: %v", err)
+	}
+}
+
+// writeFile creates the file at path with data.
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultiSourceDownloadLeavesMirrorsAlone(t *testing.T) {
+	content := testserver.RandomContent(200_000, 14)
+	primary := testserver.NewTestServer(t, content)
+	mirror := testserver.NewTestServer(t, content)
+	cfg := quietConfig(t, primary.FileURL("data.bin"), 4)
+	// Room to append in place, which must not be used.
+	backing := []string{mirror.FileURL("data.bin"), "untouched"}
+	cfg.Mirrors = backing[:1]
+
+	if err := downloader.NewDownloader().MultiSourceDownload(context.Background(), cfg, []string{mirror.FileURL("data.bin")}); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(cfg.OutputDir, "data.bin"), content)
+	if backing[1] != "untouched" {
+		t.Errorf("MultiSourceDownload wrote %q into the caller's Mirrors array", backing[1])
+	}
+	if len(rangeGETs(mirror)) == 0 {
+		t.Error("the mirror served no chunks")
+	}
+}
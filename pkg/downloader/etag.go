@@ -0,0 +1,38 @@
+package downloader
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrContentChanged means the file on the server is no longer the one a
+// resumed download started with, so the bytes already on disk are useless.
+var ErrContentChanged = errors.New("the file changed on the server since the download started (ETag mismatch); delete the partial file and its .gdl.json state file and download it again")
+
+// parseETag splits an ETag header value into its opaque part and whether it
+// is weak (W/"...").
+func parseETag(etag string) (opaque string, weak bool) {
+	etag = strings.TrimSpace(etag)
+	if rest, ok := strings.CutPrefix(etag, "W/"); ok {
+		return rest, true
+	}
+	return etag, false
+}
+
+// sameETag reports whether a and b name the same version of a file. Weak
+// ETags are compared by their opaque value only.
+func sameETag(a, b string) bool {
+	oa, _ := parseETag(a)
+	ob, _ := parseETag(b)
+	return oa == ob
+}
+
+// ifMatch returns the If-Match value that makes the server refuse a range
+// of anything but etag, or "" if etag is weak: If-Match only accepts strong
+// ETags, so for a weak one only the check on resume applies.
+func ifMatch(etag string) string {
+	if _, weak := parseETag(etag); weak {
+		return ""
+	}
+	return etag
+}
@@ -0,0 +1,30 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"gdl/pkg/extract"
+)
+
+// extractFile unpacks the downloaded archive name into cfg.OutputDir, or
+// the directory it was saved in. The archive itself is kept. Files that are
+// not archives are left alone.
+func extractFile(name string, cfg DownloadConfig) error {
+	dest := cfg.OutputDir
+	if dest == "" {
+		dest = filepath.Dir(name)
+	}
+	e := &extract.Extractor{StripComponents: cfg.StripComponents}
+	err := e.Extract(name, dest)
+	if errors.Is(err, extract.ErrNotArchive) {
+		cfg.printf("%s is not an archive, keeping it as is\n", name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("extracting %s: %w", name, err)
+	}
+	cfg.printf("Extracted %s to %s\n", name, dest)
+	return nil
+}
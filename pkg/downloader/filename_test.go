@@ -0,0 +1,44 @@
+package downloader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFilename(t *testing.T) {
+	tests := []struct {
+		name               string
+		contentDisposition string
+		url                string
+		want               string
+	}{
+		{"plain", "", "https://example.com/files/archive.tar.gz", "archive.tar.gz"},
+		{"query", "", "https://cdn.example.com/file.zip?token=abc123&expires=1234567890", "file.zip"},
+		{"long query", "", "https://cdn.example.com/video.mp4?X-Amz-Signature=" + strings.Repeat("f00d", 200) + "&X-Amz-Expires=3600", "video.mp4"},
+		{"fragment", "", "https://example.com/docs/report.pdf#page=2", "report.pdf"},
+		{"query and fragment", "", "https://example.com/a.iso?mirror=eu#sha256", "a.iso"},
+		{"encoded unicode", "", "https://example.com/%E6%96%87%E4%BB%B6.txt", "文件.txt"},
+		{"raw unicode", "", "https://example.com/données/résumé.pdf", "résumé.pdf"},
+		{"emoji", "", "https://example.com/%F0%9F%93%A6.bin", "📦.bin"},
+		{"windows-illegal", "", "https://example.com/a%3Ab%3Fc%2A.txt", "a_b_c_.txt"},
+		{"quotes, pipe and angle brackets", "", "https://example.com/%22q%22%7Cp%3Cx%3E.txt", "_q__p_x_.txt"},
+		{"encoded backslash", "", "https://example.com/dir%5Cfile.txt", "dir_file.txt"},
+		{"control character", "", "https://example.com/new%0Aline.txt", "new_line.txt"},
+		{"root", "", "https://example.com/", "download"},
+		{"no path", "", "https://example.com", "download"},
+		{"dot-dot", "", "https://example.com/%2E%2E", "download"},
+		{"directory", "", "https://example.com/releases/", "releases"},
+		{"content-disposition", `attachment; filename="report.pdf"`, "https://example.com/export?id=1", "report.pdf"},
+		{"content-disposition utf-8", `attachment; filename*=UTF-8''na%C3%AFve.txt`, "https://example.com/dl", "naïve.txt"},
+		{"content-disposition traversal", `attachment; filename="../../etc/passwd"`, "https://example.com/dl", ".._.._etc_passwd"},
+		{"content-disposition illegal", `attachment; filename="a<b>:c.txt"`, "https://example.com/dl", "a_b__c.txt"},
+		{"bad content-disposition", `attachment; filename=`, "https://example.com/fallback.bin?x=1", "fallback.bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseFilename(tt.contentDisposition, tt.url); got != tt.want {
+				t.Errorf("parseFilename(%q, %q) = %q, want %q", tt.contentDisposition, tt.url, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package downloader
+
+import (
+	"io"
+
+	ftpsource "gdl/pkg/source/ftp"
+)
+
+func (d *Downloader) probeFTP(url string) (*FileInfo, error) {
+	src, err := ftpsource.New(url, d.FTP)
+	if err != nil {
+		return nil, err
+	}
+	size, restSupported, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{
+		Url:            url,
+		Name:           src.Name(),
+		Size:           size,
+		RangeSupported: restSupported,
+	}, nil
+}
+
+func (d *Downloader) openFTPRange(url string, start, end int64) (io.ReadCloser, error) {
+	src, err := ftpsource.New(url, d.FTP)
+	if err != nil {
+		return nil, err
+	}
+	return src.Open(start, end)
+}
@@ -0,0 +1,38 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"gdl/pkg/useragent"
+)
+
+// sendKeepalive asks url's server for the first byte of the file over a
+// connection other than the stalled chunk ones, so that the host's idle
+// pooled connections and any NAT or firewall state for it stay alive while
+// no data arrives (DownloadConfig.KeepalivePeriod). It gives up after
+// timeout; failures are only logged.
+func sendKeepalive(ctx context.Context, d *Downloader, url string, headers http.Header, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	req.Header.Set("User-Agent", useragent.Default)
+	setHeaders(req, headers)
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		slog.Debug("keep-alive probe failed", "url", url, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+	// Should the server ignore the range, stop after a byte rather than
+	// reading the whole file.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1))
+	slog.Debug("keep-alive probe sent", "url", url, "status", resp.StatusCode)
+}
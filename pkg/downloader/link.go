@@ -0,0 +1,131 @@
+package downloader
+
+import (
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strings"
+)
+
+// parseLinkHeader reads a Link header (RFC 8288), such as
+// `<https://mirror.example.com/file.zip>; rel="duplicate", <...>; rel=next`,
+// and returns the link targets by relation type. A link with several
+// space-separated relation types is listed under each of them. Relation
+// types are lower-cased; targets are returned as written.
+func parseLinkHeader(header string) map[string][]string {
+	links := make(map[string][]string)
+	s := header
+	for {
+		start := strings.IndexByte(s, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '>')
+		if end < 0 {
+			break
+		}
+		target := strings.TrimSpace(s[start+1 : start+end])
+		s = s[start+end+1:]
+
+		var params map[string]string
+		params, s = parseLinkParams(s)
+		for _, rel := range strings.Fields(params["rel"]) {
+			rel = strings.ToLower(rel)
+			links[rel] = append(links[rel], target)
+		}
+	}
+	return links
+}
+
+// parseLinkParams reads the ";"-separated parameters that follow a link
+// target, up to the "," before the next link, and returns them with the
+// rest of the header. Names are lower-cased; values may be quoted strings,
+// which may contain "," and ";". Only the first of repeated parameters
+// counts, as the RFC asks for rel.
+func parseLinkParams(s string) (map[string]string, string) {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return params, s
+		}
+		if s[0] == ',' {
+			return params, s[1:]
+		}
+		if s[0] != ';' {
+			// Junk between parameters; skip to the next separator.
+			i := strings.IndexAny(s, ";,")
+			if i < 0 {
+				return params, ""
+			}
+			s = s[i:]
+			continue
+		}
+		s = strings.TrimLeft(s[1:], " \t")
+
+		i := strings.IndexAny(s, "=;,")
+		if i < 0 {
+			i = len(s)
+		}
+		name := strings.ToLower(strings.TrimSpace(strings.TrimSuffix(s[:i], "*")))
+		s = s[i:]
+		var value string
+		if strings.HasPrefix(s, "=") {
+			value, s = parseParamValue(strings.TrimLeft(s[1:], " \t"))
+		}
+		if _, seen := params[name]; !seen && name != "" {
+			params[name] = value
+		}
+	}
+}
+
+// parseParamValue reads a token or quoted-string value and returns it with
+// the rest of s.
+func parseParamValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.IndexAny(s, ";,")
+		if i < 0 {
+			i = len(s)
+		}
+		return strings.TrimSpace(s[:i]), s[i:]
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), "" // unterminated
+}
+
+// linkMirrors returns the absolute URLs of the rel=duplicate links in h,
+// which serve the same file as base.
+func linkMirrors(h http.Header, base string) []string {
+	links := h.Values("Link")
+	if len(links) == 0 {
+		return nil
+	}
+	baseURL, err := neturl.Parse(base)
+	if err != nil {
+		return nil
+	}
+	var mirrors []string
+	for _, target := range parseLinkHeader(strings.Join(links, ", "))["duplicate"] {
+		u, err := baseURL.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		if m := u.String(); m != base && !slices.Contains(mirrors, m) {
+			mirrors = append(mirrors, m)
+		}
+	}
+	return mirrors
+}
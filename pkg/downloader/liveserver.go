@@ -0,0 +1,192 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LiveServer serves a file over HTTP while it downloads, so that a media
+// player can start playing it early (DownloadConfig.LiveServer). Reads of
+// bytes that haven't arrived yet wait for them. Once the download is done
+// the finished file is served until the server is closed.
+type LiveServer struct {
+	srv *http.Server
+	ln  net.Listener
+
+	mu    sync.RWMutex // held for reading while reading the output file
+	out   io.ReaderAt  // the output file while downloading
+	state *DownloadState
+	name  string
+	size  int64
+	final string // the finished file, once the download is done
+	err   error  // why the download stopped, if it failed
+	ended chan struct{}
+}
+
+// ErrLiveDownloadFailed is returned to readers of a LiveServer whose
+// download failed before the bytes they wait for arrived.
+var ErrLiveDownloadFailed = errors.New("the download failed")
+
+// NewLiveServer starts serving on addr. Until a download starts, requests
+// get 503 Service Unavailable.
+func NewLiveServer(addr string) (*LiveServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &LiveServer{ln: ln, ended: make(chan struct{})}
+	s.srv = &http.Server{Handler: s}
+	go s.srv.Serve(ln)
+	return s, nil
+}
+
+// URL returns the address the file is served at; any path serves it.
+func (s *LiveServer) URL() string {
+	return "http://" + s.ln.Addr().String() + "/"
+}
+
+// Close stops the server and ends the requests in progress.
+func (s *LiveServer) Close() error {
+	return s.srv.Close()
+}
+
+// start serves out, whose downloaded bytes are those state records.
+func (s *LiveServer) start(out io.ReaderAt, state *DownloadState, name string, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.out, s.state, s.name, s.size = out, state, name, size
+}
+
+// finish switches to serving the finished file at path, or, if err is set,
+// fails the reads still waiting. It must be called before the output file
+// passed to start is closed. Only the first call counts.
+func (s *LiveServer) finish(path string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.ended:
+		return
+	default:
+	}
+	s.out, s.final = nil, path
+	if err != nil {
+		s.err = errors.Join(ErrLiveDownloadFailed, err)
+	}
+	close(s.ended)
+}
+
+func (s *LiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	name, size, started := s.name, s.size, s.state != nil
+	s.mu.RUnlock()
+	if !started {
+		http.Error(w, "the download has not started yet", http.StatusServiceUnavailable)
+		return
+	}
+	lr := &liveReader{s: s, ctx: r.Context(), size: size}
+	defer lr.close()
+	// ServeContent handles Range requests and sets Content-Length and
+	// Accept-Ranges.
+	http.ServeContent(w, r, name, time.Time{}, lr)
+}
+
+// liveReader is an io.ReadSeeker over the file of a LiveServer for one
+// request.
+type liveReader struct {
+	s    *LiveServer
+	ctx  context.Context
+	size int64
+	off  int64
+	f    *os.File // the finished file, once switched to it
+}
+
+func (r *liveReader) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	for {
+		n, ok, err := r.readLive(p)
+		if ok {
+			return n, err
+		}
+		select {
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case <-r.s.ended:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// readLive reads from the output file if the bytes at r.off are there, or
+// from the finished file once there is one. ok is false if there is
+// nothing to read yet.
+func (r *liveReader) readLive(p []byte) (n int, ok bool, err error) {
+	s := r.s
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	switch {
+	case s.out != nil:
+		avail := s.state.available(r.off)
+		if avail == 0 {
+			return 0, false, nil
+		}
+		n, err = s.out.ReadAt(p[:min(int64(len(p)), avail)], r.off)
+	case s.err != nil:
+		return 0, true, s.err
+	default:
+		if r.f == nil {
+			if r.f, err = os.Open(s.final); err != nil {
+				return 0, true, err
+			}
+		}
+		n, err = r.f.ReadAt(p[:min(int64(len(p)), r.size-r.off)], r.off)
+	}
+	r.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, true, err
+}
+
+func (r *liveReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the file")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+func (r *liveReader) close() {
+	if r.f != nil {
+		r.f.Close()
+	}
+}
+
+// available returns how many bytes from off on have been downloaded, up to
+// the end of the chunk holding off.
+func (s *DownloadState) available(off int64) int64 {
+	s.chunksMu.RLock()
+	defer s.chunksMu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.Chunks {
+		if off >= c.Start && off <= c.End {
+			return max(c.Start+atomic.LoadInt64(&c.Downloaded)-off, 0)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// ErrLocked means another gdl instance kept the output file locked for
+// longer than DownloadConfig.LockWait.
+var ErrLocked = errors.New("another gdl instance is downloading this file")
+
+// lockOutput takes an advisory lock on fileName's .gdl.lock sidecar, so that
+// two gdl instances never write the same file at once. If another instance
+// holds it, lockOutput waits, for at most cfg.LockWait if that is set.
+// unlock removes the sidecar and releases the lock; calling it again does
+// nothing.
+func lockOutput(ctx context.Context, fileName string, cfg DownloadConfig) (unlock func(), err error) {
+	path := fileName + ".gdl.lock"
+	waited := false
+	for {
+		l := flock.New(path)
+		ok, err := l.TryLock()
+		if err != nil {
+			return nil, fmt.Errorf("locking %s: %w", path, err)
+		}
+		if !ok {
+			if !waited {
+				cfg.printf("Another gdl instance is downloading this file. Waiting...\n")
+				waited = true
+			}
+			if ok, err = waitLock(ctx, l, cfg.LockWait); !ok {
+				return nil, err
+			}
+		}
+		// The instance we waited for removed the sidecar before unlocking
+		// it, so this lock is on a file nobody else will open. Take the
+		// lock again on a new one.
+		if _, err := os.Stat(path); err != nil {
+			l.Close()
+			continue
+		}
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				os.Remove(path)
+				l.Close()
+			})
+		}, nil
+	}
+}
+
+// waitLock retries l until it is free, ctx is done or wait, if positive,
+// has passed.
+func waitLock(ctx context.Context, l *flock.Flock, wait time.Duration) (bool, error) {
+	waitCtx := ctx
+	if wait > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, wait)
+		defer cancel()
+	}
+	ok, err := l.TryLockContext(waitCtx, 250*time.Millisecond)
+	if ok {
+		return true, nil
+	}
+	l.Close()
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false, fmt.Errorf("%w (gave up after %s)", ErrLocked, wait)
+	}
+	return false, err
+}
@@ -0,0 +1,93 @@
+package downloader_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+)
+
+// raceForLock starts two downloads of the same file at once, each waiting at
+// most lockWait for the other, and returns their errors and what they
+// printed.
+func raceForLock(t *testing.T, lockWait time.Duration) (errs []error, out string, path string) {
+	t.Helper()
+	content := testserver.RandomContent(300_000, 40)
+	srv := testserver.NewTestServer(t, content)
+	srv.SetThrottleBps(250_000) // 600ms for each connection's half
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 2)
+	cfg.Quiet = false
+	cfg.LockWait = lockWait
+
+	errs = make([]error, 2)
+	start := make(chan struct{})
+	output := captureStdout(t, func() {
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				errs[i] = downloader.NewDownloader().Download(cfg)
+			}()
+		}
+		close(start)
+		wg.Wait()
+	})
+	path = filepath.Join(cfg.OutputDir, "data.bin")
+	checkFile(t, path, content)
+	return errs, string(output), path
+}
+
+func TestLockWaitsForOtherDownload(t *testing.T) {
+	errs, out, path := raceForLock(t, 10*time.Second)
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("download %d: %v", i, err)
+		}
+	}
+	if n := strings.Count(out, "Waiting..."); n != 1 {
+		t.Errorf(`"Waiting..." printed %d times, want once by the download that lost the race`, n)
+	}
+	checkNoState(t, path)
+	checkNoLock(t, path)
+}
+
+func TestLockWaitTimesOut(t *testing.T) {
+	errs, out, path := raceForLock(t, 150*time.Millisecond)
+	var failed, ok int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, downloader.ErrLocked):
+			failed++
+			if !strings.Contains(err.Error(), "gave up after 150ms") {
+				t.Errorf("error %q does not say how long it waited", err)
+			}
+		default:
+			t.Errorf("download failed: %v", err)
+		}
+	}
+	if ok != 1 || failed != 1 {
+		t.Errorf("%d downloads succeeded and %d timed out, want one each", ok, failed)
+	}
+	if !strings.Contains(out, "Waiting...") {
+		t.Error(`"Waiting..." was not printed`)
+	}
+	checkNoLock(t, path)
+}
+
+// checkNoLock fails t if a lock file was left next to path.
+func checkNoLock(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path + ".gdl.lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
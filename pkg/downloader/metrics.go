@@ -0,0 +1,72 @@
+package downloader
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+// MetricRoundTripper counts how many requests got a fresh connection versus
+// one reused from the idle pool, and how many response body bytes were read.
+type MetricRoundTripper struct {
+	Base http.RoundTripper
+
+	newConns    atomic.Int64
+	reusedConns atomic.Int64
+	received    atomic.Int64
+}
+
+func (m *MetricRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				m.reusedConns.Add(1)
+			} else {
+				m.newConns.Add(1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := m.Base.RoundTrip(req)
+	if err == nil {
+		resp.Body = &countingBody{ReadCloser: resp.Body, n: &m.received}
+	}
+	return resp, err
+}
+
+// countingBody adds the bytes read from a response body to n.
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// Stats returns the number of new and reused connections so far.
+func (m *MetricRoundTripper) Stats() (newConns, reused int64) {
+	return m.newConns.Load(), m.reusedConns.Load()
+}
+
+// BytesReceived returns how many bytes of HTTP response bodies the
+// downloader has read, including data that was later thrown away, such as
+// that of a failed chunk. It is zero if Client was replaced.
+func (d *Downloader) BytesReceived() int64 {
+	if d.metrics == nil {
+		return 0
+	}
+	return d.metrics.received.Load()
+}
+
+// ConnectionStats returns how many connections the downloader opened and how
+// many requests reused a pooled one. Both are zero if Client was replaced.
+func (d *Downloader) ConnectionStats() (newConns, reused int64) {
+	if d.metrics == nil {
+		return 0, 0
+	}
+	return d.metrics.Stats()
+}
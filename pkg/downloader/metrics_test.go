@@ -0,0 +1,42 @@
+package downloader_test
+
+import (
+	"fmt"
+	"testing"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+)
+
+func TestBatchReusesConnections(t *testing.T) {
+	content := testserver.RandomContent(200_000, 20)
+	srv := testserver.NewTestServer(t, content)
+	d := downloader.NewDownloader()
+
+	// Five downloads from the same host, one after another through one
+	// Downloader, as 'gdl batch' runs them.
+	const files, concurrency = 5, 4
+	for i := 0; i < files; i++ {
+		cfg := quietConfig(t, srv.FileURL(fmt.Sprintf("file%d.bin", i)), concurrency)
+		if err := d.Download(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newConns, reused := d.ConnectionStats()
+	requests := int64(len(srv.RequestLog()))
+	if newConns+reused != requests {
+		t.Errorf("ConnectionStats() = %d new + %d reused, want %d requests in all", newConns, reused, requests)
+	}
+	if reused == 0 {
+		t.Fatalf("no connection was reused over %d requests", requests)
+	}
+	// Only the first download should need to open its connections; the
+	// later ones find them idle in the pool.
+	if newConns > concurrency+1 {
+		t.Errorf("opened %d connections, want at most %d", newConns, concurrency+1)
+	}
+	if got := d.BytesReceived(); got < files*int64(len(content)) {
+		t.Errorf("BytesReceived() = %d, want at least %d", got, files*len(content))
+	}
+}
@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// MultiSourceDownload downloads cfg.Url with its chunks spread over cfg.Url
+// and mirrors at the same time, unlike failover, which only moves to another
+// mirror once one fails. Every mirror must serve the same file.
+func (d *Downloader) MultiSourceDownload(ctx context.Context, cfg DownloadConfig, mirrors []string) error {
+	// A fresh slice: appending could write into the caller's array.
+	cfg.Mirrors = slices.Concat(cfg.Mirrors, mirrors)
+	return d.DownloadContext(ctx, cfg)
+}
+
+// sourceSet assigns the chunks of a download to its sources. Chunks are
+// split into contiguous blocks, one per source, so with two sources and
+// four chunks, chunks 0 and 1 use the first source and 2 and 3 the second.
+// A chunk that fails moves on to the next source.
+type sourceSet struct {
+	mu     sync.Mutex
+	urls   []string
+	chunks int
+	moved  map[int]int // chunk ID to how many sources it has moved on
+}
+
+func newSourceSet(urls []string, chunks int) *sourceSet {
+	return &sourceSet{urls: urls, chunks: max(chunks, 1), moved: make(map[int]int)}
+}
+
+// index returns the source chunk id is assigned to.
+func (s *sourceSet) index(id int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return (id*len(s.urls)/s.chunks + s.moved[id]) % len(s.urls)
+}
+
+// fail moves chunk id on to the next source.
+func (s *sourceSet) fail(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moved[id]++
+}
+
+// probeMirrors checks that each mirror serves a file of size bytes with
+// range support and returns the ones that do. The others are reported and
+// left out rather than failing the whole download.
+func (d *Downloader) probeMirrors(ctx context.Context, mirrors []string, headers http.Header, size int64, cfg DownloadConfig) []string {
+	var usable []string
+	for _, m := range mirrors {
+		info, err := d.ProbeContext(ctx, m, headers)
+		switch {
+		case err != nil:
+			cfg.printf("Warning: skipping mirror %s: %v\n", m, err)
+		case info.Size != size:
+			cfg.printf("Warning: skipping mirror %s: size %d differs from %d\n", m, info.Size, size)
+		case !info.RangeSupported:
+			cfg.printf("Warning: skipping mirror %s: no range support\n", m)
+		default:
+			usable = append(usable, m)
+		}
+	}
+	return usable
+}
+
+// chunkURL returns the URL chunk c is downloaded from: its mirror if the
+// download uses several, otherwise the current URL.
+func (t *transfer) chunkURL(c *ChunkState) string {
+	if t.sources == nil {
+		return t.currentURL()
+	}
+	if i := t.sources.index(c.ID); i > 0 {
+		return t.sources.urls[i]
+	}
+	return t.currentURL()
+}
+
+// failSource moves chunk c on to another source, if there is one.
+func (t *transfer) failSource(c *ChunkState, err error) {
+	if t.sources == nil {
+		return
+	}
+	from := t.chunkURL(c)
+	t.sources.fail(c.ID)
+	slog.Warn("mirror failed, switching", "chunk", c.ID, "from", from, "to", t.chunkURL(c), "error", err)
+}
+
+// addMirrors appends the advertised mirrors that aren't url or already in
+// mirrors.
+func addMirrors(mirrors, advertised []string, url string) []string {
+	mirrors = slices.Clone(mirrors)
+	for _, m := range advertised {
+		if m != url && !slices.Contains(mirrors, m) {
+			mirrors = append(mirrors, m)
+		}
+	}
+	return mirrors
+}
@@ -0,0 +1,72 @@
+package downloader_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+)
+
+func TestNoClobberKeepsEmptyFile(t *testing.T) {
+	content := testserver.RandomContent(50_000, 70)
+	srv := testserver.NewTestServer(t, content)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 2)
+	cfg.NoClobber = true
+	path := filepath.Join(cfg.OutputDir, "data.bin")
+	// Even an empty file, which --skip-existing would replace, is kept.
+	writeFile(t, path, nil)
+
+	err := downloader.NewDownloader().Download(cfg)
+	if !errors.Is(err, downloader.ErrFileExists) {
+		t.Fatalf("Download() error = %v, want ErrFileExists", err)
+	}
+	checkFile(t, path, nil)
+	if n := len(rangeGETs(srv)); n != 0 {
+		t.Errorf("made %d GET requests for a file it won't write", n)
+	}
+
+	cfg.NoClobber = false
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, content)
+}
+
+func TestNoClobberResumesPartialDownload(t *testing.T) {
+	content := testserver.RandomContent(100_000, 71)
+	srv := testserver.NewTestServer(t, content)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 2)
+	cfg.NoClobber = true
+	path := filepath.Join(cfg.OutputDir, "data.bin")
+
+	// A download that got half of its first chunk.
+	partial := make([]byte, len(content))
+	copy(partial, content[:25_000])
+	writeFile(t, path, partial)
+	state := &downloader.DownloadState{
+		URL:         cfg.Url,
+		File:        path,
+		Size:        int64(len(content)),
+		Concurrency: 2,
+		Chunks: []*downloader.ChunkState{
+			{ID: 0, Start: 0, End: 49_999, Downloaded: 25_000},
+			{ID: 1, Start: 50_000, End: 99_999},
+		},
+	}
+	if err := state.Save(path + ".gdl.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatalf("resuming with --no-clobber: %v", err)
+	}
+	checkFile(t, path, content)
+	checkNoState(t, path)
+	for _, r := range rangeGETs(srv) {
+		if r == "bytes=0-49999" {
+			t.Error("the first chunk was downloaded again from the start")
+		}
+	}
+}
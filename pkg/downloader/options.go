@@ -0,0 +1,178 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"gdl/pkg/dnsprefetch"
+	"gdl/pkg/wpad"
+)
+
+// DownloaderOption configures a Downloader created by NewDownloader.
+type DownloaderOption func(*Downloader)
+
+// WithIdleConnTimeout sets how long an idle pooled connection is kept.
+// Lower it for CDNs that drop idle connections early (default 90s).
+func WithIdleConnTimeout(timeout time.Duration) DownloaderOption {
+	return func(d *Downloader) {
+		d.transport.IdleConnTimeout = timeout
+	}
+}
+
+// WithResponseHeaderTimeout bounds the wait for response headers after a
+// request has been sent. Zero means no limit.
+func WithResponseHeaderTimeout(timeout time.Duration) DownloaderOption {
+	return func(d *Downloader) {
+		d.transport.ResponseHeaderTimeout = timeout
+	}
+}
+
+// WithExpectContinueTimeout bounds the wait for a "100 Continue" response.
+func WithExpectContinueTimeout(timeout time.Duration) DownloaderOption {
+	return func(d *Downloader) {
+		d.transport.ExpectContinueTimeout = timeout
+	}
+}
+
+// WithMaxConnAge stops reusing connections older than age. Zero means no limit.
+func WithMaxConnAge(age time.Duration) DownloaderOption {
+	return func(d *Downloader) {
+		d.maxConnAge = age
+	}
+}
+
+// WithHTTP2 negotiates HTTP/2 with servers that support it. It is off by
+// default because chunks then share a single TCP connection, which is
+// usually slower than one connection per chunk.
+func WithHTTP2() DownloaderOption {
+	return func(d *Downloader) {
+		d.transport.ForceAttemptHTTP2 = true
+		d.transport.TLSNextProto = nil
+	}
+}
+
+// WithHTTP2PushCapture enables HTTP/2 and saves checksum and signature files
+// the server offers to push next to the downloaded file.
+func WithHTTP2PushCapture() DownloaderOption {
+	return func(d *Downloader) {
+		WithHTTP2()(d)
+		d.push = &PushCachingTransport{Base: d.transport}
+		d.metrics.Base = d.push
+	}
+}
+
+// WithResolve dials the address in overrides instead of resolving a
+// "host:port" key, like curl's --resolve. TLS still uses the host name.
+func WithResolve(overrides map[string]string) DownloaderOption {
+	return func(d *Downloader) {
+		d.resolve = overrides
+	}
+}
+
+// WithDNSCache dials hosts in addrs, a map of hostname to addresses such as
+// dnsprefetch.PrefetchAll returns, without looking them up again.
+func WithDNSCache(addrs map[string][]string) DownloaderOption {
+	return func(d *Downloader) {
+		d.dns = dnsprefetch.NewResolver(addrs)
+	}
+}
+
+// WithProbeCache keeps up to size Probe results in memory for ttl (5 minutes
+// if zero), so batches that list a URL more than once probe it only once.
+func WithProbeCache(size int, ttl time.Duration) DownloaderOption {
+	return func(d *Downloader) {
+		d.probeCache = newProbeCache(size, ttl)
+	}
+}
+
+// WithHappyEyeballs sets how long a dial waits on the preferred address
+// family (usually IPv6) before racing a connection over the other one
+// (default 300ms). On dual-stack networks where one family is unreachable
+// this keeps connection setup close to the delay instead of a full timeout.
+// A negative delay disables the fallback. It has no effect with
+// EnableCDNFailover, which dials one address at a time.
+func WithHappyEyeballs(delay time.Duration) DownloaderOption {
+	return func(d *Downloader) {
+		d.dialer.FallbackDelay = delay
+	}
+}
+
+// WithBindAddress makes outgoing connections from the local IP address
+// addr, e.g. a Kubernetes pod's IP so that NetworkPolicy rules apply to
+// them. Only servers reachable over addr's IP version are dialed. An addr
+// that is not an IP address is ignored.
+func WithBindAddress(addr string) DownloaderOption {
+	return func(d *Downloader) {
+		if ip := net.ParseIP(addr); ip != nil {
+			d.dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+	}
+}
+
+// WithAutoProxy sends each request through the proxy that the network's
+// WPAD/PAC configuration picks for it. If no configuration is found,
+// requests go direct.
+func WithAutoProxy() DownloaderOption {
+	return func(d *Downloader) {
+		var warnOnce sync.Once
+		d.transport.Proxy = func(req *http.Request) (*neturl.URL, error) {
+			proxy, err := wpad.FindProxy(req.URL.String())
+			if err != nil {
+				warnOnce.Do(func() {
+					slog.Warn("auto proxy unavailable, connecting directly", "error", err)
+				})
+				return nil, nil
+			}
+			if proxy == "" {
+				return nil, nil
+			}
+			return neturl.Parse(proxy)
+		}
+	}
+}
+
+var errConnExpired = errors.New("connection exceeded its maximum age")
+
+// ageConn fails the first write after it expires. The transport treats a
+// failed first write on a reused connection as "nothing sent" and retries
+// the request on a fresh connection, which is exactly what we want.
+type ageConn struct {
+	net.Conn
+	expires   time.Time
+	closeOnce sync.Once
+}
+
+func (c *ageConn) Write(p []byte) (int, error) {
+	if time.Now().After(c.expires) {
+		c.closeOnce.Do(func() { c.Conn.Close() })
+		return 0, errConnExpired
+	}
+	return c.Conn.Write(p)
+}
+
+// dialContext is the transport's dial function. It layers address overrides,
+// CDN failover, prefetched DNS and connection ageing on top of the plain
+// dialer.
+func (d *Downloader) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if to, ok := d.resolve[addr]; ok {
+		addr = to
+	}
+	dial := d.dialer.DialContext
+	if d.cdn != nil {
+		dial = d.cdn.DialContext(dial)
+	}
+	if d.dns != nil {
+		dial = d.dns.DialContext(dial)
+	}
+	conn, err := dial(ctx, network, addr)
+	if err != nil || d.maxConnAge <= 0 {
+		return conn, err
+	}
+	return &ageConn{Conn: conn, expires: time.Now().Add(d.maxConnAge)}, nil
+}
@@ -0,0 +1,157 @@
+package downloader
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"gdl/pkg/testserver"
+)
+
+// dualStackResolver resolves every name to both ::1 and 127.0.0.1, as DNS
+// does for a dual-stack host.
+func dualStackResolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveDualStackDNS(server)
+			return client, nil
+		},
+	}
+}
+
+// serveDualStackDNS answers DNS queries in TCP framing on c, which is what
+// the Go resolver speaks over a connection that is not a PacketConn.
+func serveDualStackDNS(c net.Conn) {
+	defer c.Close()
+	for {
+		var size [2]byte
+		if _, err := io.ReadFull(c, size[:]); err != nil {
+			return
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(c, msg); err != nil {
+			return
+		}
+		var p dnsmessage.Parser
+		h, err := p.Start(msg)
+		if err != nil {
+			return
+		}
+		q, err := p.Question()
+		if err != nil {
+			return
+		}
+
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true})
+		b.StartQuestions()
+		b.Question(q)
+		b.StartAnswers()
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+		switch q.Type {
+		case dnsmessage.TypeA:
+			b.AResource(rh, dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+		case dnsmessage.TypeAAAA:
+			b.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}})
+		}
+		resp, err := b.Finish()
+		if err != nil {
+			return
+		}
+		if _, err := c.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestHappyEyeballsFallsBackToIPv4(t *testing.T) {
+	if ln, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skip("no IPv6 on this machine:", err)
+	} else {
+		ln.Close()
+	}
+	srv := testserver.NewTestServer(t, []byte("dual-stack"))
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, delay := range []time.Duration{100 * time.Millisecond, 400 * time.Millisecond} {
+		t.Run(delay.String(), func(t *testing.T) {
+			d := NewDownloader(WithHappyEyeballs(delay))
+			d.dialer.Resolver = dualStackResolver()
+			var mu sync.Mutex
+			var dialed []string
+			d.dialer.ControlContext = func(ctx context.Context, network, address string, c syscall.RawConn) error {
+				mu.Lock()
+				dialed = append(dialed, network)
+				mu.Unlock()
+				if network == "tcp6" {
+					// A black-holed IPv6 route: the connection never
+					// completes, until the IPv4 one wins the race.
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				return nil
+			}
+
+			start := time.Now()
+			info, err := d.Probe("http://dualstack.test:"+u.Port()+"/data.bin", nil)
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size != int64(len("dual-stack")) {
+				t.Errorf("Probe() size = %d", info.Size)
+			}
+			if elapsed < delay || elapsed > delay+2*time.Second {
+				t.Errorf("connected after %v, want just after the %v fallback delay", elapsed, delay)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(dialed) != 2 || dialed[0] != "tcp6" || dialed[1] != "tcp4" {
+				t.Errorf("dialed %v, want IPv6 first, then IPv4", dialed)
+			}
+		})
+	}
+}
+
+func TestBindAddress(t *testing.T) {
+	// All of 127.0.0.0/8 is the loopback interface on Linux; elsewhere only
+	// 127.0.0.1 may be.
+	if ln, err := net.Listen("tcp4", "127.0.0.2:0"); err != nil {
+		t.Skip("127.0.0.2 is not a local address here:", err)
+	} else {
+		ln.Close()
+	}
+	srv := testserver.NewTestServer(t, []byte("bound"))
+
+	for _, addr := range []string{"127.0.0.2", "not-an-ip"} {
+		d := NewDownloader(WithBindAddress(addr))
+		if _, err := d.Probe(srv.FileURL("data.bin"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log := srv.RequestLog()
+	if len(log) != 2 {
+		t.Fatalf("server got %d requests, want 2", len(log))
+	}
+	for i, want := range []string{"127.0.0.2", "127.0.0.1"} {
+		host, _, err := net.SplitHostPort(log[i].RemoteAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host != want {
+			t.Errorf("request %d came from %s, want %s", i, host, want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package downloader
+
+import (
+	"context"
+	"io"
+
+	"gdl/pkg/pipeline"
+	ftpsource "gdl/pkg/source/ftp"
+	sftpsource "gdl/pkg/source/sftp"
+)
+
+// openChunk is openRange for a chunk of t. With cfg.PipelineDepth above 1
+// the range is fetched as a pipeline of smaller range requests.
+func (d *Downloader) openChunk(ctx context.Context, t *transfer, url string, start, end, size int64) (io.ReadCloser, error) {
+	if t.pipelineDepth < 2 || ftpsource.IsFTP(url) || sftpsource.IsSFTP(url) {
+		return d.openRange(ctx, url, start, end, t.headers, size)
+	}
+	p := &pipeline.PipelinedDownloader{
+		Fetch: func(ctx context.Context, start, end int64) (io.ReadCloser, error) {
+			return d.openRange(ctx, url, start, end, t.headers, size)
+		},
+		Depth: t.pipelineDepth,
+	}
+	return p.Open(ctx, start, end)
+}
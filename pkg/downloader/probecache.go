@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultProbeCacheTTL is used when WithProbeCache is given no TTL.
+const defaultProbeCacheTTL = 5 * time.Minute
+
+// probeCache is an LRU cache of Probe results keyed by URL.
+type probeCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type probeEntry struct {
+	url     string
+	info    FileInfo
+	expires time.Time
+}
+
+func newProbeCache(size int, ttl time.Duration) *probeCache {
+	if ttl <= 0 {
+		ttl = defaultProbeCacheTTL
+	}
+	return &probeCache{size: size, ttl: ttl, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns a copy of the cached result for url, if still fresh.
+func (c *probeCache) get(url string) (*FileInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[url]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*probeEntry)
+	if time.Now().After(e.expires) {
+		c.order.Remove(el)
+		delete(c.entries, url)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	info := e.info
+	return &info, true
+}
+
+func (c *probeCache) put(url string, info *FileInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &probeEntry{url: url, info: *info, expires: time.Now().Add(c.ttl)}
+	if el, ok := c.entries[url]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[url] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*probeEntry).url)
+	}
+}
+
+// remove drops url's entry, once its result is known to be stale.
+func (c *probeCache) remove(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[url]; ok {
+		c.order.Remove(el)
+		delete(c.entries, url)
+	}
+}
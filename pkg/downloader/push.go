@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// pushedExts are the companion files worth capturing next to a download.
+var pushedExts = []string{".sha256", ".sha512", ".sha1", ".md5", ".asc", ".sig"}
+
+// PushCachingTransport remembers the checksum and signature files a server
+// offers to push alongside a response. Go's HTTP/2 client refuses pushed
+// streams (it advertises SETTINGS_ENABLE_PUSH=0), so the offers are read
+// from the Link rel=preload headers push-capable servers derive their
+// pushes from, and fetched afterwards.
+type PushCachingTransport struct {
+	Base http.RoundTripper
+
+	mu     sync.Mutex
+	pushed map[string][]string // request URL -> offered resource URLs
+}
+
+func (p *PushCachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := p.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var offered []string
+	for _, link := range resp.Header.Values("Link") {
+		for _, target := range preloadLinks(link) {
+			u, err := req.URL.Parse(target)
+			if err != nil || !isPushedCompanion(u) {
+				continue
+			}
+			offered = append(offered, u.String())
+		}
+	}
+	if len(offered) > 0 {
+		p.mu.Lock()
+		if p.pushed == nil {
+			p.pushed = make(map[string][]string)
+		}
+		key := req.URL.String()
+		for _, u := range offered {
+			if !contains(p.pushed[key], u) {
+				p.pushed[key] = append(p.pushed[key], u)
+			}
+		}
+		p.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// Pushed returns the resources offered with responses for rawURL.
+func (p *PushCachingTransport) Pushed(rawURL string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.pushed[rawURL]...)
+}
+
+// preloadLinks returns the targets of the rel=preload entries of a Link
+// header value.
+func preloadLinks(header string) []string {
+	var targets []string
+	for _, entry := range strings.Split(header, ",") {
+		target, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(k, "rel") && strings.EqualFold(strings.Trim(v, `"`), "preload") {
+				targets = append(targets, target[1:len(target)-1])
+				break
+			}
+		}
+	}
+	return targets
+}
+
+func isPushedCompanion(u *neturl.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	return contains(pushedExts, ext)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// savePushed stores the companion files offered with rawURL in dir.
+func (d *Downloader) savePushed(ctx context.Context, rawURL string, headers http.Header, dir string, cfg DownloadConfig) {
+	for _, u := range d.push.Pushed(rawURL) {
+		name, err := d.fetchPushed(ctx, u, headers, dir)
+		if err != nil {
+			cfg.printf("Warning: could not save pushed %s: %v\n", u, err)
+			continue
+		}
+		cfg.printf("Saved pushed resource %s\n", name)
+	}
+}
+
+func (d *Downloader) fetchPushed(ctx context.Context, rawURL string, headers http.Header, dir string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	setHeaders(req, headers)
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp)
+	}
+
+	name := filepath.Join(dir, parseFilename(resp.Header.Get("Content-Disposition"), rawURL))
+	f, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return "", fmt.Errorf("writing %s: %w", name, err)
+	}
+	return name, f.Close()
+}
@@ -0,0 +1,48 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"gdl/pkg/useragent"
+)
+
+// acceptsRangeAt reports whether url answers a range request starting at
+// offset with 206 Partial Content.
+func (d *Downloader) acceptsRangeAt(ctx context.Context, url string, offset int64, headers http.Header) bool {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset))
+	req.Header.Set("User-Agent", useragent.Default)
+	setHeaders(req, headers)
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusPartialContent
+}
+
+// splitForRanges is tried when a single-connection download, from a server
+// that did not advertise range support, fails part way. Some servers accept
+// ranges after all, or only some of the nodes behind a load balancer do. If
+// a range from where the download stopped now works, the single chunk is
+// cut there, the rest is split into n new chunks, and true is returned.
+func (d *Downloader) splitForRanges(ctx context.Context, url string, headers http.Header, state *DownloadState, n int) bool {
+	if len(state.Chunks) != 1 || n < 1 {
+		return false
+	}
+	first := state.Chunks[0]
+	offset := first.Start + first.Downloaded
+	if offset == 0 || offset > first.End || !d.acceptsRangeAt(ctx, url, offset, headers) {
+		return false
+	}
+
+	n = int(min(int64(n), first.End-offset+1))
+	state.split(first, offset, n)
+	return true
+}
@@ -0,0 +1,94 @@
+package downloader_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/fileutil"
+	"gdl/pkg/testserver"
+)
+
+func TestDownloadRefusesEscapingPaths(t *testing.T) {
+	content := testserver.RandomContent(10_000, 50)
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim.txt")
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, srv *testserver.TestServer, cfg *downloader.DownloadConfig)
+	}{
+		{"server name through a planted symlink", func(t *testing.T, srv *testserver.TestServer, cfg *downloader.DownloadConfig) {
+			srv.SetFilename("report.pdf")
+			symlink(t, victim, filepath.Join(cfg.OutputDir, "report.pdf"))
+		}},
+		{"output name with dot-dot", func(t *testing.T, srv *testserver.TestServer, cfg *downloader.DownloadConfig) {
+			cfg.OutputName = "../victim.txt"
+		}},
+		{"absolute output name under --dir", func(t *testing.T, srv *testserver.TestServer, cfg *downloader.DownloadConfig) {
+			cfg.OutputName = victim
+		}},
+		{"output name through a planted symlink", func(t *testing.T, srv *testserver.TestServer, cfg *downloader.DownloadConfig) {
+			cfg.OutputName = "out.bin"
+			symlink(t, victim, filepath.Join(cfg.OutputDir, "out.bin"))
+		}},
+		{"output path that is a planted symlink", func(t *testing.T, srv *testserver.TestServer, cfg *downloader.DownloadConfig) {
+			cfg.OutputName = filepath.Join(cfg.OutputDir, "out.bin")
+			cfg.OutputDir = ""
+			symlink(t, victim, cfg.OutputName)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeFile(t, victim, []byte("precious"))
+			srv := testserver.NewTestServer(t, content)
+			cfg := quietConfig(t, srv.FileURL("report.pdf"), 2)
+			tt.setup(t, srv, &cfg)
+
+			err := downloader.NewDownloader().Download(cfg)
+			if !errors.Is(err, fileutil.ErrEscapesBase) {
+				t.Errorf("Download() error = %v, want ErrEscapesBase", err)
+			}
+			checkFile(t, victim, []byte("precious"))
+			if n := len(rangeGETs(srv)); n != 0 {
+				t.Errorf("downloaded anyway, in %d requests", n)
+			}
+		})
+	}
+}
+
+func TestDownloadExplicitOutputPath(t *testing.T) {
+	content := testserver.RandomContent(10_000, 51)
+	srv := testserver.NewTestServer(t, content)
+
+	// Without --dir, --output may name any directory, absolute or not.
+	dir := t.TempDir()
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 2)
+	cfg.OutputDir = ""
+	cfg.OutputName = filepath.Join(dir, "nested", "..", "copy.bin")
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(dir, "copy.bin"), content)
+
+	t.Chdir(dir)
+	if err := os.Mkdir("work", 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir("work")
+	cfg.OutputName = "../up.bin"
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(dir, "up.bin"), content)
+}
+
+// symlink creates a symlink at link pointing to target, or skips t.
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("cannot create symlinks:", err)
+	}
+}
@@ -0,0 +1,23 @@
+package downloader
+
+import (
+	neturl "net/url"
+	"strings"
+
+	"gdl/pkg/urlutil"
+)
+
+// stripTracking returns cfg.Url without its tracking parameters, see
+// DownloadConfig.SanitizeURL.
+func stripTracking(cfg DownloadConfig) string {
+	u, err := neturl.Parse(cfg.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return cfg.Url
+	}
+	stripped, removed := urlutil.StripTracking(u, cfg.KeepParams)
+	if len(removed) == 0 {
+		return cfg.Url
+	}
+	cfg.printf("Removed tracking parameters from the URL: %s\n", strings.Join(removed, ", "))
+	return stripped.String()
+}
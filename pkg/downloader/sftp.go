@@ -0,0 +1,47 @@
+package downloader
+
+import (
+	"io"
+
+	sftpsource "gdl/pkg/source/sftp"
+)
+
+// sftpSource returns the cached source for url so that a password prompted
+// for during Probe is reused by the chunk download.
+func (d *Downloader) sftpSource(url string) (*sftpsource.SFTPSource, error) {
+	if src, ok := d.sftpSources.Load(url); ok {
+		return src.(*sftpsource.SFTPSource), nil
+	}
+	src, err := sftpsource.New(url, d.SFTP)
+	if err != nil {
+		return nil, err
+	}
+	d.sftpSources.Store(url, src)
+	return src, nil
+}
+
+func (d *Downloader) probeSFTP(url string) (*FileInfo, error) {
+	src, err := d.sftpSource(url)
+	if err != nil {
+		return nil, err
+	}
+	size, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// A single SFTP session is used for the whole transfer.
+	return &FileInfo{
+		Url:            url,
+		Name:           src.Name(),
+		Size:           size,
+		RangeSupported: false,
+	}, nil
+}
+
+func (d *Downloader) openSFTPRange(url string, start, end int64) (io.ReadCloser, error) {
+	src, err := d.sftpSource(url)
+	if err != nil {
+		return nil, err
+	}
+	return src.Open(start, end)
+}
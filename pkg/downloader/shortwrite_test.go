@@ -0,0 +1,53 @@
+package downloader_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+	"gdl/pkg/testutil/iofault"
+)
+
+// flakyUntil passes writes through sim until it has cut max of them short,
+// and straight to w after that, which keeps the retries' backoff short.
+type flakyUntil struct {
+	sim *iofault.ShortWriteSimulator
+	w   io.WriterAt
+	max int
+}
+
+func (f *flakyUntil) WriteAt(p []byte, off int64) (int, error) {
+	if f.sim.ShortWrites() < f.max {
+		return f.sim.WriteAt(p, off)
+	}
+	return f.w.WriteAt(p, off)
+}
+
+func TestShortWritesAreRetried(t *testing.T) {
+	content := testserver.RandomContent(2_000_000, 13)
+	srv := testserver.NewTestServer(t, content)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 4)
+	sink := &memSink{}
+	var sim *iofault.ShortWriteSimulator
+	cfg.Sink = func(info *downloader.FileInfo) (io.WriterAt, error) {
+		sink.buf = make([]byte, info.Size)
+		sim = iofault.NewShortWriteSimulator(sink, 0.5, 1)
+		return &flakyUntil{sim: sim, w: sink, max: 3}, nil
+	}
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if sim.ShortWrites() == 0 {
+		t.Fatal("no write was cut short")
+	}
+	if !bytes.Equal(sink.buf, content) {
+		t.Fatalf("the file is corrupt after %d short writes", sim.ShortWrites())
+	}
+	// Each short write requests the rest of its chunk again.
+	if gets := len(rangeGETs(srv)); gets < 4+sim.ShortWrites() {
+		t.Errorf("%d GETs for 4 chunks and %d short writes, want a retry for each", gets, sim.ShortWrites())
+	}
+}
@@ -0,0 +1,97 @@
+package downloader
+
+import (
+	"fmt"
+	"log/slog"
+	neturl "net/url"
+	"strconv"
+	"time"
+
+	"gdl/pkg/resolver"
+)
+
+// expiryMargin refreshes a signed URL slightly before it expires so that a
+// request started just in time doesn't fail.
+const expiryMargin = 30 * time.Second
+
+// signedURLExpiry returns when a pre-signed S3, GCS or Azure SAS URL or a
+// CloudFront signed URL stops working, from its X-Amz-Date/X-Amz-Expires,
+// X-Goog-Date/X-Goog-Expires, se or Expires/Policy query parameters.
+func signedURLExpiry(rawURL string) (time.Time, bool) {
+	if exp, ok := resolver.CloudFrontExpiry(rawURL); ok {
+		return exp, true
+	}
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return time.Time{}, false
+	}
+	q := u.Query()
+
+	for _, prefix := range []string{"X-Amz-", "X-Goog-"} {
+		date, expires := q.Get(prefix+"Date"), q.Get(prefix+"Expires")
+		if date == "" || expires == "" {
+			continue
+		}
+		signed, err := time.Parse("20060102T150405Z", date)
+		secs, err2 := strconv.Atoi(expires)
+		if err == nil && err2 == nil {
+			return signed.Add(time.Duration(secs) * time.Second), true
+		}
+	}
+	if se := q.Get("se"); se != "" && q.Get("sig") != "" {
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z", time.DateOnly} {
+			if t, err := time.Parse(layout, se); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// urlExpired reports whether rawURL is a signed URL that has expired or is
+// about to.
+func urlExpired(rawURL string) bool {
+	exp, ok := signedURLExpiry(rawURL)
+	return ok && time.Now().Add(expiryMargin).After(exp)
+}
+
+// refreshURL returns a fresh signed URL for cfg.Url: from cfg.URLRefresher
+// if set, otherwise by resolving cfg.Url again, which only helps when a
+// resolver (e.g. Google Drive) produced the signed URL.
+func (d *Downloader) refreshURL(cfg DownloadConfig) (string, error) {
+	if cfg.URLRefresher != nil {
+		return cfg.URLRefresher(cfg.Url)
+	}
+	fresh, _, err := resolver.Resolve(cfg.Url, resolver.Options{
+		WebDAVUser:     cfg.WebDAVUser,
+		WebDAVPass:     cfg.WebDAVPass,
+		TorrentDataDir: cfg.TorrentDataDir,
+	})
+	if err != nil {
+		return "", err
+	}
+	if urlExpired(fresh) {
+		return "", fmt.Errorf("signed URL for %s has expired and no URLRefresher is set", cfg.Url)
+	}
+	return fresh, nil
+}
+
+// currentURL returns the URL to request next, first swapping in a fresh one
+// if the signed URL has expired.
+func (t *transfer) currentURL() string {
+	t.urlMu.Lock()
+	defer t.urlMu.Unlock()
+	if t.refresh == nil || !urlExpired(t.url) {
+		return t.url
+	}
+
+	fresh, err := t.refresh()
+	if err != nil {
+		slog.Warn("could not refresh expired URL", "error", err)
+		return t.url
+	}
+	slog.Info("refreshed expired signed URL")
+	t.url = fresh
+	t.state.setURL(fresh)
+	return t.url
+}
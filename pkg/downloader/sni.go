@@ -0,0 +1,61 @@
+package downloader
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+)
+
+type sniKey struct{}
+
+// withSNI makes TLS connections dialed for requests with ctx present host
+// as the server name, whatever the URL's host is.
+func withSNI(ctx context.Context, host string) context.Context {
+	return context.WithValue(ctx, sniKey{}, host)
+}
+
+// dialTLSContext is the transport's TLS dial function. It sends the SNI
+// override from the request context, if any.
+func (d *Downloader) dialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := d.transport.TLSClientConfig.Clone()
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if sni, _ := ctx.Value(sniKey{}).(string); sni != "" {
+		cfg.ServerName = sni
+	} else if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	if d.transport.ForceAttemptHTTP2 && len(cfg.NextProtos) == 0 {
+		cfg.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	tc := tls.Client(conn, cfg)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// ParseResolve parses a curl-style "host:port:addr" override, returning the
+// "host:port" to match and the "addr:port" to dial instead.
+func ParseResolve(s string) (from, to string, err error) {
+	host, rest, ok1 := strings.Cut(s, ":")
+	port, addr, ok2 := strings.Cut(rest, ":")
+	if !ok1 || !ok2 || host == "" || port == "" || addr == "" {
+		return "", "", fmt.Errorf("invalid resolve %q, expected host:port:addr", s)
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if net.ParseIP(addr) == nil {
+		return "", "", fmt.Errorf("invalid resolve %q: %q is not an IP address", s, addr)
+	}
+	return net.JoinHostPort(host, port), net.JoinHostPort(addr, port), nil
+}
@@ -0,0 +1,51 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+
+	"gdl/pkg/sparkline"
+)
+
+// speedGraphWidth is both the number of one-second samples kept and the
+// width of the rendered sparkline.
+const speedGraphWidth = 60
+
+// speedGraph samples a bar's throughput once per second for a sparkline.
+type speedGraph struct {
+	mu      sync.Mutex
+	samples []float64
+}
+
+// run records the bytes added to bar each second until done is closed.
+func (g *speedGraph) run(bar *mpb.Bar, done <-chan struct{}) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	last := bar.Current()
+	for {
+		select {
+		case <-ticker.C:
+			cur := bar.Current()
+			g.mu.Lock()
+			g.samples = append(g.samples, float64(cur-last))
+			if len(g.samples) > speedGraphWidth {
+				g.samples = g.samples[1:]
+			}
+			g.mu.Unlock()
+			last = cur
+		case <-done:
+			return
+		}
+	}
+}
+
+func (g *speedGraph) decorator() decor.Decorator {
+	return decor.Any(func(decor.Statistics) string {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return " " + sparkline.Sparkline(g.samples, speedGraphWidth)
+	})
+}
@@ -0,0 +1,53 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+)
+
+// spinner shows a message with a spinner while a step with no progress to
+// report runs, such as resolving a cloud storage link, which can take a
+// few seconds.
+type spinner struct {
+	cfg *DownloadConfig
+	p   *mpb.Progress
+	bar *mpb.Bar
+}
+
+// spinner starts a spinner showing msg, unless cfg.Quiet is set.
+func (cfg *DownloadConfig) spinner(msg string) *spinner {
+	s := &spinner{cfg: cfg}
+	if cfg.Quiet {
+		return s
+	}
+	var out io.Writer = os.Stdout
+	if cfg.OutputName == StdoutName {
+		out = os.Stderr
+	}
+	s.p = mpb.New(mpb.WithWidth(1), mpb.WithOutput(out))
+	s.bar = s.p.AddSpinner(0, mpb.PrependDecorators(decor.Name(msg, decor.WCSyncSpaceR)))
+	return s
+}
+
+// printf prints like cfg.printf, above the spinner while it runs.
+func (s *spinner) printf(format string, a ...any) {
+	if s.p == nil {
+		s.cfg.printf(format, a...)
+		return
+	}
+	fmt.Fprintf(s.p, format, a...)
+}
+
+// stop removes the spinner. It may be called more than once.
+func (s *spinner) stop() {
+	if s.p == nil {
+		return
+	}
+	s.bar.Abort(true)
+	s.p.Wait()
+	s.p = nil
+}
@@ -1,66 +1,199 @@
 package downloader
 
 import (
-	"encoding/json"
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"gdl/pkg/statecodec"
 )
 
 type ChunkState struct {
-	ID         int   `json:"id"`
-	Start      int64 `json:"start"`
-	End        int64 `json:"end"`
-	Downloaded int64 `json:"downloaded"`
+	ID         int    `json:"id"`
+	Start      int64  `json:"start"`
+	End        int64  `json:"end"`
+	Downloaded int64  `json:"downloaded"`
+	CRC        uint32 `json:"crc,omitempty"` // CRC-32C of the downloaded bytes
+	Failed     bool   `json:"failed,omitempty"`
+	Error      string `json:"error,omitempty"`
 }
 
 type DownloadState struct {
 	URL         string        `json:"url"`
+	OriginalURL string        `json:"original_url,omitempty"` // as given, before resolving
+	Expires     time.Time     `json:"expires,omitzero"`       // when URL, if signed, expires
 	File        string        `json:"file"`
 	Size        int64         `json:"size"`
+	ETag        string        `json:"etag,omitempty"`
 	Concurrency int           `json:"concurrency"`
+	SplitSize   int64         `json:"split_size,omitempty"`
+	Volumes     []string      `json:"volumes,omitempty"`
 	Chunks      []*ChunkState `json:"chunks"`
-	mu          sync.Mutex
+	mu          sync.Mutex   // guards the chunks' fields other than Downloaded
+	chunksMu    sync.RWMutex // guards the Chunks slice itself
+	codec       statecodec.Codec // format Save writes; JSON if nil
 }
 
+// LoadState reads a state file in either format.
 func LoadState(filename string) (*DownloadState, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	var state DownloadState
-	if err := json.Unmarshal(data, &state); err != nil {
+	saved, err := statecodec.Decode(data)
+	if err != nil {
 		return nil, err
 	}
+	state := DownloadState{
+		URL:         saved.URL,
+		OriginalURL: saved.OriginalURL,
+		Expires:     saved.Expires,
+		File:        saved.File,
+		Size:        saved.Size,
+		ETag:        saved.ETag,
+		Concurrency: saved.Concurrency,
+		SplitSize:   saved.SplitSize,
+		Volumes:     saved.Volumes,
+		Chunks:      make([]*ChunkState, len(saved.Chunks)),
+	}
+	for i, c := range saved.Chunks {
+		state.Chunks[i] = &ChunkState{
+			ID:         c.ID,
+			Start:      c.Start,
+			End:        c.End,
+			Downloaded: c.Downloaded,
+			CRC:        c.CRC,
+			Failed:     c.Failed,
+			Error:      c.Error,
+		}
+	}
 	return &state, nil
 }
 
 func (s *DownloadState) Save(filename string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.chunksMu.RLock()
+	defer s.chunksMu.RUnlock()
 	
-	// Create a snapshot to avoid race conditions during json.Marshal
+	// Create a snapshot to avoid race conditions during encoding
 	// specifically for the Downloaded field which is updated atomically
-	snapshot := DownloadState{
+	snapshot := statecodec.State{
 		URL:         s.URL,
+		OriginalURL: s.OriginalURL,
+		Expires:     s.Expires,
 		File:        s.File,
 		Size:        s.Size,
+		ETag:        s.ETag,
 		Concurrency: s.Concurrency,
-		Chunks:      make([]*ChunkState, len(s.Chunks)),
+		SplitSize:   s.SplitSize,
+		Volumes:     s.Volumes,
+		Chunks:      make([]statecodec.Chunk, len(s.Chunks)),
 	}
 
 	for i, c := range s.Chunks {
-		snapshot.Chunks[i] = &ChunkState{
+		snapshot.Chunks[i] = statecodec.Chunk{
 			ID:         c.ID,
 			Start:      c.Start,
 			End:        c.End,
 			Downloaded: atomic.LoadInt64(&c.Downloaded),
+			CRC:        c.CRC,
+			Failed:     c.Failed,
+			Error:      c.Error,
 		}
 	}
 	
-	data, err := json.MarshalIndent(snapshot, "", "  ")
+	codec := s.codec
+	if codec == nil {
+		codec = statecodec.New(statecodec.JSON)
+	}
+	data, err := codec.Encode(&snapshot)
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(filename, data, 0644)
 }
+
+// Downloaded returns the number of bytes downloaded across all chunks.
+func (s *DownloadState) Downloaded() int64 {
+	s.chunksMu.RLock()
+	defer s.chunksMu.RUnlock()
+	var total int64
+	for _, c := range s.Chunks {
+		total += atomic.LoadInt64(&c.Downloaded)
+	}
+	return total
+}
+
+// MarkFailed records that c was given up on, so the state file shows which
+// ranges are missing.
+func (s *DownloadState) MarkFailed(c *ChunkState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.Failed = true
+	c.Error = err.Error()
+}
+
+// clearFailure forgets that c was given up on, before it is tried again.
+func (s *DownloadState) clearFailure(c *ChunkState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.Failed, c.Error = false, ""
+}
+
+// chunk returns the chunk with the given ID.
+func (s *DownloadState) chunk(id int) *ChunkState {
+	s.chunksMu.RLock()
+	defer s.chunksMu.RUnlock()
+	return s.Chunks[id]
+}
+
+// split cuts c short to end at offset-1 and adds n chunks that share the
+// bytes from offset to its old end between them.
+func (s *DownloadState) split(c *ChunkState, offset int64, n int) {
+	s.mu.Lock()
+	end := c.End
+	c.End = offset - 1
+	c.Failed, c.Error = false, ""
+	s.mu.Unlock()
+
+	s.chunksMu.Lock()
+	defer s.chunksMu.Unlock()
+	chunkSize := (end - offset + 1) / int64(n)
+	for i := 0; i < n; i++ {
+		start := offset + int64(i)*chunkSize
+		last := start + chunkSize - 1
+		if i == n-1 {
+			last = end
+		}
+		s.Chunks = append(s.Chunks, &ChunkState{ID: len(s.Chunks), Start: start, End: last})
+	}
+	s.Concurrency = n
+}
+
+// setURL records the URL being downloaded and, if it is signed, when it
+// expires.
+func (s *DownloadState) setURL(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.URL = url
+	s.Expires, _ = signedURLExpiry(url)
+}
+
+// advance records n more bytes of c, whose CRC-32C is now sum. Both change
+// together so a saved state never pairs a count with the wrong checksum.
+func (s *DownloadState) advance(c *ChunkState, n int64, sum uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	atomic.AddInt64(&c.Downloaded, n)
+	c.CRC = sum
+}
+
+// reset marks c as not downloaded at all and returns how many bytes it had.
+func (s *DownloadState) reset(c *ChunkState) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.CRC = 0
+	return atomic.SwapInt64(&c.Downloaded, 0)
+}
@@ -0,0 +1,66 @@
+package downloader_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+)
+
+// TestHighConcurrencyDownload runs many chunks at once while the state is
+// saved every second, chunks fail and resume, and progress is read, so that
+// 'go test -race' catches unguarded access to the download state.
+func TestHighConcurrencyDownload(t *testing.T) {
+	content := testserver.RandomContent(4<<20, 60)
+	srv := testserver.NewTestServer(t, content)
+	srv.SetThrottleBps(48 << 10) // 64KiB chunks take more than a second
+	srv.SetDropAfter(40 << 10)   // and are cut off part way
+
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 64)
+	path := filepath.Join(cfg.OutputDir, "data.bin")
+	var progress atomic.Int64
+	cfg.OnProgress = func(file string, downloaded, total int64) {
+		progress.Store(downloaded)
+	}
+
+	// Stop the first run while all chunks are busy, leaving a state file
+	// written while they were.
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	downloader.NewDownloader().DownloadContext(ctx, cfg)
+	state, err := downloader.LoadState(path + ".gdl.json")
+	if err != nil {
+		t.Fatalf("no state after an interrupted download: %v", err)
+	}
+	if len(state.Chunks) != 64 {
+		t.Fatalf("state has %d chunks, want 64", len(state.Chunks))
+	}
+	var saved int64
+	for _, c := range state.Chunks {
+		if c.Downloaded < 0 || c.Downloaded > c.End-c.Start+1 {
+			t.Errorf("chunk %d: %d bytes downloaded of %d-%d", c.ID, c.Downloaded, c.Start, c.End)
+		}
+		saved += c.Downloaded
+	}
+	if saved == 0 {
+		t.Error("the state records no progress")
+	}
+
+	srv.SetThrottleBps(0)
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, content)
+	checkNoState(t, path)
+	if got := progress.Load(); got != int64(len(content)) {
+		t.Errorf("last progress = %d, want %d", got, len(content))
+	}
+	if _, err := os.Stat(path + ".gdl.lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+
+	"gdl/pkg/compress"
+	"gdl/pkg/decompress"
+	"gdl/pkg/digest"
+	ftpsource "gdl/pkg/source/ftp"
+	sftpsource "gdl/pkg/source/sftp"
+	"gdl/pkg/useragent"
+)
+
+// StdoutName is the OutputName that streams the download to stdout.
+const StdoutName = "-"
+
+// openStream returns the whole body of url over a single connection.
+func (d *Downloader) openStream(ctx context.Context, url string, headers http.Header) (io.ReadCloser, error) {
+	if ftpsource.IsFTP(url) {
+		return d.openFTPRange(url, 0, -1)
+	}
+	if sftpsource.IsSFTP(url) {
+		return d.openSFTPRange(url, 0, -1)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", useragent.Default)
+	setHeaders(req, headers)
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, statusError(resp)
+	}
+	return resp.Body, nil
+}
+
+// streamTo copies url to w sequentially. The progress bar goes to stderr so
+// that w may be stdout. The bytes received are hashed as for a file, so a
+// checksum mismatch is still an error, if only once they have been written.
+func (d *Downloader) streamTo(ctx context.Context, w io.Writer, url string, headers http.Header, info *FileInfo, cfg DownloadConfig) error {
+	var sum hash.Hash
+	if algo := cfg.checksumAlgorithm(); algo != "" {
+		var err error
+		if sum, err = digest.NewHash(algo); err != nil {
+			return err
+		}
+	}
+	body, err := d.openStream(ctx, url, headers)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if len(cfg.Tee) > 0 {
+		tees, err := openTees(cfg.Tee)
+		if err != nil {
+			return err
+		}
+		defer closeTees(tees)
+		w = io.MultiWriter(w, io.NewOffsetWriter(tees, 0))
+	}
+
+	var barOutput io.Writer = os.Stderr
+	if cfg.Quiet {
+		barOutput = io.Discard
+	}
+	p := mpb.New(mpb.WithWidth(64), mpb.WithOutput(barOutput))
+	bar := p.AddBar(info.Size,
+		mpb.PrependDecorators(
+			decor.Name(info.Name),
+			decor.Percentage(decor.WCSyncSpace),
+		),
+		mpb.AppendDecorators(
+			decor.EwmaETA(decor.ET_STYLE_GO, 90),
+			decor.Name(" ] "),
+			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 60),
+		),
+	)
+
+	var src io.Reader = bar.ProxyReader(body)
+	if sum != nil {
+		src = io.TeeReader(src, sum)
+	}
+	if cfg.Decompress {
+		var zr io.ReadCloser
+		if zr, _, err = decompress.NewReader(src); err == nil {
+			defer zr.Close()
+			src = zr
+		}
+	}
+	if err == nil && cfg.Compress != "" {
+		var zw io.WriteCloser
+		if zw, err = compress.NewWriter(w, cfg.Compress, cfg.CompressLevel); err == nil {
+			if _, err = io.Copy(zw, src); err == nil {
+				err = zw.Close()
+			}
+		}
+	} else if err == nil {
+		_, err = io.Copy(w, src)
+	}
+	if err != nil || !bar.Completed() {
+		bar.Abort(false)
+	}
+	p.Wait()
+	if err != nil {
+		return fmt.Errorf("streaming %s: %w", info.Name, err)
+	}
+	if sum != nil {
+		cfg.printf("%s: %x\n", digest.Label(cfg.checksumAlgorithm()), sum.Sum(nil))
+		return cfg.verifyChecksum(sum.Sum(nil))
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package downloader_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"testing"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+)
+
+// captureStdout runs f with os.Stdout redirected to a pipe and returns what
+// f wrote to it.
+func captureStdout(t *testing.T, f func()) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- data
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestDownloadToStdout(t *testing.T) {
+	content := testserver.RandomContent(3<<20, 11)
+	srv := testserver.NewTestServer(t, content)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 8)
+	cfg.OutputName = downloader.StdoutName
+	// Progress and messages must go to stderr, not into the piped bytes.
+	cfg.Quiet = false
+
+	var err error
+	got := captureStdout(t, func() {
+		err = downloader.NewDownloader().Download(cfg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("stdout got %d bytes, want the %d served bytes", len(got), len(content))
+	}
+
+	var gets []http.Request
+	for _, r := range srv.RequestLog() {
+		if r.Method == http.MethodGet {
+			gets = append(gets, r)
+		}
+	}
+	if len(gets) != 1 || gets[0].Header.Get("Range") != "" {
+		t.Errorf("want a single GET without Range, got %d requests", len(gets))
+	}
+	if entries, _ := os.ReadDir(cfg.OutputDir); len(entries) > 0 {
+		t.Errorf("streaming to stdout wrote files: %v", entries)
+	}
+}
+
+func TestFailingHookKeepsStdoutClean(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook is a sh command")
+	}
+	content := testserver.RandomContent(100_000, 12)
+	srv := testserver.NewTestServer(t, content)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 1)
+	cfg.OutputName = downloader.StdoutName
+	cfg.Quiet = false
+	cfg.OnComplete = "echo from the hook; exit 3"
+
+	var err error
+	got := captureStdout(t, func() {
+		err = downloader.NewDownloader().Download(cfg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Neither the hook's output nor the warning about it may end up in
+	// the piped bytes.
+	if !bytes.Equal(got, content) {
+		t.Fatalf("stdout got %d bytes, want the %d served bytes", len(got), len(content))
+	}
+}
+
+func TestStreamVerifiesChecksum(t *testing.T) {
+	content := testserver.RandomContent(200_000, 14)
+	srv := testserver.NewTestServer(t, content)
+	sum := sha256.Sum256(content)
+	cfg := quietConfig(t, srv.FileURL("data.bin"), 1)
+	cfg.OutputName = downloader.StdoutName
+
+	cfg.Checksum = sum[:]
+	var err error
+	captureStdout(t, func() { err = downloader.NewDownloader().Download(cfg) })
+	if err != nil {
+		t.Fatalf("matching checksum: %v", err)
+	}
+
+	cfg.Checksum = make([]byte, sha256.Size)
+	captureStdout(t, func() { err = downloader.NewDownloader().Download(cfg) })
+	if !errors.Is(err, downloader.ErrChecksumMismatch) {
+		t.Fatalf("wrong checksum: got %v, want ErrChecksumMismatch", err)
+	}
+}
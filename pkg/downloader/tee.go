@@ -0,0 +1,79 @@
+package downloader
+
+import (
+	"cmp"
+	"io"
+	"slices"
+
+	"gdl/pkg/multiout"
+)
+
+// openTees opens the DownloadConfig.Tee outputs.
+func openTees(paths []string) (multiout.MultiWriteAt, error) {
+	var tees multiout.MultiWriteAt
+	for _, path := range paths {
+		out, err := multiout.Open(path)
+		if err != nil {
+			closeTees(tees)
+			return nil, err
+		}
+		tees = append(tees, out)
+	}
+	return tees, nil
+}
+
+func closeTees(tees multiout.MultiWriteAt) error {
+	var first error
+	for _, w := range tees {
+		if err := w.(io.Closer).Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// teeStreams reports whether any of paths only takes bytes in order.
+func teeStreams(paths []string) bool {
+	return slices.ContainsFunc(paths, multiout.IsStream)
+}
+
+// teeFile is an outputFile whose writes also go to the tee outputs. Reads
+// come from the output file alone.
+type teeFile struct {
+	outputFile
+	tees multiout.MultiWriteAt
+	all  multiout.MultiWriteAt // the output file, then the tees
+}
+
+// newTeeFile opens the tee outputs for out and copies to them what an
+// earlier run already downloaded.
+func newTeeFile(out outputFile, paths []string, chunks []*ChunkState) (*teeFile, error) {
+	tees, err := openTees(paths)
+	if err != nil {
+		return nil, err
+	}
+	// In offset order, as stream outputs need.
+	chunks = slices.SortedFunc(slices.Values(chunks), func(a, b *ChunkState) int { return cmp.Compare(a.Start, b.Start) })
+	for _, c := range chunks {
+		if c.Downloaded == 0 {
+			continue
+		}
+		if _, err := io.Copy(io.NewOffsetWriter(tees, c.Start), io.NewSectionReader(out, c.Start, c.Downloaded)); err != nil {
+			closeTees(tees)
+			return nil, err
+		}
+	}
+	return &teeFile{outputFile: out, tees: tees, all: append(multiout.MultiWriteAt{out}, tees...)}, nil
+}
+
+func (f *teeFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.all.WriteAt(p, off)
+}
+
+func (f *teeFile) Close() error {
+	err := closeTees(f.tees)
+	if cerr := f.outputFile.Close(); cerr != nil {
+		err = cerr
+	}
+	return err
+}
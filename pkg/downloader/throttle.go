@@ -0,0 +1,81 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"gdl/pkg/bytesize"
+	"gdl/pkg/schedule"
+
+	"golang.org/x/time/rate"
+)
+
+// throttleBurst is the most a throttled read takes from the token bucket at
+// once, so a low rate still gives smooth progress.
+const throttleBurst = 64 * 1024
+
+// newThrottle returns a token bucket for bytesPerSec, unlimited if 0.
+func newThrottle(bytesPerSec int64) *rate.Limiter {
+	return rate.NewLimiter(throttleLimit(bytesPerSec), throttleBurst)
+}
+
+func throttleLimit(bytesPerSec int64) rate.Limit {
+	if bytesPerSec <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(bytesPerSec)
+}
+
+// followSchedule sets limiter to the rate of s every minute until done is
+// closed. Reads in progress carry on at the new rate.
+func followSchedule(limiter *rate.Limiter, s schedule.RateSchedule, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	current := limiter.Limit()
+	for {
+		select {
+		case now := <-ticker.C:
+			bps := s.CurrentRate(now)
+			if limit := throttleLimit(bps); limit != current {
+				current = limit
+				limiter.SetLimitAt(now, limit)
+				if bps == schedule.Unlimited {
+					slog.Info("rate schedule: limit lifted")
+				} else {
+					slog.Info("rate schedule: limit changed", "rate", bytesize.Format(bps)+"/s")
+				}
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// throttledReader reads from r no faster than limiter allows. All chunks of
+// a download share the limiter.
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// At most a second's worth, so a slow rate doesn't hold a read past
+	// the idle timeout.
+	n := throttleBurst
+	if limit := t.limiter.Limit(); limit != rate.Inf {
+		n = min(n, int(limit)+1)
+	}
+	if len(p) > n {
+		p = p[:n]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.limiter.WaitN(t.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
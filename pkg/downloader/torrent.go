@@ -0,0 +1,120 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+
+	"gdl/pkg/resolver/magnet"
+)
+
+// maxTorrentFileSize bounds how much of a .torrent file is read into memory.
+const maxTorrentFileSize = 16 << 20
+
+// downloadMagnet fetches a magnet link over BitTorrent. It is used when the
+// torrent has no HTTP seed the regular segmented path could use. BitTorrent
+// only saves to files, so stdout, the null device and a Sink are refused.
+func (d *Downloader) downloadMagnet(ctx context.Context, cfg DownloadConfig) (string, *FileInfo, error) {
+	if cfg.OutputName == StdoutName || IsDiscard(cfg.OutputName) || cfg.Sink != nil {
+		return "", nil, fmt.Errorf("%w, and a torrent can only be downloaded to a file", magnet.ErrNoHTTPSeed)
+	}
+	cfg.printf("No HTTP seed found, downloading over BitTorrent...\n")
+
+	r := &magnet.MagnetResolver{DataDir: cfg.TorrentDataDir, SeedTime: cfg.TorrentSeedTime, Printf: cfg.printf}
+	return runTorrent(cfg, "magnet", func(progress func(done, total int64)) (string, error) {
+		return r.Download(ctx, cfg.Url, cfg.OutputDir, cfg.OutputName, progress)
+	})
+}
+
+// isTorrentFile reports whether url, as probed into info, is a .torrent file
+// rather than the data itself.
+func isTorrentFile(url string, info *FileInfo) bool {
+	if mediaType, _, err := mime.ParseMediaType(info.ContentType); err == nil && mediaType == "application/x-bittorrent" {
+		return true
+	}
+	path, _, _ := strings.Cut(url, "?")
+	return strings.HasSuffix(strings.ToLower(path), ".torrent") ||
+		strings.HasSuffix(strings.ToLower(info.Name), ".torrent")
+}
+
+// downloadTorrentFile fetches the .torrent file at url and then the torrent
+// it describes, over BitTorrent.
+func (d *Downloader) downloadTorrentFile(ctx context.Context, cfg DownloadConfig, url string, headers http.Header) (string, *FileInfo, error) {
+	body, err := d.openStream(ctx, url, headers)
+	if err != nil {
+		return "", nil, err
+	}
+	mi, err := metainfo.Load(io.LimitReader(body, maxTorrentFileSize))
+	body.Close()
+	if err != nil {
+		return "", nil, fmt.Errorf("reading torrent file %s: %w (use --no-torrent to save it as is)", url, err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return "", nil, fmt.Errorf("reading torrent file %s: %w", url, err)
+	}
+
+	cfg.printf("Downloading torrent %s over BitTorrent...\n", info.BestName())
+	r := &magnet.MagnetResolver{DataDir: cfg.TorrentDataDir, SeedTime: cfg.TorrentSeedTime, Printf: cfg.printf}
+	return runTorrent(cfg, info.BestName(), func(progress func(done, total int64)) (string, error) {
+		return r.DownloadTorrent(ctx, mi, cfg.OutputDir, cfg.OutputName, progress)
+	})
+}
+
+// runTorrent runs fetch with a progress bar labelled name.
+func runTorrent(cfg DownloadConfig, name string, fetch func(progress func(done, total int64)) (string, error)) (string, *FileInfo, error) {
+	var barOutput io.Writer = os.Stdout
+	if cfg.Quiet {
+		barOutput = io.Discard
+	}
+	p := mpb.New(mpb.WithWidth(64), mpb.WithOutput(barOutput))
+	var bar *mpb.Bar
+	var last int64
+
+	path, err := fetch(func(done, total int64) {
+		if bar == nil {
+			bar = p.AddBar(total,
+				mpb.PrependDecorators(
+					decor.Name(name),
+					decor.Percentage(decor.WCSyncSpace),
+				),
+				mpb.AppendDecorators(
+					decor.EwmaETA(decor.ET_STYLE_GO, 90),
+					decor.Name(" ] "),
+					decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 60),
+				),
+			)
+		}
+		bar.EwmaIncrInt64(done-last, 1e9)
+		last = done
+		if cfg.OnProgress != nil {
+			cfg.OnProgress(name, done, total)
+		}
+	})
+	if bar == nil {
+		p.Shutdown()
+	} else {
+		if err != nil {
+			bar.Abort(false)
+		}
+		p.Wait()
+	}
+	if err != nil {
+		return path, nil, err
+	}
+
+	return path, &FileInfo{
+		Url:  cfg.Url,
+		Name: filepath.Base(path),
+		Size: last,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package downloader_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+)
+
+// torrentFile returns a .torrent file for a small file that no peer has.
+func torrentFile(t *testing.T) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "payload.bin")
+	writeFile(t, path, testserver.RandomContent(64<<10, 21))
+	info := metainfo.Info{PieceLength: 16 << 10}
+	if err := info.BuildFromFilePath(path); err != nil {
+		t.Fatal(err)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (&metainfo.MetaInfo{InfoBytes: infoBytes}).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTorrentFileToStdoutIsPassedOn(t *testing.T) {
+	content := torrentFile(t)
+	srv := testserver.NewTestServer(t, content)
+	cfg := quietConfig(t, srv.FileURL("payload.torrent"), 1)
+	cfg.OutputName = downloader.StdoutName
+
+	var err error
+	got := captureStdout(t, func() { err = downloader.NewDownloader().Download(cfg) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("stdout got %d bytes, want the %d-byte .torrent file", len(got), len(content))
+	}
+}
+
+func TestTorrentStopsWithContext(t *testing.T) {
+	if raceEnabled {
+		// Not in gdl: the torrent client's DHT server races with itself.
+		t.Skip("github.com/anacrolix/dht fails the race detector")
+	}
+	srv := testserver.NewTestServer(t, torrentFile(t))
+	cfg := quietConfig(t, srv.FileURL("payload.torrent"), 1)
+	cfg.TorrentDataDir = t.TempDir()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- downloader.NewDownloader().DownloadContext(ctx, cfg) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("DownloadContext() = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the torrent download went on after its context was done")
+	}
+	if entries, _ := os.ReadDir(cfg.OutputDir); len(entries) > 0 {
+		t.Errorf("a cancelled torrent left files in the output directory: %v", entries)
+	}
+}
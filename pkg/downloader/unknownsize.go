@@ -0,0 +1,168 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"gdl/pkg/digest"
+	"gdl/pkg/splitwriter"
+
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+)
+
+// chunkWriter counts the bytes written into a chunk.
+type chunkWriter struct {
+	chunk *ChunkState
+}
+
+func (w chunkWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(&w.chunk.Downloaded, int64(len(p)))
+	return len(p), nil
+}
+
+// downloadUnknownSize fetches a file whose length the server did not report.
+// It uses a single connection and appends to the file as data arrives; the
+// state's only chunk gets its End once the body is exhausted.
+//
+// It also starts a download over without ranges, when info.Size is known;
+// only then can it write to cfg.Sink or to volumes of cfg.SplitSize, which
+// are sized up front.
+func (d *Downloader) downloadUnknownSize(ctx context.Context, fileName, url string, headers http.Header, info *FileInfo, cfg DownloadConfig) error {
+	state := &DownloadState{
+		URL:         url,
+		File:        fileName,
+		Size:        -1,
+		Concurrency: 1,
+		Chunks:      []*ChunkState{{ID: 0, Start: 0, End: -1}},
+	}
+	chunk := state.Chunks[0]
+
+	body, err := d.openStream(ctx, url, headers)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var out io.Writer = io.Discard
+	var volumes []string
+	switch {
+	case cfg.Sink != nil:
+		if info.Size < 0 {
+			return errors.New("the server did not report the file size, which writing to a sink needs")
+		}
+		w, err := cfg.Sink(info)
+		if err != nil {
+			return err
+		}
+		out = io.NewOffsetWriter(w, 0)
+	case IsDiscard(fileName):
+	case cfg.SplitSize > 0:
+		if info.Size < 0 {
+			return errors.New("the server did not report the file size, which splitting into volumes needs")
+		}
+		w, err := splitwriter.Open(fileName, cfg.SplitSize, info.Size)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		volumes = w.Volumes()
+		out = io.NewOffsetWriter(w, 0)
+	default:
+		f, err := os.Create(fileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var barOutput io.Writer = os.Stdout
+	if cfg.Quiet {
+		barOutput = io.Discard
+	}
+	p := mpb.New(mpb.WithWidth(64), mpb.WithOutput(barOutput))
+	bar := p.AddBar(0,
+		mpb.PrependDecorators(
+			decor.Name(filepath.Base(fileName)),
+			decor.CurrentKibiByte("% .2f", decor.WCSyncSpace),
+		),
+		mpb.AppendDecorators(
+			decor.Name(" ] "),
+			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 60),
+		),
+	)
+
+	done := make(chan struct{})
+	if cfg.OnProgress != nil {
+		go func() {
+			ticker := time.NewTicker(1 * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					cfg.OnProgress(fileName, state.Downloaded(), -1)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	writers := []io.Writer{out, chunkWriter{chunk}}
+	if len(cfg.Tee) > 0 {
+		tees, err := openTees(cfg.Tee)
+		if err != nil {
+			return err
+		}
+		defer closeTees(tees)
+		writers = append(writers, io.NewOffsetWriter(tees, 0))
+	}
+	var sum hash.Hash
+	if algo := cfg.checksumAlgorithm(); algo != "" {
+		var err error
+		if sum, err = digest.NewHash(algo); err != nil {
+			return err
+		}
+		writers = append(writers, sum)
+	}
+	n, err := io.Copy(io.MultiWriter(writers...), bar.ProxyReader(body))
+	close(done)
+	if err != nil {
+		bar.Abort(false)
+		p.Wait()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("downloading %s: %w", info.Name, err)
+	}
+	bar.SetTotal(-1, true)
+	p.Wait()
+	if (cfg.Sink != nil || len(volumes) > 0) && n != info.Size {
+		return fmt.Errorf("downloading %s: got %d bytes, want %d", info.Name, n, info.Size)
+	}
+
+	chunk.End = n - 1
+	state.Size = n
+	info.Size = n
+
+	if cfg.OnProgress != nil {
+		cfg.OnProgress(fileName, n, n)
+	}
+	if len(volumes) > 0 {
+		cfg.printf("Saved as %d volumes: %s ... %s\n", len(volumes), volumes[0], volumes[len(volumes)-1])
+	}
+	if sum != nil {
+		cfg.printf("%s: %x\n", digest.Label(cfg.checksumAlgorithm()), sum.Sum(nil))
+		return cfg.verifyChecksum(sum.Sum(nil))
+	}
+	return nil
+}
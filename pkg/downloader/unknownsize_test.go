@@ -0,0 +1,66 @@
+package downloader_test
+
+import (
+	"crypto/sha256"
+	"path/filepath"
+	"testing"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+)
+
+func TestProbeUnknownSize(t *testing.T) {
+	srv := testserver.NewTestServer(t, []byte("generated"))
+	srv.SetUnknownSize(true)
+
+	info, err := downloader.NewDownloader().Probe(srv.FileURL("feed.xml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != -1 || info.RangeSupported {
+		t.Errorf("Probe() = size %d, ranges %v; want -1, false", info.Size, info.RangeSupported)
+	}
+}
+
+func TestDownloadUnknownSize(t *testing.T) {
+	content := testserver.RandomContent(700_000, 12)
+	srv := testserver.NewTestServer(t, content)
+	srv.SetUnknownSize(true)
+	srv.SetThrottleBps(2 << 20) // in several chunks of the chunked encoding
+	sum := sha256.Sum256(content)
+
+	cfg := quietConfig(t, srv.FileURL("feed.xml"), 8)
+	cfg.Checksum = sum[:]
+	var lastDownloaded, lastTotal int64
+	cfg.OnProgress = func(file string, downloaded, total int64) {
+		lastDownloaded, lastTotal = downloaded, total
+	}
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(cfg.OutputDir, "feed.xml")
+	checkFile(t, path, content)
+	checkNoState(t, path)
+	// Once the body ends, its length is the size.
+	if want := int64(len(content)); lastDownloaded != want || lastTotal != want {
+		t.Errorf("last progress = %d of %d, want %d of %d", lastDownloaded, lastTotal, want, want)
+	}
+	if n := len(rangeGETs(srv)); n != 1 {
+		t.Errorf("got %d GET requests, want 1 for a file of unknown size", n)
+	}
+}
+
+func TestDownloadUnknownSizeTruncatesExistingFile(t *testing.T) {
+	content := []byte("short body")
+	srv := testserver.NewTestServer(t, content)
+	srv.SetUnknownSize(true)
+	cfg := quietConfig(t, srv.FileURL("feed.xml"), 1)
+	path := filepath.Join(cfg.OutputDir, "feed.xml")
+	writeFile(t, path, testserver.RandomContent(10_000, 13))
+
+	if err := downloader.NewDownloader().Download(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, content)
+}
@@ -0,0 +1,59 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"gdl/pkg/useragent"
+)
+
+// warmupDelay spaces the connections warmupConnections opens.
+const warmupDelay = 50 * time.Millisecond
+
+// warmupConnections opens n connections to url's server one at a time,
+// delay apart, and leaves them idle in d's pool for the chunk requests to
+// pick up, instead of those opening n connections at once, which some
+// servers meet with SYN rate limiting. Each connection carries a one-byte
+// range request, held open until all n are made so that none is reused by
+// the next; reading the bodies then returns them to the pool. Failures only
+// mean fewer warm connections, so they are logged and otherwise ignored.
+func warmupConnections(ctx context.Context, d *Downloader, url string, headers http.Header, n int, delay time.Duration) {
+	var held []*http.Response
+	defer func() {
+		for _, resp := range held {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Range", "bytes=0-0")
+		req.Header.Set("User-Agent", useragent.Default)
+		setHeaders(req, headers)
+		resp, err := d.Client.Do(req)
+		if err != nil {
+			slog.Debug("connection warm-up failed", "url", url, "connection", i+1, "error", err)
+			return
+		}
+		if resp.ContentLength < 0 || resp.ContentLength > 1 {
+			// Range ignored; reading the whole file is not worth a
+			// connection.
+			resp.Body.Close()
+			return
+		}
+		held = append(held, resp)
+	}
+}
@@ -0,0 +1,63 @@
+// Package editor lets the user change text in their editor, as git commit
+// -e does.
+package editor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// Command returns the editor to run: $VISUAL, else $EDITOR, else vi, or
+// notepad on Windows. It may carry arguments, e.g. "code --wait".
+func Command() string {
+	if e := os.Getenv("VISUAL"); e != "" {
+		return e
+	}
+	if e := os.Getenv("EDITOR"); e != "" {
+		return e
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// Edit writes text to a temporary file named after pattern (as for
+// os.CreateTemp), opens it in the editor on the terminal and returns what
+// the file holds once the editor exits.
+func Edit(text, pattern string) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	editor := Command()
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", editor+` "`+f.Name()+`"`)
+	} else {
+		// Through the shell so that the editor may carry arguments; the
+		// file name is passed as $1 so it needs no quoting.
+		c = exec.Command("sh", "-c", editor+` "$@"`, editor, f.Name())
+	}
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
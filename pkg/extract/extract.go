@@ -0,0 +1,308 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gdl/pkg/decompress"
+
+	"github.com/bodgit/sevenzip"
+)
+
+// ErrNotArchive is returned for a file that is not an archive in a
+// recognised format.
+var ErrNotArchive = errors.New("not a zip, tar or 7z archive")
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	zipEmptyMagic = []byte("PK\x05\x06")
+	sevenZipMagic = []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}
+)
+
+// maxLinkTarget bounds the symlink target read from a zip or 7z entry.
+const maxLinkTarget = 4096
+
+// Extractor unpacks archives. The zero value extracts every entry as it is
+// named in the archive.
+type Extractor struct {
+	// StripComponents removes this many leading path elements from every
+	// entry, like tar's --strip-components. Entries with no more elements
+	// than that are skipped.
+	StripComponents int
+}
+
+// Extract unpacks the archive at archivePath into destDir. See
+// Extractor.Extract.
+func Extract(archivePath, destDir string) error {
+	return (&Extractor{}).Extract(archivePath, destDir)
+}
+
+// Extract unpacks the zip, 7z or tar archive at archivePath into destDir,
+// creating it if needed. The format is detected from the file's contents,
+// not its name; a tar may be compressed with gzip, zstd or bzip2. An entry
+// whose name would place it outside destDir is an error.
+func (e *Extractor) Extract(archivePath, destDir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(sevenZipMagic))
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+	// Resolved, so that checkDir can compare real paths with it.
+	if destDir, err = filepath.EvalSymlinks(destDir); err != nil {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(header, zipMagic), bytes.HasPrefix(header, zipEmptyMagic):
+		return e.extractZip(f, destDir)
+	case bytes.HasPrefix(header, sevenZipMagic):
+		return e.extract7z(f, destDir)
+	}
+
+	r, _, err := decompress.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	br := bufio.NewReader(r)
+	if block, _ := br.Peek(512); !isTar(block) {
+		return ErrNotArchive
+	}
+	return e.extractTar(br, destDir)
+}
+
+// isTar reports whether block is a tar header block: POSIX and GNU tars
+// have "ustar" at offset 257.
+func isTar(block []byte) bool {
+	return len(block) >= 262 && string(block[257:262]) == "ustar"
+}
+
+// entry is one file, directory or link of an archive.
+type entry struct {
+	name     string
+	mode     fs.FileMode
+	linkname string // symlink or hard link target
+	hardlink bool
+	open     func() (io.ReadCloser, error)
+}
+
+func (e *Extractor) extractTar(r io.Reader, destDir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar: %w", err)
+		}
+		ent := entry{
+			name:     hdr.Name,
+			mode:     hdr.FileInfo().Mode(),
+			linkname: hdr.Linkname,
+			open:     func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink:
+		case tar.TypeLink:
+			ent.hardlink = true
+		default:
+			continue // devices, FIFOs and the like
+		}
+		if err := e.write(destDir, ent); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *Extractor) extractZip(f *os.File, destDir string) error {
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, st.Size())
+	if err != nil {
+		return fmt.Errorf("reading zip: %w", err)
+	}
+	for _, zf := range zr.File {
+		ent := entry{name: zf.Name, mode: zf.Mode(), open: zf.Open}
+		if ent.mode&fs.ModeSymlink != 0 {
+			if ent.linkname, err = readLinkTarget(zf.Open); err != nil {
+				return err
+			}
+		}
+		if err := e.write(destDir, ent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Extractor) extract7z(f *os.File, destDir string) error {
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := sevenzip.NewReader(f, st.Size())
+	if err != nil {
+		return fmt.Errorf("reading 7z: %w", err)
+	}
+	for _, zf := range zr.File {
+		ent := entry{name: zf.Name, mode: zf.Mode(), open: zf.Open}
+		if ent.mode&fs.ModeSymlink != 0 {
+			if ent.linkname, err = readLinkTarget(zf.Open); err != nil {
+				return err
+			}
+		}
+		if err := e.write(destDir, ent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLinkTarget reads a symlink's target, which zip and 7z store as the
+// entry's contents.
+func readLinkTarget(open func() (io.ReadCloser, error)) (string, error) {
+	rc, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	target, err := io.ReadAll(io.LimitReader(rc, maxLinkTarget))
+	return string(target), err
+}
+
+// write creates ent under destDir.
+func (e *Extractor) write(destDir string, ent entry) error {
+	rel, err := e.path(ent.name)
+	if err != nil || rel == "" {
+		return err
+	}
+	target := filepath.Join(destDir, rel)
+
+	if ent.mode.IsDir() {
+		if err := checkDir(destDir, target); err != nil {
+			return err
+		}
+		return os.MkdirAll(target, 0755)
+	}
+	if err := checkDir(destDir, filepath.Dir(target)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	switch {
+	case ent.hardlink:
+		from, err := e.path(ent.linkname)
+		if err != nil {
+			return err
+		}
+		if from == "" {
+			return nil // its target was stripped away too
+		}
+		from = filepath.Join(destDir, from)
+		if err := checkDir(destDir, from); err != nil {
+			return err
+		}
+		os.Remove(target)
+		return os.Link(from, target)
+	case ent.mode&fs.ModeSymlink != 0:
+		// Relative targets only, and only ones that stay inside destDir.
+		// checkDir catches links that escape through other links.
+		resolved := path.Join(path.Dir(filepath.ToSlash(rel)), ent.linkname)
+		if path.IsAbs(ent.linkname) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+			return fmt.Errorf("unsafe symlink %s -> %s in archive", ent.name, ent.linkname)
+		}
+		os.Remove(target)
+		return os.Symlink(ent.linkname, target)
+	}
+
+	src, err := ent.open()
+	if err != nil {
+		return fmt.Errorf("extracting %s: %w", ent.name, err)
+	}
+	defer src.Close()
+	perm := ent.mode.Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+	// A symlink from the archive in its place must not be followed.
+	os.Remove(target)
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return fmt.Errorf("extracting %s: %w", ent.name, err)
+	}
+	return out.Close()
+}
+
+// path returns an entry's path relative to the destination, after
+// StripComponents, or "" if nothing is left of it. Absolute names and names
+// with a ".." element are rejected.
+func (e *Extractor) path(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("unsafe path %q in archive", name)
+	}
+	var parts []string
+	for _, p := range strings.Split(name, "/") {
+		switch p {
+		case "..":
+			return "", fmt.Errorf("unsafe path %q in archive", name)
+		case "", ".":
+			continue
+		}
+		parts = append(parts, p)
+	}
+	if len(parts) <= e.StripComponents {
+		return "", nil
+	}
+	return filepath.Join(parts[e.StripComponents:]...), nil
+}
+
+// checkDir returns an error if dir, as far as it exists, leads outside root
+// through a symlink, so that nothing is written or created there.
+func checkDir(root, dir string) error {
+	existing := dir
+	for existing != root {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("unsafe path %s in archive: it leads outside %s", dir, root)
+	}
+	return nil
+}
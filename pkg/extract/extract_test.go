@@ -0,0 +1,304 @@
+package extract_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"gdl/pkg/extract"
+)
+
+// The 7z archives in testdata were made with bsdtar, which can write 7z
+// but, unlike Go, not read it back, e.g.
+//
+//	bsdtar -P --format 7zip -cf traversal.7z -s ',^evil.txt$,../evil.txt,' evil.txt
+//
+// good.7z holds top/a.txt, top/sub/b.txt and top/link.txt -> a.txt;
+// traversal.7z ../evil.txt; absolute.7z /tmp/gdl-evil.txt; symlink.7z
+// up -> .. and up/evil.txt; chain.7z b -> ., a -> b/.. and a/evil.txt.
+
+// member is an entry of a tar or zip archive built for a test.
+type member struct {
+	name     string
+	body     string // contents, or the target of a link
+	symlink  bool
+	hardlink bool
+	dir      bool
+}
+
+// goodMembers is the same tree as good.7z.
+var goodMembers = []member{
+	{name: "top/", dir: true},
+	{name: "top/a.txt", body: "hello\n"},
+	{name: "top/sub/", dir: true},
+	{name: "top/sub/b.txt", body: "world\n"},
+	{name: "top/link.txt", body: "a.txt", symlink: true},
+}
+
+func writeTar(t *testing.T, members []member) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "archive.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(m.body))}
+		switch {
+		case m.dir:
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		case m.symlink:
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, m.body, 0
+		case m.hardlink:
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, m.body, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(m.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeZip(t *testing.T, members []member) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "archive.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, m := range members {
+		if m.hardlink {
+			t.Fatal("zip has no hard links")
+		}
+		hdr := &zip.FileHeader{Name: m.name}
+		switch {
+		case m.dir:
+			hdr.SetMode(fs.ModeDir | 0755)
+		case m.symlink:
+			hdr.SetMode(fs.ModeSymlink | 0777)
+		default:
+			hdr.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(m.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// destination returns a directory to extract into, inside one that nothing
+// may be written to.
+func destination(t *testing.T) (dest, outside string) {
+	t.Helper()
+	outside = t.TempDir()
+	return filepath.Join(outside, "dest"), outside
+}
+
+// checkOutside fails t if anything but dest, and want, is in outside.
+func checkOutside(t *testing.T, outside string, want ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := map[string]bool{"dest": true}
+	for _, name := range want {
+		allowed[name] = true
+	}
+	for _, e := range entries {
+		if !allowed[e.Name()] {
+			t.Errorf("%s was written outside the destination", e.Name())
+		}
+	}
+}
+
+func TestExtractRejectsEscapes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the archives use symlinks")
+	}
+	chain := []member{
+		{name: "b", body: ".", symlink: true},
+		{name: "a", body: "b/..", symlink: true},
+		{name: "a/evil.txt", body: "evil"},
+	}
+	for _, tc := range []struct {
+		name    string
+		archive func(t *testing.T) string
+	}{
+		{"tar dotdot", func(t *testing.T) string { return writeTar(t, []member{{name: "../evil.txt", body: "evil"}}) }},
+		{"tar nested dotdot", func(t *testing.T) string { return writeTar(t, []member{{name: "top/../../evil.txt", body: "evil"}}) }},
+		{"tar absolute", func(t *testing.T) string { return writeTar(t, []member{{name: "/tmp/gdl-evil.txt", body: "evil"}}) }},
+		{"tar backslash dotdot", func(t *testing.T) string { return writeTar(t, []member{{name: `..\evil.txt`, body: "evil"}}) }},
+		{"tar symlink up", func(t *testing.T) string { return writeTar(t, []member{{name: "up", body: "..", symlink: true}}) }},
+		{"tar absolute symlink", func(t *testing.T) string { return writeTar(t, []member{{name: "etc", body: "/etc", symlink: true}}) }},
+		{"tar symlink chain then file", func(t *testing.T) string { return writeTar(t, chain) }},
+		{"tar symlink chain then dir", func(t *testing.T) string {
+			return writeTar(t, []member{chain[0], chain[1], {name: "a/evil/", dir: true}})
+		}},
+		{"tar hardlink dotdot", func(t *testing.T) string {
+			return writeTar(t, []member{{name: "h", body: "../outside.txt", hardlink: true}})
+		}},
+		{"tar hardlink through symlink", func(t *testing.T) string {
+			return writeTar(t, []member{chain[0], chain[1], {name: "h", body: "a/outside.txt", hardlink: true}})
+		}},
+		{"zip dotdot", func(t *testing.T) string { return writeZip(t, []member{{name: "../evil.txt", body: "evil"}}) }},
+		{"zip absolute", func(t *testing.T) string { return writeZip(t, []member{{name: "/tmp/gdl-evil.txt", body: "evil"}}) }},
+		{"zip symlink up", func(t *testing.T) string { return writeZip(t, []member{{name: "up", body: "../", symlink: true}}) }},
+		{"zip symlink chain then file", func(t *testing.T) string { return writeZip(t, chain) }},
+		{"7z dotdot", func(t *testing.T) string { return "testdata/traversal.7z" }},
+		{"7z absolute", func(t *testing.T) string { return "testdata/absolute.7z" }},
+		{"7z symlink up", func(t *testing.T) string { return "testdata/symlink.7z" }},
+		{"7z symlink chain then file", func(t *testing.T) string { return "testdata/chain.7z" }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dest, outside := destination(t)
+			// A file next to the destination that links may try to reach.
+			target := filepath.Join(outside, "outside.txt")
+			if err := os.WriteFile(target, []byte("keep"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := extract.Extract(tc.archive(t), dest); err == nil {
+				t.Error("Extract() succeeded")
+			}
+			checkOutside(t, outside, "outside.txt")
+			if data, err := os.ReadFile(target); err != nil || string(data) != "keep" {
+				t.Errorf("the file outside was changed: %q, %v", data, err)
+			}
+			if _, err := os.Stat("/tmp/gdl-evil.txt"); err == nil {
+				t.Error("an absolute entry was written to /tmp/gdl-evil.txt")
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the archives use symlinks")
+	}
+	for _, tc := range []struct {
+		format  string
+		archive func(t *testing.T) string
+	}{
+		{"tar", func(t *testing.T) string { return writeTar(t, goodMembers) }},
+		{"zip", func(t *testing.T) string { return writeZip(t, goodMembers) }},
+		{"7z", func(t *testing.T) string { return "testdata/good.7z" }},
+	} {
+		for _, sc := range []struct {
+			strip int
+			want  map[string]string // path: contents, or "-> target" for a symlink
+		}{
+			{0, map[string]string{"top/a.txt": "hello\n", "top/sub/b.txt": "world\n", "top/link.txt": "-> a.txt"}},
+			{1, map[string]string{"a.txt": "hello\n", "sub/b.txt": "world\n", "link.txt": "-> a.txt"}},
+			{2, map[string]string{"b.txt": "world\n"}},
+			{3, map[string]string{}},
+		} {
+			t.Run(fmt.Sprintf("%s strip %d", tc.format, sc.strip), func(t *testing.T) {
+				dest, outside := destination(t)
+				e := &extract.Extractor{StripComponents: sc.strip}
+				if err := e.Extract(tc.archive(t), dest); err != nil {
+					t.Fatal(err)
+				}
+				checkOutside(t, outside)
+				checkTree(t, dest, sc.want)
+			})
+		}
+	}
+}
+
+// checkTree fails t unless the files and symlinks under dir are exactly
+// want.
+func checkTree(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	got := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			got[rel] = "-> " + target
+			return err
+		}
+		data, err := os.ReadFile(path)
+		got[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Errorf("extracted %v, want %v", got, want)
+		return
+	}
+	for name, contents := range want {
+		if got[name] != contents {
+			t.Errorf("%s = %q, want %q", name, got[name], contents)
+		}
+	}
+}
+
+func TestExtractHardlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links in tars are for Unix")
+	}
+	archive := writeTar(t, []member{
+		{name: "top/data.txt", body: "data"},
+		{name: "top/copy.txt", body: "top/data.txt", hardlink: true},
+		// Stripped to nothing, so the link to it is skipped too.
+		{name: "root.txt", body: "root"},
+		{name: "top/root-link.txt", body: "root.txt", hardlink: true},
+	})
+	dest, _ := destination(t)
+	if err := (&extract.Extractor{StripComponents: 1}).Extract(archive, dest); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dest, map[string]string{"data.txt": "data", "copy.txt": "data"})
+	a, err := os.Stat(filepath.Join(dest, "data.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.Stat(filepath.Join(dest, "copy.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(a, b) {
+		t.Error("copy.txt is not a hard link to data.txt")
+	}
+}
+
+func TestExtractNotArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.txt")
+	if err := os.WriteFile(path, []byte("just text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := extract.Extract(path, t.TempDir()); err != extract.ErrNotArchive {
+		t.Errorf("Extract() = %v, want ErrNotArchive", err)
+	}
+}
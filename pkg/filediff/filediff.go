@@ -0,0 +1,102 @@
+package filediff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+// blockSize is how much of each file is read and compared at a time.
+const blockSize = 64 << 10
+
+// DiffResult describes how two files differ.
+type DiffResult struct {
+	Identical    bool
+	SizeA, SizeB int64
+	// Offset is the first byte at which the files differ, or, if one is a
+	// prefix of the other, the size of the shorter one. -1 if identical.
+	Offset       int64
+	HashA, HashB string // hex SHA-256
+	Err          error  // a file could not be read; the rest is not set
+}
+
+// SameSize reports whether the files have the same size.
+func (r DiffResult) SameSize() bool {
+	return r.SizeA == r.SizeB
+}
+
+// Compare compares files a and b block by block, hashing both as it goes,
+// so neither is held in memory.
+func Compare(a, b string) DiffResult {
+	fa, err := os.Open(a)
+	if err != nil {
+		return DiffResult{Err: err}
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return DiffResult{Err: err}
+	}
+	defer fb.Close()
+
+	ha, hb := sha256.New(), sha256.New()
+	bufA, bufB := make([]byte, blockSize), make([]byte, blockSize)
+	res := DiffResult{Offset: -1}
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if err := readErr(errA); err != nil {
+			return DiffResult{Err: err}
+		}
+		if err := readErr(errB); err != nil {
+			return DiffResult{Err: err}
+		}
+		if res.Offset < 0 {
+			n := min(na, nb)
+			if i := firstDiff(bufA[:n], bufB[:n]); i >= 0 {
+				res.Offset = res.SizeA + int64(i)
+			} else if na != nb {
+				res.Offset = res.SizeA + int64(n)
+			}
+		}
+		ha.Write(bufA[:na])
+		hb.Write(bufB[:nb])
+		res.SizeA += int64(na)
+		res.SizeB += int64(nb)
+		if na < blockSize && nb < blockSize {
+			break
+		}
+	}
+	res.Identical = res.Offset < 0
+	res.HashA, res.HashB = sum(ha), sum(hb)
+	return res
+}
+
+// readErr drops the errors io.ReadFull returns at the end of a file.
+func readErr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+// firstDiff returns the index of the first byte that differs between a and
+// b, which have the same length, or -1.
+func firstDiff(a, b []byte) int {
+	if bytes.Equal(a, b) {
+		return -1
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+func sum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,111 @@
+package fileutil
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrTempWrite is returned when writing the temporary file of an atomic
+// replacement fails, e.g. because the disk is full or the directory is not
+// writable. The destination is untouched.
+type ErrTempWrite struct {
+	Path  string
+	Cause error
+}
+
+func (e *ErrTempWrite) Error() string {
+	return fmt.Sprintf("writing temporary file %s: %v", e.Path, e.Cause)
+}
+
+func (e *ErrTempWrite) Unwrap() error { return e.Cause }
+
+// ErrRename is returned when a complete temporary file could not be moved
+// to its final path. MoveFile leaves the temporary file in place so the data
+// is not lost; WriteFile, whose caller still has the data, removes it.
+type ErrRename struct {
+	TempPath, FinalPath string
+	Cause               error
+}
+
+func (e *ErrRename) Error() string {
+	return fmt.Sprintf("moving %s to %s: %v", e.TempPath, e.FinalPath, e.Cause)
+}
+
+func (e *ErrRename) Unwrap() error { return e.Cause }
+
+// WriteFile writes data to path+".tmp" and renames it over path, so readers
+// see either the old contents or the new, never half of them. If either
+// step fails, the temporary file is removed.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return &ErrTempWrite{Path: tmp, Cause: err}
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return &ErrTempWrite{Path: tmp, Cause: err}
+	}
+	if err := MoveFile(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// MoveFile renames tmp to final. When they are on different filesystems,
+// where a rename is impossible, it copies tmp next to final and renames the
+// copy instead, then removes tmp.
+func MoveFile(tmp, final string) error {
+	err := os.Rename(tmp, final)
+	if err == nil {
+		return nil
+	}
+	if isCrossDevice(err) {
+		err = copyFile(tmp, final)
+		if err == nil {
+			return os.Remove(tmp)
+		}
+	}
+	return &ErrRename{TempPath: tmp, FinalPath: final, Cause: err}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Chmod(fi.Mode().Perm())
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+	}
+	return err
+}
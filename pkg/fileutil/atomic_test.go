@@ -0,0 +1,93 @@
+package fileutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gdl/pkg/fileutil"
+)
+
+// checkNoTemp fails t if WriteFile left path's temporary file behind.
+func checkNoTemp(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	for _, data := range []string{"old", "new"} {
+		if err := fileutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := os.ReadFile(path); err != nil || string(got) != data {
+			t.Fatalf("ReadFile() = %q, %v; want %q", got, err, data)
+		}
+	}
+	checkNoTemp(t, path)
+}
+
+func TestWriteFileTempWriteError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "state.json")
+	err := fileutil.WriteFile(path, []byte("data"), 0644)
+
+	var tempErr *fileutil.ErrTempWrite
+	if !errors.As(err, &tempErr) {
+		t.Fatalf("WriteFile() = %v, want an ErrTempWrite", err)
+	}
+	if tempErr.Path != path+".tmp" || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ErrTempWrite = %+v, want the temporary path and a cause of fs.ErrNotExist", tempErr)
+	}
+	var renameErr *fileutil.ErrRename
+	if errors.As(err, &renameErr) {
+		t.Errorf("a failed write is also an ErrRename: %v", err)
+	}
+}
+
+func TestWriteFileRenameError(t *testing.T) {
+	// A file can't be renamed over a directory that has something in it.
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.MkdirAll(filepath.Join(path, "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := fileutil.WriteFile(path, []byte("data"), 0644)
+
+	var renameErr *fileutil.ErrRename
+	if !errors.As(err, &renameErr) {
+		t.Fatalf("WriteFile() = %v, want an ErrRename", err)
+	}
+	if renameErr.TempPath != path+".tmp" || renameErr.FinalPath != path || renameErr.Cause == nil {
+		t.Errorf("ErrRename = %+v", renameErr)
+	}
+	var tempErr *fileutil.ErrTempWrite
+	if errors.As(err, &tempErr) {
+		t.Errorf("a failed rename is also an ErrTempWrite: %v", err)
+	}
+	checkNoTemp(t, path)
+	if _, err := os.Stat(filepath.Join(path, "keep")); err != nil {
+		t.Errorf("the destination was touched: %v", err)
+	}
+}
+
+func TestMoveFileKeepsTempOnError(t *testing.T) {
+	dir := t.TempDir()
+	tmp, final := filepath.Join(dir, "part"), filepath.Join(dir, "final")
+	if err := os.WriteFile(tmp, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(final, "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var renameErr *fileutil.ErrRename
+	if err := fileutil.MoveFile(tmp, final); !errors.As(err, &renameErr) {
+		t.Fatalf("MoveFile() = %v, want an ErrRename", err)
+	}
+	if got, err := os.ReadFile(tmp); err != nil || string(got) != "data" {
+		t.Errorf("the temporary file was lost: %q, %v", got, err)
+	}
+}
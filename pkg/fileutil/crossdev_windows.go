@@ -0,0 +1,16 @@
+//go:build windows
+
+package fileutil
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, which MoveFileEx returns
+// without MOVEFILE_COPY_ALLOWED.
+const errorNotSameDevice = syscall.Errno(17)
+
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
@@ -0,0 +1,78 @@
+package fileutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEscapesBase is returned by SafeJoin for a name that leads outside the
+// base directory.
+var ErrEscapesBase = errors.New("path escapes the base directory")
+
+// SafeJoin joins name to base and checks that the result, with every
+// symlink along it resolved, is still inside base, so that a name chosen by
+// a server ("../../etc/cron.d/x", or one going through a planted symlink)
+// cannot place a file elsewhere. base and the path need not exist yet; only
+// the parts that do are resolved. It returns the joined, unresolved path.
+func SafeJoin(base, name string) (string, error) {
+	if base == "" {
+		base = "."
+	}
+	joined := filepath.Join(base, name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: %s is absolute", ErrEscapesBase, name)
+	}
+
+	root, err := resolve(base)
+	if err != nil {
+		return "", err
+	}
+	real, err := resolve(joined)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s resolves to %s, outside %s", ErrEscapesBase, name, real, base)
+	}
+	return joined, nil
+}
+
+// resolve returns the absolute path p refers to: the longest existing part
+// of it with its symlinks evaluated, followed by the rest. A dangling symlink
+// is followed to where its target would be.
+func resolve(p string) (string, error) {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	for hops := 0; ; hops++ {
+		existing, rest := p, ""
+		for {
+			if _, err := os.Lstat(existing); err == nil {
+				break
+			}
+			parent := filepath.Dir(existing)
+			if parent == existing {
+				break
+			}
+			rest = filepath.Join(filepath.Base(existing), rest)
+			existing = parent
+		}
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		target, lerr := os.Readlink(existing)
+		if lerr != nil || hops == 255 {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(existing), target)
+		}
+		p = filepath.Join(target, rest)
+	}
+}
@@ -0,0 +1,90 @@
+package fileutil_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gdl/pkg/fileutil"
+)
+
+func TestSafeJoin(t *testing.T) {
+	base := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(base, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Symlinks planted in the output directory.
+	for name, target := range map[string]string{
+		"escape":   outside,                            // a directory elsewhere
+		"file.iso": filepath.Join(outside, "file.iso"), // a file elsewhere, not there yet
+		"inside":   filepath.Join(base, "sub"),         // a directory within base
+		"relative": "../" + filepath.Base(outside),     // elsewhere, by a relative path
+	} {
+		if err := os.Symlink(target, filepath.Join(base, name)); err != nil {
+			t.Skip("cannot create symlinks:", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"file.bin", true},
+		{"sub/file.bin", true},
+		{"new/dir/file.bin", true},
+		{"sub/../file.bin", true},
+		{"inside/file.bin", true},
+		{"escape/../file.bin", true}, // cleaned before it is resolved
+		{"../file.bin", false},
+		{"../../etc/cron.d/evil", false},
+		{"sub/../../file.bin", false},
+		{"/etc/cron.d/evil", false},
+		{"escape/file.bin", false},
+		{"file.iso", false},
+		{"relative/file.bin", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fileutil.SafeJoin(base, tt.name)
+			if !tt.ok {
+				if !errors.Is(err, fileutil.ErrEscapesBase) {
+					t.Errorf("SafeJoin(%q) = %q, %v; want ErrEscapesBase", tt.name, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SafeJoin(%q): %v", tt.name, err)
+			}
+			if want := filepath.Join(base, tt.name); got != want {
+				t.Errorf("SafeJoin(%q) = %q, want %q", tt.name, got, want)
+			}
+		})
+	}
+}
+
+func TestSafeJoinSymlinkedBase(t *testing.T) {
+	// The output directory itself may be a symlink; names inside it are fine.
+	real := t.TempDir()
+	base := filepath.Join(t.TempDir(), "downloads")
+	if err := os.Symlink(real, base); err != nil {
+		t.Skip("cannot create symlinks:", err)
+	}
+	if _, err := fileutil.SafeJoin(base, "file.bin"); err != nil {
+		t.Errorf("SafeJoin in a symlinked directory: %v", err)
+	}
+	if _, err := fileutil.SafeJoin(base, "../file.bin"); !errors.Is(err, fileutil.ErrEscapesBase) {
+		t.Errorf("SafeJoin(../file.bin) in a symlinked directory: err = %v, want ErrEscapesBase", err)
+	}
+}
+
+func TestSafeJoinEmptyBase(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if got, err := fileutil.SafeJoin("", "file.bin"); err != nil || got != "file.bin" {
+		t.Errorf(`SafeJoin("", "file.bin") = %q, %v`, got, err)
+	}
+	if _, err := fileutil.SafeJoin("", "../file.bin"); !errors.Is(err, fileutil.ErrEscapesBase) {
+		t.Errorf(`SafeJoin("", "../file.bin"): err = %v, want ErrEscapesBase`, err)
+	}
+}
@@ -0,0 +1,100 @@
+package hasher
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"gdl/pkg/digest"
+)
+
+// ParseAlgorithm checks a hash name: md5, sha1, sha256, sha512 or crc32.
+// Dashes are ignored, so "sha-256" works too.
+func ParseAlgorithm(s string) (string, error) {
+	return digest.Normalize(s)
+}
+
+// Result is the checksum of one file submitted to an AsyncHashPool.
+type Result struct {
+	Seq  int // order of submission, from 0
+	File string
+	Sum  []byte
+	Err  error
+}
+
+// AsyncHashPool hashes files in the background, so that whoever submits
+// them can go on with other work. Results arrive on Results in the order
+// they finish.
+type AsyncHashPool struct {
+	newHash func() hash.Hash
+	slots   chan struct{}
+	results chan Result
+	wg      sync.WaitGroup
+	seq     int
+}
+
+// NewAsyncHashPool returns a pool hashing with algo (see ParseAlgorithm)
+// and at most workers files at a time; if workers is not positive, half the
+// CPUs.
+func NewAsyncHashPool(algo string, workers int) *AsyncHashPool {
+	if workers <= 0 {
+		workers = max(runtime.NumCPU()/2, 1)
+	}
+	newHash := func() hash.Hash {
+		h, err := digest.NewHash(algo)
+		if err != nil {
+			return sha256.New()
+		}
+		return h
+	}
+	return &AsyncHashPool{
+		newHash: newHash,
+		slots:   make(chan struct{}, workers),
+		results: make(chan Result),
+	}
+}
+
+// Submit queues file for hashing and returns at once. Submit and Close are
+// meant to be called from one goroutine, and Submit not after Close.
+func (p *AsyncHashPool) Submit(file string) {
+	r := Result{Seq: p.seq, File: file}
+	p.seq++
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.slots <- struct{}{}
+		r.Sum, r.Err = p.hashFile(file)
+		<-p.slots
+		p.results <- r
+	}()
+}
+
+// Results delivers a Result per submitted file. It is closed once Close has
+// been called and every file is hashed, so it must be drained.
+func (p *AsyncHashPool) Results() <-chan Result {
+	return p.results
+}
+
+// Close marks the end of the submissions.
+func (p *AsyncHashPool) Close() {
+	go func() {
+		p.wg.Wait()
+		close(p.results)
+	}()
+}
+
+func (p *AsyncHashPool) hashFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := p.newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,136 @@
+package hashwriter
+
+import (
+	"container/heap"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+)
+
+// DefaultMaxBuffered is how many out-of-order bytes are kept in memory before
+// further segments are only recorded and later re-read from the source.
+const DefaultMaxBuffered = 32 << 20
+
+type segment struct {
+	off  int64
+	n    int64
+	data []byte // nil if the bytes must be re-read from src
+}
+
+type segmentHeap []*segment
+
+func (h segmentHeap) Len() int           { return len(h) }
+func (h segmentHeap) Less(i, j int) bool { return h[i].off < h[j].off }
+func (h segmentHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *segmentHeap) Push(x any)        { *h = append(*h, x.(*segment)) }
+func (h *segmentHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+// OrderedHashWriter hashes data that arrives out of order, as it does from
+// parallel chunks. Segments are kept in a priority queue by offset and fed to
+// the hash as soon as they extend the contiguous prefix. Once more than
+// maxBuffered bytes are pending, new segments are recorded without their data
+// and read back from src (normally the output file) when their turn comes.
+type OrderedHashWriter struct {
+	mu          sync.Mutex
+	h           hash.Hash
+	src         io.ReaderAt
+	maxBuffered int64
+	buffered    int64
+	next        int64
+	pending     segmentHeap
+	err         error
+}
+
+func New(h hash.Hash, src io.ReaderAt, maxBuffered int64) *OrderedHashWriter {
+	return &OrderedHashWriter{h: h, src: src, maxBuffered: maxBuffered}
+}
+
+// NewSHA256 returns a SHA-256 writer that re-reads from src when needed.
+func NewSHA256(src io.ReaderAt) *OrderedHashWriter {
+	return New(sha256.New(), src, DefaultMaxBuffered)
+}
+
+// WriteAt records p as the bytes at offset off. p is not retained.
+func (w *OrderedHashWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seg := &segment{off: off, n: int64(len(p))}
+	switch {
+	case off == w.next:
+		w.h.Write(p)
+		w.next += seg.n
+		w.flush()
+		return len(p), w.err
+	case w.buffered+seg.n <= w.maxBuffered:
+		seg.data = append([]byte(nil), p...)
+		w.buffered += seg.n
+	}
+	heap.Push(&w.pending, seg)
+	w.flush()
+	return len(p), w.err
+}
+
+// Mark records that bytes [off, off+n) are already present in src, e.g.
+// from a previous run that is being resumed.
+func (w *OrderedHashWriter) Mark(off, n int64) {
+	if n <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	heap.Push(&w.pending, &segment{off: off, n: n})
+	w.flush()
+}
+
+// flush feeds every pending segment that touches the hashed prefix.
+func (w *OrderedHashWriter) flush() {
+	for w.err == nil && len(w.pending) > 0 && w.pending[0].off <= w.next {
+		seg := heap.Pop(&w.pending).(*segment)
+		if seg.data != nil {
+			w.buffered -= seg.n
+		}
+		end := seg.off + seg.n
+		if end <= w.next {
+			continue // Already hashed
+		}
+		skip := w.next - seg.off
+		if seg.data != nil {
+			w.h.Write(seg.data[skip:])
+		} else if w.src == nil {
+			w.err = fmt.Errorf("segment at %d was not buffered and no source is set", seg.off)
+			return
+		} else if _, err := io.Copy(w.h, io.NewSectionReader(w.src, w.next, end-w.next)); err != nil {
+			w.err = err
+			return
+		}
+		w.next = end
+	}
+}
+
+// Offset returns how many leading bytes have been hashed.
+func (w *OrderedHashWriter) Offset() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.next
+}
+
+// Sum returns the hash once size contiguous bytes have been written.
+func (w *OrderedHashWriter) Sum(size int64) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return nil, w.err
+	}
+	if w.next != size {
+		return nil, fmt.Errorf("hash incomplete: %d of %d bytes", w.next, size)
+	}
+	return w.h.Sum(nil), nil
+}
@@ -0,0 +1,213 @@
+package hashwriter_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gdl/pkg/hashwriter"
+)
+
+// segment is a piece of content at its offset.
+type segment struct {
+	off  int64
+	data []byte
+}
+
+// split cuts content into pieces of the given size; the last may be shorter.
+func split(content []byte, size int) []segment {
+	var segs []segment
+	for off := 0; off < len(content); off += size {
+		segs = append(segs, segment{int64(off), content[off:min(off+size, len(content))]})
+	}
+	return segs
+}
+
+// countingReader is an io.ReaderAt that counts the bytes read from it.
+type countingReader struct {
+	r *bytes.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func content(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+func TestOrders(t *testing.T) {
+	data := content(100_000)
+	want := sha256.Sum256(data)
+	for _, tc := range []struct {
+		name  string
+		order func(segs []segment)
+	}{
+		{"in order", func([]segment) {}},
+		{"reversed", func(segs []segment) {
+			for i, j := 0, len(segs)-1; i < j; i, j = i+1, j-1 {
+				segs[i], segs[j] = segs[j], segs[i]
+			}
+		}},
+		{"shuffled", func(segs []segment) {
+			rand.New(rand.NewSource(2)).Shuffle(len(segs), func(i, j int) { segs[i], segs[j] = segs[j], segs[i] })
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			segs := split(data, 777)
+			tc.order(segs)
+			w := hashwriter.NewSHA256(nil)
+			for _, s := range segs {
+				if _, err := w.WriteAt(s.data, s.off); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := w.Sum(int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want[:]) {
+				t.Error("Sum() is not the SHA-256 of the content")
+			}
+		})
+	}
+}
+
+func TestWriteAtDoesNotRetain(t *testing.T) {
+	data := content(1000)
+	w := hashwriter.NewSHA256(nil)
+	second := append([]byte(nil), data[500:]...)
+	w.WriteAt(second, 500)
+	for i := range second {
+		second[i] = 0 // the caller reuses its buffer
+	}
+	w.WriteAt(data[:500], 0)
+	got, err := w.Sum(int64(len(data)))
+	want := sha256.Sum256(data)
+	if err != nil || !bytes.Equal(got, want[:]) {
+		t.Errorf("Sum() = %x, %v; want %x", got, err, want)
+	}
+}
+
+func TestOverlappingSegments(t *testing.T) {
+	data := content(1000)
+	w := hashwriter.NewSHA256(nil)
+	// A retried range arrives again, partly over bytes already hashed.
+	w.WriteAt(data[600:], 600)
+	w.WriteAt(data[:400], 0)
+	w.WriteAt(data[300:700], 300)
+	w.WriteAt(data[100:200], 100)
+	got, err := w.Sum(int64(len(data)))
+	want := sha256.Sum256(data)
+	if err != nil || !bytes.Equal(got, want[:]) {
+		t.Errorf("Sum() = %x, %v; want %x", got, err, want)
+	}
+}
+
+func TestRereadsBeyondMaxBuffered(t *testing.T) {
+	data := content(10_000)
+	src := &countingReader{r: bytes.NewReader(data)}
+	w := hashwriter.New(sha256.New(), src, 2000)
+	segs := split(data, 1000)
+	// Everything but the first segment arrives before it; only two of
+	// the nine fit in the buffer.
+	for _, s := range segs[1:] {
+		w.WriteAt(s.data, s.off)
+	}
+	if w.Offset() != 0 {
+		t.Fatalf("Offset() = %d before the first segment, want 0", w.Offset())
+	}
+	w.WriteAt(segs[0].data, 0)
+
+	got, err := w.Sum(int64(len(data)))
+	want := sha256.Sum256(data)
+	if err != nil || !bytes.Equal(got, want[:]) {
+		t.Fatalf("Sum() = %x, %v; want %x", got, err, want)
+	}
+	if n := src.n.Load(); n != 7000 {
+		t.Errorf("read %d bytes back from the source, want the 7000 not buffered", n)
+	}
+}
+
+func TestUnbufferedWithoutSource(t *testing.T) {
+	data := content(3000)
+	w := hashwriter.New(sha256.New(), nil, 0)
+	w.WriteAt(data[1000:], 1000)
+	if _, err := w.WriteAt(data[:1000], 0); err == nil {
+		t.Error("WriteAt() succeeded although a skipped segment can't be read back")
+	}
+	if _, err := w.Sum(int64(len(data))); err == nil {
+		t.Error("Sum() succeeded although a segment was lost")
+	}
+}
+
+func TestMarkResumedPrefix(t *testing.T) {
+	data := content(5000)
+	src := &countingReader{r: bytes.NewReader(data)}
+	w := hashwriter.New(sha256.New(), src, hashwriter.DefaultMaxBuffered)
+	// A resumed run has 0-1999 and 3000-3999 from last time.
+	w.Mark(3000, 1000)
+	w.Mark(0, 2000)
+	w.Mark(4000, 0) // nothing
+	if w.Offset() != 2000 {
+		t.Fatalf("Offset() = %d after marking the prefix, want 2000", w.Offset())
+	}
+	w.WriteAt(data[4000:], 4000)
+	w.WriteAt(data[2000:3000], 2000)
+
+	got, err := w.Sum(int64(len(data)))
+	want := sha256.Sum256(data)
+	if err != nil || !bytes.Equal(got, want[:]) {
+		t.Fatalf("Sum() = %x, %v; want %x", got, err, want)
+	}
+	if n := src.n.Load(); n != 3000 {
+		t.Errorf("read %d bytes from the source, want the 3000 marked", n)
+	}
+}
+
+func TestSumIncomplete(t *testing.T) {
+	data := content(1000)
+	w := hashwriter.NewSHA256(nil)
+	w.WriteAt(data[:400], 0)
+	w.WriteAt(data[500:], 500)
+	if _, err := w.Sum(int64(len(data))); err == nil {
+		t.Error("Sum() succeeded with a gap at 400-499")
+	}
+	if w.Offset() != 400 {
+		t.Errorf("Offset() = %d, want 400", w.Offset())
+	}
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	data := content(200_000)
+	src := bytes.NewReader(data)
+	w := hashwriter.New(sha256.New(), src, 16<<10)
+	segs := split(data, 4096)
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := worker; i < len(segs); i += 8 {
+				if _, err := w.WriteAt(segs[i].data, segs[i].off); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	got, err := w.Sum(int64(len(data)))
+	want := sha256.Sum256(data)
+	if err != nil || !bytes.Equal(got, want[:]) {
+		t.Errorf("Sum() = %x, %v; want %x", got, err, want)
+	}
+}
@@ -0,0 +1,63 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// Timeout is the maximum time a hook command is allowed to run.
+const Timeout = 60 * time.Second
+
+// RunHook executes command through the system shell with env appended to the
+// current process environment. Both its stdout and its stderr go to stderr,
+// so that they never mix with a download written to stdout.
+func RunHook(command string, env []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	c := shellCommand(ctx, command, env)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+
+	err := c.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("hook timed out after %s", Timeout)
+	}
+	return err
+}
+
+// RunScript is RunHook with the output of the script captured instead of
+// passed through. A script that exits non-zero returns an *exec.ExitError.
+func RunScript(script string, env []string) (stdout, stderr []byte, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	var outBuf, errBuf bytes.Buffer
+	c := shellCommand(ctx, script, env)
+	c.Stdout = &outBuf
+	c.Stderr = &errBuf
+
+	err = c.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("script timed out after %s", Timeout)
+	}
+	return outBuf.Bytes(), errBuf.Bytes(), err
+}
+
+// shellCommand runs command through sh, or cmd on Windows, with env
+// appended to the current process environment.
+func shellCommand(ctx context.Context, command string, env []string) *exec.Cmd {
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		c = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	c.Env = append(os.Environ(), env...)
+	return c
+}
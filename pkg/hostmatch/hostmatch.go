@@ -0,0 +1,35 @@
+// Package hostmatch looks up per-host settings by hostname.
+package hostmatch
+
+import "strings"
+
+// Lookup returns the value table gives for host, and whether there is one.
+// Keys are hostnames or "*.suffix" wildcards, which match any subdomain of
+// suffix but not suffix itself; the most specific key wins:
+// "a.cdn.example.com" over "*.cdn.example.com" over "*.example.com".
+// Matching is case-insensitive.
+func Lookup[V any](host string, table map[string]V) (V, bool) {
+	var zero V
+	if host == "" || len(table) == 0 {
+		return zero, false
+	}
+	lower := make(map[string]V, len(table))
+	for k, v := range table {
+		lower[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if v, ok := lower[host]; ok {
+		return v, true
+	}
+	for rest := host; ; {
+		_, parent, ok := strings.Cut(rest, ".")
+		if !ok {
+			return zero, false
+		}
+		if v, ok := lower["*."+parent]; ok {
+			return v, true
+		}
+		rest = parent
+	}
+}
@@ -0,0 +1,91 @@
+package ioprofile
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// File is what WriteProfiler wraps, normally an *os.File.
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+}
+
+// WriteProfiler records how long each WriteAt call on the wrapped file takes.
+// High latencies point at the disk rather than the network.
+type WriteProfiler struct {
+	File
+	mu      sync.Mutex
+	samples []time.Duration
+	bytes   int64
+}
+
+func New(f File) *WriteProfiler {
+	return &WriteProfiler{File: f}
+}
+
+func (p *WriteProfiler) WriteAt(b []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := p.File.WriteAt(b, off)
+	elapsed := time.Since(start)
+
+	p.mu.Lock()
+	p.samples = append(p.samples, elapsed)
+	p.bytes += int64(n)
+	p.mu.Unlock()
+	return n, err
+}
+
+// Stats summarizes the recorded write latencies.
+type Stats struct {
+	Writes int
+	Bytes  int64
+	Total  time.Duration
+	Min    time.Duration
+	Max    time.Duration
+	P50    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+}
+
+func (p *WriteProfiler) Stats() Stats {
+	p.mu.Lock()
+	sorted := slices.Clone(p.samples)
+	s := Stats{Writes: len(sorted), Bytes: p.bytes}
+	p.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return s
+	}
+	slices.Sort(sorted)
+	for _, d := range sorted {
+		s.Total += d
+	}
+	s.Min, s.Max = sorted[0], sorted[len(sorted)-1]
+	s.P50 = percentile(sorted, 50)
+	s.P95 = percentile(sorted, 95)
+	s.P99 = percentile(sorted, 99)
+	return s
+}
+
+// percentile returns the nearest-rank pth percentile of sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)]
+}
+
+// Report writes a summary of Stats to w.
+func (p *WriteProfiler) Report(w io.Writer) {
+	s := p.Stats()
+	if s.Writes == 0 {
+		fmt.Fprintln(w, "I/O profile: no writes")
+		return
+	}
+	fmt.Fprintf(w, "I/O profile: %d writes, %d bytes, %s spent writing\n", s.Writes, s.Bytes, s.Total.Round(time.Microsecond))
+	fmt.Fprintf(w, "  write latency: min %s  p50 %s  p95 %s  p99 %s  max %s\n",
+		s.Min, s.P50, s.P95, s.P99, s.Max)
+}
@@ -0,0 +1,70 @@
+// Package kaprobe sends a small request to a server whenever a download has
+// received nothing for a while, for servers and middleboxes that drop
+// connections idle for 30 to 60 seconds and don't honour TCP keepalive.
+// The probe goes over another connection, so it can't revive a stalled
+// one, but it keeps the server's idle pooled connections and the NAT and
+// firewall state for the host fresh, so that the retry after a stall
+// doesn't start from scratch.
+package kaprobe
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPeriod is the idle time after which a probe is sent by default.
+const DefaultPeriod = 20 * time.Second
+
+// Prober calls its probe once nothing has been received for its period, and
+// again every period for as long as that lasts.
+type Prober struct {
+	period time.Duration
+	probe  func()
+	last   atomic.Int64 // UnixNano of the last activity
+}
+
+// New returns a Prober that calls probe after period (DefaultPeriod if not
+// positive) without activity. probe reports its own failures; they don't
+// stop the Prober.
+func New(period time.Duration, probe func()) *Prober {
+	if period <= 0 {
+		period = DefaultPeriod
+	}
+	p := &Prober{period: period, probe: probe}
+	p.Touch()
+	return p
+}
+
+// Touch records activity, such as bytes received. It may be called from any
+// goroutine, and on a nil Prober.
+func (p *Prober) Touch() {
+	if p != nil {
+		p.last.Store(time.Now().UnixNano())
+	}
+}
+
+// Idle returns how long it has been since the last activity.
+func (p *Prober) Idle() time.Duration {
+	return time.Since(time.Unix(0, p.last.Load()))
+}
+
+// Run sends probes until done is closed. A probe counts as activity, so the
+// next one follows a period later if the download is still idle.
+func (p *Prober) Run(done <-chan struct{}) {
+	timer := time.NewTimer(p.period)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-done:
+			return
+		}
+		if idle := p.Idle(); idle < p.period {
+			timer.Reset(p.period - idle)
+			continue
+		}
+		p.probe()
+		p.Touch()
+		timer.Reset(p.period)
+	}
+}
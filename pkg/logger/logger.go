@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+)
+
+// Init installs the default slog logger writing warnings and errors to
+// stderr, plus debug records when debug is true. If logFile is not empty,
+// every record is also appended to that file.
+func Init(debug bool, logFile string) error {
+	level := slog.LevelWarn
+	if debug {
+		level = slog.LevelDebug
+	}
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+
+	if logFile != "" {
+		fh, err := NewFileHandler(logFile, slog.LevelDebug)
+		if err != nil {
+			return err
+		}
+		h = teeHandler{h, fh}
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// NewFileHandler returns a handler appending records at or above level to
+// the file at path, creating it if needed.
+func NewFileHandler(path string, level slog.Level) (slog.Handler, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return slog.NewTextHandler(f, &slog.HandlerOptions{Level: level}), nil
+}
+
+// teeHandler passes each record to every handler that accepts its level.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
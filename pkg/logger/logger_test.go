@@ -0,0 +1,73 @@
+package logger_test
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/logger"
+	"gdl/pkg/testserver"
+)
+
+func TestLogFileGetsDownloadRecords(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	logFile := filepath.Join(t.TempDir(), "gdl.log")
+	srv := testserver.NewTestServer(t, testserver.RandomContent(100_000, 1))
+	url := srv.FileURL("data.bin")
+
+	// Two runs, as two gdl invocations would, append to the same file.
+	for i := 0; i < 2; i++ {
+		if err := logger.Init(false, logFile); err != nil {
+			t.Fatal(err)
+		}
+		err := downloader.NewDownloader().Download(downloader.DownloadConfig{
+			Url:         url,
+			OutputDir:   t.TempDir(),
+			Concurrency: 2,
+			Quiet:       true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	for _, msg := range []string{`msg="download started"`, `msg="download finished"`} {
+		if n := strings.Count(log, msg); n != 2 {
+			t.Errorf("%s appears %d times, want 2:\n%s", msg, n, log)
+		}
+	}
+	if !strings.Contains(log, "url="+url) {
+		t.Errorf("log lacks url=%s:\n%s", url, log)
+	}
+	// The file gets debug records even without --debug.
+	if !strings.Contains(log, "level=DEBUG") {
+		t.Errorf("log has no debug records:\n%s", log)
+	}
+}
+
+func TestNewFileHandlerLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gdl.log")
+	h, err := logger.NewFileHandler(path, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(h)
+	log.Debug("hidden")
+	log.Info("shown", "n", 1)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); strings.Contains(got, "hidden") || !strings.Contains(got, `msg=shown n=1`) {
+		t.Errorf("log file holds %q, want only the info record", got)
+	}
+}
@@ -0,0 +1,34 @@
+// Package mimedirs picks an output directory from a file's MIME type.
+package mimedirs
+
+import (
+	"mime"
+	"strings"
+)
+
+// Lookup returns the directory mappings gives for contentType, or "" if
+// none does. Keys are MIME types, "type/*" wildcards or "*/*"; parameters
+// such as charset are ignored, and the most specific key wins:
+// "image/png" over "image/*" over "*/*". Matching is case-insensitive.
+func Lookup(contentType string, mappings map[string]string) string {
+	if contentType == "" || len(mappings) == 0 {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(contentType, ";")
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	major, _, _ := strings.Cut(mediaType, "/")
+
+	lower := make(map[string]string, len(mappings))
+	for k, v := range mappings {
+		lower[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	for _, key := range []string{mediaType, major + "/*", "*/*"} {
+		if dir, ok := lower[key]; ok {
+			return dir
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+// Package multiout writes downloaded bytes to several outputs at once, like
+// tee(1).
+package multiout
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+// MultiWriteAt is an io.WriterAt that writes to each of its writers in turn,
+// like io.MultiWriter. If one of them writes less, the writers after it only
+// get the bytes it took, so that all of them hold the same prefix of p.
+type MultiWriteAt []io.WriterAt
+
+func (m MultiWriteAt) WriteAt(p []byte, off int64) (int, error) {
+	n := len(p)
+	for _, w := range m {
+		var err error
+		if n, err = w.WriteAt(p[:n], off); err != nil {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+// ErrOutOfOrder is returned for a write to a stream output that would
+// leave a gap after the bytes already sent.
+var ErrOutOfOrder = errors.New("stream output can only be written in order")
+
+// Output is an extra destination opened by Open.
+type Output interface {
+	io.WriterAt
+	io.Closer
+}
+
+// IsStream reports whether path is a Unix socket. Such an output takes the
+// bytes only in order, so a download tee'd to it must use one connection.
+func IsStream(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeSocket != 0
+}
+
+// Open opens path as an output: a Unix socket is connected to, anything
+// else is created, or truncated, as a file.
+func Open(path string) (Output, error) {
+	if IsStream(path) {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		return &stream{Conn: conn}, nil
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// stream adapts a connection to io.WriterAt for bytes that arrive in
+// order. Bytes before the ones already sent are skipped, as a retry sends
+// the same bytes again.
+type stream struct {
+	net.Conn
+	mu   sync.Mutex
+	next int64
+}
+
+func (s *stream) WriteAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if off > s.next {
+		return 0, fmt.Errorf("%w: write at %d, %d bytes sent", ErrOutOfOrder, off, s.next)
+	}
+	skip := s.next - off
+	if skip >= int64(len(p)) {
+		return len(p), nil
+	}
+	n, err := s.Write(p[skip:])
+	s.next += int64(n)
+	return int(skip) + n, err
+}
@@ -0,0 +1,135 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiryMargin is how long before it expires a token is replaced, so that
+// it doesn't run out between being handed out and the request arriving.
+// Short-lived tokens are replaced halfway through their lifetime instead.
+const expiryMargin = 30 * time.Second
+
+// ClientCredentialsProvider gets access tokens with the OAuth2 client
+// credentials grant (RFC 6749 section 4.4) and fetches a new one once the
+// current one expires. It is safe for concurrent use.
+type ClientCredentialsProvider struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	Client       *http.Client // http.DefaultClient if nil
+
+	mu          sync.Mutex
+	tokenType   string
+	token       string
+	renewAt     time.Time // zero if the server gave no expires_in
+	credsInBody bool      // the server wants the credentials in the form, not Basic auth
+}
+
+// tokenResponse is the token endpoint's answer, successful or not.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Authorization returns the Authorization header value for a request:
+// "Bearer <token>".
+func (p *ClientCredentialsProvider) Authorization(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token == "" || (!p.renewAt.IsZero() && time.Now().After(p.renewAt)) {
+		if err := p.refresh(ctx); err != nil {
+			return "", err
+		}
+	}
+	return p.tokenType + " " + p.token, nil
+}
+
+// refresh fetches a new token. Credentials are sent with HTTP Basic auth,
+// as RFC 6749 recommends; if the server refuses that, they are sent in the
+// form instead, as some servers require.
+func (p *ClientCredentialsProvider) refresh(ctx context.Context) error {
+	tok, status, err := p.request(ctx, p.credsInBody)
+	if err != nil && !p.credsInBody && (status == http.StatusBadRequest || status == http.StatusUnauthorized) {
+		if tok2, _, err2 := p.request(ctx, true); err2 == nil {
+			tok, err = tok2, nil
+			p.credsInBody = true
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	p.token = tok.AccessToken
+	p.tokenType = "Bearer"
+	if tok.TokenType != "" && !strings.EqualFold(tok.TokenType, "bearer") {
+		p.tokenType = tok.TokenType
+	}
+	p.renewAt = time.Time{}
+	if tok.ExpiresIn > 0 {
+		lifetime := time.Duration(tok.ExpiresIn) * time.Second
+		p.renewAt = time.Now().Add(lifetime - min(expiryMargin, lifetime/2))
+	}
+	return nil
+}
+
+func (p *ClientCredentialsProvider) request(ctx context.Context, credsInBody bool) (*tokenResponse, int, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(p.Scopes) > 0 {
+		form.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	if credsInBody {
+		form.Set("client_id", p.ClientID)
+		form.Set("client_secret", p.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !credsInBody {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("oauth2 token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("oauth2 token request: %w", err)
+	}
+
+	var tok tokenResponse
+	jsonErr := json.Unmarshal(body, &tok)
+	if resp.StatusCode != http.StatusOK {
+		if jsonErr == nil && tok.Error != "" {
+			return nil, resp.StatusCode, fmt.Errorf("oauth2 token request: %s: %s %s", resp.Status, tok.Error, tok.ErrorDescription)
+		}
+		return nil, resp.StatusCode, fmt.Errorf("oauth2 token request: %s", resp.Status)
+	}
+	if jsonErr != nil {
+		return nil, resp.StatusCode, fmt.Errorf("oauth2 token request: invalid response: %w", jsonErr)
+	}
+	if tok.AccessToken == "" {
+		return nil, resp.StatusCode, fmt.Errorf("oauth2 token request: no access_token in response")
+	}
+	return &tok, resp.StatusCode, nil
+}
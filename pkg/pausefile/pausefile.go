@@ -0,0 +1,91 @@
+// Package pausefile pauses downloads while a file exists, so scripts and
+// other programs can hold gdl back without sending it signals.
+package pausefile
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often the file is looked for by default.
+const DefaultInterval = 5 * time.Second
+
+// Watcher looks for a file every interval and is paused while it exists.
+type Watcher struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	resumed chan struct{} // closed while not paused
+}
+
+// New returns a Watcher for path, polling every interval (DefaultInterval
+// if not positive). The file is looked for once straight away.
+func New(path string, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	w := &Watcher{path: path, interval: interval, resumed: make(chan struct{})}
+	close(w.resumed)
+	w.poll()
+	return w
+}
+
+// Run polls for the file until done is closed.
+func (w *Watcher) Run(done <-chan struct{}) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.poll()
+		case <-done:
+			return
+		}
+	}
+}
+
+func (w *Watcher) poll() {
+	_, err := os.Stat(w.path)
+	exists := err == nil
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.resumed:
+		if exists {
+			w.resumed = make(chan struct{})
+		}
+	default:
+		if !exists {
+			close(w.resumed)
+		}
+	}
+}
+
+// Paused reports whether the file existed when last looked for.
+func (w *Watcher) Paused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.resumed:
+		return false
+	default:
+		return true
+	}
+}
+
+// Wait blocks while paused. It returns ctx's error if ctx ends first.
+func (w *Watcher) Wait(ctx context.Context) error {
+	w.mu.Lock()
+	resumed := w.resumed
+	w.mu.Unlock()
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,181 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// DefaultBlockSize is how many bytes each request asks for when BlockSize is
+// not set.
+const DefaultBlockSize = 4 << 20
+
+// FetchFunc opens bytes start..end (inclusive) of the file. A nil reader
+// with a nil error means there is nothing to read in that range.
+type FetchFunc func(ctx context.Context, start, end int64) (io.ReadCloser, error)
+
+// PipelinedDownloader reads a byte range as a series of smaller range
+// requests and keeps up to Depth of them in flight: the request for block
+// N+1 goes out while block N is still being received, so the connection
+// doesn't sit idle for a round trip between blocks. Over HTTP/2 the
+// requests share one connection. It is safe for concurrent use.
+type PipelinedDownloader struct {
+	Fetch     FetchFunc
+	Depth     int   // requests in flight; 1 if not positive
+	BlockSize int64 // bytes per request; DefaultBlockSize if not positive
+}
+
+// result is the response to one block's request.
+type result struct {
+	body io.ReadCloser
+	err  error
+}
+
+// Open returns a reader for bytes start..end, delivered in order, or nil if
+// the server has nothing there, as FetchFunc does. It waits for the response
+// to the first request, so an error from the server is returned here rather
+// than by the first Read. Closing the reader cancels the requests still in
+// flight.
+func (p *PipelinedDownloader) Open(ctx context.Context, start, end int64) (io.ReadCloser, error) {
+	depth := max(p.Depth, 1)
+	blockSize := p.BlockSize
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	if start > end {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &reader{
+		cancel: cancel,
+		slots:  make(chan struct{}, depth),
+	}
+	for s := start; s <= end; s += blockSize {
+		r.blocks = append(r.blocks, [2]int64{s, min(s+blockSize-1, end)})
+	}
+	// One buffered channel per block demultiplexes the responses, which
+	// may arrive in any order, back into block order.
+	r.results = make([]chan result, len(r.blocks))
+	for i := range r.results {
+		r.results[i] = make(chan result, 1)
+	}
+	go r.issue(ctx, p.Fetch)
+
+	// Like FetchFunc, nothing at the start means nothing at all.
+	if err := r.next(); err != nil || r.body == nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// reader hands out the blocks' bodies one after the other.
+type reader struct {
+	cancel  context.CancelFunc
+	blocks  [][2]int64
+	results []chan result
+	slots   chan struct{} // one per request in flight
+	taken   int           // first block whose response hasn't been taken
+	body    io.ReadCloser // body being read, nil between blocks
+	left    int64         // bytes of it not read yet
+	err     error         // sticky error from a response
+	closed  bool
+}
+
+// issue is the request queue: it sends the blocks' requests in order,
+// waiting for a free slot before each. Blocks it never gets to because ctx
+// is cancelled receive ctx's error.
+func (r *reader) issue(ctx context.Context, fetch FetchFunc) {
+	for i, b := range r.blocks {
+		select {
+		case r.slots <- struct{}{}:
+		case <-ctx.Done():
+			for _, ch := range r.results[i:] {
+				ch <- result{err: ctx.Err()}
+			}
+			return
+		}
+		go func() {
+			body, err := fetch(ctx, b[0], b[1])
+			r.results[i] <- result{body, err}
+		}()
+	}
+}
+
+// next waits for the response to the next block and makes its body the one
+// being read. A nil body means the server had nothing for the block.
+func (r *reader) next() error {
+	i := r.taken
+	res := <-r.results[i]
+	r.taken++
+	if res.err != nil {
+		r.err = res.err
+		return res.err
+	}
+	r.body = res.body
+	r.left = r.blocks[i][1] - r.blocks[i][0] + 1
+	return nil
+}
+
+func (r *reader) Read(buf []byte) (int, error) {
+	if r.closed {
+		return 0, errors.New("pipeline: read after close")
+	}
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	for {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.body == nil {
+			if r.taken == len(r.blocks) {
+				return 0, io.EOF
+			}
+			if err := r.next(); err != nil {
+				return 0, err
+			}
+			if r.body == nil {
+				r.err = io.ErrUnexpectedEOF
+				return 0, r.err
+			}
+		}
+		n, err := r.body.Read(buf[:min(int64(len(buf)), r.left)])
+		r.left -= int64(n)
+		if r.left == 0 {
+			r.body.Close()
+			r.body = nil
+			<-r.slots // let the next request go out
+			err = nil
+		} else if err == io.EOF {
+			// The next block's bytes would land at the wrong offset.
+			err = io.ErrUnexpectedEOF
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close cancels the requests in flight and closes every body received.
+func (r *reader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.cancel()
+	if r.body != nil {
+		r.body.Close()
+	}
+	rest := r.results[r.taken:]
+	go func() {
+		for _, ch := range rest {
+			if res := <-ch; res.body != nil {
+				res.body.Close()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,102 @@
+package progressfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gdl/pkg/fileutil"
+)
+
+const (
+	StatusDownloading = "downloading"
+	StatusDone        = "done"
+	StatusError       = "error"
+)
+
+// Progress is the content of a progress file.
+type Progress struct {
+	URL        string `json:"url"`
+	File       string `json:"file"`
+	Downloaded int64  `json:"downloaded"`
+	Total      int64  `json:"total"`
+	Speed      int64  `json:"speed"` // bytes per second since the last update
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Writer keeps a JSON progress file for one URL up to date, for tools that
+// monitor a download without parsing terminal output.
+type Writer struct {
+	path     string
+	mu       sync.Mutex
+	progress Progress
+	updated  time.Time
+}
+
+// New returns a Writer for url whose file is Path(dir, url).
+func New(dir, url string) *Writer {
+	return &Writer{
+		path:     Path(dir, url),
+		progress: Progress{URL: url, Total: -1, Status: StatusDownloading},
+	}
+}
+
+// Path returns the progress file for url in dir, named by a hash of url.
+func Path(dir, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// Update records that downloaded of total bytes of file are done.
+func (w *Writer) Update(file string, downloaded, total int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	if !w.updated.IsZero() {
+		if elapsed := now.Sub(w.updated).Seconds(); elapsed > 0 {
+			w.progress.Speed = int64(float64(downloaded-w.progress.Downloaded) / elapsed)
+		}
+	}
+	w.updated = now
+	w.progress.File = file
+	w.progress.Downloaded = downloaded
+	w.progress.Total = total
+	return w.write()
+}
+
+// Finish records the outcome of the download.
+func (w *Writer) Finish(file string, err error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if file != "" {
+		w.progress.File = file
+	}
+	w.progress.Speed = 0
+	if err != nil {
+		w.progress.Status = StatusError
+		w.progress.Error = err.Error()
+	} else {
+		w.progress.Status = StatusDone
+		if w.progress.Total >= 0 {
+			w.progress.Downloaded = w.progress.Total
+		}
+	}
+	return w.write()
+}
+
+// write replaces the file in one step so readers never see half of it.
+func (w *Writer) write() error {
+	data, err := json.Marshal(&w.progress)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(w.path, data, 0644)
+}
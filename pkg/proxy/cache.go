@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gdl/pkg/fileutil"
+)
+
+// Cache stores files by the SHA-256 of their contents, with an index from
+// URL to contents, so that several URLs serving the same file share a copy.
+//
+// Layout: objects/ab/abcd... holds the files, index/<hash of URL>.json the
+// entries and tmp/ the downloads in progress.
+type Cache struct {
+	Dir string
+}
+
+// Entry describes a cached URL.
+type Entry struct {
+	URL     string    `json:"url"`
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	Name    string    `json:"name"` // the file name the download was saved as
+	Fetched time.Time `json:"fetched"`
+}
+
+func urlKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) indexPath(url string) string {
+	return filepath.Join(c.Dir, "index", urlKey(url)+".json")
+}
+
+func (c *Cache) objectPath(sum string) string {
+	return filepath.Join(c.Dir, "objects", sum[:2], sum)
+}
+
+// TempDir returns the directory url is downloaded into before it is stored.
+// It is the same on every call, so an interrupted download resumes.
+func (c *Cache) TempDir(url string) string {
+	return filepath.Join(c.Dir, "tmp", urlKey(url)[:16])
+}
+
+// Lookup returns url's entry, or nil if it is not cached.
+func (c *Cache) Lookup(url string) (*Entry, error) {
+	data, err := os.ReadFile(c.indexPath(url))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(c.objectPath(e.SHA256)); err != nil {
+		return nil, nil
+	}
+	return &e, nil
+}
+
+// Open opens the file of e.
+func (c *Cache) Open(e *Entry) (*os.File, error) {
+	return os.Open(c.objectPath(e.SHA256))
+}
+
+// Store moves the downloaded file path into the cache as url's contents.
+func (c *Cache) Store(url, path string) (*Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{
+		URL:     url,
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+		Size:    size,
+		Name:    filepath.Base(path),
+		Fetched: time.Now().UTC(),
+	}
+	obj := c.objectPath(e.SHA256)
+	if err := os.MkdirAll(filepath.Dir(obj), 0755); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(obj); err == nil {
+		// Another URL already brought the same contents.
+		os.Remove(path)
+	} else if err := os.Rename(path, obj); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	index := c.indexPath(url)
+	if err := os.MkdirAll(filepath.Dir(index), 0755); err != nil {
+		return nil, err
+	}
+	return e, fileutil.WriteFile(index, data, 0644)
+}
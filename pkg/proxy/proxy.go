@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gdl/pkg/zerocopy"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// FetchFunc downloads url into dir and returns the path of the file.
+type FetchFunc func(ctx context.Context, url, dir string) (string, error)
+
+// Server answers GET /https://example.com/file.zip with the file at that
+// URL, downloading it into Cache on the first request and serving later
+// ones from there. Requests in absolute form, as sent to an HTTP proxy,
+// work too.
+type Server struct {
+	Cache *Cache
+	Fetch FetchFunc
+
+	group singleflight.Group // downloads in progress, by URL
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	url, err := targetURL(r.RequestURI)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e, err := s.Cache.Lookup(url)
+	if err == nil && e == nil {
+		slog.Info("proxy cache miss, downloading", "url", url)
+		e, err = s.fetch(r.Context(), url)
+	} else if err == nil {
+		slog.Info("proxy cache hit", "url", url, "sha256", e.SHA256)
+	}
+	if err != nil {
+		slog.Warn("proxy request failed", "url", url, "error", err)
+		if r.Context().Err() == nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+
+	f, err := s.Cache.Open(e)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	if ct := mime.TypeByExtension(filepath.Ext(e.Name)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": e.Name}))
+	w.Header().Set("ETag", `"`+e.SHA256+`"`)
+	if sendWhole(w, r, e, f) {
+		return
+	}
+	http.ServeContent(w, r, e.Name, e.Fetched, f)
+}
+
+// sendWhole answers a plain GET for the whole of f with zerocopy.SendFile,
+// on the hijacked connection, which is closed afterwards. It returns false,
+// having written nothing, for requests that ServeContent should handle:
+// HEAD, ranges, conditional requests and HTTP/2.
+func sendWhole(w http.ResponseWriter, r *http.Request, e *Entry, f *os.File) bool {
+	if r.Method != http.MethodGet || r.Header.Get("Range") != "" ||
+		r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	h := w.Header().Clone()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "application/octet-stream")
+	}
+	if !e.Fetched.IsZero() {
+		h.Set("Last-Modified", e.Fetched.UTC().Format(http.TimeFormat))
+	}
+	h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	h.Set("Connection", "close")
+	buf.WriteString("HTTP/1.1 200 OK\r\n")
+	h.Write(buf)
+	buf.WriteString("\r\n")
+	if err := buf.Flush(); err != nil {
+		return true
+	}
+	if _, err := zerocopy.SendFile(conn, f, 0, fi.Size()); err != nil {
+		slog.Warn("proxy send failed", "file", e.Name, "error", err)
+	}
+	return true
+}
+
+// fetch downloads url into the cache once, however many clients ask for it
+// meanwhile. The download goes on if the client that started it leaves.
+func (s *Server) fetch(ctx context.Context, url string) (*Entry, error) {
+	ch := s.group.DoChan(url, func() (any, error) {
+		dir := s.Cache.TempDir(url)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		path, err := s.Fetch(context.WithoutCancel(ctx), url, dir)
+		if err != nil {
+			return nil, err
+		}
+		e, err := s.Cache.Store(url, path)
+		if err != nil {
+			return nil, err
+		}
+		os.RemoveAll(dir)
+		return e, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*Entry), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// targetURL extracts the URL to fetch from a request URI, either
+// "/https://host/path" or, from a client using gdl as an HTTP proxy,
+// "http://host/path".
+func targetURL(requestURI string) (string, error) {
+	url := strings.TrimPrefix(requestURI, "/")
+	// Some clients collapse the double slash.
+	for _, scheme := range []string{"http:/", "https:/"} {
+		if rest, ok := strings.CutPrefix(url, scheme); ok && !strings.HasPrefix(rest, "/") {
+			url = scheme + "/" + rest
+		}
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return "", fmt.Errorf("request a URL as /https://host/path, not %q", requestURI)
+	}
+	return url, nil
+}
@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"container/heap"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Download priorities, highest first.
+const (
+	Critical   = 5
+	High       = 4
+	Normal     = 3
+	Low        = 2
+	Background = 1
+)
+
+var priorityNames = map[string]int{
+	"critical":   Critical,
+	"high":       High,
+	"normal":     Normal,
+	"low":        Low,
+	"background": Background,
+}
+
+// ParsePriority reads a priority given by name, such as "high", or as a
+// number from 1 (background) to 5 (critical).
+func ParsePriority(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if p, ok := priorityNames[s]; ok {
+		return p, nil
+	}
+	if p, err := strconv.Atoi(s); err == nil && p >= Background && p <= Critical {
+		return p, nil
+	}
+	return 0, fmt.Errorf("invalid priority %q (want critical, high, normal, low, background or 1-5)", s)
+}
+
+// PriorityQueue hands out items highest priority first, and items of equal
+// priority in the order they were pushed. It is not safe for concurrent use.
+type PriorityQueue[T any] struct {
+	items itemHeap[T]
+	seq   int
+}
+
+type item[T any] struct {
+	value    T
+	priority int
+	seq      int
+}
+
+// Push adds v with the given priority.
+func (q *PriorityQueue[T]) Push(v T, priority int) {
+	q.seq++
+	heap.Push(&q.items, item[T]{value: v, priority: priority, seq: q.seq})
+}
+
+// Pop removes and returns the item with the highest priority. It returns
+// false if the queue is empty.
+func (q *PriorityQueue[T]) Pop() (T, bool) {
+	if len(q.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return heap.Pop(&q.items).(item[T]).value, true
+}
+
+// Len returns the number of items in the queue.
+func (q *PriorityQueue[T]) Len() int {
+	return len(q.items)
+}
+
+// itemHeap implements heap.Interface for PriorityQueue.
+type itemHeap[T any] []item[T]
+
+func (h itemHeap[T]) Len() int { return len(h) }
+
+func (h itemHeap[T]) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h itemHeap[T]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *itemHeap[T]) Push(x any) { *h = append(*h, x.(item[T])) }
+
+func (h *itemHeap[T]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
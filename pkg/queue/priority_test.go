@@ -0,0 +1,88 @@
+package queue_test
+
+import (
+	"slices"
+	"testing"
+
+	"gdl/pkg/queue"
+)
+
+func TestParsePriority(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want int
+	}{
+		{"critical", queue.Critical},
+		{"High", queue.High},
+		{" normal ", queue.Normal},
+		{"LOW", queue.Low},
+		{"background", queue.Background},
+		{"5", queue.Critical},
+		{"1", queue.Background},
+		{"3", queue.Normal},
+	} {
+		if got, err := queue.ParsePriority(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParsePriority(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "urgent", "0", "6", "-1", "2.5"} {
+		if got, err := queue.ParsePriority(in); err == nil {
+			t.Errorf("ParsePriority(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+	var q queue.PriorityQueue[string]
+	q.Push("low-1", queue.Low)
+	q.Push("normal-1", queue.Normal)
+	q.Push("critical", queue.Critical)
+	q.Push("normal-2", queue.Normal)
+	q.Push("low-2", queue.Low)
+	q.Push("normal-3", queue.Normal)
+	q.Push("background", queue.Background)
+	if q.Len() != 7 {
+		t.Fatalf("Len() = %d, want 7", q.Len())
+	}
+
+	var got []string
+	for {
+		v, ok := q.Pop()
+		if !ok {
+			break
+		}
+		got = append(got, v)
+	}
+	// Highest first; equal priorities in the order they were pushed.
+	want := []string{"critical", "normal-1", "normal-2", "normal-3", "low-1", "low-2", "background"}
+	if !slices.Equal(got, want) {
+		t.Errorf("popped %q, want %q", got, want)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d after popping everything", q.Len())
+	}
+}
+
+func TestPriorityQueueInterleaved(t *testing.T) {
+	var q queue.PriorityQueue[int]
+	q.Push(1, queue.Normal)
+	q.Push(2, queue.Normal)
+	if v, _ := q.Pop(); v != 1 {
+		t.Errorf("Pop() = %d, want 1", v)
+	}
+	// Pushed later, but more urgent than what is left.
+	q.Push(3, queue.High)
+	q.Push(4, queue.Normal)
+	for _, want := range []int{3, 2, 4} {
+		if v, ok := q.Pop(); !ok || v != want {
+			t.Errorf("Pop() = %d, %v; want %d", v, ok, want)
+		}
+	}
+}
+
+func TestPriorityQueueEmpty(t *testing.T) {
+	var q queue.PriorityQueue[*int]
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Pop() on an empty queue = %v, %v; want nil, false", v, ok)
+	}
+}
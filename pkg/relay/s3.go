@@ -0,0 +1,207 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// MinPartSize is the smallest part S3 accepts, other than the last.
+	MinPartSize = 5 << 20
+	// maxParts is the most parts a multipart upload can have.
+	maxParts = 10000
+	// maxUploads is how many parts are uploaded at the same time. Writes
+	// wait while that many are in flight, which bounds the memory used.
+	maxUploads = 8
+)
+
+// ParseS3URL splits an s3://bucket/key URL.
+func ParseS3URL(s string) (bucket, key string, err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", err
+	}
+	key = strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "s3" || u.Host == "" || key == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %q (want s3://bucket/key)", s)
+	}
+	return u.Host, key, nil
+}
+
+// S3Relay uploads a file to S3 as it is downloaded, as a multipart upload.
+// It is an io.WriterAt: the downloader's chunks are written to it at their
+// offsets, in any order, and each part is uploaded as soon as all its bytes
+// have been written, so only the parts being filled are held in memory.
+// Writes must not overlap. Call Complete once everything is written, or
+// Abort to give up.
+type S3Relay struct {
+	client   *s3.Client
+	bucket   string
+	key      string
+	size     int64
+	partSize int64
+	uploadID *string
+	ctx      context.Context
+
+	mu        sync.Mutex
+	filling   map[int32]*part // parts not fully written yet, by number
+	completed []types.CompletedPart
+	err       error // first failed upload
+
+	slots   chan struct{} // one per part upload in flight
+	uploads sync.WaitGroup
+}
+
+// part is the buffer of one part being written.
+type part struct {
+	buf     []byte
+	written int
+}
+
+// NewS3Relay starts a multipart upload of a size-byte file to bucket/key.
+// ctx is used for all of the upload's requests.
+func NewS3Relay(ctx context.Context, client *s3.Client, bucket, key string, size int64, contentType string) (*S3Relay, error) {
+	if size < 0 {
+		return nil, errors.New("relaying to S3 needs the file size, which the server did not report")
+	}
+	// The smallest part size, in MiB, that keeps within the part limit.
+	partSize := max(int64(MinPartSize), (size+maxParts-1)/maxParts)
+	partSize = (partSize + 1<<20 - 1) &^ (1<<20 - 1)
+
+	in := &s3.CreateMultipartUploadInput{Bucket: &bucket, Key: &key}
+	if contentType != "" {
+		in.ContentType = &contentType
+	}
+	out, err := client.CreateMultipartUpload(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("starting upload to s3://%s/%s: %w", bucket, key, err)
+	}
+	return &S3Relay{
+		client:   client,
+		bucket:   bucket,
+		key:      key,
+		size:     size,
+		partSize: partSize,
+		uploadID: out.UploadId,
+		ctx:      ctx,
+		filling:  make(map[int32]*part),
+		slots:    make(chan struct{}, maxUploads),
+	}, nil
+}
+
+// WriteAt copies p into the parts it belongs to and starts the upload of
+// those it completes.
+func (r *S3Relay) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > r.size {
+		return 0, fmt.Errorf("write at %d-%d is outside the %d-byte file", off, off+int64(len(p)), r.size)
+	}
+	n := 0
+	for n < len(p) {
+		num := int32((off+int64(n))/r.partSize) + 1
+		start := int64(num-1) * r.partSize
+
+		r.mu.Lock()
+		if r.err != nil {
+			r.mu.Unlock()
+			return n, r.err
+		}
+		pt := r.filling[num]
+		if pt == nil {
+			pt = &part{buf: make([]byte, min(r.partSize, r.size-start))}
+			r.filling[num] = pt
+		}
+		copied := copy(pt.buf[off+int64(n)-start:], p[n:])
+		pt.written += copied
+		full := pt.written == len(pt.buf)
+		if full {
+			delete(r.filling, num)
+		}
+		r.mu.Unlock()
+
+		n += copied
+		if full {
+			r.upload(num, pt.buf)
+		}
+	}
+	return n, nil
+}
+
+// upload uploads a part in the background once a slot is free.
+func (r *S3Relay) upload(num int32, buf []byte) {
+	r.slots <- struct{}{}
+	r.uploads.Add(1)
+	go func() {
+		defer r.uploads.Done()
+		defer func() { <-r.slots }()
+		out, err := r.client.UploadPart(r.ctx, &s3.UploadPartInput{
+			Bucket:        &r.bucket,
+			Key:           &r.key,
+			UploadId:      r.uploadID,
+			PartNumber:    &num,
+			Body:          bytes.NewReader(buf),
+			ContentLength: aws.Int64(int64(len(buf))),
+		})
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err != nil {
+			if r.err == nil {
+				r.err = fmt.Errorf("uploading part %d: %w", num, err)
+			}
+			return
+		}
+		r.completed = append(r.completed, types.CompletedPart{ETag: out.ETag, PartNumber: &num})
+	}()
+}
+
+// Complete waits for the parts still uploading and completes the upload.
+// It fails if any part was not fully written.
+func (r *S3Relay) Complete() error {
+	if r.size == 0 {
+		// An upload needs at least one part, which may be empty.
+		r.upload(1, nil)
+	}
+	r.uploads.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.filling) > 0 {
+		return fmt.Errorf("%d parts were not completely downloaded", len(r.filling))
+	}
+	slices.SortFunc(r.completed, func(a, b types.CompletedPart) int {
+		return int(*a.PartNumber - *b.PartNumber)
+	})
+	_, err := r.client.CompleteMultipartUpload(r.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &r.bucket,
+		Key:             &r.key,
+		UploadId:        r.uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: r.completed},
+	})
+	if err != nil {
+		return fmt.Errorf("completing upload to s3://%s/%s: %w", r.bucket, r.key, err)
+	}
+	return nil
+}
+
+// Abort waits for the parts still uploading and aborts the upload, so that
+// S3 drops the parts already stored.
+func (r *S3Relay) Abort() error {
+	r.uploads.Wait()
+	_, err := r.client.AbortMultipartUpload(context.WithoutCancel(r.ctx), &s3.AbortMultipartUploadInput{
+		Bucket:   &r.bucket,
+		Key:      &r.key,
+		UploadId: r.uploadID,
+	})
+	return err
+}
@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gdl/pkg/useragent"
+)
+
+// --- Dropbox Resolver ---
+
+// DropboxResolver turns Dropbox share links into direct downloads by
+// setting dl=1. Short db.tt links are expanded first.
+type DropboxResolver struct {
+	// Client expands db.tt links. It must not follow redirects; if nil,
+	// such a client is used.
+	Client *http.Client
+}
+
+func (r *DropboxResolver) CanResolve(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	return host == "db.tt" || host == "dropbox.com" || host == "www.dropbox.com"
+}
+
+func (r *DropboxResolver) Resolve(u string) (string, map[string]string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u, nil, err
+	}
+	if strings.EqualFold(parsed.Hostname(), "db.tt") {
+		if parsed, err = r.expand(parsed); err != nil {
+			return u, nil, err
+		}
+		if !r.CanResolve(parsed.String()) {
+			return parsed.String(), nil, nil
+		}
+	}
+
+	q := parsed.Query()
+	q.Set("dl", "1")
+	parsed.RawQuery = q.Encode()
+	return parsed.String(), nil, nil
+}
+
+// expand returns where a db.tt short link redirects to, without following
+// the redirect itself.
+func (r *DropboxResolver) expand(short *url.URL) (*url.URL, error) {
+	client := r.Client
+	if client == nil {
+		client = &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+	}
+	req, err := http.NewRequest("GET", short.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", useragent.Default)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	location := resp.Header.Get("Location")
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+		return nil, fmt.Errorf("expanding %s: expected a redirect, got %s", short, resp.Status)
+	}
+	return short.Parse(location)
+}
@@ -0,0 +1,117 @@
+package resolver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// shortLinkServer stands in for db.tt, redirecting /<code> to targets[code].
+type shortLinkServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func newShortLinkServer(t *testing.T, targets map[string]string) *shortLinkServer {
+	s := &shortLinkServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		s.mu.Unlock()
+		target, ok := targets[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// client returns a client that sends every request to s, whatever its
+// host, and does not follow redirects, as DropboxResolver.Client must.
+func (s *shortLinkServer) client() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestDropboxResolver(t *testing.T) {
+	srv := newShortLinkServer(t, map[string]string{
+		"AbCd123":   "https://www.dropbox.com/s/xyz789/report.pdf?dl=0",
+		"Elsewhere": "https://example.com/file.zip",
+	})
+	r := &DropboxResolver{Client: srv.client()}
+
+	tests := []struct {
+		name, url, want string
+		requests        int // made to the short link server
+	}{
+		{"direct", "https://www.dropbox.com/s/xyz789/report.pdf?dl=0", "https://www.dropbox.com/s/xyz789/report.pdf?dl=1", 0},
+		{"direct without query", "https://dropbox.com/s/xyz789/report.pdf", "https://dropbox.com/s/xyz789/report.pdf?dl=1", 0},
+		{"short link", "https://db.tt/AbCd123", "https://www.dropbox.com/s/xyz789/report.pdf?dl=1", 1},
+		{"short link to another site", "http://db.tt/Elsewhere", "https://example.com/file.zip", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.mu.Lock()
+			srv.requests = nil
+			srv.mu.Unlock()
+			if !r.CanResolve(tt.url) {
+				t.Fatalf("CanResolve(%q) = false", tt.url)
+			}
+			got, headers, err := r.Resolve(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || headers != nil {
+				t.Errorf("Resolve(%q) = %q, %v; want %q", tt.url, got, headers, tt.want)
+			}
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if len(srv.requests) != tt.requests {
+				t.Fatalf("made %d requests, want %d", len(srv.requests), tt.requests)
+			}
+			if tt.requests > 0 && srv.requests[0].Header.Get("User-Agent") == "" {
+				t.Error("the short link request has no User-Agent")
+			}
+		})
+	}
+}
+
+func TestDropboxResolverShortLinkErrors(t *testing.T) {
+	srv := newShortLinkServer(t, nil)
+	r := &DropboxResolver{Client: srv.client()}
+	if _, _, err := r.Resolve("https://db.tt/Missing"); err == nil || !strings.Contains(err.Error(), "expected a redirect, got 404") {
+		t.Errorf("Resolve() error = %v, want one about the missing redirect", err)
+	}
+}
+
+func TestDropboxCanResolve(t *testing.T) {
+	for u, want := range map[string]bool{
+		"https://www.dropbox.com/s/x/f.zip":   true,
+		"https://DB.TT/abc":                   true,
+		"https://dl.dropboxusercontent.com/x": false,
+		"https://notdropbox.com/s/x/f.zip":    false,
+		"https://example.com/?u=dropbox.com":  false,
+	} {
+		if got := (&DropboxResolver{}).CanResolve(u); got != want {
+			t.Errorf("CanResolve(%q) = %v, want %v", u, got, want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package magnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gdl/pkg/fileutil"
+
+	alog "github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// MetadataTimeout bounds how long we wait for peers to send torrent metadata.
+const MetadataTimeout = 2 * time.Minute
+
+// ErrNoHTTPSeed means the torrent must be fetched over BitTorrent itself.
+var ErrNoHTTPSeed = errors.New("torrent has no usable HTTP seed")
+
+// metadata fetched by Resolve, keyed by info hash, so Download doesn't have
+// to ask the swarm again.
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[metainfo.Hash]*metainfo.MetaInfo)
+)
+
+// IsMagnet reports whether u is a magnet URI.
+func IsMagnet(u string) bool {
+	return strings.HasPrefix(strings.ToLower(u), "magnet:?")
+}
+
+type MagnetResolver struct {
+	DataDir  string        // Where partial torrent data is stored
+	SeedTime time.Duration // How long to keep seeding once a download completes
+	// Printf, if set, is given the messages of Download and DownloadTorrent.
+	Printf func(format string, a ...any)
+}
+
+func (r *MagnetResolver) CanResolve(u string) bool {
+	return IsMagnet(u)
+}
+
+// Resolve returns an HTTP seed URL for the magnet link, either from its "ws"
+// parameter or from the url-list of the fetched metadata. ErrNoHTTPSeed is
+// returned if the file is only available from peers.
+func (r *MagnetResolver) Resolve(u string) (string, map[string]string, error) {
+	m, err := metainfo.ParseMagnetUri(u)
+	if err != nil {
+		return u, nil, err
+	}
+	if ws := m.Params.Get("ws"); ws != "" {
+		return ws, nil, nil
+	}
+
+	mi, err := r.fetchMetainfo(u)
+	if err != nil {
+		return u, nil, err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return u, nil, err
+	}
+	// Our downloader fetches a single file, so only single-file torrents
+	// can be served from a web seed.
+	if len(mi.UrlList) == 0 || info.IsDir() {
+		return u, nil, ErrNoHTTPSeed
+	}
+	return webSeedURL(mi.UrlList[0], info.BestName()), nil, nil
+}
+
+// webSeedURL applies the BEP 19 rule: a URL ending in "/" names a directory
+// that holds the file.
+func webSeedURL(seed, name string) string {
+	if strings.HasSuffix(seed, "/") {
+		return seed + name
+	}
+	return seed
+}
+
+func (r *MagnetResolver) dataDir() string {
+	if r.DataDir != "" {
+		return r.DataDir
+	}
+	return filepath.Join(os.TempDir(), "gdl-torrent")
+}
+
+func (r *MagnetResolver) newClient() (*torrent.Client, error) {
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = r.dataDir()
+	cfg.ListenPort = 0
+	cfg.Seed = r.SeedTime > 0
+	cfg.Logger = alog.NewLogger("gdl").WithFilterLevel(alog.Never)
+	return torrent.NewClient(cfg)
+}
+
+func (r *MagnetResolver) fetchMetainfo(u string) (*metainfo.MetaInfo, error) {
+	m, err := metainfo.ParseMagnetUri(u)
+	if err != nil {
+		return nil, err
+	}
+	cacheMu.Lock()
+	mi, ok := cache[m.InfoHash]
+	cacheMu.Unlock()
+	if ok {
+		return mi, nil
+	}
+
+	client, err := r.newClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	t, err := client.AddMagnet(u)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-t.GotInfo():
+	case <-time.After(MetadataTimeout):
+		return nil, fmt.Errorf("timed out fetching torrent metadata after %s", MetadataTimeout)
+	}
+
+	full := t.Metainfo()
+	cacheMu.Lock()
+	cache[m.InfoHash] = &full
+	cacheMu.Unlock()
+	return &full, nil
+}
+
+// Download fetches the torrent over BitTorrent and moves the result into
+// outDir, named name or, if that is empty, as the torrent names it. progress
+// is called about once a second with bytes done and total. It returns the
+// path of the downloaded file or directory, and stops early with ctx's error
+// if ctx is cancelled.
+func (r *MagnetResolver) Download(ctx context.Context, u, outDir, name string, progress func(done, total int64)) (string, error) {
+	client, err := r.newClient()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	m, err := metainfo.ParseMagnetUri(u)
+	if err != nil {
+		return "", err
+	}
+	cacheMu.Lock()
+	mi, cached := cache[m.InfoHash]
+	cacheMu.Unlock()
+
+	var t *torrent.Torrent
+	if cached {
+		t, err = client.AddTorrent(mi)
+	} else {
+		t, err = client.AddMagnet(u)
+	}
+	if err != nil {
+		return "", err
+	}
+	return r.fetch(ctx, t, outDir, name, progress)
+}
+
+// DownloadTorrent is like Download for a torrent given by its .torrent file
+// rather than a magnet link.
+func (r *MagnetResolver) DownloadTorrent(ctx context.Context, mi *metainfo.MetaInfo, outDir, name string, progress func(done, total int64)) (string, error) {
+	client, err := r.newClient()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	t, err := client.AddTorrent(mi)
+	if err != nil {
+		return "", err
+	}
+	return r.fetch(ctx, t, outDir, name, progress)
+}
+
+// printf passes a message to Printf, if there is one.
+func (r *MagnetResolver) printf(format string, a ...any) {
+	if r.Printf != nil {
+		r.Printf(format, a...)
+	}
+}
+
+// fetch downloads t, seeds it for SeedTime and moves the result into outDir
+// as name, or as the torrent names it.
+func (r *MagnetResolver) fetch(ctx context.Context, t *torrent.Torrent, outDir, name string, progress func(done, total int64)) (string, error) {
+	select {
+	case <-t.GotInfo():
+	case <-time.After(MetadataTimeout):
+		return "", fmt.Errorf("timed out fetching torrent metadata after %s", MetadataTimeout)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	t.DownloadAll()
+	total := t.Length()
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for t.BytesCompleted() < total {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			// The data downloaded so far stays under DataDir for next time.
+			return "", ctx.Err()
+		}
+		if progress != nil {
+			progress(t.BytesCompleted(), total)
+		}
+	}
+	if progress != nil {
+		progress(total, total)
+	}
+	if r.SeedTime > 0 {
+		// The data has to stay under DataDir while it is being seeded.
+		r.printf("Seeding for %s...\n", r.SeedTime)
+		select {
+		case <-time.After(r.SeedTime):
+		case <-ctx.Done():
+		}
+	}
+
+	// Assemble: the storage already wrote files under DataDir/<name>.
+	// Both names come from the torrent, so neither may lead out of its
+	// directory.
+	src, err := fileutil.SafeJoin(r.dataDir(), t.Info().BestName())
+	if err != nil {
+		return "", fmt.Errorf("refusing to read %s: %w", t.Info().BestName(), err)
+	}
+	if name == "" {
+		name = t.Info().BestName()
+	}
+	dst, err := fileutil.SafeJoin(outDir, name)
+	if err != nil {
+		return src, fmt.Errorf("refusing to write %s: %w", name, err)
+	}
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return src, err
+		}
+	}
+	if err := fileutil.MoveFile(src, dst); err != nil {
+		return src, fmt.Errorf("download complete but %w", err)
+	}
+	return dst, nil
+}
@@ -7,6 +7,10 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+
+	"gdl/pkg/resolver/magnet"
+	"gdl/pkg/useragent"
+	"gdl/pkg/webdav"
 )
 
 type Resolver interface {
@@ -19,10 +23,25 @@ var (
 	onedriveRegex = regexp.MustCompile(`1drv\.ms|onedrive\.live\.com`)
 )
 
-func Resolve(inputUrl string) (string, map[string]string, error) {
+// Options carries per-download settings that some resolvers need.
+type Options struct {
+	WebDAVUser     string
+	WebDAVPass     string
+	TorrentDataDir string
+	// HTTP and Headers are used for WebDAV PROPFIND requests, so that they
+	// go through the same proxy, TLS and header settings as the download.
+	HTTP    *http.Client
+	Headers http.Header
+}
+
+func Resolve(inputUrl string, opts Options) (string, map[string]string, error) {
 	resolvers := []Resolver{
 		&GoogleDriveResolver{},
 		&OneDriveResolver{},
+		&DropboxResolver{},
+		&WebDAVResolver{User: opts.WebDAVUser, Pass: opts.WebDAVPass, HTTP: opts.HTTP, Headers: opts.Headers},
+		&magnet.MagnetResolver{DataDir: opts.TorrentDataDir},
+		&CloudFrontResolver{},
 	}
 
 	for _, r := range resolvers {
@@ -35,7 +54,11 @@ func Resolve(inputUrl string) (string, map[string]string, error) {
 
 // --- Google Drive Resolver ---
 
-type GoogleDriveResolver struct{}
+type GoogleDriveResolver struct {
+	// Client fetches the export page, following redirects; if nil, a
+	// default client is used.
+	Client *http.Client
+}
 
 func (r *GoogleDriveResolver) CanResolve(u string) bool {
 	return gdriveRegex.MatchString(u)
@@ -55,9 +78,12 @@ func (r *GoogleDriveResolver) Resolve(u string) (string, map[string]string, erro
 		return "", nil, err
 	}
 	req.Header.Set("Range", "bytes=0-4096")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("User-Agent", useragent.Default)
 
-	client := &http.Client{} // Default client follows redirects
+	client := r.Client
+	if client == nil {
+		client = &http.Client{} // Default client follows redirects
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", nil, err
@@ -169,3 +195,44 @@ func (r *OneDriveResolver) Resolve(u string) (string, map[string]string, error)
 
 	return parsed.String(), nil, nil
 }
+
+// --- WebDAV Resolver ---
+
+type WebDAVResolver struct {
+	User    string
+	Pass    string
+	HTTP    *http.Client
+	Headers http.Header
+}
+
+func (r *WebDAVResolver) CanResolve(u string) bool {
+	return webdav.IsWebDAV(u)
+}
+
+func (r *WebDAVResolver) Resolve(u string) (string, map[string]string, error) {
+	// Flag credentials take precedence over ones embedded in the URL.
+	client := &webdav.Client{HTTP: r.HTTP, Headers: r.Headers}
+	httpUrl, err := webdav.NormalizeURL(u, client)
+	if err != nil {
+		return u, nil, err
+	}
+	if r.User != "" {
+		client.User, client.Pass = r.User, r.Pass
+	}
+
+	// PROPFIND tells us whether this is a file and what size to expect
+	// before the regular HEAD probe runs.
+	resources, err := client.Propfind(httpUrl, "0")
+	if err != nil {
+		return httpUrl, nil, err
+	}
+	if len(resources) > 0 && resources[0].IsDir {
+		return httpUrl, nil, fmt.Errorf("%s is a WebDAV collection, use 'gdl mirror' to download it", u)
+	}
+
+	headers := make(map[string]string)
+	if auth := client.AuthHeader(); auth != "" {
+		headers["Authorization"] = auth
+	}
+	return httpUrl, headers, nil
+}
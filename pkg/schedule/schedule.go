@@ -0,0 +1,87 @@
+// Package schedule holds bandwidth limits that depend on the time of day.
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gdl/pkg/bytesize"
+)
+
+// Unlimited is the rate of a time range without a limit.
+const Unlimited int64 = 0
+
+// Range limits downloads to Rate bytes per second from Start until End,
+// both measured from midnight. A range whose End is before its Start runs
+// past midnight.
+type Range struct {
+	Start, End time.Duration
+	Rate       int64
+}
+
+func (r Range) contains(d time.Duration) bool {
+	if r.Start <= r.End {
+		return d >= r.Start && d < r.End
+	}
+	return d >= r.Start || d < r.End
+}
+
+// RateSchedule is a set of time ranges with their rates.
+type RateSchedule []Range
+
+// Parse reads a schedule such as {"00:00-08:00": "unlimited", "08:00-18:00":
+// "2MB", "18:00-24:00": "5MB"}. Rates are sizes per second as for
+// bytesize.Parse, or "unlimited".
+func Parse(m map[string]string) (RateSchedule, error) {
+	var s RateSchedule
+	for span, rate := range m {
+		from, to, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid time range %q, expected HH:MM-HH:MM", span)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		r := Range{Start: start, End: end}
+		if !strings.EqualFold(strings.TrimSpace(rate), "unlimited") {
+			if r.Rate, err = bytesize.Parse(rate); err != nil {
+				return nil, fmt.Errorf("time range %s: %w", span, err)
+			}
+		}
+		s = append(s, r)
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].Start < s[j].Start })
+	return s, nil
+}
+
+// parseClock reads "HH:MM" as the time since midnight; "24:00" is the end
+// of the day.
+func parseClock(s string) (time.Duration, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hours, herr := strconv.Atoi(h)
+	minutes, merr := strconv.Atoi(m)
+	if !ok || herr != nil || merr != nil || hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// CurrentRate returns the rate, in bytes per second, of the first range
+// that contains t's time of day, or Unlimited if none does.
+func (s RateSchedule) CurrentRate(t time.Time) int64 {
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	for _, r := range s {
+		if r.contains(d) {
+			return r.Rate
+		}
+	}
+	return Unlimited
+}
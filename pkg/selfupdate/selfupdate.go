@@ -0,0 +1,262 @@
+package selfupdate
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+)
+
+// ErrUpToDate is returned by Update when no newer release exists.
+var ErrUpToDate = errors.New("already up to date")
+
+// checksumAssets are the names checked for a release's SHA-256 list.
+var checksumAssets = []string{"checksums.txt", "SHA256SUMS", "sha256sums.txt"}
+
+var client = &http.Client{Timeout: 10 * time.Minute}
+
+// apiURL is the GitHub API that releases are looked up in.
+var apiURL = "https://api.github.com"
+
+type release struct {
+	TagName string  `json:"tag_name"`
+	Assets  []asset `json:"assets"`
+}
+
+type asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// Update replaces the running executable with the binary for this GOOS and
+// GOARCH from the latest GitHub release of owner/repo, if that release is
+// newer than currentVersion. The binary must be published uncompressed, with
+// "<os>_<arch>" in its name, next to a checksums file it is verified against.
+func Update(currentVersion, owner, repo string) error {
+	rel, err := latestRelease(owner, repo)
+	if err != nil {
+		return err
+	}
+	if !newer(rel.TagName, currentVersion) {
+		return ErrUpToDate
+	}
+
+	bin, err := rel.binary()
+	if err != nil {
+		return err
+	}
+	want, err := rel.checksum(bin.Name)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	// Download next to the executable so the final rename stays on one
+	// filesystem.
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".gdl-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	got, err := download(bin, tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", bin.Name, got, want)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	fmt.Printf("Updating %s to %s\n", currentVersion, rel.TagName)
+	return replace(exe, tmp.Name())
+}
+
+func latestRelease(owner, repo string) (*release, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/releases/latest", apiURL, owner, repo)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching latest release: %s", resp.Status)
+	}
+	var rel release
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return nil, fmt.Errorf("decoding release: %w", err)
+	}
+	return &rel, nil
+}
+
+// binary returns the uncompressed binary asset for this platform: the one
+// whose name ends in "<os>_<arch>", or "<os>_<arch>.exe". Version numbers
+// such as gdl_1.2.3_linux_amd64 rule out going by the extension.
+func (r *release) binary() (asset, error) {
+	platform := runtime.GOOS + "_" + runtime.GOARCH
+	for _, a := range r.Assets {
+		name := strings.ToLower(a.Name)
+		if strings.HasSuffix(name, platform) || strings.HasSuffix(name, platform+".exe") {
+			return a, nil
+		}
+	}
+	return asset{}, fmt.Errorf("release %s has no binary for %s", r.TagName, platform)
+}
+
+// checksum returns the published SHA-256 of the asset called name.
+func (r *release) checksum(name string) (string, error) {
+	for _, a := range r.Assets {
+		if !contains(checksumAssets, a.Name) && a.Name != name+".sha256" {
+			continue
+		}
+		resp, err := client.Get(a.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("fetching %s: %s", a.Name, resp.Status)
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			// "<hash>  <name>", or just "<hash>" in a per-file .sha256.
+			if len(fields) == 1 || (len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name) {
+				return strings.ToLower(fields[0]), nil
+			}
+		}
+		return "", fmt.Errorf("%s has no entry for %s", a.Name, name)
+	}
+	return "", fmt.Errorf("release %s publishes no checksums; refusing to update", r.TagName)
+}
+
+// download writes a to w with a progress bar and returns its SHA-256.
+func download(a asset, w io.Writer) (string, error) {
+	resp, err := client.Get(a.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading %s: %s", a.Name, resp.Status)
+	}
+
+	p := mpb.New(mpb.WithWidth(64))
+	bar := p.AddBar(resp.ContentLength,
+		mpb.PrependDecorators(
+			decor.Name(a.Name),
+			decor.Percentage(decor.WCSyncSpace),
+		),
+		mpb.AppendDecorators(
+			decor.EwmaETA(decor.ET_STYLE_GO, 90),
+			decor.Name(" ] "),
+			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 60),
+		),
+	)
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(w, h), bar.ProxyReader(resp.Body))
+	if err != nil || !bar.Completed() {
+		bar.Abort(false)
+	}
+	p.Wait()
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", a.Name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replace swaps the executable at exe for the file at next. Windows can't
+// overwrite a running executable but can rename it, so the old binary is
+// moved aside first and left for the next update to delete.
+func replace(exe, next string) error {
+	if runtime.GOOS != "windows" {
+		return os.Rename(next, exe)
+	}
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(next, exe); err != nil {
+		os.Rename(old, exe)
+		return err
+	}
+	return nil
+}
+
+// newer reports whether version tag is later than current. A current
+// version that isn't a release number, such as "dev", is always older.
+func newer(tag, current string) bool {
+	t, ok := parseVersion(tag)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return true
+	}
+	for i := range t {
+		if t[i] != c[i] {
+			return t[i] > c[i]
+		}
+	}
+	return false
+}
+
+// parseVersion reads "v1.2.3" (the v and trailing parts are optional).
+func parseVersion(v string) ([3]int, bool) {
+	var out [3]int
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return out, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return out, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want [3]int
+		ok   bool
+	}{
+		{"v1.2.3", [3]int{1, 2, 3}, true},
+		{"1.2.3", [3]int{1, 2, 3}, true},
+		{"v1.2", [3]int{1, 2, 0}, true},
+		{"v2", [3]int{2, 0, 0}, true},
+		{"v1.2.3-rc.1", [3]int{1, 2, 3}, true},
+		{"v1.2.3.4", [3]int{}, false},
+		{"dev", [3]int{}, false},
+		{"", [3]int{}, false},
+		{"v1.x.3", [3]int{}, false},
+	} {
+		got, ok := parseVersion(tt.in)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("parseVersion(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewer(t *testing.T) {
+	for _, tt := range []struct {
+		tag, current string
+		want         bool
+	}{
+		{"v1.2.4", "v1.2.3", true},
+		{"v1.3.0", "v1.2.9", true},
+		{"v2.0.0", "v1.9.9", true},
+		{"v1.10.0", "v1.9.0", true}, // numerically, not as strings
+		{"v1.2.3", "v1.2.3", false},
+		{"v1.2.3", "1.2.3", false},
+		{"v1.2.2", "v1.2.3", false},
+		{"v1.2.3", "dev", true},
+		{"nightly", "v1.2.3", false},
+		{"v1.2.3-rc.1", "v1.2.3", false},
+	} {
+		if got := newer(tt.tag, tt.current); got != tt.want {
+			t.Errorf("newer(%q, %q) = %v, want %v", tt.tag, tt.current, got, tt.want)
+		}
+	}
+}
+
+// releaseServer serves a GitHub releases API whose latest release of
+// owner/repo has an asset for each of files, with its contents.
+func releaseServer(t *testing.T, tag string, files map[string]string) {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	mux.HandleFunc("/repos/owner/repo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		rel := release{TagName: tag}
+		for name, body := range files {
+			rel.Assets = append(rel.Assets, asset{Name: name, URL: srv.URL + "/download/" + name, Size: int64(len(body))})
+		}
+		json.NewEncoder(w).Encode(rel)
+	})
+	mux.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[strings.TrimPrefix(r.URL.Path, "/download/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	})
+
+	old := apiURL
+	apiURL = srv.URL
+	t.Cleanup(func() { apiURL = old })
+}
+
+func TestBinary(t *testing.T) {
+	platform := runtime.GOOS + "_" + runtime.GOARCH
+	for _, tt := range []struct {
+		name   string
+		assets []string
+		want   string // "" for none
+	}{
+		{"versioned name", []string{"gdl_1.2.3_" + platform + ".tar.gz", "gdl_1.2.3_" + platform, "checksums.txt"}, "gdl_1.2.3_" + platform},
+		{"exe", []string{"gdl_1.2.3_" + platform + ".zip", "gdl_1.2.3_" + platform + ".exe"}, "gdl_1.2.3_" + platform + ".exe"},
+		{"upper case", []string{"GDL-" + strings.ToUpper(platform)}, "GDL-" + strings.ToUpper(platform)},
+		{"archives only", []string{"gdl_1.2.3_" + platform + ".tar.gz", "gdl_1.2.3_" + platform + ".zip"}, ""},
+		{"checksum only", []string{"gdl_1.2.3_" + platform + ".sha256"}, ""},
+		{"other platform", []string{"gdl_1.2.3_plan9_mips"}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]string)
+			for _, name := range tt.assets {
+				files[name] = "data"
+			}
+			releaseServer(t, "v1.2.3", files)
+			rel, err := latestRelease("owner", "repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			bin, err := rel.binary()
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("binary() = %s, want an error", bin.Name)
+				}
+				return
+			}
+			if err != nil || bin.Name != tt.want {
+				t.Errorf("binary() = %q, %v; want %q", bin.Name, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	const sum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	const bin = "gdl_1.2.3_linux_amd64"
+	for _, tt := range []struct {
+		name  string
+		files map[string]string
+		want  string // "" for an error
+	}{
+		{"checksums.txt", map[string]string{
+			"checksums.txt": "0000  gdl_1.2.3_darwin_arm64\n" + sum + "  " + bin + "\n",
+		}, sum},
+		{"binary mode marker", map[string]string{"SHA256SUMS": sum + " *" + bin + "\n"}, sum},
+		{"upper case hash", map[string]string{"sha256sums.txt": strings.ToUpper(sum) + "  " + bin + "\n"}, sum},
+		{"per-file", map[string]string{bin + ".sha256": sum + "\n"}, sum},
+		{"longer name", map[string]string{"checksums.txt": sum + "  " + bin + ".tar.gz\n"}, ""},
+		{"no entry", map[string]string{"checksums.txt": sum + "  gdl_1.2.3_darwin_arm64\n"}, ""},
+		{"no checksums", map[string]string{"README.md": sum + "\n"}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			releaseServer(t, "v1.2.3", tt.files)
+			rel, err := latestRelease("owner", "repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := rel.checksum(bin)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("checksum() = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("checksum() = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestReleaseStatus(t *testing.T) {
+	releaseServer(t, "v1.2.3", nil)
+	if _, err := latestRelease("owner", "missing"); err == nil {
+		t.Error("latestRelease() succeeded for a repository without releases")
+	}
+}
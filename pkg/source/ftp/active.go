@@ -0,0 +1,198 @@
+package ftp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// activeConn is a minimal FTP control connection for active mode, which the
+// FTP library does not support: the server connects back to a port we
+// listen on (PORT/EPRT) instead of us connecting to one it opened.
+type activeConn struct {
+	conn net.Conn
+	text *textproto.Conn
+	tls  *tls.Config
+}
+
+func (s *FTPSource) dialActive() (*activeConn, error) {
+	conn, err := net.DialTimeout("tcp", s.Host, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &activeConn{conn: conn, text: textproto.NewConn(conn)}
+	if _, _, err := c.text.ReadResponse(220); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	if s.opts.TLS {
+		if _, err := c.cmd(234, "AUTH TLS"); err != nil {
+			c.close()
+			return nil, err
+		}
+		c.tls = s.tlsConfig()
+		c.conn = tls.Client(conn, c.tls)
+		c.text = textproto.NewConn(c.conn)
+	}
+
+	code, msg, err := c.send("USER %s", s.User)
+	if err == nil && code == 331 {
+		_, err = c.cmd(230, "PASS %s", s.Password)
+	} else if err == nil && code != 230 {
+		err = &textproto.Error{Code: code, Msg: msg}
+	}
+	if err == nil && c.tls != nil {
+		if _, err = c.cmd(200, "PBSZ 0"); err == nil {
+			_, err = c.cmd(200, "PROT P")
+		}
+	}
+	if err == nil {
+		_, err = c.cmd(200, "TYPE I")
+	}
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// send issues a command and returns the server's reply, whatever its code.
+func (c *activeConn) send(format string, args ...any) (int, string, error) {
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(0)
+}
+
+// cmd issues a command and fails unless the reply has the expected code.
+func (c *activeConn) cmd(expected int, format string, args ...any) (string, error) {
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		return "", err
+	}
+	_, msg, err := c.text.ReadResponse(expected)
+	return msg, err
+}
+
+func (c *activeConn) close() error {
+	c.send("QUIT")
+	return c.conn.Close()
+}
+
+// listen opens the port the server will connect back to and announces it
+// with PORT, or EPRT for IPv6.
+func (c *activeConn) listen(opts Options) (*net.TCPListener, error) {
+	ip := c.conn.LocalAddr().(*net.TCPAddr).IP
+	var l net.Listener
+	var err error
+	if opts.PortMin == 0 {
+		l, err = net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	} else {
+		for port := opts.PortMin; port <= opts.PortMax; port++ {
+			if l, err = net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port))); err == nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no free port for the FTP data connection: %w", err)
+	}
+
+	port := l.Addr().(*net.TCPAddr).Port
+	if ip4 := ip.To4(); ip4 != nil {
+		_, err = c.cmd(200, "PORT %d,%d,%d,%d,%d,%d", ip4[0], ip4[1], ip4[2], ip4[3], port>>8, port&0xff)
+	} else {
+		_, err = c.cmd(200, "EPRT |2|%s|%d|", ip, port)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l.(*net.TCPListener), nil
+}
+
+// retr starts retrieving path from offset and waits for the server to
+// connect back.
+func (c *activeConn) retr(path string, offset int64, opts Options) (net.Conn, error) {
+	l, err := c.listen(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	if offset > 0 {
+		if _, err := c.cmd(350, "REST %d", offset); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := c.cmd(1, "RETR %s", path); err != nil {
+		return nil, err
+	}
+
+	l.SetDeadline(time.Now().Add(dialTimeout))
+	conn, err := l.Accept()
+	if err != nil {
+		return nil, fmt.Errorf("server did not open the data connection (is active mode blocked?): %w", err)
+	}
+	if c.tls != nil {
+		conn = tls.Client(conn, c.tls)
+	}
+	return conn, nil
+}
+
+func (s *FTPSource) statActive() (int64, bool, error) {
+	c, err := s.dialActive()
+	if err != nil {
+		return 0, false, err
+	}
+	defer c.close()
+
+	msg, err := c.cmd(213, "SIZE %s", s.Path)
+	if err != nil {
+		return 0, false, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid SIZE reply %q", msg)
+	}
+
+	// Unlike passive mode, REST can be tried without a data connection.
+	_, err = c.cmd(350, "REST 1")
+	return size, err == nil, nil
+}
+
+func (s *FTPSource) openActive(offset, end int64) (io.ReadCloser, error) {
+	c, err := s.dialActive()
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.retr(s.Path, offset, s.opts)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	var r io.Reader = data
+	if end >= 0 {
+		r = io.LimitReader(data, end-offset+1)
+	}
+	return &activeReader{Reader: r, data: data, conn: c}, nil
+}
+
+type activeReader struct {
+	io.Reader
+	data net.Conn
+	conn *activeConn
+}
+
+func (r *activeReader) Close() error {
+	r.data.Close()
+	// 226 when the whole file was sent, 426 or similar when cut short.
+	r.conn.text.ReadResponse(0)
+	return r.conn.close()
+}
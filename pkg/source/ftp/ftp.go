@@ -0,0 +1,240 @@
+package ftp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	goftp "github.com/jlaffaye/ftp"
+)
+
+const dialTimeout = 30 * time.Second
+
+// Mode selects who opens the data connection.
+type Mode string
+
+const (
+	// Passive has the client connect to a port the server picks (PASV/EPSV).
+	Passive Mode = "passive"
+	// Active has the server connect back to a port the client listens on
+	// (PORT/EPRT).
+	Active Mode = "active"
+)
+
+// ParseMode parses "active" or "passive". The empty string means Passive.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(s)) {
+	case "", Passive:
+		return Passive, nil
+	case Active:
+		return Active, nil
+	}
+	return "", fmt.Errorf("invalid FTP mode %q, use active or passive", s)
+}
+
+// Options holds connection settings that cannot be expressed in the URL.
+type Options struct {
+	Mode Mode
+	// PortMin and PortMax bound the data connection port: the port listened
+	// on in active mode, and the ports the server may offer in passive mode.
+	// Zero means any port.
+	PortMin, PortMax int
+	// TLS upgrades the control and data connections with AUTH TLS (explicit
+	// FTPS). The certificate is verified like an HTTPS server's.
+	TLS bool
+}
+
+// ParsePortRange parses a range such as "40000-41000".
+func ParsePortRange(s string) (min, max int, err error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		hi = lo
+	}
+	min, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	max, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || min < 1 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("invalid port range %q, expected e.g. 40000-41000", s)
+	}
+	return min, max, nil
+}
+
+// inRange reports whether port is allowed by opts.
+func (o Options) inRange(port int) bool {
+	return o.PortMin == 0 || (port >= o.PortMin && port <= o.PortMax)
+}
+
+// FTPSource describes a file served over FTP.
+type FTPSource struct {
+	Host     string // host:port
+	Path     string
+	User     string
+	Password string
+	opts     Options
+}
+
+// IsFTP reports whether rawURL uses the ftp:// scheme.
+func IsFTP(rawURL string) bool {
+	return strings.HasPrefix(strings.ToLower(rawURL), "ftp://")
+}
+
+// New parses an ftp://[user[:pass]@]host[:port]/path URL.
+// Without credentials the anonymous account is used.
+func New(rawURL string, opts Options) (*FTPSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ftp" {
+		return nil, fmt.Errorf("not an ftp url: %s", rawURL)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "21")
+	}
+
+	s := &FTPSource{
+		Host:     host,
+		Path:     u.Path,
+		User:     "anonymous",
+		Password: "anonymous",
+		opts:     opts,
+	}
+	if u.User != nil {
+		s.User = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			s.Password = p
+		}
+	}
+	return s, nil
+}
+
+// Name returns the base name of the remote file.
+func (s *FTPSource) Name() string {
+	return path.Base(s.Path)
+}
+
+// tlsConfig returns the TLS settings for the control and data connections.
+// Data connections resume the control connection's session, which many
+// servers require.
+func (s *FTPSource) tlsConfig() *tls.Config {
+	host, _, _ := net.SplitHostPort(s.Host)
+	return &tls.Config{ServerName: host, ClientSessionCache: tls.NewLRUClientSessionCache(4)}
+}
+
+func (s *FTPSource) connect() (*goftp.ServerConn, error) {
+	opts := []goftp.DialOption{goftp.DialWithTimeout(dialTimeout)}
+	var tlsConfig *tls.Config
+	if s.opts.TLS {
+		tlsConfig = s.tlsConfig()
+		opts = append(opts, goftp.DialWithExplicitTLS(tlsConfig))
+	}
+	if s.opts.PortMin != 0 {
+		// The server picks the passive port; all we can do is refuse one
+		// the firewall would block instead of hanging until it times out.
+		control := true
+		opts = append(opts, goftp.DialWithDialFunc(func(network, addr string) (net.Conn, error) {
+			if control {
+				control = false
+				return net.DialTimeout(network, addr, dialTimeout)
+			}
+			_, portStr, _ := net.SplitHostPort(addr)
+			if port, _ := strconv.Atoi(portStr); !s.opts.inRange(port) {
+				return nil, fmt.Errorf("server offered passive port %d, outside the allowed range %d-%d", port, s.opts.PortMin, s.opts.PortMax)
+			}
+			conn, err := net.DialTimeout(network, addr, dialTimeout)
+			if err != nil || tlsConfig == nil {
+				return conn, err
+			}
+			// With a dial function the library leaves TLS to us.
+			return tls.Client(conn, tlsConfig), nil
+		}))
+	}
+
+	c, err := goftp.Dial(s.Host, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Login(s.User, s.Password); err != nil {
+		c.Quit()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Stat returns the size of the remote file (via SIZE) and whether the
+// server accepts REST, which is required for ranged downloads.
+func (s *FTPSource) Stat() (int64, bool, error) {
+	if s.opts.Mode == Active {
+		return s.statActive()
+	}
+	c, err := s.connect()
+	if err != nil {
+		return 0, false, err
+	}
+	defer c.Quit()
+
+	size, err := c.FileSize(s.Path)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// There is no portable way to query REST support, so try a
+	// retrieval from offset 1 and abort it straight away.
+	restSupported := false
+	if size > 1 {
+		if resp, err := c.RetrFrom(s.Path, 1); err == nil {
+			restSupported = true
+			resp.Close()
+		}
+	}
+	return size, restSupported, nil
+}
+
+// Open starts a retrieval at offset on a dedicated connection. If end is
+// non-negative the reader stops after byte end (inclusive).
+func (s *FTPSource) Open(offset, end int64) (io.ReadCloser, error) {
+	if s.opts.Mode == Active {
+		return s.openActive(offset, end)
+	}
+	c, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *goftp.Response
+	if offset > 0 {
+		resp, err = c.RetrFrom(s.Path, uint64(offset))
+	} else {
+		resp, err = c.Retr(s.Path)
+	}
+	if err != nil {
+		c.Quit()
+		return nil, err
+	}
+
+	var r io.Reader = resp
+	if end >= 0 {
+		r = io.LimitReader(resp, end-offset+1)
+	}
+	return &retrReader{Reader: r, resp: resp, conn: c}, nil
+}
+
+type retrReader struct {
+	io.Reader
+	resp *goftp.Response
+	conn *goftp.ServerConn
+}
+
+func (r *retrReader) Close() error {
+	// Closing a transfer early makes the server report an aborted
+	// transfer, which is expected for ranged reads.
+	r.resp.Close()
+	return r.conn.Quit()
+}
@@ -0,0 +1,215 @@
+package sftp
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkgsftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	testUser     = "gdl"
+	testPassword = "secret"
+)
+
+// sftpServer is an SSH server on loopback that serves the local file system
+// over SFTP to testUser with testPassword.
+type sftpServer struct {
+	addr    string
+	hostKey ssh.PublicKey
+}
+
+func newSFTPServer(t *testing.T) *sftpServer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == testUser && string(pass) == testPassword {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+	return &sftpServer{addr: ln.Addr().String(), hostKey: signer.PublicKey()}
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					if srv, err := pkgsftp.NewServer(ch); err == nil {
+						srv.Serve()
+					}
+					ch.Close()
+				}
+			}
+		}()
+	}
+}
+
+// knownHosts writes a known_hosts file with key for addr.
+func knownHosts(t *testing.T, addr string, key ssh.PublicKey) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)
+	if err := os.WriteFile(path, []byte(line+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testFile writes content to a temporary file and returns its sftp:// URL
+// on srv.
+func testFile(t *testing.T, srv *sftpServer, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return "sftp://" + testUser + ":" + testPassword + "@" + srv.addr + filepath.ToSlash(path)
+}
+
+// noAgent keeps the tests from using the developer's SSH agent and keys.
+func noAgent(t *testing.T) Options {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	return Options{IdentityFile: filepath.Join(t.TempDir(), "no_such_key")}
+}
+
+func TestStatAndOpen(t *testing.T) {
+	srv := newSFTPServer(t)
+	opts := noAgent(t)
+	opts.KnownHostsFile = knownHosts(t, srv.addr, srv.hostKey)
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+
+	s, err := New(testFile(t, srv, content), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name() != "data.bin" {
+		t.Errorf("Name() = %q, want data.bin", s.Name())
+	}
+	size, err := s.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(content)) {
+		t.Errorf("Stat() = %d, want %d", size, len(content))
+	}
+
+	for _, tc := range []struct{ offset, end int64 }{
+		{0, -1},
+		{12345, -1},
+		{100, 199},
+	} {
+		r, err := s.Open(tc.offset, tc.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := content[tc.offset:]
+		if tc.end >= 0 {
+			want = content[tc.offset : tc.end+1]
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Open(%d, %d) read %d bytes, want %d matching bytes", tc.offset, tc.end, len(got), len(want))
+		}
+	}
+}
+
+func TestMissingKnownHostsFailsClosed(t *testing.T) {
+	srv := newSFTPServer(t)
+	opts := noAgent(t)
+	opts.KnownHostsFile = filepath.Join(t.TempDir(), "known_hosts")
+
+	s, err := New(testFile(t, srv, []byte("data")), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat(); !errors.Is(err, ErrNoKnownHosts) {
+		t.Fatalf("Stat() error = %v, want ErrNoKnownHosts", err)
+	}
+
+	opts.Insecure = true
+	if s, err = New(testFile(t, srv, []byte("data")), opts); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := s.Stat(); err != nil || size != 4 {
+		t.Fatalf("Stat() with Insecure = %d, %v, want 4, nil", size, err)
+	}
+}
+
+func TestUnknownHostKeyRejected(t *testing.T) {
+	srv := newSFTPServer(t)
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ssh.NewPublicKey(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := noAgent(t)
+	opts.KnownHostsFile = knownHosts(t, srv.addr, otherKey)
+
+	s, err := New(testFile(t, srv, []byte("data")), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyErr *knownhosts.KeyError
+	if _, err := s.Stat(); !errors.As(err, &keyErr) {
+		t.Fatalf("Stat() error = %v, want a *knownhosts.KeyError", err)
+	}
+}
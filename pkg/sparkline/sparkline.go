@@ -0,0 +1,34 @@
+package sparkline
+
+import "strings"
+
+var blocks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline renders the last width values as block characters scaled to the
+// largest of them. Fewer values than width are padded on the left.
+func Sparkline(values []float64, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+
+	var max float64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", width-len(values)))
+	for _, v := range values {
+		i := 0
+		if max > 0 && v > 0 {
+			i = int(v / max * float64(len(blocks)-1))
+		}
+		b.WriteRune(blocks[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package splitwriter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// VolumeName returns the name of volume i (0-based) of base: base.001,
+// base.002 and so on.
+func VolumeName(base string, i int) string {
+	return fmt.Sprintf("%s.%03d", base, i+1)
+}
+
+// SplitWriter spreads a file of known size over volumes of at most
+// volumeSize bytes each, mapping offsets in the whole file to the volume
+// holding them.
+type SplitWriter struct {
+	volumeSize int64
+	names      []string
+	files      []*os.File
+}
+
+// Open creates or reopens the volumes needed for a file of total bytes and
+// sizes each of them, keeping existing data.
+func Open(base string, volumeSize, total int64) (*SplitWriter, error) {
+	if volumeSize <= 0 {
+		return nil, fmt.Errorf("invalid volume size %d", volumeSize)
+	}
+	w := &SplitWriter{volumeSize: volumeSize}
+	for i := 0; int64(i)*volumeSize < total; i++ {
+		name := VolumeName(base, i)
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		w.names = append(w.names, name)
+		w.files = append(w.files, f)
+
+		size := min(volumeSize, total-int64(i)*volumeSize)
+		if stat, err := f.Stat(); err != nil || stat.Size() != size {
+			if err := f.Truncate(size); err != nil {
+				w.Close()
+				return nil, err
+			}
+		}
+	}
+	return w, nil
+}
+
+// Volumes returns the volume file names in order.
+func (w *SplitWriter) Volumes() []string {
+	return append([]string(nil), w.names...)
+}
+
+func (w *SplitWriter) WriteAt(p []byte, off int64) (int, error) {
+	return w.span(p, off, (*os.File).WriteAt)
+}
+
+func (w *SplitWriter) ReadAt(p []byte, off int64) (int, error) {
+	return w.span(p, off, (*os.File).ReadAt)
+}
+
+// span applies op to each volume that part of p at off falls into.
+func (w *SplitWriter) span(p []byte, off int64, op func(*os.File, []byte, int64) (int, error)) (int, error) {
+	done := 0
+	for len(p) > 0 {
+		i := int(off / w.volumeSize)
+		if off < 0 || i >= len(w.files) {
+			return done, io.EOF
+		}
+		volOff := off % w.volumeSize
+		part := p[:min(int64(len(p)), w.volumeSize-volOff)]
+		n, err := op(w.files[i], part, volOff)
+		done += n
+		if err != nil {
+			return done, err
+		}
+		p = p[n:]
+		off += int64(n)
+	}
+	return done, nil
+}
+
+func (w *SplitWriter) Close() error {
+	var firstErr error
+	for _, f := range w.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Merge joins the volumes starting at first (which must end in .001) back
+// into a single file and returns its name. The volumes are left in place.
+func Merge(first string) (string, error) {
+	base, ok := strings.CutSuffix(first, ".001")
+	if !ok {
+		return "", fmt.Errorf("%s is not a first volume (expected a .001 suffix)", first)
+	}
+
+	out, err := os.OpenFile(base, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	for i := 0; ; i++ {
+		f, err := os.Open(VolumeName(base, i))
+		if os.IsNotExist(err) && i > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(out, f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("merging %s: %w", VolumeName(base, i), err)
+		}
+	}
+	return base, out.Close()
+}
@@ -0,0 +1,213 @@
+package splitwriter_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gdl/pkg/splitwriter"
+)
+
+func TestVolumeName(t *testing.T) {
+	for _, tt := range []struct {
+		i    int
+		want string
+	}{
+		{0, "data.bin.001"},
+		{1, "data.bin.002"},
+		{98, "data.bin.099"},
+		{999, "data.bin.1000"},
+	} {
+		if got := splitwriter.VolumeName("data.bin", tt.i); got != tt.want {
+			t.Errorf("VolumeName(%d) = %q, want %q", tt.i, got, tt.want)
+		}
+	}
+}
+
+// volumeSizes returns the sizes of base's volumes, in order.
+func volumeSizes(t *testing.T, base string) []int64 {
+	t.Helper()
+	var sizes []int64
+	for i := 0; ; i++ {
+		st, err := os.Stat(splitwriter.VolumeName(base, i))
+		if os.IsNotExist(err) {
+			return sizes
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, st.Size())
+	}
+}
+
+func TestOpenSizesVolumes(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		volumeSize, total int64
+		want              []int64
+	}{
+		{"remainder", 100, 250, []int64{100, 100, 50}},
+		{"exact", 100, 300, []int64{100, 100, 100}},
+		{"one short volume", 100, 1, []int64{1}},
+		{"empty file", 100, 0, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			base := filepath.Join(t.TempDir(), "data.bin")
+			w, err := splitwriter.Open(base, tt.volumeSize, tt.total)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if got := volumeSizes(t, base); !slices.Equal(got, tt.want) {
+				t.Errorf("volume sizes = %v, want %v", got, tt.want)
+			}
+			if got := w.Volumes(); len(got) != len(tt.want) {
+				t.Errorf("Volumes() = %v, want %d names", got, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestOpenInvalidVolumeSize(t *testing.T) {
+	if _, err := splitwriter.Open(filepath.Join(t.TempDir(), "data.bin"), 0, 100); err == nil {
+		t.Error("Open() accepted a volume size of 0")
+	}
+}
+
+// TestOffsetMapping writes ranges of a 250-byte file in 100-byte volumes
+// and checks where their bytes land.
+func TestOffsetMapping(t *testing.T) {
+	content := make([]byte, 250)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	for _, tt := range []struct {
+		name     string
+		off, len int64
+	}{
+		{"start of first volume", 0, 10},
+		{"inside a volume", 120, 30},
+		{"end of a volume", 90, 10},
+		{"start of a later volume", 200, 5},
+		{"across one boundary", 95, 10},
+		{"across two boundaries", 50, 180},
+		{"whole file", 0, 250},
+		{"end of last volume", 240, 10},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			base := filepath.Join(t.TempDir(), "data.bin")
+			w, err := splitwriter.Open(base, 100, int64(len(content)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			n, err := w.WriteAt(content[tt.off:tt.off+tt.len], tt.off)
+			if err != nil || int64(n) != tt.len {
+				t.Fatalf("WriteAt() = %d, %v; want %d", n, err, tt.len)
+			}
+
+			// The volumes, joined, hold the range at its offset and zeros
+			// elsewhere.
+			want := make([]byte, len(content))
+			copy(want[tt.off:], content[tt.off:tt.off+tt.len])
+			var joined []byte
+			for _, name := range w.Volumes() {
+				data, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				joined = append(joined, data...)
+			}
+			if !bytes.Equal(joined, want) {
+				t.Errorf("volumes hold %v, want %v", joined, want)
+			}
+
+			got := make([]byte, tt.len)
+			if n, err := w.ReadAt(got, tt.off); err != nil || int64(n) != tt.len {
+				t.Fatalf("ReadAt() = %d, %v; want %d", n, err, tt.len)
+			}
+			if !bytes.Equal(got, content[tt.off:tt.off+tt.len]) {
+				t.Errorf("ReadAt() read %v, want %v", got, content[tt.off:tt.off+tt.len])
+			}
+		})
+	}
+}
+
+func TestWritePastEnd(t *testing.T) {
+	w, err := splitwriter.Open(filepath.Join(t.TempDir(), "data.bin"), 100, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// There is no fourth volume for offset 300 to go to.
+	if n, err := w.WriteAt([]byte{1}, 300); !errors.Is(err, io.EOF) || n != 0 {
+		t.Errorf("WriteAt() after the end = %d, %v; want 0, io.EOF", n, err)
+	}
+	if _, err := w.WriteAt([]byte{1}, -1); !errors.Is(err, io.EOF) {
+		t.Errorf("WriteAt() at -1 = %v, want io.EOF", err)
+	}
+}
+
+func TestReopenKeepsData(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "data.bin")
+	w, err := splitwriter.Open(base, 100, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteAt([]byte("resumed"), 150)
+	w.Close()
+
+	w, err = splitwriter.Open(base, 100, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	got := make([]byte, 7)
+	if _, err := w.ReadAt(got, 150); err != nil || string(got) != "resumed" {
+		t.Errorf("ReadAt() after reopening = %q, %v; want %q", got, err, "resumed")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 25)
+	base := filepath.Join(t.TempDir(), "data.bin")
+	w, err := splitwriter.Open(base, 100, int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteAt(content, 0)
+	w.Close()
+
+	merged, err := splitwriter.Merge(splitwriter.VolumeName(base, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged != base {
+		t.Errorf("Merge() = %q, want %q", merged, base)
+	}
+	if data, err := os.ReadFile(base); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("merged file = %q, %v; want the content", data, err)
+	}
+	if got := volumeSizes(t, base); len(got) != 3 {
+		t.Errorf("%d volumes left after merging, want all 3", len(got))
+	}
+
+	// The merged file is not overwritten.
+	if _, err := splitwriter.Merge(splitwriter.VolumeName(base, 0)); err == nil {
+		t.Error("Merge() overwrote an existing file")
+	}
+}
+
+func TestMergeRejects(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := splitwriter.Merge(filepath.Join(dir, "data.bin.002")); err == nil {
+		t.Error("Merge() accepted a volume other than the first")
+	}
+	if _, err := splitwriter.Merge(filepath.Join(dir, "missing.001")); err == nil {
+		t.Error("Merge() succeeded without volumes")
+	}
+}
@@ -0,0 +1,194 @@
+package statecodec
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoMagic starts a binary state file, followed by a DownloadState
+// message as defined in state.proto.
+var protoMagic = []byte("GDLP")
+
+// Field numbers of state.proto.
+const (
+	fieldURL         protowire.Number = 1
+	fieldOriginalURL protowire.Number = 2
+	fieldExpires     protowire.Number = 3
+	fieldFile        protowire.Number = 4
+	fieldSize        protowire.Number = 5
+	fieldETag        protowire.Number = 6
+	fieldConcurrency protowire.Number = 7
+	fieldSplitSize   protowire.Number = 8
+	fieldVolumes     protowire.Number = 9
+	fieldChunks      protowire.Number = 10
+
+	fieldChunkID         protowire.Number = 1
+	fieldChunkStart      protowire.Number = 2
+	fieldChunkEnd        protowire.Number = 3
+	fieldChunkDownloaded protowire.Number = 4
+	fieldChunkCRC        protowire.Number = 5
+	fieldChunkFailed     protowire.Number = 6
+	fieldChunkError      protowire.Number = 7
+)
+
+var errTruncated = errors.New("state file: truncated or malformed protobuf")
+
+// protoCodec is the compact binary format. As in proto3, zero values are
+// left out.
+type protoCodec struct{}
+
+func (protoCodec) Encode(s *State) ([]byte, error) {
+	b := append([]byte(nil), protoMagic...)
+	b = appendString(b, fieldURL, s.URL)
+	b = appendString(b, fieldOriginalURL, s.OriginalURL)
+	if !s.Expires.IsZero() {
+		b = appendInt(b, fieldExpires, s.Expires.UnixNano())
+	}
+	b = appendString(b, fieldFile, s.File)
+	b = appendInt(b, fieldSize, s.Size)
+	b = appendString(b, fieldETag, s.ETag)
+	b = appendInt(b, fieldConcurrency, int64(s.Concurrency))
+	b = appendInt(b, fieldSplitSize, s.SplitSize)
+	for _, v := range s.Volumes {
+		b = protowire.AppendTag(b, fieldVolumes, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	}
+	var chunk []byte
+	for _, c := range s.Chunks {
+		chunk = appendInt(chunk[:0], fieldChunkID, int64(c.ID))
+		chunk = appendInt(chunk, fieldChunkStart, c.Start)
+		chunk = appendInt(chunk, fieldChunkEnd, c.End)
+		chunk = appendInt(chunk, fieldChunkDownloaded, c.Downloaded)
+		if c.CRC != 0 {
+			chunk = protowire.AppendTag(chunk, fieldChunkCRC, protowire.Fixed32Type)
+			chunk = protowire.AppendFixed32(chunk, c.CRC)
+		}
+		if c.Failed {
+			chunk = protowire.AppendTag(chunk, fieldChunkFailed, protowire.VarintType)
+			chunk = protowire.AppendVarint(chunk, 1)
+		}
+		chunk = appendString(chunk, fieldChunkError, c.Error)
+		b = protowire.AppendTag(b, fieldChunks, protowire.BytesType)
+		b = protowire.AppendBytes(b, chunk)
+	}
+	return b, nil
+}
+
+func (protoCodec) Decode(data []byte) (*State, error) {
+	b := data[len(protoMagic):]
+	s := &State{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, errTruncated
+		}
+		b = b[n:]
+		var err error
+		switch {
+		case num == fieldURL && typ == protowire.BytesType:
+			s.URL, n = protowire.ConsumeString(b)
+		case num == fieldOriginalURL && typ == protowire.BytesType:
+			s.OriginalURL, n = protowire.ConsumeString(b)
+		case num == fieldExpires && typ == protowire.VarintType:
+			var v int64
+			v, n = consumeInt(b)
+			s.Expires = time.Unix(0, v)
+		case num == fieldFile && typ == protowire.BytesType:
+			s.File, n = protowire.ConsumeString(b)
+		case num == fieldSize && typ == protowire.VarintType:
+			s.Size, n = consumeInt(b)
+		case num == fieldETag && typ == protowire.BytesType:
+			s.ETag, n = protowire.ConsumeString(b)
+		case num == fieldConcurrency && typ == protowire.VarintType:
+			var v int64
+			v, n = consumeInt(b)
+			s.Concurrency = int(v)
+		case num == fieldSplitSize && typ == protowire.VarintType:
+			s.SplitSize, n = consumeInt(b)
+		case num == fieldVolumes && typ == protowire.BytesType:
+			var v string
+			v, n = protowire.ConsumeString(b)
+			s.Volumes = append(s.Volumes, v)
+		case num == fieldChunks && typ == protowire.BytesType:
+			var msg []byte
+			msg, n = protowire.ConsumeBytes(b)
+			if n >= 0 {
+				var c Chunk
+				c, err = decodeChunk(msg)
+				s.Chunks = append(s.Chunks, c)
+			}
+		default:
+			// A field from a newer version of gdl.
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errTruncated
+		}
+		b = b[n:]
+	}
+	return s, nil
+}
+
+func decodeChunk(b []byte) (Chunk, error) {
+	var c Chunk
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return c, errTruncated
+		}
+		b = b[n:]
+		var v int64
+		switch {
+		case num == fieldChunkID && typ == protowire.VarintType:
+			v, n = consumeInt(b)
+			c.ID = int(v)
+		case num == fieldChunkStart && typ == protowire.VarintType:
+			c.Start, n = consumeInt(b)
+		case num == fieldChunkEnd && typ == protowire.VarintType:
+			c.End, n = consumeInt(b)
+		case num == fieldChunkDownloaded && typ == protowire.VarintType:
+			c.Downloaded, n = consumeInt(b)
+		case num == fieldChunkCRC && typ == protowire.Fixed32Type:
+			c.CRC, n = protowire.ConsumeFixed32(b)
+		case num == fieldChunkFailed && typ == protowire.VarintType:
+			v, n = consumeInt(b)
+			c.Failed = v != 0
+		case num == fieldChunkError && typ == protowire.BytesType:
+			c.Error, n = protowire.ConsumeString(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return c, fmt.Errorf("chunk %d: %w", c.ID, errTruncated)
+		}
+		b = b[n:]
+	}
+	return c, nil
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func consumeInt(b []byte) (int64, int) {
+	v, n := protowire.ConsumeVarint(b)
+	return int64(v), n
+}
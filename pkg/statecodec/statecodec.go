@@ -0,0 +1,101 @@
+package statecodec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// State file formats.
+const (
+	JSON  = "json"
+	Proto = "proto"
+)
+
+// State is the content of a state file: the progress of an unfinished
+// download.
+type State struct {
+	URL         string    `json:"url"`
+	OriginalURL string    `json:"original_url,omitempty"` // as given, before resolving
+	Expires     time.Time `json:"expires,omitzero"`       // when URL, if signed, expires
+	File        string    `json:"file"`
+	Size        int64     `json:"size"`
+	ETag        string    `json:"etag,omitempty"`
+	Concurrency int       `json:"concurrency"`
+	SplitSize   int64     `json:"split_size,omitempty"`
+	Volumes     []string  `json:"volumes,omitempty"`
+	Chunks      []Chunk   `json:"chunks"`
+}
+
+// Chunk is the progress of one byte range of the download.
+type Chunk struct {
+	ID         int    `json:"id"`
+	Start      int64  `json:"start"`
+	End        int64  `json:"end"`
+	Downloaded int64  `json:"downloaded"`
+	CRC        uint32 `json:"crc,omitempty"` // CRC-32C of the downloaded bytes
+	Failed     bool   `json:"failed,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Encoder writes a state in one format.
+type Encoder interface {
+	Encode(s *State) ([]byte, error)
+}
+
+// Decoder reads a state in one format.
+type Decoder interface {
+	Decode(data []byte) (*State, error)
+}
+
+// Codec is the Encoder and Decoder of a format.
+type Codec interface {
+	Encoder
+	Decoder
+}
+
+// ParseFormat checks a --state-format value. "" means JSON.
+func ParseFormat(s string) (string, error) {
+	switch f := strings.ToLower(strings.TrimSpace(s)); f {
+	case "":
+		return JSON, nil
+	case JSON, Proto:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid state format %q (want json or proto)", s)
+}
+
+// New returns the codec of format, as returned by ParseFormat. Any other
+// value gets JSON.
+func New(format string) Codec {
+	if format == Proto {
+		return protoCodec{}
+	}
+	return jsonCodec{}
+}
+
+// Decode reads a state in whichever format data is in, telling them apart
+// by the binary format's magic bytes.
+func Decode(data []byte) (*State, error) {
+	if bytes.HasPrefix(data, protoMagic) {
+		return protoCodec{}.Decode(data)
+	}
+	return jsonCodec{}.Decode(data)
+}
+
+// jsonCodec is the default, human-readable format.
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(s *State) ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+func (jsonCodec) Decode(data []byte) (*State, error) {
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,45 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileInfo is the subset of download metadata available to templates.
+type FileInfo struct {
+	Url  string // URL as given by the user
+	Name string // Name from Content-Disposition or the URL path
+	Size int64
+}
+
+// ExpandFilename replaces the tokens below in tmpl. Unknown tokens are kept
+// as-is. "/" in the template creates subdirectories.
+//
+//	{url_filename}  name from Content-Disposition or the URL
+//	{date}          download date, YYYY-MM-DD
+//	{domain}        host of the source URL
+//	{ext}           file extension without the dot
+//	{size}          file size in bytes
+//	{hash8}         first 8 hex chars of the URL's SHA-256
+func ExpandFilename(tmpl string, info *FileInfo) string {
+	domain := "unknown"
+	if u, err := url.Parse(info.Url); err == nil && u.Hostname() != "" {
+		domain = u.Hostname()
+	}
+	sum := sha256.Sum256([]byte(info.Url))
+
+	r := strings.NewReplacer(
+		"{url_filename}", info.Name,
+		"{date}", time.Now().Format("2006-01-02"),
+		"{domain}", domain,
+		"{ext}", strings.TrimPrefix(filepath.Ext(info.Name), "."),
+		"{size}", strconv.FormatInt(info.Size, 10),
+		"{hash8}", hex.EncodeToString(sum[:])[:8],
+	)
+	return filepath.FromSlash(r.Replace(tmpl))
+}
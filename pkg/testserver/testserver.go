@@ -0,0 +1,293 @@
+package testserver
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestServer serves one file at every path.
+type TestServer struct {
+	*httptest.Server
+
+	content []byte
+
+	mu           sync.Mutex
+	rangeSupport bool
+	throttleBps  int64
+	delay        time.Duration
+	errorRate    float64
+	filename     string
+	reportedSize int64
+	rangeShift   int64
+	dropAfter    int64
+	failFirst    int
+	unknownSize  bool
+	requests     []http.Request
+}
+
+// RandomContent returns size bytes of pseudo-random content, the same for
+// the same seed, for files whose every byte is worth checking.
+func RandomContent(size int, seed uint64) []byte {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(rng.Uint32())
+	}
+	return b
+}
+
+// NewTestServer starts a server for content that supports Range requests.
+// It is closed when the test ends.
+func NewTestServer(t testing.TB, content []byte) *TestServer {
+	t.Helper()
+	s := &TestServer{content: content, rangeSupport: true}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// SetRangeSupport turns Range handling on or off. When off, Range headers
+// are ignored and every GET returns the whole file with 200.
+func (s *TestServer) SetRangeSupport(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rangeSupport = on
+}
+
+// SetThrottleBps limits each response to about bps bytes per second.
+// Zero means no limit.
+func (s *TestServer) SetThrottleBps(bps int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttleBps = bps
+}
+
+// SetDelay makes the server wait d before answering each request.
+func (s *TestServer) SetDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// SetErrorRate makes the given fraction (0 to 1) of requests fail with
+// 500 Internal Server Error.
+func (s *TestServer) SetErrorRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorRate = rate
+}
+
+// SetFilename sends name in a Content-Disposition header. Empty sends none.
+func (s *TestServer) SetFilename(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filename = name
+}
+
+// SetReportedSize makes 206 responses give size as the total in
+// Content-Range, as a server does once the file was replaced mid-download.
+// Zero reports the real size.
+func (s *TestServer) SetReportedSize(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reportedSize = size
+}
+
+// SetRangeShift moves the start of every range response n bytes from the
+// requested one, like a server with an off-by-one in its range handling.
+func (s *TestServer) SetRangeShift(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rangeShift = n
+}
+
+// SetDropAfter cuts every response off after n bytes of body by closing
+// the connection, like a flaky network, so that downloads have to retry
+// or resume. Zero sends whole bodies.
+func (s *TestServer) SetDropAfter(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropAfter = n
+}
+
+// SetFailFirst makes the next n GET requests fail with 503 Service
+// Unavailable, for testing retries without the randomness of SetErrorRate.
+func (s *TestServer) SetFailFirst(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failFirst = n
+}
+
+// SetUnknownSize makes the server send no Content-Length and stream GET
+// bodies with chunked transfer encoding, ignoring Range, like a server that
+// generates the file as it sends it.
+func (s *TestServer) SetUnknownSize(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unknownSize = on
+}
+
+// Content returns the file the server serves.
+func (s *TestServer) Content() []byte {
+	return s.content
+}
+
+// RequestLog returns the requests received so far, oldest first.
+func (s *TestServer) RequestLog() []http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]http.Request(nil), s.requests...)
+}
+
+// FileURL returns the URL of name on the server.
+func (s *TestServer) FileURL(name string) string {
+	return s.URL + "/" + strings.TrimPrefix(name, "/")
+}
+
+func (s *TestServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	logged := *r.Clone(r.Context())
+	logged.Body = nil
+	s.requests = append(s.requests, logged)
+	rangeSupport, bps, delay, errorRate, filename := s.rangeSupport, s.throttleBps, s.delay, s.errorRate, s.filename
+	reportedSize, rangeShift, dropAfter, unknownSize := s.reportedSize, s.rangeShift, s.dropAfter, s.unknownSize
+	fail := r.Method == http.MethodGet && s.failFirst > 0
+	if fail {
+		s.failFirst--
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fail {
+		http.Error(w, "injected failure", http.StatusServiceUnavailable)
+		return
+	}
+	if errorRate > 0 && rand.Float64() < errorRate {
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if unknownSize {
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			// Flushing before any body is written makes the response
+			// chunked instead of sized.
+			w.(http.Flusher).Flush()
+			s.write(w, r, s.content, bps)
+		}
+		return
+	}
+
+	size := int64(len(s.content))
+	start, end, status := int64(0), size-1, http.StatusOK
+	if rangeSupport {
+		w.Header().Set("Accept-Ranges", "bytes")
+		if h := r.Header.Get("Range"); h != "" {
+			var ok bool
+			start, end, ok = parseRange(h, size)
+			if !ok {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+				http.Error(w, "range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			status = http.StatusPartialContent
+			start = min(max(start+rangeShift, 0), end)
+			total := size
+			if reportedSize > 0 {
+				total = reportedSize
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, total))
+		}
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	body := s.content[start : end+1]
+	if dropAfter > 0 && int64(len(body)) > dropAfter {
+		s.write(w, r, body[:dropAfter], bps)
+		w.(http.Flusher).Flush()
+		// Aborting the handler closes the connection mid-body.
+		panic(http.ErrAbortHandler)
+	}
+	s.write(w, r, body, bps)
+}
+
+// write sends body, in 100ms slices when throttled.
+func (s *TestServer) write(w http.ResponseWriter, r *http.Request, body []byte, bps int64) {
+	if bps <= 0 {
+		w.Write(body)
+		return
+	}
+	slice := max(int(bps/10), 1)
+	for len(body) > 0 {
+		n := min(slice, len(body))
+		if _, err := w.Write(body[:n]); err != nil {
+			return
+		}
+		w.(http.Flusher).Flush()
+		body = body[n:]
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// parseRange parses a single "bytes=" range against size.
+func parseRange(h string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(h, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		// Suffix range: the last n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size - 1, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
@@ -0,0 +1,46 @@
+// Package iofault wraps writers to inject the misbehaviour of unreliable
+// filesystems, for exercising the downloader's error handling.
+package iofault
+
+import (
+	"io"
+	"math/rand/v2"
+	"sync"
+)
+
+// ShortWriteSimulator is an io.WriterAt that, with probability Rate, writes
+// only a random part of the buffer and still returns a nil error, as some
+// network filesystems do.
+type ShortWriteSimulator struct {
+	W    io.WriterAt
+	Rate float64 // chance of a short write, from 0 to 1
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	short int
+}
+
+// NewShortWriteSimulator returns a ShortWriteSimulator over w. The same seed
+// gives the same sequence of short writes.
+func NewShortWriteSimulator(w io.WriterAt, rate float64, seed uint64) *ShortWriteSimulator {
+	return &ShortWriteSimulator{W: w, Rate: rate, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+func (s *ShortWriteSimulator) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) > 1 {
+		s.mu.Lock()
+		if s.rng.Float64() < s.Rate {
+			p = p[:s.rng.IntN(len(p))]
+			s.short++
+		}
+		s.mu.Unlock()
+	}
+	return s.W.WriteAt(p, off)
+}
+
+// ShortWrites returns how many writes were cut short so far.
+func (s *ShortWriteSimulator) ShortWrites() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.short
+}
@@ -0,0 +1,223 @@
+package vcr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Credentials and session tokens are kept out of cassettes: the request
+// headers in redactedRequest are dropped, and the response headers in
+// redactedResponse keep their names but have their values replaced, so
+// that replays still see them. Set-Cookie keeps the cookie names and
+// attributes.
+var (
+	redactedRequest  = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key", "X-Auth-Token", "X-Csrf-Token"}
+	redactedResponse = []string{"X-Auth-Token", "X-Csrf-Token", "X-Xsrf-Token", "X-Amz-Security-Token"}
+)
+
+// Redacted replaces the values of redacted headers and cookies.
+const Redacted = "REDACTED"
+
+// Cassette is the content of a cassette file: the HTTP interactions of one
+// test, in the order they happened.
+type Cassette struct {
+	Interactions []Interaction `yaml:"interactions"`
+}
+
+// Interaction is one request and the response it got.
+type Interaction struct {
+	Request  Request  `yaml:"request"`
+	Response Response `yaml:"response"`
+}
+
+type Request struct {
+	Method  string      `yaml:"method"`
+	URL     string      `yaml:"url"`
+	Headers http.Header `yaml:"headers,omitempty"`
+	Body    string      `yaml:"body,omitempty"`
+}
+
+type Response struct {
+	Status  string      `yaml:"status"`
+	Code    int         `yaml:"code"`
+	Headers http.Header `yaml:"headers,omitempty"`
+	Body    string      `yaml:"body,omitempty"`
+}
+
+// Transport records HTTP interactions to a cassette file, or replays them
+// from it, like Ruby's VCR. In replay mode no request leaves the process.
+type Transport struct {
+	File   string
+	Record bool
+	// Base makes the real requests when recording; http.DefaultTransport
+	// if nil.
+	Base http.RoundTripper
+
+	mu       sync.Mutex
+	cassette *Cassette
+	loadErr  error
+	used     []bool
+}
+
+// NewTransport returns a Transport for cassetteFile. With record set, real
+// requests are made and the cassette is rewritten with them; otherwise
+// responses come from the cassette, which must exist.
+func NewTransport(cassetteFile string, record bool) http.RoundTripper {
+	return &Transport{File: cassetteFile, Record: record}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cassette == nil && t.loadErr == nil {
+		t.load()
+	}
+	if t.loadErr != nil {
+		return nil, t.loadErr
+	}
+
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	if t.Record {
+		return t.record(req, reqBody)
+	}
+	return t.replay(req)
+}
+
+// load reads the cassette, or starts an empty one when recording.
+func (t *Transport) load() {
+	t.cassette = &Cassette{}
+	if t.Record {
+		return
+	}
+	data, err := os.ReadFile(t.File)
+	if err != nil {
+		t.loadErr = fmt.Errorf("vcr: %w (record it first)", err)
+		return
+	}
+	if err := yaml.Unmarshal(data, t.cassette); err != nil {
+		t.loadErr = fmt.Errorf("vcr: reading %s: %w", t.File, err)
+		return
+	}
+	t.used = make([]bool, len(t.cassette.Interactions))
+}
+
+func (t *Transport) record(req *http.Request, reqBody []byte) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	headers := req.Header.Clone()
+	for _, h := range redactedRequest {
+		headers.Del(h)
+	}
+	t.cassette.Interactions = append(t.cassette.Interactions, Interaction{
+		Request: Request{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: headers,
+			Body:    string(reqBody),
+		},
+		Response: Response{
+			Status:  resp.Status,
+			Code:    resp.StatusCode,
+			Headers: redactResponse(resp.Header),
+			Body:    string(body),
+		},
+	})
+	return resp, t.save()
+}
+
+// redactResponse returns a copy of h without the values of session
+// cookies and tokens.
+func redactResponse(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range redactedResponse {
+		for i := range h[name] {
+			h[name][i] = Redacted
+		}
+	}
+	for i, line := range h["Set-Cookie"] {
+		name, rest, _ := strings.Cut(line, "=")
+		if _, attrs, ok := strings.Cut(rest, ";"); ok {
+			h["Set-Cookie"][i] = name + "=" + Redacted + ";" + attrs
+		} else {
+			h["Set-Cookie"][i] = name + "=" + Redacted
+		}
+	}
+	return h
+}
+
+// save writes the cassette, so that it is complete after every request.
+func (t *Transport) save() error {
+	data, err := yaml.Marshal(t.cassette)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.File), 0755); err != nil {
+		return err
+	}
+	tmp := t.File + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.File)
+}
+
+// replay answers req with the first unused interaction of the same method
+// and URL, or, once all of those are used, the last of them.
+func (t *Transport) replay(req *http.Request) (*http.Response, error) {
+	match := -1
+	for i, in := range t.cassette.Interactions {
+		if in.Request.Method != req.Method || in.Request.URL != req.URL.String() {
+			continue
+		}
+		match = i
+		if !t.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("vcr: no interaction for %s %s in %s", req.Method, req.URL, t.File)
+	}
+	t.used[match] = true
+
+	r := t.cassette.Interactions[match].Response
+	return &http.Response{
+		Status:        r.Status,
+		StatusCode:    r.Code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Headers.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(r.Body))),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}, nil
+}
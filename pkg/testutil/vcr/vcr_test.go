@@ -0,0 +1,104 @@
+package vcr_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gdl/pkg/testutil/vcr"
+)
+
+const (
+	sessionID = "s3ss10n-1d-d0-n0t-l34k"
+	csrf      = "csrf-t0k3n-d0-n0t-l34k"
+	apiKey    = "4p1-k3y-d0-n0t-l34k"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "SID", Value: sessionID, Path: "/", HttpOnly: true})
+		http.SetCookie(w, &http.Cookie{Name: "lang", Value: "en"})
+		w.Header().Set("X-Csrf-Token", csrf)
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "hello "+r.URL.Query().Get("name"))
+	}))
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "cassettes", "hello.yaml")
+
+	get := func(rt http.RoundTripper, name string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest("GET", srv.URL+"/?name="+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("X-Api-Key", apiKey)
+		resp, err := (&http.Client{Transport: rt}).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	body := func(resp *http.Response) string {
+		t.Helper()
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	rec := vcr.NewTransport(file, true)
+	for _, name := range []string{"a", "b"} {
+		resp := get(rec, name)
+		// The caller still gets the real response while recording.
+		if got := resp.Header.Get("X-Csrf-Token"); got != csrf {
+			t.Errorf("recorded response X-Csrf-Token = %q, want %q", got, csrf)
+		}
+		if got := body(resp); got != "hello "+name {
+			t.Errorf("recorded body = %q", got)
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{sessionID, csrf, apiKey} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette holds %q:\n%s", secret, data)
+		}
+	}
+
+	srv.Close() // replays must not need the server
+	play := vcr.NewTransport(file, false)
+	resp := get(play, "b")
+	if got := body(resp); got != "hello b" {
+		t.Errorf("replayed body = %q, want %q", got, "hello b")
+	}
+	if got := resp.Header.Get("X-Csrf-Token"); got != vcr.Redacted {
+		t.Errorf("replayed X-Csrf-Token = %q, want %q", got, vcr.Redacted)
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 2 || cookies[0].Name != "SID" || cookies[0].Value != vcr.Redacted || !cookies[0].HttpOnly || cookies[0].Path != "/" {
+		t.Errorf("replayed cookies = %v, want SID=%s with its attributes, then lang", cookies, vcr.Redacted)
+	} else if cookies[1].Value != vcr.Redacted {
+		t.Errorf("cookie lang = %q, want it redacted too", cookies[1].Value)
+	}
+
+	if _, err := (&http.Client{Transport: play}).Get(srv.URL + "/?name=c"); err == nil || !strings.Contains(err.Error(), "no interaction") {
+		t.Errorf("unrecorded request: err = %v, want no interaction", err)
+	}
+}
+
+func TestReplayWithoutCassette(t *testing.T) {
+	rt := vcr.NewTransport(filepath.Join(t.TempDir(), "missing.yaml"), false)
+	if _, err := (&http.Client{Transport: rt}).Get("https://example.com/"); err == nil || !strings.Contains(err.Error(), "record it first") {
+		t.Errorf("err = %v, want one saying to record the cassette", err)
+	}
+}
@@ -0,0 +1,171 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	"gdl/pkg/downloader"
+)
+
+type Status int
+
+const (
+	StatusQueued Status = iota
+	StatusDownloading
+	StatusPaused
+	StatusDone
+	StatusFailed
+	StatusCancelled
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusDownloading:
+		return "downloading"
+	case StatusPaused:
+		return "paused"
+	case StatusDone:
+		return "done"
+	case StatusFailed:
+		return "failed"
+	case StatusCancelled:
+		return "deleted"
+	}
+	return "queued"
+}
+
+// SessionInfo is a point-in-time copy of a session's progress.
+type SessionInfo struct {
+	Url        string
+	File       string
+	Status     Status
+	Downloaded int64
+	Total      int64
+	Err        error
+}
+
+// DownloadSession runs one download in the background. Each run gets its own
+// cancellable context, so Pause simply cancels it and Resume starts a new run
+// that picks up from the state file.
+type DownloadSession struct {
+	d   *downloader.Downloader
+	cfg downloader.DownloadConfig
+
+	mu       sync.Mutex
+	info     SessionInfo
+	cancel   context.CancelFunc
+	finished chan struct{} // Closed when the current run returns
+	resume   bool          // Start a new run once the paused one returns
+}
+
+func NewDownloadSession(d *downloader.Downloader, cfg downloader.DownloadConfig) *DownloadSession {
+	return &DownloadSession{
+		d:    d,
+		cfg:  cfg,
+		info: SessionInfo{Url: cfg.Url},
+	}
+}
+
+// Info returns the current progress of the session.
+func (s *DownloadSession) Info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info
+}
+
+// Resume starts the download, or restarts it after Pause. If the paused run
+// is still stopping, the new one starts as soon as it has.
+func (s *DownloadSession) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.info.Status == StatusDone || s.info.Status == StatusCancelled {
+		return
+	}
+	if s.finished != nil {
+		if s.info.Status == StatusPaused {
+			s.resume = true
+			s.info.Status = StatusDownloading
+		}
+		return
+	}
+	s.start()
+}
+
+// start begins a new run. s.mu must be held.
+func (s *DownloadSession) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.finished = make(chan struct{})
+	s.info.Status = StatusDownloading
+	s.info.Err = nil
+
+	cfg := s.cfg
+	cfg.Quiet = true
+	cfg.OnProgress = func(file string, downloaded, total int64) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.info.File, s.info.Downloaded, s.info.Total = file, downloaded, total
+	}
+
+	go func(finished chan struct{}) {
+		err := s.d.DownloadContext(ctx, cfg)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case errors.Is(err, context.Canceled):
+			// Pause or Cancel already set the status.
+		case err != nil:
+			s.info.Status = StatusFailed
+			s.info.Err = err
+		default:
+			s.info.Status = StatusDone
+		}
+		s.cancel = nil
+		s.finished = nil
+		close(finished)
+		if s.resume && s.info.Status != StatusDone {
+			s.resume = false
+			s.start()
+		}
+	}(s.finished)
+}
+
+// Pause stops the download, keeping the partial file and its state.
+func (s *DownloadSession) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel == nil {
+		return
+	}
+	s.info.Status = StatusPaused
+	s.resume = false
+	s.cancel()
+}
+
+// Cancel stops the download and deletes the output and state files.
+func (s *DownloadSession) Cancel() {
+	s.mu.Lock()
+	s.info.Status = StatusCancelled
+	s.resume = false
+	finished := s.finished
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	if finished != nil {
+		<-finished
+	}
+	// The run names the file as soon as it knows it, so once it has
+	// returned this is the file it may have written.
+	s.mu.Lock()
+	file := s.info.File
+	s.mu.Unlock()
+	if file != "" {
+		os.Remove(file)
+		os.Remove(file + ".gdl.json")
+	}
+}
@@ -0,0 +1,81 @@
+package tui_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gdl/pkg/downloader"
+	"gdl/pkg/testserver"
+	"gdl/pkg/tui"
+)
+
+// waitFor polls cond until it holds, failing t after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// newSession returns a session downloading a 400 KB file, throttled so that
+// it takes a couple of seconds, and where the file will be.
+func newSession(t *testing.T) (*tui.DownloadSession, *testserver.TestServer, string) {
+	srv := testserver.NewTestServer(t, testserver.RandomContent(400_000, 30))
+	srv.SetThrottleBps(100_000)
+	dir := t.TempDir()
+	s := tui.NewDownloadSession(downloader.NewDownloader(), downloader.DownloadConfig{
+		Url:         srv.FileURL("data.bin"),
+		OutputDir:   dir,
+		Concurrency: 2,
+	})
+	return s, srv, filepath.Join(dir, "data.bin")
+}
+
+func TestResumeRightAfterPause(t *testing.T) {
+	s, srv, path := newSession(t)
+	s.Resume()
+	waitFor(t, "the download to start", func() bool { return s.Info().File != "" })
+
+	// The paused run is still stopping when Resume is called.
+	s.Pause()
+	s.Resume()
+	if st := s.Info().Status; st != tui.StatusDownloading {
+		t.Fatalf("status after Resume = %s, want downloading", st)
+	}
+	waitFor(t, "the download to finish", func() bool { return s.Info().Status == tui.StatusDone })
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, srv.Content()) {
+		t.Error("the resumed download is corrupt")
+	}
+}
+
+func TestCancelBeforeFirstProgressTick(t *testing.T) {
+	s, _, path := newSession(t)
+	s.Resume()
+	// Cancel as soon as the file exists, well before the first
+	// once-a-second progress report.
+	waitFor(t, "the output file", func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	s.Cancel()
+
+	for _, p := range []string{path, path + ".gdl.json"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", p, err)
+		}
+	}
+	if st := s.Info().Status; st != tui.StatusCancelled {
+		t.Errorf("status = %s, want deleted", st)
+	}
+}
@@ -0,0 +1,105 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type tickMsg time.Time
+
+func tick() tea.Cmd {
+	return tea.Tick(500*time.Millisecond, func(t time.Time) tea.Msg { return tickMsg(t) })
+}
+
+// TUIDownloadManager is a bubbletea model listing download sessions.
+// Keys: up/down (or k/j) select, p pauses, r resumes, d deletes, q quits.
+type TUIDownloadManager struct {
+	sessions []*DownloadSession
+	cursor   int
+}
+
+func NewTUIDownloadManager(sessions []*DownloadSession) *TUIDownloadManager {
+	return &TUIDownloadManager{sessions: sessions}
+}
+
+// Run starts every session and blocks until the user quits. Sessions still
+// running on exit are paused, so they resume on the next run.
+func (m *TUIDownloadManager) Run() error {
+	for _, s := range m.sessions {
+		s.Resume()
+	}
+	_, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	for _, s := range m.sessions {
+		s.Pause()
+	}
+	return err
+}
+
+func (m *TUIDownloadManager) Init() tea.Cmd {
+	return tick()
+}
+
+func (m *TUIDownloadManager) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tickMsg:
+		return m, tick()
+	case tea.KeyMsg:
+		if len(m.sessions) == 0 {
+			return m, tea.Quit
+		}
+		current := m.sessions[m.cursor]
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.sessions)-1 {
+				m.cursor++
+			}
+		case "p":
+			current.Pause()
+		case "r":
+			current.Resume()
+		case "d":
+			return m, func() tea.Msg {
+				current.Cancel()
+				return nil
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *TUIDownloadManager) View() string {
+	var b strings.Builder
+	b.WriteString("gdl downloads\n\n")
+	for i, s := range m.sessions {
+		info := s.Info()
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		name := info.Url
+		if info.File != "" {
+			name = filepath.Base(info.File)
+		}
+		percent := 0.0
+		if info.Total > 0 {
+			percent = float64(info.Downloaded) * 100 / float64(info.Total)
+		}
+		fmt.Fprintf(&b, "%s%-12s %6.1f%%  %s", cursor, info.Status, percent, name)
+		if info.Err != nil {
+			fmt.Fprintf(&b, "  (%v)", info.Err)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n↑/↓ select • p pause • r resume • d delete • q quit\n")
+	return b.String()
+}
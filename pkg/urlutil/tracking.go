@@ -0,0 +1,80 @@
+package urlutil
+
+import (
+	"net/url"
+	"strings"
+)
+
+// trackingParams are query parameters that only serve analytics. Any
+// parameter starting with "utm_" is one too. A plain "ref" is not on the
+// list: GitLab's and GitHub's file APIs use it to pick the branch.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "gclsrc": true, "dclid": true,
+	"gbraid": true, "wbraid": true, "msclkid": true, "yclid": true,
+	"twclid": true, "ttclid": true, "li_fat_id": true, "igshid": true,
+	"igsh": true, "mc_cid": true, "mc_eid": true, "_ga": true,
+	"_gl": true, "_hsenc": true, "_hsmi": true, "__hssc": true,
+	"__hstc": true, "__hsfp": true, "hsctatracking": true, "mkt_tok": true,
+	"oly_anon_id": true, "oly_enc_id": true, "rb_clickid": true, "s_cid": true,
+	"vero_conv": true, "vero_id": true, "wickedid": true, "ref_src": true,
+	"ref_url": true, "spm": true, "scm": true, "_openstat": true,
+	"cmpid": true, "trk": true, "trkcampaign": true, "sc_campaign": true,
+	"sc_channel": true, "icid": true, "ncid": true, "srsltid": true,
+}
+
+// signatureParams mark a signed URL (S3, GCS, Azure SAS, CloudFront). The
+// signature covers the whole query, so nothing may be removed from it.
+var signatureParams = []string{"signature", "x-amz-signature", "x-goog-signature", "sig", "key-pair-id"}
+
+// IsTracking reports whether the query parameter name only serves
+// analytics.
+func IsTracking(name string) bool {
+	name = strings.ToLower(name)
+	return trackingParams[name] || strings.HasPrefix(name, "utm_")
+}
+
+// StripTracking returns u without its tracking query parameters, except
+// those named in keep, and the names of the parameters it removed. The rest
+// of the query keeps its order and encoding. Signed URLs are returned as
+// they are.
+func StripTracking(u *url.URL, keep []string) (*url.URL, []string) {
+	if u.RawQuery == "" || isSigned(u.Query()) {
+		return u, nil
+	}
+	kept := make(map[string]bool, len(keep))
+	for _, k := range keep {
+		kept[strings.ToLower(k)] = true
+	}
+
+	var parts, removed []string
+	for _, part := range strings.Split(u.RawQuery, "&") {
+		name, _, _ := strings.Cut(part, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if IsTracking(name) && !kept[strings.ToLower(name)] {
+			removed = append(removed, name)
+			continue
+		}
+		parts = append(parts, part)
+	}
+	if len(removed) == 0 {
+		return u, nil
+	}
+	stripped := *u
+	stripped.RawQuery = strings.Join(parts, "&")
+	stripped.ForceQuery = false
+	return &stripped, removed
+}
+
+func isSigned(q url.Values) bool {
+	for name := range q {
+		name = strings.ToLower(name)
+		for _, s := range signatureParams {
+			if name == s {
+				return true
+			}
+		}
+	}
+	return false
+}
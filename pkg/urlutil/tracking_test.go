@@ -0,0 +1,131 @@
+package urlutil_test
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+
+	"gdl/pkg/urlutil"
+)
+
+func TestIsTracking(t *testing.T) {
+	for name, want := range map[string]bool{
+		"utm_source":   true,
+		"UTM_Campaign": true,
+		"utm_":         true,
+		"fbclid":       true,
+		"GCLID":        true,
+		"_ga":          true,
+		"ref":          false, // picks the branch in GitLab's and GitHub's APIs
+		"ref_src":      true,
+		"id":           false,
+		"token":        false,
+		"utm":          false,
+		"xutm_source":  false,
+	} {
+		if got := urlutil.IsTracking(name); got != want {
+			t.Errorf("IsTracking(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestStripTracking(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		in      string
+		keep    []string
+		want    string
+		removed []string
+	}{
+		{
+			name:    "utm and click ids",
+			in:      "https://example.com/f.zip?utm_source=news&id=7&fbclid=abc&utm_medium=email",
+			want:    "https://example.com/f.zip?id=7",
+			removed: []string{"utm_source", "fbclid", "utm_medium"},
+		},
+		{
+			name: "no query",
+			in:   "https://example.com/f.zip",
+			want: "https://example.com/f.zip",
+		},
+		{
+			name: "nothing to strip",
+			in:   "https://example.com/f.zip?b=2&a=1",
+			want: "https://example.com/f.zip?b=2&a=1",
+		},
+		{
+			name:    "only tracking",
+			in:      "https://example.com/f.zip?utm_source=x",
+			want:    "https://example.com/f.zip",
+			removed: []string{"utm_source"},
+		},
+		{
+			name:    "order and encoding kept",
+			in:      "https://example.com/f.zip?z=a%2Bb&gclid=1&a=c+d&empty",
+			want:    "https://example.com/f.zip?z=a%2Bb&a=c+d&empty",
+			removed: []string{"gclid"},
+		},
+		{
+			name:    "fragment kept",
+			in:      "https://example.com/f.zip?utm_source=x&v=2#part",
+			want:    "https://example.com/f.zip?v=2#part",
+			removed: []string{"utm_source"},
+		},
+		{
+			name:    "escaped name",
+			in:      "https://example.com/f.zip?utm%5Fsource=x&v=2",
+			want:    "https://example.com/f.zip?v=2",
+			removed: []string{"utm_source"},
+		},
+		{
+			name:    "upper case name",
+			in:      "https://example.com/f.zip?UTM_Source=x&v=2",
+			want:    "https://example.com/f.zip?v=2",
+			removed: []string{"UTM_Source"},
+		},
+		{
+			name:    "keep",
+			in:      "https://example.com/f.zip?utm_source=x&fbclid=y",
+			keep:    []string{"UTM_SOURCE"},
+			want:    "https://example.com/f.zip?utm_source=x",
+			removed: []string{"fbclid"},
+		},
+		{
+			name: "ref is a branch",
+			in:   "https://gitlab.com/api/v4/projects/1/repository/files/a/raw?ref=main",
+			want: "https://gitlab.com/api/v4/projects/1/repository/files/a/raw?ref=main",
+		},
+		{
+			name: "S3 presigned",
+			in:   "https://bucket.s3.amazonaws.com/f.zip?utm_source=x&X-Amz-Signature=abc",
+			want: "https://bucket.s3.amazonaws.com/f.zip?utm_source=x&X-Amz-Signature=abc",
+		},
+		{
+			name: "Azure SAS",
+			in:   "https://acct.blob.core.windows.net/c/f.zip?sv=2020&sig=abc&utm_source=x",
+			want: "https://acct.blob.core.windows.net/c/f.zip?sv=2020&sig=abc&utm_source=x",
+		},
+		{
+			name: "CloudFront",
+			in:   "https://d1.cloudfront.net/f.zip?Policy=p&Signature=s&Key-Pair-Id=k&fbclid=y",
+			want: "https://d1.cloudfront.net/f.zip?Policy=p&Signature=s&Key-Pair-Id=k&fbclid=y",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, removed := urlutil.StripTracking(u, tt.keep)
+			if got.String() != tt.want {
+				t.Errorf("StripTracking() = %s, want %s", got, tt.want)
+			}
+			if !slices.Equal(removed, tt.removed) {
+				t.Errorf("removed %q, want %q", removed, tt.removed)
+			}
+			if u.String() != tt.in {
+				t.Errorf("StripTracking() changed its argument to %s", u)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package useragent
+
+import (
+	"bytes"
+	"net/url"
+)
+
+// Default is the User-Agent sent with every request.
+const Default = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// Profile is a named set of headers that mimics a real browser.
+type Profile struct {
+	Name    string
+	Headers map[string]string
+}
+
+// Profiles are tried in order when a server rejects the default User-Agent.
+// Accept-Encoding is deliberately identity: ranged writes need raw bytes.
+var Profiles = []Profile{
+	{
+		Name: "chrome",
+		Headers: map[string]string{
+			"User-Agent":      Default,
+			"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+			"Accept-Language": "en-US,en;q=0.9",
+			"Accept-Encoding": "identity",
+		},
+	},
+	{
+		Name: "firefox",
+		Headers: map[string]string{
+			"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+			"Accept-Language": "en-US,en;q=0.5",
+			"Accept-Encoding": "identity",
+		},
+	},
+	{
+		Name: "safari",
+		Headers: map[string]string{
+			"User-Agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_2) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15",
+			"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			"Accept-Language": "en-US,en;q=0.9",
+			"Accept-Encoding": "identity",
+		},
+	},
+}
+
+var botMarkers = [][]byte{
+	[]byte("Access Denied"),
+	[]byte("Cloudflare"),
+	[]byte("Please enable JavaScript"),
+}
+
+// IsBotChallenge reports whether a 403 body looks like a bot-detection page.
+func IsBotChallenge(body []byte) bool {
+	for _, m := range botMarkers {
+		if bytes.Contains(body, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// BrowserHeaders returns the full header set of p for a request to target,
+// including a Referer pointing at the target's origin.
+func BrowserHeaders(p Profile, target string) map[string]string {
+	h := make(map[string]string, len(p.Headers)+1)
+	for k, v := range p.Headers {
+		h[k] = v
+	}
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		h["Referer"] = u.Scheme + "://" + u.Host + "/"
+	}
+	return h
+}
+
+// UserAgentOnly returns just the User-Agent header of p.
+func UserAgentOnly(p Profile) map[string]string {
+	return map[string]string{"User-Agent": p.Headers["User-Agent"]}
+}
@@ -0,0 +1,87 @@
+// Package watch remembers what a watched URL looked like the last time it
+// was downloaded, so that the next download can tell whether it changed.
+package watch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gdl/pkg/fileutil"
+
+	"github.com/gofrs/flock"
+)
+
+// Entry is the last download of a watched URL.
+type Entry struct {
+	File    string    `json:"file"`
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	Checked time.Time `json:"checked"` // when it was last downloaded
+	Changed time.Time `json:"changed"` // when its hash last changed
+}
+
+// History is a JSON file of Entries by URL, shared by every gdl process.
+type History struct {
+	Path string
+}
+
+// Load reads the history file. A missing file gives an empty history.
+func (h *History) Load() (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+	data, err := os.ReadFile(h.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Record replaces the entry for url. Like accounting.BandwidthLedger, the
+// file is locked while it is rewritten and replaced in one rename.
+func (h *History) Record(url string, e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(h.Path), 0700); err != nil {
+		return err
+	}
+	lock := flock.New(h.Path + ".lock")
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	entries, err := h.Load()
+	if err != nil {
+		return err
+	}
+	entries[url] = e
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(h.Path, data, 0600)
+}
+
+// HashFile returns the hex SHA-256 and size of the file name.
+func HashFile(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,165 @@
+package webdav
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/></d:prop></d:propfind>`
+
+// Resource is a single entry of a PROPFIND response.
+type Resource struct {
+	URL   string
+	Size  int64
+	IsDir bool
+}
+
+type Client struct {
+	HTTP *http.Client // http.DefaultClient if nil
+	User string
+	Pass string
+	// Headers are sent with every request, e.g. the configured global
+	// headers.
+	Headers http.Header
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ContentLength int64 `xml:"getcontentlength"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// IsWebDAV reports whether rawURL uses the webdav:// or webdavs:// scheme.
+func IsWebDAV(rawURL string) bool {
+	lower := strings.ToLower(rawURL)
+	return strings.HasPrefix(lower, "webdav://") || strings.HasPrefix(lower, "webdavs://")
+}
+
+// NormalizeURL rewrites webdav:// to http:// and webdavs:// to https://.
+// Credentials embedded in the URL are moved into the returned Client.
+func NormalizeURL(rawURL string, c *Client) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "webdav":
+		u.Scheme = "http"
+	case "webdavs":
+		u.Scheme = "https"
+	}
+	if u.User != nil {
+		c.User = u.User.Username()
+		c.Pass, _ = u.User.Password()
+		u.User = nil
+	}
+	return u.String(), nil
+}
+
+// AuthHeader returns the Basic Authorization value, or "" without credentials.
+func (c *Client) AuthHeader() string {
+	if c.User == "" {
+		return ""
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.User+":"+c.Pass))
+}
+
+// Propfind lists target with the given Depth ("0" or "1").
+func (c *Client) Propfind(target string, depth string) ([]Resource, error) {
+	req, err := http.NewRequest("PROPFIND", target, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range c.Headers {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	if auth := c.AuthHeader(); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND %s: server returned %s", target, resp.Status)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("PROPFIND %s: %v", target, err)
+	}
+
+	base, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	var resources []Resource
+	for _, r := range ms.Responses {
+		href, err := base.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		res := Resource{URL: href.String()}
+		for _, ps := range r.Propstat {
+			if ps.Prop.ResourceType.Collection != nil {
+				res.IsDir = true
+			}
+			if ps.Prop.ContentLength > 0 {
+				res.Size = ps.Prop.ContentLength
+			}
+		}
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+// Walk recursively lists all files below the collection at target.
+// Depth 1 is used at every level since many servers reject Depth: infinity.
+func (c *Client) Walk(target string) ([]Resource, error) {
+	if !strings.HasSuffix(target, "/") {
+		target += "/"
+	}
+	entries, err := c.Propfind(target, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []Resource
+	for _, e := range entries {
+		if strings.TrimSuffix(e.URL, "/") == strings.TrimSuffix(target, "/") {
+			continue // The collection itself
+		}
+		if e.IsDir {
+			sub, err := c.Walk(e.URL)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, sub...)
+			continue
+		}
+		files = append(files, e)
+	}
+	return files, nil
+}
@@ -0,0 +1,92 @@
+package workqueue
+
+import "sync"
+
+// PendingRange is a byte range left over by a chunk that gave up.
+type PendingRange struct {
+	Start, End int64
+	ChunkID    int // Chunk whose state tracks this range
+	Attempts   int // How many workers have already failed on it
+}
+
+// ChunkQueue hands orphaned ranges to workers that finished their own
+// chunk. Pop blocks while the queue is empty but some worker is still busy,
+// because that worker may yet fail and push its remainder.
+type ChunkQueue struct {
+	mu      sync.Mutex
+	items   []PendingRange
+	waiters []chan PendingRange // workers blocked in Pop, longest waiting first
+	busy    int
+}
+
+// New returns a queue shared by the given number of busy workers.
+func New(workers int) *ChunkQueue {
+	return &ChunkQueue{busy: workers}
+}
+
+// Push adds a range for another worker to pick up. A worker already waiting
+// in Pop gets it straight away, so that the worker which gave up on the
+// range doesn't take it back by calling Pop first.
+func (q *ChunkQueue) Push(r PendingRange) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiters) > 0 {
+		w := q.waiters[0]
+		q.waiters = q.waiters[1:]
+		q.busy++
+		w <- r
+		return
+	}
+	q.items = append(q.items, r)
+}
+
+// Pop marks the calling worker idle and waits for a range. It returns false
+// once the queue is empty and every worker is idle, meaning no more work
+// can appear. A worker that gets a range counts as busy again.
+func (q *ChunkQueue) Pop() (PendingRange, bool) {
+	q.mu.Lock()
+	q.busy--
+	if len(q.items) > 0 {
+		r := q.items[0]
+		q.items = q.items[1:]
+		q.busy++
+		q.mu.Unlock()
+		return r, true
+	}
+	if q.busy == 0 {
+		q.finish()
+		q.mu.Unlock()
+		return PendingRange{}, false
+	}
+	w := make(chan PendingRange, 1)
+	q.waiters = append(q.waiters, w)
+	q.mu.Unlock()
+	r, ok := <-w
+	return r, ok
+}
+
+// Leave removes a worker that stops without calling Pop.
+func (q *ChunkQueue) Leave() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.busy--
+	if q.busy == 0 && len(q.items) == 0 {
+		q.finish()
+	}
+}
+
+// finish wakes the waiting workers to tell them there is no more work.
+// q.mu must be held.
+func (q *ChunkQueue) finish() {
+	for _, w := range q.waiters {
+		close(w)
+	}
+	q.waiters = nil
+}
+
+// Len returns the number of queued ranges.
+func (q *ChunkQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
@@ -0,0 +1,157 @@
+package workqueue
+
+import (
+	"testing"
+	"time"
+)
+
+// popResult is what a Pop running in a goroutine returned.
+type popResult struct {
+	r  PendingRange
+	ok bool
+}
+
+// popAsync calls q.Pop in a goroutine and returns where its result goes.
+func popAsync(q *ChunkQueue) <-chan popResult {
+	ch := make(chan popResult, 1)
+	go func() {
+		r, ok := q.Pop()
+		ch <- popResult{r, ok}
+	}()
+	return ch
+}
+
+// waitIdle waits until n workers are blocked in q.Pop.
+func waitIdle(t *testing.T, q *ChunkQueue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		q.mu.Lock()
+		waiting := len(q.waiters)
+		q.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d workers waiting, want %d", waiting, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// result returns what ch got, failing t if it takes too long.
+func result(t *testing.T, ch <-chan popResult) popResult {
+	t.Helper()
+	select {
+	case res := <-ch:
+		return res
+	case <-time.After(5 * time.Second):
+		t.Fatal("Pop() did not return")
+		return popResult{}
+	}
+}
+
+func TestPopEndsOnceAllWorkersIdle(t *testing.T) {
+	q := New(3)
+	first, second := popAsync(q), popAsync(q)
+	waitIdle(t, q, 2)
+	if _, ok := q.Pop(); ok {
+		t.Error("the last Pop() got a range from an empty queue")
+	}
+	for _, ch := range []<-chan popResult{first, second} {
+		if res := result(t, ch); res.ok {
+			t.Errorf("a waiting Pop() got %+v, want none", res.r)
+		}
+	}
+}
+
+func TestPopWaitsForBusyWorker(t *testing.T) {
+	q := New(2)
+	idle := popAsync(q)
+	waitIdle(t, q, 1)
+	select {
+	case res := <-idle:
+		t.Fatalf("Pop() returned %+v while another worker was busy", res)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	want := PendingRange{Start: 100, End: 199, ChunkID: 1, Attempts: 1}
+	q.Push(want)
+	if res := result(t, idle); !res.ok || res.r != want {
+		t.Errorf("Pop() = %+v, %v; want %+v", res.r, res.ok, want)
+	}
+}
+
+func TestLeave(t *testing.T) {
+	q := New(2)
+	idle := popAsync(q)
+	waitIdle(t, q, 1)
+	q.Leave()
+	if res := result(t, idle); res.ok {
+		t.Errorf("Pop() got %+v after the only busy worker left", res.r)
+	}
+}
+
+func TestLeaveWhileOthersBusy(t *testing.T) {
+	q := New(3)
+	idle := popAsync(q)
+	waitIdle(t, q, 1)
+	q.Leave() // one worker is still busy and may push more
+	select {
+	case res := <-idle:
+		t.Fatalf("Pop() returned %+v while a worker was busy", res)
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.Leave()
+	if res := result(t, idle); res.ok {
+		t.Errorf("Pop() got %+v after every busy worker left", res.r)
+	}
+}
+
+// TestPushHandsOffToIdleWorker checks that a range given up on goes to the
+// worker already waiting, not back to the one that pushed it.
+func TestPushHandsOffToIdleWorker(t *testing.T) {
+	q := New(2)
+	idle := popAsync(q)
+	waitIdle(t, q, 1)
+
+	failed := PendingRange{Start: 0, End: 99, ChunkID: 0, Attempts: 1}
+	q.Push(failed)
+	pusher := popAsync(q)
+	if res := result(t, idle); !res.ok || res.r != failed {
+		t.Fatalf("idle worker's Pop() = %+v, %v; want %+v", res.r, res.ok, failed)
+	}
+	select {
+	case res := <-pusher:
+		t.Fatalf("the pushing worker's Pop() = %+v, %v; want it to wait", res.r, res.ok)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The worker that took the range finishes it.
+	if _, ok := q.Pop(); ok {
+		t.Error("Pop() got a range from an empty queue")
+	}
+	if res := result(t, pusher); res.ok {
+		t.Errorf("the pushing worker's Pop() got %+v, want none", res.r)
+	}
+}
+
+func TestPushWithoutIdleWorkers(t *testing.T) {
+	q := New(2)
+	a := PendingRange{Start: 0, End: 99, ChunkID: 0, Attempts: 1}
+	b := PendingRange{Start: 100, End: 199, ChunkID: 1, Attempts: 2}
+	q.Push(a)
+	q.Push(b)
+	if q.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", q.Len())
+	}
+	for _, want := range []PendingRange{a, b} {
+		if r, ok := q.Pop(); !ok || r != want {
+			t.Errorf("Pop() = %+v, %v; want %+v", r, ok, want)
+		}
+	}
+	q.Leave()
+	if _, ok := q.Pop(); ok {
+		t.Error("Pop() got a range from an empty queue")
+	}
+}
@@ -0,0 +1,217 @@
+package wpad
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// PAC is a compiled proxy auto-config script.
+type PAC struct {
+	mu sync.Mutex // goja runtimes are not safe for concurrent use
+	rt *goja.Runtime
+	fn goja.Callable
+}
+
+// CompilePAC evaluates script and returns its FindProxyForURL function.
+func CompilePAC(script string) (*PAC, error) {
+	rt := goja.New()
+	registerHelpers(rt)
+	if _, err := rt.RunString(pacDateHelpers); err != nil {
+		return nil, err
+	}
+	if _, err := rt.RunString(script); err != nil {
+		return nil, fmt.Errorf("PAC script: %w", err)
+	}
+	fn, ok := goja.AssertFunction(rt.Get("FindProxyForURL"))
+	if !ok {
+		return nil, fmt.Errorf("PAC script does not define FindProxyForURL")
+	}
+	return &PAC{rt: rt, fn: fn}, nil
+}
+
+// FindProxyForURL runs the script for target and returns its raw result,
+// e.g. "PROXY proxy:8080; DIRECT".
+func (p *PAC) FindProxyForURL(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, err := p.fn(goja.Undefined(), p.rt.ToValue(target), p.rt.ToValue(u.Hostname()))
+	if err != nil {
+		return "", fmt.Errorf("FindProxyForURL: %w", err)
+	}
+	return v.String(), nil
+}
+
+// ParseResult returns the proxy URL for the first usable entry of a
+// FindProxyForURL result, or "" for DIRECT.
+func ParseResult(result string) (string, error) {
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "DIRECT":
+			return "", nil
+		case "PROXY", "HTTP":
+			if len(fields) == 2 {
+				return "http://" + fields[1], nil
+			}
+		case "HTTPS":
+			if len(fields) == 2 {
+				return "https://" + fields[1], nil
+			}
+		case "SOCKS", "SOCKS5":
+			if len(fields) == 2 {
+				return "socks5://" + fields[1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no usable proxy in PAC result %q", result)
+}
+
+// registerHelpers defines the DNS and string functions PAC scripts expect.
+func registerHelpers(rt *goja.Runtime) {
+	rt.Set("isPlainHostName", func(host string) bool {
+		return !strings.Contains(host, ".")
+	})
+	rt.Set("dnsDomainIs", func(host, domain string) bool {
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(domain))
+	})
+	rt.Set("localHostOrDomainIs", func(host, hostdom string) bool {
+		host, hostdom = strings.ToLower(host), strings.ToLower(hostdom)
+		return host == hostdom || (!strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+"."))
+	})
+	rt.Set("isResolvable", func(host string) bool {
+		return resolveIPv4(host) != nil
+	})
+	rt.Set("dnsResolve", func(host string) any {
+		if ip := resolveIPv4(host); ip != nil {
+			return ip.String()
+		}
+		return nil
+	})
+	rt.Set("isInNet", func(host, pattern, mask string) bool {
+		ip := net.ParseIP(host).To4()
+		if ip == nil {
+			ip = resolveIPv4(host)
+		}
+		p, m := net.ParseIP(pattern).To4(), net.ParseIP(mask).To4()
+		if ip == nil || p == nil || m == nil {
+			return false
+		}
+		return ip.Mask(net.IPMask(m)).Equal(p.Mask(net.IPMask(m)))
+	})
+	rt.Set("myIpAddress", myIPAddress)
+	rt.Set("dnsDomainLevels", func(host string) int {
+		return strings.Count(host, ".")
+	})
+	rt.Set("shExpMatch", func(str, shexp string) bool {
+		re := regexp.QuoteMeta(shexp)
+		re = strings.ReplaceAll(re, `\*`, ".*")
+		re = strings.ReplaceAll(re, `\?`, ".")
+		ok, _ := regexp.MatchString("^"+re+"$", str)
+		return ok
+	})
+}
+
+func resolveIPv4(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.To4()
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if v4 := ip.To4(); v4 != nil {
+			return v4
+		}
+	}
+	return nil
+}
+
+// myIPAddress returns the address of the interface used for outbound
+// traffic. Dialing UDP sends no packets.
+func myIPAddress() string {
+	conn, err := net.Dial("udp4", "192.0.2.1:80")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// pacDateHelpers implements the time-based PAC functions. Each takes an
+// optional trailing "GMT" argument.
+const pacDateHelpers = `
+function __pacArgs(args) {
+	args = Array.prototype.slice.call(args);
+	var gmt = args[args.length - 1] === "GMT";
+	if (gmt) args.pop();
+	return { args: args, gmt: gmt, now: new Date() };
+}
+
+function __inRange(lo, cur, hi) {
+	return lo <= hi ? cur >= lo && cur <= hi : cur >= lo || cur <= hi;
+}
+
+function weekdayRange() {
+	var p = __pacArgs(arguments);
+	var days = ["SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"];
+	var a = days.indexOf(String(p.args[0]).toUpperCase());
+	var b = p.args.length > 1 ? days.indexOf(String(p.args[1]).toUpperCase()) : a;
+	if (a < 0 || b < 0) return false;
+	return __inRange(a, p.gmt ? p.now.getUTCDay() : p.now.getDay(), b);
+}
+
+function timeRange() {
+	var p = __pacArgs(arguments), a = p.args, n = p.now;
+	var cur = p.gmt
+		? n.getUTCHours() * 3600 + n.getUTCMinutes() * 60 + n.getUTCSeconds()
+		: n.getHours() * 3600 + n.getMinutes() * 60 + n.getSeconds();
+	switch (a.length) {
+	case 1: return __inRange(a[0] * 3600, cur, a[0] * 3600 + 3599);
+	case 2: return __inRange(a[0] * 3600, cur, a[1] * 3600);
+	case 4: return __inRange(a[0] * 3600 + a[1] * 60, cur, a[2] * 3600 + a[3] * 60);
+	case 6: return __inRange(a[0] * 3600 + a[1] * 60 + a[2], cur, a[3] * 3600 + a[4] * 60 + a[5]);
+	}
+	return false;
+}
+
+function dateRange() {
+	var p = __pacArgs(arguments), n = p.now;
+	var months = ["JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"];
+	var cur = p.gmt
+		? { d: n.getUTCDate(), m: n.getUTCMonth(), y: n.getUTCFullYear() }
+		: { d: n.getDate(), m: n.getMonth(), y: n.getFullYear() };
+	function parse(list) {
+		var r = {};
+		list.forEach(function (v) {
+			if (typeof v === "string") r.m = months.indexOf(v.toUpperCase());
+			else if (v > 31) r.y = v;
+			else r.d = v;
+		});
+		return r;
+	}
+	// Fields a bound leaves out are taken from today, so they always match.
+	function key(o) {
+		return (o.y !== undefined ? o.y : cur.y) * 10000 +
+			(o.m !== undefined ? o.m : cur.m) * 100 +
+			(o.d !== undefined ? o.d : cur.d);
+	}
+	var a = p.args;
+	if (a.length === 1) return key(parse(a)) === key(cur);
+	if (a.length % 2 !== 0) return false;
+	return __inRange(key(parse(a.slice(0, a.length / 2))), key(cur), key(parse(a.slice(a.length / 2))));
+}
+`
@@ -0,0 +1,163 @@
+package wpad
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leaseGlobs are DHCP client lease files that may carry option 252.
+var leaseGlobs = []string{
+	"/var/lib/dhcp/*.leases",
+	"/var/lib/dhclient/*.lease*",
+	"/var/lib/NetworkManager/*.lease",
+}
+
+var wpadOption = regexp.MustCompile(`(?:option\s+(?:wpad(?:-url)?|option-252)\s+|^WPAD=)"?([^";\s]+)`)
+
+// pacClient fetches PAC files directly; the proxy isn't known yet.
+var pacClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: &http.Transport{Proxy: nil},
+}
+
+// ErrNotFound is returned when neither DHCP nor DNS yields a PAC file.
+var ErrNotFound = errors.New("no WPAD configuration found")
+
+// Discover returns the URL of the network's PAC file. DHCP option 252 is
+// read from the lease files of dhclient and NetworkManager, since querying
+// the DHCP server needs privileges; after that http://wpad.<domain>/wpad.dat
+// is tried for the local domain and each of its parents.
+func Discover() (string, error) {
+	if u := dhcpPACURL(); u != "" {
+		return u, nil
+	}
+	for _, host := range wpadHosts() {
+		if _, err := net.LookupHost(host); err != nil {
+			continue
+		}
+		u := "http://" + host + "/wpad.dat"
+		if resp, err := pacClient.Head(u); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return u, nil
+			}
+		}
+	}
+	return "", ErrNotFound
+}
+
+// dhcpPACURL returns the most recent option 252 value found in lease files.
+func dhcpPACURL() string {
+	var found string
+	for _, glob := range leaseGlobs {
+		files, _ := filepath.Glob(glob)
+		for _, name := range files {
+			f, err := os.Open(name)
+			if err != nil {
+				continue
+			}
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if m := wpadOption.FindStringSubmatch(strings.TrimSpace(scanner.Text())); m != nil {
+					found = m[1]
+				}
+			}
+			f.Close()
+		}
+	}
+	return found
+}
+
+// wpadHosts lists wpad.<domain> candidates from the most to the least
+// specific, never going above a second-level domain.
+func wpadHosts() []string {
+	var domains []string
+	if host, err := os.Hostname(); err == nil {
+		if _, domain, ok := strings.Cut(host, "."); ok {
+			domains = append(domains, domain)
+		}
+	}
+	if f, err := os.Open("/etc/resolv.conf"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) > 1 && (fields[0] == "search" || fields[0] == "domain") {
+				domains = append(domains, fields[1:]...)
+			}
+		}
+		f.Close()
+	}
+
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		domain = strings.Trim(strings.ToLower(domain), ".")
+		for strings.Count(domain, ".") >= 1 {
+			if h := "wpad." + domain; !seen[h] {
+				seen[h] = true
+				hosts = append(hosts, h)
+			}
+			_, domain, _ = strings.Cut(domain, ".")
+		}
+	}
+	return hosts
+}
+
+// Load fetches and compiles the PAC file at pacURL.
+func Load(pacURL string) (*PAC, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pacClient.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", pacURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := pacClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching PAC %s: %s", pacURL, resp.Status)
+	}
+	script, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return CompilePAC(string(script))
+}
+
+var (
+	loadOnce  sync.Once
+	loadedPAC *PAC
+	loadErr   error
+)
+
+// FindProxy returns the proxy URL the network's PAC file picks for
+// targetURL, or "" to connect directly. Discovery runs once per process.
+func FindProxy(targetURL string) (string, error) {
+	loadOnce.Do(func() {
+		var pacURL string
+		if pacURL, loadErr = Discover(); loadErr == nil {
+			loadedPAC, loadErr = Load(pacURL)
+		}
+	})
+	if loadErr != nil {
+		return "", loadErr
+	}
+	result, err := loadedPAC.FindProxyForURL(targetURL)
+	if err != nil {
+		return "", err
+	}
+	return ParseResult(result)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package zerocopy
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+func sendFile(conn net.Conn, f *os.File, offset, n int64) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,64 @@
+//go:build linux || darwin
+
+package zerocopy
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// maxSendfile is the most one sendfile call is asked to send; Linux sends
+// at most about 2 GiB per call anyway.
+const maxSendfile = 1 << 30
+
+func sendFile(conn net.Conn, f *os.File, offset, n int64) (int64, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	src, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	var sendErr, writeErr error
+	err = src.Read(func(infd uintptr) bool {
+		writeErr = raw.Write(func(outfd uintptr) bool {
+			for written < n {
+				off := offset + written
+				sent, err := syscall.Sendfile(int(outfd), int(infd), &off, int(min(n-written, maxSendfile)))
+				if sent > 0 {
+					written += int64(sent)
+				}
+				switch {
+				case err == syscall.EAGAIN:
+					return false // wait until conn is writable again
+				case err == syscall.EINTR:
+					continue
+				case err != nil:
+					sendErr = os.NewSyscallError("sendfile", err)
+					return true
+				case sent == 0:
+					sendErr = errors.New("sendfile: file shorter than requested")
+					return true
+				}
+			}
+			return true
+		})
+		return true
+	})
+	if sendErr != nil {
+		return written, sendErr
+	}
+	if writeErr != nil {
+		return written, writeErr
+	}
+	return written, err
+}
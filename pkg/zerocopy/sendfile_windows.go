@@ -0,0 +1,23 @@
+//go:build windows
+
+package zerocopy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+)
+
+// sendFile hands the file to the TCP connection's ReadFrom, which the
+// runtime implements with TransmitFile on its own overlapped socket.
+func sendFile(conn net.Conn, f *os.File, offset, n int64) (int64, error) {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return tc.ReadFrom(&io.LimitedReader{R: f, N: n})
+}
@@ -0,0 +1,21 @@
+// Package zerocopy sends files over network connections without copying
+// them through user space where the OS allows it.
+package zerocopy
+
+import (
+	"io"
+	"net"
+	"os"
+)
+
+// SendFile writes n bytes of f, starting at offset, to conn and returns how
+// many it wrote. It uses sendfile(2) on Linux and macOS and TransmitFile on
+// Windows; if those aren't available for conn, or fail before sending
+// anything, the rest is copied with io.Copy. f's file offset is not used.
+func SendFile(conn net.Conn, f *os.File, offset, n int64) (int64, error) {
+	written, err := sendFile(conn, f, offset, n)
+	if err == nil || written > 0 {
+		return written, err
+	}
+	return io.Copy(conn, io.NewSectionReader(f, offset, n))
+}
@@ -0,0 +1,145 @@
+package zerocopy_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gdl/pkg/testserver"
+	"gdl/pkg/zerocopy"
+)
+
+// tempFile creates a file holding data.
+func tempFile(tb testing.TB, data []byte) *os.File {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "data.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		tb.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { f.Close() })
+	return f
+}
+
+// loopback returns the client end of a TCP connection over loopback whose
+// server end copies everything it reads to dst, and a channel that is closed
+// once the client end is closed and all was copied.
+func loopback(tb testing.TB, dst io.Writer) (net.Conn, <-chan struct{}) {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { ln.Close() })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(dst, conn)
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	return conn, done
+}
+
+// counter is an io.Writer that counts and discards what it is given.
+type counter int64
+
+func (c *counter) Write(p []byte) (int, error) {
+	*c += counter(len(p))
+	return len(p), nil
+}
+
+func TestSendFile(t *testing.T) {
+	content := testserver.RandomContent(3_000_000, 1)
+	f := tempFile(t, content)
+	var received bytes.Buffer
+	conn, done := loopback(t, &received)
+
+	n, err := zerocopy.SendFile(conn, f, 1000, 2_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	<-done
+	if n != 2_000_000 {
+		t.Errorf("SendFile() sent %d bytes, want 2000000", n)
+	}
+	if !bytes.Equal(received.Bytes(), content[1000:2_001_000]) {
+		t.Errorf("received %d bytes, not the requested range", received.Len())
+	}
+}
+
+func TestSendFileFallsBackToCopy(t *testing.T) {
+	content := testserver.RandomContent(100_000, 2)
+	f := tempFile(t, content)
+	// A pipe has no file descriptor for sendfile.
+	client, server := net.Pipe()
+	received := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(server)
+		received <- data
+	}()
+
+	n, err := zerocopy.SendFile(client, f, 10, 50_000)
+	client.Close()
+	if err != nil || n != 50_000 {
+		t.Fatalf("SendFile() = %d, %v; want 50000, nil", n, err)
+	}
+	if got := <-received; !bytes.Equal(got, content[10:50_010]) {
+		t.Errorf("received %d bytes, not the requested range", len(got))
+	}
+}
+
+const benchSize = 64 << 20
+
+// benchmarkSend sends a 64 MiB file over loopback b.N times with send.
+func benchmarkSend(b *testing.B, send func(conn net.Conn, f *os.File) (int64, error)) {
+	f := tempFile(b, testserver.RandomContent(benchSize, 3))
+	var received counter
+	conn, done := loopback(b, &received)
+	b.SetBytes(benchSize)
+	b.ResetTimer()
+	for range b.N {
+		if _, err := send(conn, f); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	conn.Close()
+	<-done
+	if received != counter(b.N*benchSize) {
+		b.Fatalf("received %d bytes, want %d", received, b.N*benchSize)
+	}
+}
+
+// BenchmarkSendFile and BenchmarkCopy compare sendfile(2) with copying
+// through a user-space buffer, e.g.
+//
+//	go test -bench . -benchmem ./pkg/zerocopy
+func BenchmarkSendFile(b *testing.B) {
+	benchmarkSend(b, func(conn net.Conn, f *os.File) (int64, error) {
+		return zerocopy.SendFile(conn, f, 0, benchSize)
+	})
+}
+
+func BenchmarkCopy(b *testing.B) {
+	benchmarkSend(b, func(conn net.Conn, f *os.File) (int64, error) {
+		// A SectionReader hides the *os.File, so the runtime can't use
+		// sendfile behind io.Copy's back.
+		return io.Copy(conn, io.NewSectionReader(f, 0, benchSize))
+	})
+}